@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 // Result is the value returned by Forward. It is used in the call of the next
@@ -37,6 +38,10 @@ type FWContext struct {
 
 	// List of parameters given to the executor.
 	Params []interface{}
+
+	// Span tracing the current action, nil when tracing is disabled.
+	// Actions may use it to start spans for the calls they make.
+	Span *tracing.Span
 }
 
 // BWContext is the context used in calls to Backward functions (backward
@@ -47,6 +52,9 @@ type BWContext struct {
 
 	// List of parameters given to the executor.
 	Params []interface{}
+
+	// Span tracing the current action, nil when tracing is disabled.
+	Span *tracing.Span
 }
 
 // Action defines actions that should be . It is composed of two functions:
@@ -133,6 +141,12 @@ func (p *Pipeline) Result() Result {
 // After rolling back all completed actions, it returns the original error
 // returned by the action that failed.
 func (p *Pipeline) Execute(params ...interface{}) error {
+	return p.ExecuteWithSpan(tracing.SpanContext{}, params...)
+}
+
+// ExecuteWithSpan executes the pipeline like Execute, tracing it as a child
+// of parent. The pipeline starts a new trace when parent is not valid.
+func (p *Pipeline) ExecuteWithSpan(parent tracing.SpanContext, params ...interface{}) error {
 	var (
 		r   Result
 		err error
@@ -140,9 +154,13 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 	if len(p.actions) == 0 {
 		return ErrPipelineNoActions
 	}
+	span := tracing.StartSpan("pipeline", parent)
+	span.SetTag("pipeline.actions", p.actionNames())
+	defer span.Finish()
 	fwCtx := FWContext{Params: params}
 	for i, a := range p.actions {
 		log.Debugf("[pipeline] running the Forward for the %s action", a.Name)
+		fwCtx.Span = span.StartChild(a.Name).SetTag("action.phase", "forward")
 		if a.Forward == nil {
 			err = ErrPipelineForwardMissing
 		} else if len(fwCtx.Params) < a.MinParams {
@@ -159,20 +177,33 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 			if a.OnError != nil {
 				a.OnError(fwCtx, err)
 			}
-			p.rollback(i-1, params)
+			fwCtx.Span.FinishWithError(err)
+			span.SetError(err)
+			p.rollback(i-1, params, span)
 			return err
 		}
+		fwCtx.Span.Finish()
 	}
 	return nil
 }
 
-func (p *Pipeline) rollback(index int, params []interface{}) {
+func (p *Pipeline) rollback(index int, params []interface{}, span *tracing.Span) {
 	bwCtx := BWContext{Params: params}
 	for i := index; i >= 0; i-- {
 		log.Debugf("[pipeline] running Backward for %s action", p.actions[i].Name)
 		if p.actions[i].Backward != nil {
 			bwCtx.FWResult = p.actions[i].result
+			bwCtx.Span = span.StartChild(p.actions[i].Name).SetTag("action.phase", "backward")
 			p.actions[i].Backward(bwCtx)
+			bwCtx.Span.Finish()
 		}
 	}
 }
+
+func (p *Pipeline) actionNames() []string {
+	names := make([]string, len(p.actions))
+	for i, a := range p.actions {
+		names[i] = a.Name
+	}
+	return names
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 )
 
@@ -173,3 +174,64 @@ func (s *S) TestActionOnError(c *check.C) {
 	c.Assert(err, check.Equals, returnedErr)
 	c.Assert(called, check.Equals, true)
 }
+
+func (s *S) TestExecuteTracing(c *check.C) {
+	exporter := &tracing.RecordingExporter{}
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+	var forwardSpan, backwardSpan tracing.SpanContext
+	actions := []*Action{
+		{
+			Name: "hello",
+			Forward: func(ctx FWContext) (Result, error) {
+				forwardSpan = ctx.Span.Context()
+				return "ok", nil
+			},
+			Backward: func(ctx BWContext) {
+				backwardSpan = ctx.Span.Context()
+			},
+		},
+		&errorAction,
+	}
+	pipeline := NewPipeline(actions...)
+	err := pipeline.Execute()
+	c.Assert(err, check.NotNil)
+	spans := exporter.Spans()
+	c.Assert(spans, check.HasLen, 4)
+	hello, failed, rolledBack, root := spans[0], spans[1], spans[2], spans[3]
+	c.Assert(root.Operation, check.Equals, "pipeline")
+	c.Assert(root.ParentID, check.Equals, uint64(0))
+	c.Assert(root.Tags["pipeline.actions"], check.DeepEquals, []string{"hello", "error"})
+	c.Assert(root.Tags["error"], check.Equals, true)
+	c.Assert(hello.Operation, check.Equals, "hello")
+	c.Assert(hello.Context, check.Equals, forwardSpan)
+	c.Assert(hello.ParentID, check.Equals, root.Context.SpanID)
+	c.Assert(hello.Tags, check.DeepEquals, map[string]interface{}{"action.phase": "forward"})
+	c.Assert(failed.Operation, check.Equals, "error")
+	c.Assert(failed.Tags, check.DeepEquals, map[string]interface{}{
+		"action.phase":  "forward",
+		"error":         true,
+		"error.message": "Failed to execute.",
+	})
+	c.Assert(rolledBack.Operation, check.Equals, "hello")
+	c.Assert(rolledBack.Context, check.Equals, backwardSpan)
+	c.Assert(rolledBack.ParentID, check.Equals, root.Context.SpanID)
+	c.Assert(rolledBack.Tags, check.DeepEquals, map[string]interface{}{"action.phase": "backward"})
+}
+
+func (s *S) TestExecuteWithSpan(c *check.C) {
+	exporter := &tracing.RecordingExporter{}
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+	parent := tracing.StartSpan("request", tracing.SpanContext{})
+	pipeline := NewPipeline(&helloAction)
+	err := pipeline.ExecuteWithSpan(parent.Context(), "world")
+	c.Assert(err, check.IsNil)
+	spans := exporter.Spans()
+	c.Assert(spans, check.HasLen, 2)
+	root := spans[1]
+	c.Assert(root.Operation, check.Equals, "pipeline")
+	c.Assert(root.Context.TraceID, check.Equals, parent.Context().TraceID)
+	c.Assert(root.ParentID, check.Equals, parent.Context().SpanID)
+	c.Assert(spans[0].ParentID, check.Equals, root.Context.SpanID)
+}
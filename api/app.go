@@ -11,9 +11,11 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ajg/form"
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/app/bind"
@@ -44,6 +46,7 @@ func getAppFromContext(name string, r *http.Request) (app.App, error) {
 		if err != nil {
 			return app.App{}, err
 		}
+		a.Span = context.GetSpan(r)
 		context.SetApp(r, a)
 	}
 	return *a, nil
@@ -258,6 +261,7 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		Description: ia.Description,
 		Pool:        ia.Pool,
 		RouterOpts:  ia.RouterOpts,
+		Span:        context.GetSpan(r),
 	}
 	if a.TeamOwner == "" {
 		a.TeamOwner, err = permission.TeamForPermission(t, permission.PermAppCreate)
@@ -1048,7 +1052,18 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	unit := r.URL.Query().Get("unit")
 	follow := r.URL.Query().Get("follow")
 	appName := r.URL.Query().Get(":app")
-	filterLog := app.Applog{Source: source, Unit: unit}
+	filterLog := app.Applog{Source: source, Unit: unit, Level: r.URL.Query().Get("level")}
+	for _, field := range r.URL.Query()["field"] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			msg := fmt.Sprintf(`Invalid field filter %q, expected "<name>=<value>".`, field)
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+		if filterLog.Fields == nil {
+			filterLog.Fields = map[string]interface{}{}
+		}
+		filterLog.Fields[parts[0]] = parts[1]
+	}
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1059,10 +1074,37 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	filter := &app.LogFilter{
+		Source: filterLog.Source,
+		Unit:   filterLog.Unit,
+		Level:  filterLog.Level,
+		Fields: filterLog.Fields,
+		Text:   r.URL.Query().Get("text"),
+		Grep:   r.URL.Query().Get("grep"),
+		Cursor: r.URL.Query().Get("cursor"),
+		Lines:  lines,
+	}
+	filter.Invert, _ = strconv.ParseBool(r.URL.Query().Get("invert"))
+	for param, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := r.URL.Query().Get(param); v != "" {
+			*value, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				msg := fmt.Sprintf(`Parameter %q must be a date in RFC 3339 format.`, param)
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+			}
+		}
+	}
+	err = filter.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	logs, err := a.SearchLogs(filter)
 	if err != nil {
 		return err
 	}
+	if cursor := app.NextLogCursor(filter, logs); cursor != "" && follow != "1" {
+		w.Header().Set("X-Tsuru-Log-Cursor", cursor)
+	}
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(logs)
 	if err != nil {
@@ -1077,7 +1119,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
+	l, err := app.NewFilteredLogListener(&a, filter)
 	if err != nil {
 		return err
 	}
@@ -1089,12 +1131,13 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	logChan := l.ListenChan()
 	for {
 		var logMsg app.Applog
+		var ok bool
 		select {
 		case <-closeChan:
 			return nil
-		case logMsg = <-logChan:
+		case logMsg, ok = <-logChan:
 		}
-		if logMsg == (app.Applog{}) {
+		if !ok {
 			break
 		}
 		err := encoder.Encode([]app.Applog{logMsg})
@@ -1133,7 +1176,9 @@ func getServiceInstance(serviceName, instanceName, appName string) (*service.Ser
 //   200: Ok
 //   400: Invalid data
 //   401: Unauthorized
+//   403: App pool not allowed by the service
 //   404: App not found
+//   412: Service instance not ready
 func bindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	instanceName := r.URL.Query().Get(":instance")
 	appName := r.URL.Query().Get(":app")
@@ -1157,6 +1202,23 @@ func bindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
+	if !instance.IsReady() {
+		msg := fmt.Sprintf("Service instance %q is not ready yet.", instanceName)
+		if instance.State == service.InstanceStateFailed {
+			msg = fmt.Sprintf("Service instance %q failed to be provisioned: %s", instanceName, instance.StateError)
+		}
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: msg}
+	}
+	srv, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	if !srv.AllowsPool(a.Pool) {
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: fmt.Sprintf("Apps in the pool %q cannot bind instances of the service %q.", a.Pool, serviceName),
+		}
+	}
 	evt, err := event.New(&event.Opts{
 		Target:     appTarget(appName),
 		Kind:       permission.PermAppUpdateBind,
@@ -1172,7 +1234,9 @@ func bindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
 	defer keepAliveWriter.Stop()
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	err = instance.BindApp(a, !noRestart, writer)
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	err = instance.BindApp(a, !noRestart, writer, requestID)
 	if err != nil {
 		return err
 	}
@@ -1234,7 +1298,9 @@ func unbindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
 	defer keepAliveWriter.Stop()
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	err = instance.UnbindApp(a, !noRestart, writer)
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	err = instance.UnbindApp(a, !noRestart, writer, requestID)
 	if err != nil {
 		return err
 	}
@@ -1242,6 +1308,73 @@ func unbindServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return nil
 }
 
+// title: rotate service instance credentials
+// path: /services/{service}/instances/{instance}/{app}/rotate
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: App is not bound to the instance
+//   401: Unauthorized
+//   404: App not found
+//   412: Service instance not ready
+func rotateServiceInstanceCredentials(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	instanceName, appName, serviceName := r.URL.Query().Get(":instance"), r.URL.Query().Get(":app"),
+		r.URL.Query().Get(":service")
+	noRestart, _ := strconv.ParseBool(r.FormValue("noRestart"))
+	instance, a, err := getServiceInstance(serviceName, instanceName, appName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBindRotate,
+		append(permission.Contexts(permission.CtxTeam, instance.Teams),
+			permission.Context(permission.CtxServiceInstance, instance.Name),
+		)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	allowed = permission.Check(t, permission.PermAppUpdateBind,
+		contextsForApp(a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if instance.FindApp(appName) == -1 {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: service.ErrAppNotBound.Error()}
+	}
+	if !instance.IsReady() {
+		return &errors.HTTP{
+			Code:    http.StatusPreconditionFailed,
+			Message: fmt.Sprintf("Service instance %q is not ready yet.", instanceName),
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermServiceInstanceUpdateBindRotate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	err = instance.RotateAppCredentials(a, !noRestart, writer, requestID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(writer, "\nCredentials of the instance %q used by the app %q were rotated.\n", instanceName, appName)
+	return nil
+}
+
 // title: app restart
 // path: /apps/{app}/restart
 // method: POST
@@ -1373,6 +1506,190 @@ func addLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// title: app log drain list
+// path: /apps/{app}/log-drains
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appLogDrainList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppRead,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if len(a.LogDrains) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	drains := make([]app.LogDrain, len(a.LogDrains))
+	for i, d := range a.LogDrains {
+		d.URL = d.DisplayURL()
+		drains[i] = d
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(drains)
+}
+
+// title: app log drain add
+// path: /apps/{app}/log-drains
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   201: Log drain added
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+//   409: Log drain already exists
+func appLogDrainAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	drain := app.LogDrain{URL: r.FormValue("url"), Format: r.FormValue("format")}
+	if drain.URL == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the url of the log drain."}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateLogDrainAdd,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target: appTarget(appName),
+		Kind:   permission.PermAppUpdateLogDrainAdd,
+		Owner:  t,
+		CustomData: []map[string]interface{}{
+			{"name": "url", "value": drain.DisplayURL()},
+			{"name": "format", "value": drain.Format},
+		},
+		Allowed: event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.AddLogDrain(drain)
+	if err == app.ErrLogDrainAlreadyExists {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// title: app log drain remove
+// path: /apps/{app}/log-drains
+// method: DELETE
+// responses:
+//   200: Log drain removed
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App or log drain not found
+func appLogDrainRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	drainURL := r.URL.Query().Get("url")
+	if drainURL == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "You must provide the url of the log drain."}
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateLogDrainRemove,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	drain := app.LogDrain{URL: drainURL}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppUpdateLogDrainRemove,
+		Owner:      t,
+		CustomData: []map[string]interface{}{{"name": "url", "value": drain.DisplayURL()}},
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.RemoveLogDrain(drainURL)
+	if err == app.ErrLogDrainNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: app log limits set
+// path: /apps/{app}/log-limits
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Log limits changed
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appLogLimitsSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var limits app.AppLogLimits
+	if value := r.FormValue("loglinespersecond"); value != "" {
+		limits.LinesPerSecond, err = strconv.Atoi(value)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid log lines per second"}
+		}
+	}
+	if value := r.FormValue("logbytesperday"); value != "" {
+		limits.BytesPerDay = getSize(value)
+	}
+	appName := r.URL.Query().Get(":app")
+	a, err := getAppFromContext(appName, r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppAdminLogLimits,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppAdminLogLimits,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.SetLogLimits(limits)
+	if _, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
 // title: app swap
 // path: /swap
 // method: POST
@@ -1664,6 +1981,38 @@ func appMetricEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(metricMap)
 }
 
+// title: app resource metrics
+// path: /apps/{app}/metrics
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appResourceMetrics(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadMetric,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	metrics, err := a.ResourceMetrics(r.URL.Query().Get("process"))
+	if err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(metrics)
+}
+
 // title: rebuild routes
 // path: /apps/{app}/routes
 // method: POST
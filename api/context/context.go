@@ -11,6 +11,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 const (
@@ -19,6 +20,8 @@ const (
 	delayedHandlerKey
 	preventUnlockKey
 	appContextKey
+	routePathKey
+	spanKey
 )
 
 func Clear(r *http.Request) {
@@ -77,6 +80,33 @@ func GetDelayedHandler(r *http.Request) http.Handler {
 	return nil
 }
 
+// SetRoutePath stores the path template of the route handling the request,
+// like /apps/{app}.
+func SetRoutePath(r *http.Request, path string) {
+	context.Set(r, routePathKey, path)
+}
+
+func GetRoutePath(r *http.Request) string {
+	if v := context.Get(r, routePathKey); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
+// SetSpan stores the span tracing the request.
+func SetSpan(r *http.Request, span *tracing.Span) {
+	context.Set(r, spanKey, span)
+}
+
+// GetSpan returns the span tracing the request, which is nil when tracing is
+// disabled.
+func GetSpan(r *http.Request) *tracing.Span {
+	if v := context.Get(r, spanKey); v != nil {
+		return v.(*tracing.Span)
+	}
+	return nil
+}
+
 func SetPreventUnlock(r *http.Request) {
 	context.Set(r, preventUnlockKey, true)
 }
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
@@ -86,6 +87,7 @@ func deploy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
 	}
+	instance.Span = context.GetSpan(r)
 	var build bool
 	buildString := r.FormValue("build")
 	if buildString != "" {
@@ -224,6 +226,7 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
 	}
+	instance.Span = context.GetSpan(r)
 	image := r.FormValue("image")
 	if image == "" {
 		return &errors.HTTP{
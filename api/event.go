@@ -8,15 +8,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"golang.org/x/net/websocket"
 	"gopkg.in/mgo.v2/bson"
 )
 
+var eventStreamKeepAliveInterval = 30 * time.Second
+
 // title: event list
 // path: /events
 // method: GET
@@ -144,3 +150,145 @@ func eventCancel(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// title: event stream
+// path: /events/stream
+// method: GET
+// produce: text/event-stream
+// responses:
+//   200: OK
+//   400: Invalid filter
+func eventStream(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	r.ParseForm()
+	filter := &event.Filter{}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	err := dec.DecodeValues(&filter, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+	}
+	filter.PruneUserValues()
+	filter.Permissions, err = t.Permissions()
+	if err != nil {
+		return err
+	}
+	l, err := event.NewListener(filter)
+	if err != nil {
+		return err
+	}
+	eventTracker.add(l)
+	defer func() {
+		eventTracker.remove(l)
+		l.Close()
+	}()
+	if strings.ToLower(r.Header.Get("Upgrade")) == "websocket" {
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			closeChan := make(chan bool)
+			go func() {
+				// Clients are not expected to send anything, reading only
+				// detects closed connections.
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				close(closeChan)
+			}()
+			streamEvents(l, closeChan, func(msg *event.StreamMessage) error {
+				if msg == nil {
+					return nil
+				}
+				return websocket.JSON.Send(ws, msg)
+			})
+		}).ServeHTTP(w, r)
+		return nil
+	}
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	flush()
+	streamEvents(l, closeChan, func(msg *event.StreamMessage) error {
+		if msg == nil {
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			flush()
+			return err
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+		flush()
+		return err
+	})
+	return nil
+}
+
+// streamEvents calls send for each message received by the listener, until
+// closeChan is notified or the listener is closed. send is called with a nil
+// message when no messages were received for a while, allowing keep alive
+// messages to be sent.
+func streamEvents(l *event.Listener, closeChan <-chan bool, send func(*event.StreamMessage) error) {
+	msgChan := l.ListenChan()
+	for {
+		var msg *event.StreamMessage
+		select {
+		case <-closeChan:
+			return
+		case m, ok := <-msgChan:
+			if !ok {
+				return
+			}
+			msg = &m
+		case <-time.After(eventStreamKeepAliveInterval):
+		}
+		if send(msg) != nil {
+			return
+		}
+	}
+}
+
+type eventStreamTracker struct {
+	sync.Mutex
+	conn map[*event.Listener]struct{}
+}
+
+func (t *eventStreamTracker) add(l *event.Listener) {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		t.conn = make(map[*event.Listener]struct{})
+	}
+	t.conn[l] = struct{}{}
+}
+
+func (t *eventStreamTracker) remove(l *event.Listener) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.conn, l)
+}
+
+func (t *eventStreamTracker) String() string {
+	return "event pub/sub connections"
+}
+
+func (t *eventStreamTracker) Shutdown() {
+	t.Lock()
+	defer t.Unlock()
+	for l := range t.conn {
+		l.Close()
+	}
+}
+
+var eventTracker eventStreamTracker
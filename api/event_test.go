@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
@@ -443,3 +445,75 @@ func (s *EventSuite) TestEventCancelWithoutPermission(c *check.C) {
 	server.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
+
+func (s *EventSuite) TestEventStream(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/stream?kindname=app.deploy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	recorder := httptest.NewRecorder()
+	go func() {
+		defer wg.Done()
+		streamErr := eventStream(recorder, request, s.token)
+		c.Assert(streamErr, check.IsNil)
+	}()
+	var listener *event.Listener
+	timeout := time.After(5 * time.Second)
+	for listener == nil {
+		select {
+		case <-timeout:
+			c.Fatal("timeout after 5 seconds")
+		case <-time.After(50 * time.Millisecond):
+		}
+		eventTracker.Lock()
+		for listener = range eventTracker.conn {
+		}
+		eventTracker.Unlock()
+	}
+	// Waits for the redis subscription before publishing messages.
+	time.Sleep(100 * time.Millisecond)
+	otherTeam, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "other-app"},
+		Owner:   s.token,
+		Kind:    permission.PermAppDeploy,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "other-team")),
+	})
+	c.Assert(err, check.IsNil)
+	err = otherTeam.Done(nil)
+	c.Assert(err, check.IsNil)
+	otherKind, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "my-app"},
+		Owner:   s.token,
+		Kind:    permission.PermAppUpdateEnvSet,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	err = otherKind.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: "my-app"},
+		Owner:   s.token,
+		Kind:    permission.PermAppDeploy,
+		Allowed: event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, s.team.Name)),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("deploying")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(500 * time.Millisecond)
+	listener.Close()
+	wg.Wait()
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/event-stream")
+	var types []string
+	for _, part := range strings.Split(strings.TrimSpace(recorder.Body.String()), "\n\n") {
+		lines := strings.SplitN(part, "\n", 2)
+		c.Assert(lines, check.HasLen, 2)
+		types = append(types, strings.TrimPrefix(lines[0], "event: "))
+		var msg event.StreamMessage
+		err = json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &msg)
+		c.Assert(err, check.IsNil)
+		c.Assert(msg.Event.UniqueID, check.Equals, evt.UniqueID)
+	}
+	c.Assert(types, check.DeepEquals, []string{"created", "log", "finished"})
+}
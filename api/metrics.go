@@ -0,0 +1,53 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/context"
+	"github.com/tsuru/tsuru/metrics"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// title: metrics
+// path: /metrics
+// method: GET
+// produce: text/plain
+// responses:
+//   200: OK
+//   401: Unauthorized
+func metricsHandler(w http.ResponseWriter, r *http.Request) error {
+	if !hasMetricsToken(r) {
+		t := context.GetAuthToken(r)
+		if t == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer realm=\"tsuru\" scope=\"tsuru\"")
+			return tokenRequiredErr
+		}
+		if !permission.Check(t, permission.PermDebug) {
+			return permission.ErrUnauthorized
+		}
+	}
+	metrics.Handler().ServeHTTP(w, r)
+	return nil
+}
+
+// hasMetricsToken reports whether the request sends the token in the
+// metrics:token config as a bearer token, allowing scrapers to read the
+// metrics without a user token.
+func hasMetricsToken(r *http.Request) bool {
+	token, _ := config.GetString("metrics:token")
+	if token == "" {
+		return false
+	}
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) == 1
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -22,6 +23,8 @@ import (
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 const (
@@ -30,6 +33,11 @@ const (
 	tsuruAdminMin = "1.0.0"
 )
 
+var (
+	httpRequests        = metrics.NewCounter("tsuru_http_requests_total", "Number of HTTP requests handled, by method, route and status code.", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogram("tsuru_http_request_duration_seconds", "Latency of HTTP requests, by method and route.", metrics.DefaultBuckets, "method", "route")
+)
+
 func validate(token string, r *http.Request) (auth.Token, error) {
 	t, err := app.AuthScheme.Auth(token)
 	if err != nil {
@@ -61,6 +69,47 @@ func contextClearerMiddleware(w http.ResponseWriter, r *http.Request, next http.
 	next(w, r)
 }
 
+func metricsMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	next(w, r)
+	route := context.GetRoutePath(r)
+	if route == "" {
+		route = "unknown"
+	}
+	statusCode := http.StatusOK
+	if rw, ok := w.(negroni.ResponseWriter); ok && rw.Status() != 0 {
+		statusCode = rw.Status()
+	}
+	httpRequests.Inc(r.Method, route, strconv.Itoa(statusCode))
+	httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+}
+
+func tracingMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	route := context.GetRoutePath(r)
+	if route == "" {
+		route = "unknown"
+	}
+	span := tracing.StartSpan(r.Method+" "+route, tracing.Extract(r.Header))
+	if span == nil {
+		next(w, r)
+		return
+	}
+	span.SetTag("span.kind", "server")
+	span.SetTag("http.method", r.Method)
+	span.SetTag("http.url", r.URL.Path)
+	context.SetSpan(r, span)
+	next(w, r)
+	statusCode := http.StatusOK
+	if rw, ok := w.(negroni.ResponseWriter); ok && rw.Status() != 0 {
+		statusCode = rw.Status()
+	}
+	span.SetTag("http.status_code", statusCode)
+	if statusCode >= http.StatusInternalServerError {
+		span.SetTag("error", true)
+	}
+	span.FinishWithError(context.GetRequestError(r))
+}
+
 func flushingWriterMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	defer func() {
 		if r.Body != nil {
@@ -71,13 +120,17 @@ func flushingWriterMiddleware(w http.ResponseWriter, r *http.Request, next http.
 	next(&fw, r)
 }
 
+// setRequestIDHeaderMiddleware sets the ID of the request, read from the
+// header named in the request-id-header config entry or generated, and binds
+// the span of the request to it. Requests are bound even when the header is
+// not configured, so code receiving only the request ID can still link its
+// spans to the request.
 func setRequestIDHeaderMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	requestIDHeader, _ := config.GetString("request-id-header")
-	if requestIDHeader == "" {
-		next(w, r)
-		return
+	var requestID string
+	if requestIDHeader != "" {
+		requestID = r.Header.Get(requestIDHeader)
 	}
-	requestID := r.Header.Get(requestIDHeader)
 	if requestID == "" {
 		unparsedID, err := uuid.NewV4()
 		if err != nil {
@@ -88,6 +141,9 @@ func setRequestIDHeaderMiddleware(w http.ResponseWriter, r *http.Request, next h
 		requestID = unparsedID.String()
 	}
 	context.SetRequestID(r, requestIDHeader, requestID)
+	span := context.GetSpan(r)
+	span.SetTag("request_id", requestID)
+	defer tracing.BindRequest(requestID, span)()
 	next(w, r)
 }
 
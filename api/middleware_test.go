@@ -7,6 +7,7 @@ package api
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -20,6 +21,8 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -70,6 +73,98 @@ func (s *S) TestFlushingWriterMiddleware(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 }
 
+func (s *S) TestMetricsMiddleware(c *check.C) {
+	route := "/apps/{app}/metrics-test"
+	requests := httpRequests.Value("POST", route, "418")
+	latencies := httpRequestDuration.Count("POST", route)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/myapp/metrics-test", nil)
+	c.Assert(err, check.IsNil)
+	context.SetRoutePath(request, route)
+	h, log := doHandler()
+	log.response = http.StatusTeapot
+	metricsMiddleware(negroni.NewResponseWriter(recorder), request, h)
+	c.Assert(log.called, check.Equals, true)
+	c.Assert(httpRequests.Value("POST", route, "418"), check.Equals, requests+1)
+	c.Assert(httpRequestDuration.Count("POST", route), check.Equals, latencies+1)
+}
+
+func (s *S) TestTracingMiddleware(c *check.C) {
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewWriterExporter(&buf))
+	defer tracing.SetExporter(nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/apps/myapp/restart", nil)
+	c.Assert(err, check.IsNil)
+	parent := tracing.SpanContext{TraceID: 0xabc, SpanID: 0x123}
+	tracing.Inject(parent, request.Header)
+	context.SetRoutePath(request, "/apps/{app}/restart")
+	var span *tracing.Span
+	h := func(w http.ResponseWriter, r *http.Request) {
+		span = context.GetSpan(r)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	tracingMiddleware(negroni.NewResponseWriter(recorder), request, h)
+	c.Assert(span, check.NotNil)
+	c.Assert(span.Context().TraceID, check.Equals, parent.TraceID)
+	c.Assert(buf.String(), check.Matches, `\{"traceId":"abc","spanId":"[0-9a-f]+","parentId":"123","operation":"POST /apps/\{app\}/restart".*"error":true.*\n`)
+	c.Assert(buf.String(), check.Matches, `.*"http.status_code":503.*\n`)
+}
+
+func (s *S) TestTracingMiddlewareDisabled(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	h, log := doHandler()
+	tracingMiddleware(recorder, request, h)
+	c.Assert(log.called, check.Equals, true)
+	c.Assert(context.GetSpan(request), check.IsNil)
+}
+
+func (s *S) TestMetricsHandler(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*# TYPE tsuru_http_requests_total counter.*`)
+	c.Assert(httpRequests.Value("GET", "/metrics", "200") > 0, check.Equals, true)
+}
+
+func (s *S) TestMetricsHandlerUnauthorized(c *check.C) {
+	m := RunServer(true)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, check.IsNil)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	recorder = httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestMetricsHandlerToken(c *check.C) {
+	config.Set("metrics:token", "scrape-me")
+	defer config.Unset("metrics:token")
+	m := RunServer(true)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "Bearer scrape-me")
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = httptest.NewRecorder()
+	request.Header.Set("Authorization", "Bearer wrong")
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
 func (s *S) TestSetRequestIDHeaderMiddleware(c *check.C) {
 	config.Set("request-id-header", "Request-ID")
 	defer config.Unset("request-id-header")
@@ -83,6 +178,26 @@ func (s *S) TestSetRequestIDHeaderMiddleware(c *check.C) {
 	c.Assert(reqID, check.Not(check.Equals), "")
 }
 
+func (s *S) TestSetRequestIDHeaderMiddlewareBindsSpan(c *check.C) {
+	tracing.SetExporter(tracing.NewWriterExporter(ioutil.Discard))
+	defer tracing.SetExporter(nil)
+	config.Set("request-id-header", "Request-ID")
+	defer config.Unset("request-id-header")
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Request-ID", "test")
+	span := tracing.StartSpan("GET /", tracing.SpanContext{})
+	context.SetSpan(req, span)
+	var bound tracing.SpanContext
+	h := func(w http.ResponseWriter, r *http.Request) {
+		bound = tracing.RequestSpan("test")
+	}
+	setRequestIDHeaderMiddleware(rec, req, h)
+	c.Assert(bound, check.Equals, span.Context())
+	c.Assert(tracing.RequestSpan("test").IsValid(), check.Equals, false)
+}
+
 func (s *S) TestSetRequestIDHeaderAlreadySet(c *check.C) {
 	config.Set("request-id-header", "Request-ID")
 	defer config.Unset("request-id-header")
@@ -106,7 +221,24 @@ func (s *S) TestSetRequestIDHeaderMiddlewareNoConfig(c *check.C) {
 	setRequestIDHeaderMiddleware(rec, req, h)
 	c.Assert(log.called, check.Equals, true)
 	reqID := context.GetRequestID(req, "")
-	c.Assert(reqID, check.Equals, "")
+	c.Assert(reqID, check.Not(check.Equals), "")
+}
+
+func (s *S) TestSetRequestIDHeaderMiddlewareNoConfigBindsSpan(c *check.C) {
+	tracing.SetExporter(tracing.NewWriterExporter(ioutil.Discard))
+	defer tracing.SetExporter(nil)
+	config.Unset("request-id-header")
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	span := tracing.StartSpan("GET /", tracing.SpanContext{})
+	context.SetSpan(req, span)
+	var bound tracing.SpanContext
+	h := func(w http.ResponseWriter, r *http.Request) {
+		bound = tracing.RequestSpan(context.GetRequestID(r, ""))
+	}
+	setRequestIDHeaderMiddleware(rec, req, h)
+	c.Assert(bound, check.Equals, span.Context())
 }
 
 func (s *S) TestSetVersionHeadersMiddleware(c *check.C) {
@@ -507,6 +507,123 @@ func listPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return json.NewEncoder(w).Encode(permList)
 }
 
+type permissionCheckScheme struct {
+	Name    string
+	Granted bool
+}
+
+type permissionCheckRole struct {
+	Name         string
+	ContextType  string
+	ContextValue string
+	Granted      bool
+	Schemes      []permissionCheckScheme
+}
+
+type permissionCheckResult struct {
+	Email      string
+	Permission string
+	Contexts   []permission.PermissionContext
+	Allowed    bool
+	Roles      []permissionCheckRole
+	Targets    []permission.PermissionContext
+}
+
+// title: check user permission
+// path: /permissions/check
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: User or permission not found
+func checkPermission(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		email = t.GetUserName()
+	}
+	if !permission.Check(t, permission.PermUserReadPermissions,
+		permission.Context(permission.CtxUser, email),
+	) {
+		return permission.ErrUnauthorized
+	}
+	permName := r.URL.Query().Get("permission")
+	if permName == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "permission is required"}
+	}
+	scheme, err := permission.SafeGet(permName)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	var contexts []permission.PermissionContext
+	for _, rawCtx := range r.URL.Query()["context"] {
+		ctx, err := permission.ParseContext(rawCtx)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		if ctx.CtxType == permission.CtxApp {
+			a, err := app.GetByName(ctx.Value)
+			if err != nil {
+				return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+			}
+			contexts = append(contexts, contextsForApp(a)...)
+			continue
+		}
+		contexts = append(contexts, ctx)
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err == auth.ErrUserNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	perms, err := user.Permissions()
+	if err != nil {
+		return err
+	}
+	result := permissionCheckResult{
+		Email:      user.Email,
+		Permission: scheme.FullName(),
+		Contexts:   contexts,
+		Allowed:    permission.CheckFromPermList(perms, scheme, contexts...),
+		Targets:    permission.ContextsFromListForPermission(perms, scheme),
+	}
+	for _, roleData := range user.Roles {
+		role, err := permission.FindRole(roleData.Name)
+		if err != nil {
+			if err == permission.ErrRoleNotFound {
+				continue
+			}
+			return err
+		}
+		roleResult := permissionCheckRole{
+			Name:         role.Name,
+			ContextType:  string(role.ContextType),
+			ContextValue: roleData.ContextValue,
+		}
+		rolePerms := role.PermissionsFor(roleData.ContextValue)
+		for _, check := range permission.ExplainFromPermList(rolePerms, scheme, contexts...) {
+			name := check.Permission.Scheme.FullName()
+			if name == "" {
+				name = "*"
+			}
+			roleResult.Schemes = append(roleResult.Schemes, permissionCheckScheme{
+				Name:    name,
+				Granted: check.Granted,
+			})
+			roleResult.Granted = roleResult.Granted || check.Granted
+		}
+		result.Roles = append(result.Roles, roleResult)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
 // title: add default role
 // path: /role/default
 // method: POST
@@ -684,6 +684,114 @@ func (s *S) TestListPermissions(c *check.C) {
 	})
 }
 
+func (s *S) TestCheckPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, "team1"),
+	}, permission.Permission{
+		Scheme:  permission.PermApp,
+		Context: permission.Context(permission.CtxTeam, "team2"),
+	})
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/check?permission=app.deploy&context=team:team2", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Email, check.Equals, token.GetUserName())
+	c.Assert(result.Permission, check.Equals, "app.deploy")
+	c.Assert(result.Allowed, check.Equals, true)
+	c.Assert(result.Contexts, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxTeam, "team2"),
+	})
+	c.Assert(result.Targets, check.DeepEquals, []permission.PermissionContext{
+		permission.Context(permission.CtxTeam, "team1"),
+		permission.Context(permission.CtxTeam, "team2"),
+	})
+	c.Assert(result.Roles, check.DeepEquals, []permissionCheckRole{
+		{
+			Name:         "majortomapp.deployteam1",
+			ContextType:  "team",
+			ContextValue: "team1",
+			Schemes:      []permissionCheckScheme{{Name: "app.deploy"}},
+		},
+		{
+			Name:         "majortomappteam2",
+			ContextType:  "team",
+			ContextValue: "team2",
+			Granted:      true,
+			Schemes:      []permissionCheckScheme{{Name: "app", Granted: true}},
+		},
+	})
+}
+
+func (s *S) TestCheckPermissionOtherUser(c *check.C) {
+	otherToken := customUserWithPermission(c, "otheruser", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, "team1"),
+	})
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermUserReadPermissions,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	rec := httptest.NewRecorder()
+	url := fmt.Sprintf("/permissions/check?email=%s&permission=app.deploy&context=team:team3", otherToken.GetUserName())
+	req, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Email, check.Equals, otherToken.GetUserName())
+	c.Assert(result.Allowed, check.Equals, false)
+	c.Assert(result.Roles, check.HasLen, 1)
+	c.Assert(result.Roles[0].Granted, check.Equals, false)
+}
+
+func (s *S) TestCheckPermissionOtherUserUnauthorized(c *check.C) {
+	otherToken := customUserWithPermission(c, "otheruser")
+	token := userWithPermission(c)
+	rec := httptest.NewRecorder()
+	url := fmt.Sprintf("/permissions/check?email=%s&permission=app.deploy", otherToken.GetUserName())
+	req, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestCheckPermissionInvalidPermission(c *check.C) {
+	token := userWithPermission(c)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/check?permission=app.invalid", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestCheckPermissionInvalidContext(c *check.C) {
+	token := userWithPermission(c)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/check?permission=app.deploy&context=invalid:x", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Equals, "invalid context type \"invalid\"\n")
+}
+
 func (s *S) TestAddDefaultRole(c *check.C) {
 	_, err := permission.NewRole("r1", "team", "")
 	c.Assert(err, check.IsNil)
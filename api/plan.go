@@ -31,13 +31,20 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	isDefault, _ := strconv.ParseBool(r.FormValue("default"))
 	memory := getSize(r.FormValue("memory"))
 	swap := getSize(r.FormValue("swap"))
+	logLinesPerSecond, _ := strconv.Atoi(r.FormValue("loglinespersecond"))
+	var logBytesPerDay int64
+	if value := r.FormValue("logbytesperday"); value != "" {
+		logBytesPerDay = getSize(value)
+	}
 	plan := app.Plan{
-		Name:     r.FormValue("name"),
-		Memory:   memory,
-		Swap:     swap,
-		CpuShare: cpuShare,
-		Default:  isDefault,
-		Router:   r.FormValue("router"),
+		Name:              r.FormValue("name"),
+		Memory:            memory,
+		Swap:              swap,
+		CpuShare:          cpuShare,
+		Default:           isDefault,
+		Router:            r.FormValue("router"),
+		LogLinesPerSecond: logLinesPerSecond,
+		LogBytesPerDay:    logBytesPerDay,
 	}
 	allowed := permission.Check(t, permission.PermPlanCreate)
 	if !allowed {
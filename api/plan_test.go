@@ -69,6 +69,38 @@ func (s *S) TestPlanAddWithMegabyteAsMemoryUnit(c *check.C) {
 	})
 }
 
+func (s *S) TestPlanAddWithLogLimits(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&cpushare=100&router=fake&loglinespersecond=50&logbytesperday=1G")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer s.conn.Plans().RemoveAll(nil)
+	var plans []app.Plan
+	err = s.conn.Plans().Find(nil).All(&plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []app.Plan{
+		{Name: "xyz", Memory: 536870912, CpuShare: 100, Router: "fake", LogLinesPerSecond: 50, LogBytesPerDay: 1073741824},
+	})
+}
+
+func (s *S) TestPlanAddInvalidLogLimits(c *check.C) {
+	recorder := httptest.NewRecorder()
+	body := strings.NewReader("name=xyz&memory=512M&cpushare=100&loglinespersecond=-1")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid value for log lines per second\n")
+}
+
 func (s *S) TestPlanAddWithMegabyteAsSwapUnit(c *check.C) {
 	recorder := httptest.NewRecorder()
 	body := strings.NewReader("name=xyz&memory=512M&swap=1024&cpushare=100&router=fake")
@@ -20,6 +20,7 @@ const versionMatcher = "/{version:[0-9.]+}"
 type Route struct {
 	route   *mux.Route
 	version string
+	path    string
 }
 
 func NewRouter() *DelayedRouter {
@@ -44,14 +45,15 @@ func (r *DelayedRouter) registerVars(req *http.Request, vars map[string]string)
 
 func (r *DelayedRouter) addRoute(version, path string, h http.Handler, methods ...string) *mux.Route {
 	muxRoute := r.mux.NewRoute().Handler(h).Methods(methods...)
-	route := &Route{route: muxRoute, version: version}
+	route := &Route{route: muxRoute, version: version, path: path}
 	r.routes[muxRoute] = route
 	versionRegexp := regexp.MustCompile("/(?P<version>[0-9.]+)/")
 	muxRoute.MatcherFunc(func(httpRequest *http.Request, rm *mux.RouteMatch) bool {
 		d := versionRegexp.FindStringSubmatch(httpRequest.URL.Path)
 		return len(d) > 1 && r.routes[muxRoute].version == d[1]
 	}).PathPrefix(versionMatcher).Path(path)
-	r.mux.NewRoute().Path(path).Handler(h).Methods(methods...)
+	unversionedRoute := r.mux.NewRoute().Path(path).Handler(h).Methods(methods...)
+	r.routes[unversionedRoute] = route
 	return muxRoute
 }
 
@@ -71,5 +73,8 @@ func (r *DelayedRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	r.registerVars(req, match.Vars)
+	if route, ok := r.routes[match.Route]; ok {
+		context.SetRoutePath(req, route.path)
+	}
 	context.SetDelayedHandler(req, match.Handler)
 }
@@ -90,6 +90,18 @@ func (s *S) TestDelayedRouter(c *check.C) {
 	c.Assert(called, check.Equals, true)
 }
 
+func (s *S) TestDelayedRouterSetsRoutePath(c *check.C) {
+	router := NewRouter()
+	router.Add("1.0", "GET", "/dream/{world}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, path := range []string{"/dream/tel'aran'rhiod", "/1.0/dream/tel'aran'rhiod"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, check.IsNil)
+		router.ServeHTTP(recorder, request)
+		c.Assert(context.GetRoutePath(request), check.Equals, "/dream/{world}")
+	}
+}
+
 func (s *S) TestDelayedRouterAddAll(c *check.C) {
 	router := NewRouter()
 	called := false
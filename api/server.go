@@ -24,11 +24,16 @@ import (
 	_ "github.com/tsuru/tsuru/auth/oauth"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event/retention"
+	"github.com/tsuru/tsuru/event/sink"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/tracing"
 	"golang.org/x/net/websocket"
 	"gopkg.in/tylerb/graceful.v1"
 )
@@ -100,7 +105,16 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Put", "/services/{service}/instances/{instance}", AuthorizationRequiredHandler(updateServiceInstance))
 	m.Add("1.0", "Put", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(bindServiceInstance))
 	m.Add("1.0", "Delete", "/services/{service}/instances/{instance}/{app}", AuthorizationRequiredHandler(unbindServiceInstance))
+	m.Add("1.1", "Post", "/services/{service}/instances/{instance}/{app}/rotate", AuthorizationRequiredHandler(rotateServiceInstanceCredentials))
 	m.Add("1.0", "Get", "/services/{service}/instances/{instance}/status", AuthorizationRequiredHandler(serviceInstanceStatus))
+	m.Add("1.1", "Get", "/services/{service}/instances/{instance}/status/history", AuthorizationRequiredHandler(serviceInstanceStatusHistory))
+	m.Add("1.1", "Post", "/services/{service}/instances/{instance}/bind-requests", AuthorizationRequiredHandler(createBindRequest))
+	m.Add("1.1", "Get", "/services/{service}/instances/{instance}/bind-requests", AuthorizationRequiredHandler(listBindRequests))
+	m.Add("1.1", "Put", "/services/{service}/instances/{instance}/bind-requests/{id}", AuthorizationRequiredHandler(decideBindRequest))
+	m.Add("1.1", "Get", "/services/{service}/instances/{instance}/backups", AuthorizationRequiredHandler(serviceInstanceBackups))
+	m.Add("1.1", "Post", "/services/{service}/instances/{instance}/backups", AuthorizationRequiredHandler(createServiceInstanceBackup))
+	m.Add("1.1", "Put", "/services/{service}/instances/{instance}/backups/schedule", AuthorizationRequiredHandler(scheduleServiceInstanceBackups))
+	m.Add("1.1", "Post", "/services/{service}/instances/{instance}/backups/{backup}/restore", AuthorizationRequiredHandler(restoreServiceInstanceBackup))
 	m.Add("1.0", "Put", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceGrantTeam))
 	m.Add("1.0", "Delete", "/services/{service}/instances/permission/{instance}/{team}", AuthorizationRequiredHandler(serviceInstanceRevokeTeam))
 
@@ -109,12 +123,16 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.0", "Get", "/services", AuthorizationRequiredHandler(serviceList))
 	m.Add("1.0", "Post", "/services", AuthorizationRequiredHandler(serviceCreate))
+	m.Add("1.1", "Post", "/services/brokers", AuthorizationRequiredHandler(serviceBrokerImport))
 	m.Add("1.0", "Put", "/services/{name}", AuthorizationRequiredHandler(serviceUpdate))
 	m.Add("1.0", "Delete", "/services/{name}", AuthorizationRequiredHandler(serviceDelete))
 	m.Add("1.0", "Get", "/services/{name}", AuthorizationRequiredHandler(serviceInfo))
 	m.Add("1.0", "Get", "/services/{name}/plans", AuthorizationRequiredHandler(servicePlans))
 	m.Add("1.0", "Get", "/services/{name}/doc", AuthorizationRequiredHandler(serviceDoc))
+	m.Add("1.1", "Get", "/services/{name}/status/history", AuthorizationRequiredHandler(serviceStatusHistory))
 	m.Add("1.0", "Put", "/services/{name}/doc", AuthorizationRequiredHandler(serviceAddDoc))
+	m.Add("1.1", "Put", "/services/{name}/pools", AuthorizationRequiredHandler(serviceSetPools))
+	m.Add("1.1", "Put", "/services/{name}/proxy-rules", AuthorizationRequiredHandler(serviceSetProxyRules))
 	m.Add("1.0", "Put", "/services/{service}/team/{team}", AuthorizationRequiredHandler(grantServiceAccess))
 	m.Add("1.0", "Delete", "/services/{service}/team/{team}", AuthorizationRequiredHandler(revokeServiceAccess))
 
@@ -149,8 +167,13 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/log", AuthorizationRequiredHandler(appLog))
 	logPostHandler := AuthorizationRequiredHandler(addLog)
 	m.Add("1.0", "Post", "/apps/{app}/log", logPostHandler)
+	m.Add("1.1", "Get", "/apps/{app}/log-drains", AuthorizationRequiredHandler(appLogDrainList))
+	m.Add("1.1", "Post", "/apps/{app}/log-drains", AuthorizationRequiredHandler(appLogDrainAdd))
+	m.Add("1.1", "Delete", "/apps/{app}/log-drains", AuthorizationRequiredHandler(appLogDrainRemove))
+	m.Add("1.1", "Put", "/apps/{app}/log-limits", AuthorizationRequiredHandler(appLogLimitsSet))
 	m.Add("1.0", "Post", "/apps/{appname}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
 	m.Add("1.0", "Get", "/apps/{app}/metric/envs", AuthorizationRequiredHandler(appMetricEnvs))
+	m.Add("1.1", "Get", "/apps/{app}/metrics", AuthorizationRequiredHandler(appResourceMetrics))
 	m.Add("1.0", "Post", "/apps/{app}/routes", AuthorizationRequiredHandler(appRebuildRoutes))
 
 	m.Add("1.0", "Post", "/node/status", AuthorizationRequiredHandler(setNodeStatus))
@@ -160,6 +183,13 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.1", "Get", "/events", AuthorizationRequiredHandler(eventList))
 	m.Add("1.1", "Get", "/events/kinds", AuthorizationRequiredHandler(kindList))
+	m.Add("1.1", "Get", "/events/stream", AuthorizationRequiredHandler(eventStream))
+	m.Add("1.1", "Get", "/events/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.1", "Post", "/events/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.1", "Get", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.1", "Put", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.1", "Delete", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.1", "Get", "/events/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
 	m.Add("1.1", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
 	m.Add("1.1", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
 
@@ -212,6 +242,7 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.0", "Get", "/healthcheck/", http.HandlerFunc(healthcheck))
 	m.Add("1.0", "Get", "/healthcheck", http.HandlerFunc(healthcheck))
+	m.Add("1.0", "Get", "/metrics", Handler(metricsHandler))
 
 	m.Add("1.0", "Get", "/iaas/machines", AuthorizationRequiredHandler(machinesList))
 	m.Add("1.0", "Delete", "/iaas/machines/{machine_id}", AuthorizationRequiredHandler(machineDestroy))
@@ -244,6 +275,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/role/default", AuthorizationRequiredHandler(addDefaultRole))
 	m.Add("1.0", "Delete", "/role/default", AuthorizationRequiredHandler(removeDefaultRole))
 	m.Add("1.0", "Get", "/permissions", AuthorizationRequiredHandler(listPermissions))
+	m.Add("1.0", "Get", "/permissions/check", AuthorizationRequiredHandler(checkPermission))
 
 	m.Add("1.0", "Get", "/debug/goroutines", AuthorizationRequiredHandler(dumpGoroutines))
 	m.Add("1.0", "Get", "/debug/pprof/", AuthorizationRequiredHandler(indexHandler))
@@ -291,6 +323,8 @@ func RunServer(dry bool) http.Handler {
 		n.Use(newLoggerMiddleware())
 	}
 	n.UseHandler(m)
+	n.Use(negroni.HandlerFunc(metricsMiddleware))
+	n.Use(negroni.HandlerFunc(tracingMiddleware))
 	n.Use(negroni.HandlerFunc(flushingWriterMiddleware))
 	n.Use(negroni.HandlerFunc(setRequestIDHeaderMiddleware))
 	n.Use(negroni.HandlerFunc(errorHandlingMiddleware))
@@ -329,6 +363,7 @@ func startServer(handler http.Handler) {
 	idleTracker := newIdleTracker()
 	shutdown.Register(idleTracker)
 	shutdown.Register(&logTracker)
+	shutdown.Register(&eventTracker)
 	readTimeout, _ := config.GetInt("server:read-timeout")
 	writeTimeout, _ := config.GetInt("server:write-timeout")
 	listen, err := config.GetString("listen")
@@ -402,6 +437,10 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	err = service.RegisterTasks()
+	if err != nil {
+		fatal(err)
+	}
 	scheme, err := getAuthScheme()
 	if err != nil {
 		fmt.Printf("Warning: configuration didn't declare auth:scheme, using default scheme.\n")
@@ -411,15 +450,45 @@ func startServer(handler http.Handler) {
 		fatal(err)
 	}
 	fmt.Printf("Using %q auth scheme.\n", scheme)
+	err = tracing.Initialize()
+	if err != nil {
+		fatal(err)
+	}
 	err = provision.InitializeAll()
 	if err != nil {
 		fatal(err)
 	}
+	err = webhook.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = sink.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = retention.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = service.InitializeBackupScheduler()
+	if err != nil {
+		fatal(err)
+	}
+	err = service.InitializeHealthMonitor()
+	if err != nil {
+		fatal(err)
+	}
+	err = app.InitializeMetricsCollector()
+	if err != nil {
+		fatal(err)
+	}
 	fmt.Println("Checking components status:")
 	results := hc.Check()
 	for _, result := range results {
 		if result.Status != hc.HealthCheckOK {
 			fmt.Printf("    WARNING: %q is not working: %s\n", result.Name, result.Status)
+		} else if result.Warning != "" {
+			fmt.Printf("    WARNING: %q is degraded: %s\n", result.Name, result.Warning)
 		}
 	}
 	fmt.Println("    Components checked.")
@@ -43,6 +43,7 @@ func serviceIntancePermName(serviceName, instanceName string) string {
 // consume: application/x-www-form-urlencoded
 // responses:
 //   201: Service created
+//   202: Service instance being provisioned
 //   400: Invalid data
 //   401: Unauthorized
 //   409: Service already exists
@@ -95,7 +96,12 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if err != nil {
 		return err
 	}
-	defer func() { evt.Done(err) }()
+	var detached bool
+	defer func() {
+		if !detached {
+			evt.Done(err)
+		}
+	}()
 	requestIDHeader, _ := config.GetString("request-id-header")
 	requestID := context.GetRequestID(r, requestIDHeader)
 	err = service.CreateServiceInstance(instance, &srv, user, requestID)
@@ -111,10 +117,30 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 			Message: err.Error(),
 		}
 	}
-	if err == nil {
-		w.WriteHeader(http.StatusCreated)
+	if err != nil {
+		return err
 	}
-	return err
+	si, err := service.GetServiceInstance(serviceName, instance.Name)
+	if err != nil {
+		return err
+	}
+	if si.State == service.InstanceStatePending {
+		// The event is finished by the provisioning task, once the service
+		// is done provisioning the instance.
+		err = evt.Detach()
+		if err != nil {
+			return err
+		}
+		err = service.WatchProvisioning(si, evt.UniqueID, requestID)
+		if err != nil {
+			return err
+		}
+		detached = true
+		w.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
 }
 
 // title: service instance update
@@ -126,29 +152,52 @@ func createServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 //   400: Invalid data
 //   401: Unauthorized
 //   404: Service instance not found
+//   412: Service instance not ready
 func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	serviceName := r.URL.Query().Get(":service")
 	instanceName := r.URL.Query().Get(":instance")
 	description := r.FormValue("description")
-	if description == "" {
+	planName := r.FormValue("plan")
+	params := map[string]string{}
+	for key, values := range r.Form {
+		if strings.HasPrefix(key, "parameters.") && len(values) > 0 {
+			params[strings.TrimPrefix(key, "parameters.")] = values[0]
+		}
+	}
+	if description == "" && planName == "" && len(params) == 0 {
 		return &errors.HTTP{
 			Code:    http.StatusBadRequest,
-			Message: "Invalid value for description",
+			Message: "Neither description, plan nor parameters were set",
 		}
 	}
 	si, err := getServiceInstanceOrError(serviceName, instanceName)
 	if err != nil {
 		return err
 	}
-	allowed := permission.Check(t, permission.PermServiceInstanceUpdateDescription,
-		contextsForServiceInstance(si, serviceName)...,
-	)
-	if !allowed {
-		return permission.ErrUnauthorized
+	kind := permission.PermServiceInstanceUpdateDescription
+	var perms []*permission.PermissionScheme
+	if description != "" {
+		perms = append(perms, permission.PermServiceInstanceUpdateDescription)
+	}
+	if len(params) > 0 {
+		kind = permission.PermServiceInstanceUpdateParameters
+		perms = append(perms, kind)
+	}
+	if planName != "" {
+		kind = permission.PermServiceInstanceUpdatePlan
+		perms = append(perms, kind)
+	}
+	for _, perm := range perms {
+		allowed := permission.Check(t, perm,
+			contextsForServiceInstance(si, serviceName)...,
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
 	}
 	evt, err := event.New(&event.Opts{
 		Target:     serviceInstanceTarget(serviceName, instanceName),
-		Kind:       permission.PermServiceInstanceUpdateDescription,
+		Kind:       kind,
 		Owner:      t,
 		CustomData: event.FormToCustomData(r.Form),
 		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents,
@@ -157,7 +206,37 @@ func updateServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if err != nil {
 		return err
 	}
-	defer func() { evt.Done(err) }()
+	previousPlan := si.PlanName
+	defer func() {
+		if planName == "" {
+			evt.Done(err)
+			return
+		}
+		evt.DoneCustomData(err, map[string]string{
+			"previousPlan": previousPlan,
+			"plan":         si.PlanName,
+		})
+	}()
+	if planName != "" || len(params) > 0 {
+		requestIDHeader, _ := config.GetString("request-id-header")
+		requestID := context.GetRequestID(r, requestIDHeader)
+		err = si.Update(planName, params, requestID)
+		switch err {
+		case nil:
+		case service.ErrInvalidPlan:
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+		case service.ErrInstanceNotReady, service.ErrInstanceProvisionFailed:
+			return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+		default:
+			if e, ok := err.(*errors.ValidationError); ok {
+				return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+			}
+			return err
+		}
+	}
+	if description == "" {
+		return nil
+	}
 	si.Description = description
 	return service.UpdateService(si)
 }
@@ -201,6 +280,8 @@ func removeServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
 	unbindAllBool, _ := strconv.ParseBool(unbindAll)
 	if unbindAllBool {
 		if len(serviceInstance.Apps) > 0 {
@@ -210,7 +291,7 @@ func removeServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 					return instErr
 				}
 				fmt.Fprintf(writer, "Unbind app %q ...\n", app.GetName())
-				instErr = serviceInstance.UnbindApp(app, true, writer)
+				instErr = serviceInstance.UnbindApp(app, true, writer, requestID)
 				if instErr != nil {
 					return instErr
 				}
@@ -222,8 +303,6 @@ func removeServiceInstance(w http.ResponseWriter, r *http.Request, t auth.Token)
 			}
 		}
 	}
-	requestIDHeader, _ := config.GetString("request-id-header")
-	requestID := context.GetRequestID(r, requestIDHeader)
 	err = service.DeleteInstance(serviceInstance, requestID)
 	if err != nil {
 		if err == service.ErrServiceInstanceBound {
@@ -281,6 +360,30 @@ func readableServices(t auth.Token, contexts []permission.PermissionContext) ([]
 	return service.GetServicesByTeamsAndServices(teams, serviceNames)
 }
 
+// filterServices returns the services matching the tag, category and search
+// query parameters of the request.
+func filterServices(services []service.Service, r *http.Request) []service.Service {
+	query := r.URL.Query()
+	tag, category, search := query.Get("tag"), query.Get("category"), query.Get("search")
+	if tag == "" && category == "" && search == "" {
+		return services
+	}
+	var result []service.Service
+	for _, s := range services {
+		if tag != "" && !s.HasTag(tag) {
+			continue
+		}
+		if category != "" && !s.HasCategory(category) {
+			continue
+		}
+		if search != "" && !s.Matches(search) {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
 // title: service instance list
 // path: /services/instances
 // method: GET
@@ -301,12 +404,16 @@ func serviceInstances(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 	if err != nil {
 		return err
 	}
+	services = filterServices(services, r)
 	servicesMap := map[string]*service.ServiceModel{}
 	for _, s := range services {
 		if _, in := servicesMap[s.Name]; !in {
 			servicesMap[s.Name] = &service.ServiceModel{
-				Service:   s.Name,
-				Instances: []string{},
+				Service:    s.Name,
+				Instances:  []string{},
+				Health:     s.HealthStatus,
+				Tags:       s.Tags,
+				Categories: s.Categories,
 			}
 		}
 	}
@@ -376,6 +483,69 @@ func serviceInstanceStatus(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return nil
 }
 
+func writeHealthHistory(w http.ResponseWriter, r *http.Request, serviceName, instanceName string) error {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, err := service.HealthHistory(serviceName, instanceName, limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// title: service instance status history
+// path: /services/{service}/instances/{instance}/status/history
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service instance not found
+func serviceInstanceStatusHistory(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	serviceInstance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceReadStatus,
+		contextsForServiceInstance(serviceInstance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	return writeHealthHistory(w, r, serviceName, instanceName)
+}
+
+// title: service status history
+// path: /services/{name}/status/history
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service not found
+func serviceStatusHistory(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	serviceName := r.URL.Query().Get(":name")
+	s, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceRead,
+		contextsForService(&s)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	return writeHealthHistory(w, r, serviceName, "")
+}
+
 type serviceInstanceInfo struct {
 	Apps            []string
 	Teams           []string
@@ -384,6 +554,8 @@ type serviceInstanceInfo struct {
 	PlanName        string
 	PlanDescription string
 	CustomInfo      map[string]string
+	State           string
+	StateError      string `json:",omitempty"`
 }
 
 // title: service instance info
@@ -425,6 +597,11 @@ func serviceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) error
 		PlanName:        plan.Name,
 		PlanDescription: plan.Description,
 		CustomInfo:      info,
+		State:           serviceInstance.State,
+		StateError:      serviceInstance.StateError,
+	}
+	if sInfo.State == "" {
+		sInfo.State = service.InstanceStateReady
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(sInfo)
@@ -438,7 +615,7 @@ func serviceInstance(w http.ResponseWriter, r *http.Request, t auth.Token) error
 //   200: OK
 func serviceInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	serviceName := r.URL.Query().Get(":name")
-	_, err := getService(serviceName)
+	s, err := getService(serviceName)
 	if err != nil {
 		return err
 	}
@@ -447,6 +624,24 @@ func serviceInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
+	plan, search := r.URL.Query().Get("plan"), strings.ToLower(r.URL.Query().Get("search"))
+	if plan != "" || search != "" {
+		filtered := []service.ServiceInstance{}
+		for _, si := range instances {
+			if plan != "" && si.PlanName != plan {
+				continue
+			}
+			if search != "" && !strings.Contains(strings.ToLower(si.Name), search) &&
+				!strings.Contains(strings.ToLower(si.Description), search) {
+				continue
+			}
+			filtered = append(filtered, si)
+		}
+		instances = filtered
+	}
+	if s.HealthStatus != "" {
+		w.Header().Set("X-Tsuru-Service-Health", s.HealthStatus)
+	}
 	return json.NewEncoder(w).Encode(instances)
 }
 
@@ -519,6 +714,15 @@ func servicePlans(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
+	if search := r.URL.Query().Get("search"); search != "" {
+		filtered := []service.Plan{}
+		for _, p := range plans {
+			if p.Matches(search) {
+				filtered = append(filtered, p)
+			}
+		}
+		plans = filtered
+	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(plans)
 }
@@ -545,6 +749,7 @@ func parseFormPreserveBody(r *http.Request) {
 // method: "*"
 // responses:
 //   401: Unauthorized
+//   403: Path not exposed by the service
 //   404: Instance not found
 func serviceInstanceProxy(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	parseFormPreserveBody(r)
@@ -560,7 +765,23 @@ func serviceInstanceProxy(w http.ResponseWriter, r *http.Request, t auth.Token)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	path := r.URL.Query().Get("callback")
+	callback, err := service.ParseProxyCallback(r.URL.Query().Get("callback"))
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	srv := serviceInstance.Service()
+	rule, err := srv.ProxyRuleFor(serviceInstance, r.Method, callback.Path)
+	if err == service.ErrProxyPathNotAllowed {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: err.Error()}
+	}
+	if rule != nil && rule.Admin {
+		allowed = permission.Check(t, permission.PermServiceUpdateProxy,
+			contextsForServiceProvision(srv)...,
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+	}
 	if r.Method != httpMethodGet && r.Method != httpMethodHead {
 		evt, err := event.New(&event.Opts{
 			Target: serviceInstanceTarget(serviceName, instanceName),
@@ -576,9 +797,47 @@ func serviceInstanceProxy(w http.ResponseWriter, r *http.Request, t auth.Token)
 		if err != nil {
 			return err
 		}
-		defer func() { evt.Done(err) }()
+		proxyWriter := &proxyResponseWriter{ResponseWriter: w}
+		w = proxyWriter
+		defer func() { evt.DoneCustomData(err, proxyWriter.customData(callback.Path)) }()
+	}
+	return service.Proxy(srv, callback.RequestURI(), w, r)
+}
+
+// proxyResponseWriter records the status of responses proxied from service
+// APIs, so it can be stored in the proxy events.
+type proxyResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *proxyResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *proxyResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *proxyResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *proxyResponseWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
 	}
-	return service.Proxy(serviceInstance.Service(), path, w, r)
+	return make(chan bool)
+}
+
+func (w *proxyResponseWriter) customData(path string) map[string]interface{} {
+	return map[string]interface{}{"path": path, "status": w.status}
 }
 
 // title: grant access to service instance
@@ -656,6 +915,388 @@ func serviceInstanceRevokeTeam(w http.ResponseWriter, r *http.Request, t auth.To
 	return serviceInstance.Revoke(teamName)
 }
 
+// title: request to bind app to service instance
+// path: /services/{service}/instances/{instance}/bind-requests
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Request created
+//   400: Invalid data
+//   401: Unauthorized
+//   403: App pool not allowed by the service
+//   404: Service instance or app not found
+//   409: Request already exists
+func createBindRequest(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, a, err := getServiceInstance(serviceName, instanceName, r.FormValue("app"))
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateBindRequest,
+		contextsForApp(a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	teamName := r.FormValue("team")
+	if teamName == "" {
+		teamName = a.TeamOwner
+	}
+	var appTeam bool
+	for _, team := range a.Teams {
+		if team == teamName {
+			appTeam = true
+			break
+		}
+	}
+	if !appTeam {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Team %q does not have access to the app %q.", teamName, a.Name),
+		}
+	}
+	srv, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	if !srv.AllowsPool(a.Pool) {
+		return &errors.HTTP{
+			Code:    http.StatusForbidden,
+			Message: fmt.Sprintf("Apps in the pool %q cannot bind instances of the service %q.", a.Pool, serviceName),
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateBindRequest,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	req := service.BindRequest{
+		AppName:   a.Name,
+		Team:      teamName,
+		Requester: t.GetUserName(),
+		Message:   r.FormValue("message"),
+	}
+	err = service.CreateBindRequest(instance, &req)
+	switch err {
+	case nil:
+	case service.ErrBindRequestAlreadyExists, service.ErrTeamAlreadyHasAccess:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(req)
+}
+
+// title: list requests to bind apps to service instance
+// path: /services/{service}/instances/{instance}/bind-requests
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Service instance not found
+func listBindRequests(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBindRequest,
+		contextsForServiceInstance(instance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	requests, err := service.ListBindRequests(serviceName, instanceName, r.URL.Query().Get("status"))
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(requests)
+}
+
+// title: approve or reject request to bind app to service instance
+// path: /services/{service}/instances/{instance}/bind-requests/{id}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Request decided
+//   400: Invalid status
+//   401: Unauthorized
+//   404: Service instance or request not found
+//   409: Request already decided
+func decideBindRequest(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	status := r.FormValue("status")
+	if status != service.BindRequestApproved && status != service.BindRequestRejected {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid status %q, expected %q or %q.", status, service.BindRequestApproved, service.BindRequestRejected),
+		}
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBindRequest,
+		contextsForServiceInstance(instance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	kind := permission.PermServiceInstanceUpdateBindRequest
+	if status == service.BindRequestApproved {
+		allowed = permission.Check(t, permission.PermServiceInstanceUpdateGrant,
+			contextsForServiceInstance(instance, serviceName)...,
+		)
+		if !allowed {
+			return permission.ErrUnauthorized
+		}
+		kind = permission.PermServiceInstanceUpdateGrant
+	}
+	req, err := service.GetBindRequest(serviceName, instanceName, r.URL.Query().Get(":id"))
+	if err == service.ErrBindRequestNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	r.Form.Set("request", req.ID.Hex())
+	r.Form.Set("app", req.AppName)
+	r.Form.Set("team", req.Team)
+	evt, err := event.New(&event.Opts{
+		Target:     serviceInstanceTarget(serviceName, instanceName),
+		Kind:       kind,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed: event.Allowed(permission.PermServiceInstanceReadEvents,
+			contextsForServiceInstance(instance, serviceName)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	if status == service.BindRequestApproved {
+		err = req.Approve(instance, t.GetUserName())
+	} else {
+		err = req.Reject(t.GetUserName())
+	}
+	if err == service.ErrBindRequestNotPending {
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	return err
+}
+
+func backupHTTPError(err error) error {
+	switch err {
+	case service.ErrBackupNotSupported:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	case service.ErrBackupNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case service.ErrInstanceNotReady:
+		return &errors.HTTP{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+	return err
+}
+
+// title: list service instance backups
+// path: /services/{service}/instances/{instance}/backups
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   400: Service does not support backups
+//   401: Unauthorized
+//   404: Service instance not found
+func serviceInstanceBackups(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceInstanceReadBackups,
+		contextsForServiceInstance(instance, serviceName)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	backups, err := instance.Backups(context.GetRequestID(r, requestIDHeader))
+	if err != nil {
+		return backupHTTPError(err)
+	}
+	if len(backups) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(backups)
+}
+
+// title: create service instance backup
+// path: /services/{service}/instances/{instance}/backups
+// method: POST
+// produce: application/x-json-stream
+// responses:
+//   200: Backup created
+//   401: Unauthorized
+//   404: Service instance not found
+//   412: Service instance not ready
+func createServiceInstanceBackup(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	contexts := contextsForServiceInstance(instance, serviceName)
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBackupCreate, contexts...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if !instance.IsReady() {
+		return backupHTTPError(service.ErrInstanceNotReady)
+	}
+	evt, err := event.New(&event.Opts{
+		Target:        serviceInstanceTarget(serviceName, instanceName),
+		Kind:          permission.PermServiceInstanceUpdateBackupCreate,
+		Owner:         t,
+		CustomData:    event.FormToCustomData(r.Form),
+		Allowed:       event.Allowed(permission.PermServiceInstanceReadEvents, contexts...),
+		AllowedCancel: event.Allowed(permission.PermServiceInstanceUpdateBackupCreate, contexts...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return err
+	}
+	var backup *service.Backup
+	defer func() { evt.DoneCustomData(err, backup) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	backup, err = instance.CreateBackup(evt, io.MultiWriter(writer, evt), context.GetRequestID(r, requestIDHeader))
+	return backupHTTPError(err)
+}
+
+// title: restore service instance backup
+// path: /services/{service}/instances/{instance}/backups/{backup}/restore
+// method: POST
+// produce: application/x-json-stream
+// responses:
+//   200: Backup restored
+//   401: Unauthorized
+//   404: Service instance or backup not found
+//   412: Service instance not ready
+func restoreServiceInstanceBackup(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	backupID := r.URL.Query().Get(":backup")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	contexts := contextsForServiceInstance(instance, serviceName)
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBackupRestore, contexts...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if !instance.IsReady() {
+		return backupHTTPError(service.ErrInstanceNotReady)
+	}
+	evt, err := event.New(&event.Opts{
+		Target:        serviceInstanceTarget(serviceName, instanceName),
+		Kind:          permission.PermServiceInstanceUpdateBackupRestore,
+		Owner:         t,
+		CustomData:    event.FormToCustomData(r.Form),
+		Allowed:       event.Allowed(permission.PermServiceInstanceReadEvents, contexts...),
+		AllowedCancel: event.Allowed(permission.PermServiceInstanceUpdateBackupRestore, contexts...),
+		Cancelable:    true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	err = instance.RestoreBackup(backupID, evt, io.MultiWriter(writer, evt), context.GetRequestID(r, requestIDHeader))
+	return backupHTTPError(err)
+}
+
+// title: schedule service instance backups
+// path: /services/{service}/instances/{instance}/backups/schedule
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Backups scheduled
+//   400: Invalid interval
+//   401: Unauthorized
+//   404: Service instance not found
+func scheduleServiceInstanceBackups(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	instanceName := r.URL.Query().Get(":instance")
+	serviceName := r.URL.Query().Get(":service")
+	instance, err := getServiceInstanceOrError(serviceName, instanceName)
+	if err != nil {
+		return err
+	}
+	contexts := contextsForServiceInstance(instance, serviceName)
+	allowed := permission.Check(t, permission.PermServiceInstanceUpdateBackupSchedule, contexts...)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var interval time.Duration
+	if rawInterval := r.FormValue("interval"); rawInterval != "" {
+		interval, err = time.ParseDuration(rawInterval)
+		if err != nil || interval < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid interval %q.", rawInterval)}
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceInstanceTarget(serviceName, instanceName),
+		Kind:       permission.PermServiceInstanceUpdateBackupSchedule,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermServiceInstanceReadEvents, contexts...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = instance.SetBackupInterval(interval)
+	if err == service.ErrInvalidBackupInterval {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
 func contextsForServiceInstance(si *service.ServiceInstance, serviceName string) []permission.PermissionContext {
 	permissionValue := serviceIntancePermName(serviceName, si.Name)
 	return append(permission.Contexts(permission.CtxTeam, si.Teams),
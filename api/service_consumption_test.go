@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
@@ -22,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
@@ -270,6 +272,38 @@ func (s *ConsumptionSuite) TestCreateInstance(c *check.C) {
 	c.Assert(si.TeamOwner, check.Equals, s.team.Name)
 }
 
+func (s *ConsumptionSuite) TestCreateInstancePending(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:     "postgres",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	params := map[string]string{
+		"name":         "brainSQL",
+		"service_name": "postgres",
+		"owner":        s.team.Name,
+		"token":        "bearer " + s.token.GetValue(),
+	}
+	recorder, request := makeRequestToCreateInstanceHandler(params, c)
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	si, err := service.GetServiceInstance("postgres", "brainSQL")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, service.InstanceStatePending)
+	evts, err := event.List(&event.Filter{Target: serviceInstanceTarget("postgres", "brainSQL")})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Running, check.Equals, true)
+	c.Assert(evts[0].Kind.Name, check.Equals, "service-instance.create")
+}
+
 func (s *ConsumptionSuite) TestCreateInstanceHandlerHasAccessToTheServiceInTheInstance(c *check.C) {
 	t := auth.Team{Name: "judaspriest"}
 	err := s.conn.Teams().Insert(t)
@@ -542,6 +576,108 @@ func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstanceNoDescription(
 	c.Assert(instance.Description, check.DeepEquals, "changed")
 }
 
+func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstancePlan(c *check.C) {
+	var updateForm url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "small"}, {"name": "big", "schema": {"properties": {"size": {"type": "integer"}}}}]`))
+			return
+		}
+		r.ParseForm()
+		updateForm = r.Form
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		Teams:       []string{s.team.Name},
+	}
+	si.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"_id": si.Name})
+	params := map[string]string{
+		"plan":            "big",
+		"parameters.size": "20",
+	}
+	recorder, request := makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", s.token.GetValue(), c)
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(updateForm.Get("plan"), check.Equals, "big")
+	c.Assert(updateForm.Get("parameters.size"), check.Equals, "20")
+	instance, err := service.GetServiceInstance("mysql", "brainSQL")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.PlanName, check.Equals, "big")
+	c.Assert(instance.Parameters, check.DeepEquals, map[string]string{"size": "20"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("mysql", "brainSQL"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.plan",
+		EndCustomData: map[string]interface{}{
+			"previousPlan": "small",
+			"plan":         "big",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstanceInvalidParameters(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "big", "schema": {"properties": {"size": {"type": "integer"}}}}]`))
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{
+		Name:        "brainSQL",
+		ServiceName: "mysql",
+		PlanName:    "big",
+		Teams:       []string{s.team.Name},
+	}
+	si.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"_id": si.Name})
+	params := map[string]string{
+		"parameters.size": "huge",
+	}
+	recorder, request := makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", s.token.GetValue(), c)
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid value for parameter \"size\": must be of type integer\n")
+}
+
+func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstancePlanWithoutPermission(c *check.C) {
+	se := service.Service{Name: "mysql", Teams: []string{s.team.Name}, Endpoint: map[string]string{"production": s.ts.URL}}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	si.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"_id": si.Name})
+	params := map[string]string{
+		"description": "changed",
+		"plan":        "big",
+	}
+	token := customUserWithPermission(c, "myuser", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdateDescription,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder, request := makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", token.GetValue(), c)
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *ConsumptionSuite) TestUpdateServiceHandlerServiceInstanceNotExist(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
@@ -603,14 +739,14 @@ func (s *ConsumptionSuite) TestUpdateServiceHandlerInvalidDescription(c *check.C
 	m := RunServer(true)
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
-	c.Assert(recorder.Body.String(), check.Equals, "Invalid value for description\n")
+	c.Assert(recorder.Body.String(), check.Equals, "Neither description, plan nor parameters were set\n")
 	params = map[string]string{
 		"desc": "desc",
 	}
 	recorder, request = makeRequestToUpdateInstanceHandler(params, "mysql", "brainSQL", s.token.GetValue(), c)
 	m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
-	c.Assert(recorder.Body.String(), check.Equals, "Invalid value for description\n")
+	c.Assert(recorder.Body.String(), check.Equals, "Neither description, plan nor parameters were set\n")
 }
 
 func makeRequestToRemoveInstanceHandler(service, instance string, c *check.C) (*httptest.ResponseRecorder, *http.Request) {
@@ -1017,6 +1153,49 @@ func (s *ConsumptionSuite) TestServicesInstancesHandler(c *check.C) {
 	c.Assert(instances, check.DeepEquals, expected)
 }
 
+func (s *ConsumptionSuite) TestServicesInstancesHandlerCatalogFilters(c *check.C) {
+	err := s.conn.Services().RemoveId(s.service.Name)
+	c.Assert(err, check.IsNil)
+	srv := service.Service{Name: "redis", Teams: []string{s.team.Name}, Tags: []string{"cache", "nosql"}, Categories: []string{"storage"}}
+	err = srv.Create()
+	c.Assert(err, check.IsNil)
+	srv2 := service.Service{Name: "mongodb", Teams: []string{s.team.Name}, Tags: []string{"nosql"}, Doc: "Document database"}
+	err = srv2.Create()
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"tag=nosql", []string{"mongodb", "redis"}},
+		{"tag=cache", []string{"redis"}},
+		{"category=storage", []string{"redis"}},
+		{"search=document", []string{"mongodb"}},
+		{"tag=nosql&search=redis", []string{"redis"}},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/services/instances?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = serviceInstances(recorder, request, s.token)
+		c.Assert(err, check.IsNil)
+		var services []service.ServiceModel
+		err = json.Unmarshal(recorder.Body.Bytes(), &services)
+		c.Assert(err, check.IsNil)
+		var names []string
+		for _, srv := range services {
+			names = append(names, srv.Service)
+		}
+		sort.Strings(names)
+		c.Assert(names, check.DeepEquals, tt.expected, check.Commentf("query %q", tt.query))
+	}
+	request, err := http.NewRequest("GET", "/services/instances?tag=sql", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstances(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
 func (s *ConsumptionSuite) TestServicesInstancesHandlerAppFilter(c *check.C) {
 	err := s.conn.Services().RemoveId(s.service.Name)
 	c.Assert(err, check.IsNil)
@@ -1282,6 +1461,7 @@ func (s *ConsumptionSuite) TestServiceInstanceInfoHandler(c *check.C) {
 		PlanName:        "small",
 		PlanDescription: "not space left for you",
 		Description:     si.Description,
+		State:           "ready",
 	}
 	c.Assert(instances, check.DeepEquals, expected)
 }
@@ -1319,6 +1499,7 @@ func (s *ConsumptionSuite) TestServiceInstanceInfoHandlerNoPlanAndNoCustomInfo(c
 		PlanName:        "",
 		PlanDescription: "",
 		Description:     si.Description,
+		State:           "ready",
 	}
 	c.Assert(instances, check.DeepEquals, expected)
 }
@@ -1378,6 +1559,19 @@ func (s *ConsumptionSuite) TestServiceInfoHandler(c *check.C) {
 	c.Assert(instances, check.DeepEquals, expected)
 }
 
+func (s *ConsumptionSuite) TestServiceInfoHandlerHealth(c *check.C) {
+	srv := service.Service{Name: "mongodb", Teams: []string{s.team.Name}, HealthStatus: service.HealthStatusDown}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	defer srv.Delete()
+	request, err := http.NewRequest("GET", "/services/mongodb?:name=mongodb", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInfo(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Header().Get("X-Tsuru-Service-Health"), check.Equals, "down")
+}
+
 func (s *ConsumptionSuite) TestServiceInfoHandlerShouldReturnOnlyInstancesOfTheSameTeamOfTheUser(c *check.C) {
 	srv := service.Service{Name: "mongodb", Teams: []string{s.team.Name}}
 	err := srv.Create()
@@ -1815,3 +2009,601 @@ func (s *ConsumptionSuite) TestGrantRevokeServiceToTeamWithManyInstanceName(c *c
 	c.Assert(err, check.IsNil)
 	c.Assert(sinst.Teams, check.DeepEquals, []string{s.team.Name})
 }
+
+func (s *ConsumptionSuite) createBindRequestApp(c *check.C) (*app.App, auth.Token) {
+	team := auth.Team{Name: "otherteam"}
+	err := s.conn.Teams().Insert(team)
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", TeamOwner: team.Name, Teams: []string{team.Name}, Pool: "pool1"}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "requester", permission.Permission{
+		Scheme:  permission.PermAppUpdateBindRequest,
+		Context: permission.Context(permission.CtxTeam, team.Name),
+	})
+	return &a, token
+}
+
+func (s *ConsumptionSuite) TestCreateBindRequest(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	a, token := s.createBindRequestApp(c)
+	body := strings.NewReader("app=myapp&message=please")
+	request, err := http.NewRequest("POST", "/services/mysql/instances/my-mysql/bind-requests?:service=mysql&:instance=my-mysql", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = createBindRequest(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var req service.BindRequest
+	err = json.Unmarshal(recorder.Body.Bytes(), &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req.AppName, check.Equals, a.Name)
+	c.Assert(req.Team, check.Equals, "otherteam")
+	c.Assert(req.Requester, check.Equals, token.GetUserName())
+	c.Assert(req.Message, check.Equals, "please")
+	c.Assert(req.Status, check.Equals, service.BindRequestPending)
+	requests, err := service.ListBindRequests("mysql", "my-mysql", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].ID, check.Equals, req.ID)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "app.update.bind-request",
+		StartCustomData: []map[string]interface{}{
+			{"name": "app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestCreateBindRequestAlreadyExists(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	_, token := s.createBindRequestApp(c)
+	err = service.CreateBindRequest(&si, &service.BindRequest{AppName: "myapp", Team: "otherteam"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("app=myapp")
+	request, err := http.NewRequest("POST", "/services/mysql/instances/my-mysql/bind-requests?:service=mysql&:instance=my-mysql", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = createBindRequest(recorder, request, token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *ConsumptionSuite) TestCreateBindRequestPoolNotAllowed(c *check.C) {
+	s.service.Pools = []string{"pool2"}
+	err := s.service.Update()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	_, token := s.createBindRequestApp(c)
+	body := strings.NewReader("app=myapp")
+	request, err := http.NewRequest("POST", "/services/mysql/instances/my-mysql/bind-requests?:service=mysql&:instance=my-mysql", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = createBindRequest(recorder, request, token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusForbidden)
+	c.Assert(e.Message, check.Equals, `Apps in the pool "pool1" cannot bind instances of the service "mysql".`)
+}
+
+func (s *ConsumptionSuite) TestCreateBindRequestUnauthorized(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	s.createBindRequestApp(c)
+	body := strings.NewReader("app=myapp")
+	request, err := http.NewRequest("POST", "/services/mysql/instances/my-mysql/bind-requests?:service=mysql&:instance=my-mysql", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = createBindRequest(recorder, request, s.token)
+	c.Assert(err, check.Equals, permission.ErrUnauthorized)
+}
+
+func (s *ConsumptionSuite) TestListBindRequests(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	s.createBindRequestApp(c)
+	request, err := http.NewRequest("GET", "/services/mysql/instances/my-mysql/bind-requests?:service=mysql&:instance=my-mysql", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = listBindRequests(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	err = service.CreateBindRequest(&si, &service.BindRequest{AppName: "myapp", Team: "otherteam"})
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = listBindRequests(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var requests []service.BindRequest
+	err = json.Unmarshal(recorder.Body.Bytes(), &requests)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].AppName, check.Equals, "myapp")
+}
+
+func (s *ConsumptionSuite) TestDecideBindRequestApprove(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	s.createBindRequestApp(c)
+	req := service.BindRequest{AppName: "myapp", Team: "otherteam"}
+	err = service.CreateBindRequest(&si, &req)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/services/mysql/instances/my-mysql/bind-requests/%s?:service=mysql&:instance=my-mysql&:id=%s", req.ID.Hex(), req.ID.Hex())
+	request, err := http.NewRequest("PUT", url, strings.NewReader("status=approved"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = decideBindRequest(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	dbReq, err := service.GetBindRequest("mysql", "my-mysql", req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, service.BindRequestApproved)
+	c.Assert(dbReq.DecidedBy, check.Equals, s.token.GetUserName())
+	instance, err := service.GetServiceInstance("mysql", "my-mysql")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.Teams, check.DeepEquals, []string{s.team.Name, "otherteam"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("mysql", "my-mysql"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.grant",
+		StartCustomData: []map[string]interface{}{
+			{"name": "request", "value": req.ID.Hex()},
+			{"name": "app", "value": "myapp"},
+			{"name": "team", "value": "otherteam"},
+		},
+	}, eventtest.HasEvent)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("PUT", url, strings.NewReader("status=approved"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	err = decideBindRequest(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *ConsumptionSuite) TestDecideBindRequestReject(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	s.createBindRequestApp(c)
+	req := service.BindRequest{AppName: "myapp", Team: "otherteam"}
+	err = service.CreateBindRequest(&si, &req)
+	c.Assert(err, check.IsNil)
+	url := fmt.Sprintf("/services/mysql/instances/my-mysql/bind-requests/%s?:service=mysql&:instance=my-mysql&:id=%s", req.ID.Hex(), req.ID.Hex())
+	request, err := http.NewRequest("PUT", url, strings.NewReader("status=rejected"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = decideBindRequest(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	dbReq, err := service.GetBindRequest("mysql", "my-mysql", req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, service.BindRequestRejected)
+	instance, err := service.GetServiceInstance("mysql", "my-mysql")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.Teams, check.DeepEquals, []string{s.team.Name})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("mysql", "my-mysql"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.bind-request",
+		StartCustomData: []map[string]interface{}{
+			{"name": "status", "value": "rejected"},
+			{"name": "team", "value": "otherteam"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestDecideBindRequestInvalidStatus(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("PUT", "/services/mysql/instances/my-mysql/bind-requests/abc?:service=mysql&:instance=my-mysql&:id=abc", strings.NewReader("status=maybe"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = decideBindRequest(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *ConsumptionSuite) TestDecideBindRequestNotFound(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("PUT", "/services/mysql/instances/my-mysql/bind-requests/abc?:service=mysql&:instance=my-mysql&:id=abc", strings.NewReader("status=approved"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = decideBindRequest(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *ConsumptionSuite) createBackupInstance(c *check.C, handler http.HandlerFunc) (*service.ServiceInstance, func()) {
+	ts := httptest.NewServer(handler)
+	se := service.Service{Name: "backupsvc", Endpoint: map[string]string{"production": ts.URL}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "my-backup", ServiceName: "backupsvc", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	return &si, ts.Close
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceBackups(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "GET")
+		c.Assert(r.URL.Path, check.Equals, "/resources/my-backup/backups")
+		w.Write([]byte(`[{"id":"b1","status":"done"}]`))
+	})
+	defer cleanup()
+	request, err := http.NewRequest("GET", "/services/backupsvc/instances/my-backup/backups?:service=backupsvc&:instance=my-backup", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstanceBackups(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var backups []service.Backup
+	err = json.Unmarshal(recorder.Body.Bytes(), &backups)
+	c.Assert(err, check.IsNil)
+	c.Assert(backups, check.HasLen, 1)
+	c.Assert(backups[0].ID, check.Equals, "b1")
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceBackupsNotSupported(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer cleanup()
+	request, err := http.NewRequest("GET", "/services/backupsvc/instances/my-backup/backups?:service=backupsvc&:instance=my-backup", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstanceBackups(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, check.Equals, service.ErrBackupNotSupported.Error())
+}
+
+func (s *ConsumptionSuite) TestCreateServiceInstanceBackup(c *check.C) {
+	var calls []string
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"b1","status":"done"}`))
+	})
+	defer cleanup()
+	request, err := http.NewRequest("POST", "/services/backupsvc/instances/my-backup/backups?:service=backupsvc&:instance=my-backup", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createServiceInstanceBackup(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*Backup \\"b1\\" done.*`)
+	c.Assert(calls, check.DeepEquals, []string{"POST /resources/my-backup/backups"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("backupsvc", "my-backup"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.backup.create",
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestCreateServiceInstanceBackupUnauthorized(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to the service: %s %s", r.Method, r.URL.Path)
+	})
+	defer cleanup()
+	token := customUserWithPermission(c, "backupuser", permission.Permission{
+		Scheme:  permission.PermServiceInstanceReadBackups,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("POST", "/services/backupsvc/instances/my-backup/backups?:service=backupsvc&:instance=my-backup", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createServiceInstanceBackup(recorder, request, token)
+	c.Assert(err, check.Equals, permission.ErrUnauthorized)
+}
+
+func (s *ConsumptionSuite) TestRestoreServiceInstanceBackup(c *check.C) {
+	var calls []string
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"id":"b1","status":"done","restore_status":"done"}`))
+	})
+	defer cleanup()
+	request, err := http.NewRequest("POST", "/services/backupsvc/instances/my-backup/backups/b1/restore?:service=backupsvc&:instance=my-backup&:backup=b1", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = restoreServiceInstanceBackup(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Body.String(), check.Matches, `(?s).*Restore of backup \\"b1\\" done.*`)
+	c.Assert(calls, check.DeepEquals, []string{"POST /resources/my-backup/backups/b1/restore"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("backupsvc", "my-backup"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.backup.restore",
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestRestoreServiceInstanceBackupNotFound(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer cleanup()
+	request, err := http.NewRequest("POST", "/services/backupsvc/instances/my-backup/backups/b1/restore?:service=backupsvc&:instance=my-backup&:backup=b1", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = restoreServiceInstanceBackup(recorder, request, s.token)
+	c.Assert(err, check.NotNil)
+	e, ok := err.(*errors.HTTP)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(e.Code, check.Equals, http.StatusNotFound)
+	c.Assert(e.Message, check.Equals, service.ErrBackupNotFound.Error())
+}
+
+func (s *ConsumptionSuite) TestScheduleServiceInstanceBackups(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {})
+	defer cleanup()
+	request, err := http.NewRequest("PUT", "/services/backupsvc/instances/my-backup/backups/schedule?:service=backupsvc&:instance=my-backup", strings.NewReader("interval=24h"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	err = scheduleServiceInstanceBackups(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	instance, err := service.GetServiceInstance("backupsvc", "my-backup")
+	c.Assert(err, check.IsNil)
+	c.Assert(instance.BackupInterval, check.Equals, 24*time.Hour)
+	c.Assert(instance.NextBackup.IsZero(), check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("backupsvc", "my-backup"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.backup.schedule",
+		StartCustomData: []map[string]interface{}{
+			{"name": "interval", "value": "24h"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestScheduleServiceInstanceBackupsInvalidInterval(c *check.C) {
+	_, cleanup := s.createBackupInstance(c, func(w http.ResponseWriter, r *http.Request) {})
+	defer cleanup()
+	for _, interval := range []string{"abc", "-1h", "1m"} {
+		request, err := http.NewRequest("PUT", "/services/backupsvc/instances/my-backup/backups/schedule?:service=backupsvc&:instance=my-backup", strings.NewReader("interval="+interval))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		err = scheduleServiceInstanceBackups(recorder, request, s.token)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, check.Equals, true, check.Commentf("interval %q", interval))
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+	}
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceStatusHistory(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/mysql/instances/my-mysql/status/history?:service=mysql&:instance=my-mysql", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstanceStatusHistory(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	now := time.Now().UTC()
+	coll := s.conn.Collection("service_status_history")
+	defer coll.Close()
+	err = coll.Insert(
+		service.HealthEntry{ServiceName: "mysql", InstanceName: "my-mysql", Status: "up", Date: now.Add(-time.Hour)},
+		service.HealthEntry{ServiceName: "mysql", InstanceName: "my-mysql", Status: "down", Date: now},
+		service.HealthEntry{ServiceName: "mysql", Status: "up", Date: now},
+	)
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	err = serviceInstanceStatusHistory(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var entries []service.HealthEntry
+	err = json.Unmarshal(recorder.Body.Bytes(), &entries)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 2)
+	c.Assert(entries[0].Status, check.Equals, "down")
+	c.Assert(entries[1].Status, check.Equals, "up")
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceStatusHistoryUnauthorized(c *check.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "historyuser", permission.Permission{
+		Scheme:  permission.PermServiceInstanceReadEvents,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/services/mysql/instances/my-mysql/status/history?:service=mysql&:instance=my-mysql", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = serviceInstanceStatusHistory(recorder, request, token)
+	c.Assert(err, check.Equals, permission.ErrUnauthorized)
+}
+
+func (s *ConsumptionSuite) TestServiceInfoHandlerFilters(c *check.C) {
+	srv := service.Service{Name: "mongodb", Teams: []string{s.team.Name}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	for _, si := range []service.ServiceInstance{
+		{Name: "cache-small", ServiceName: "mongodb", PlanName: "small", Teams: []string{s.team.Name}},
+		{Name: "cache-big", ServiceName: "mongodb", PlanName: "big", Teams: []string{s.team.Name}},
+		{Name: "sessions", ServiceName: "mongodb", PlanName: "small", Teams: []string{s.team.Name}, Description: "user sessions cache"},
+	} {
+		err = si.Create()
+		c.Assert(err, check.IsNil)
+	}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"plan=small", []string{"cache-small", "sessions"}},
+		{"search=cache", []string{"cache-big", "cache-small", "sessions"}},
+		{"plan=small&search=cache-", []string{"cache-small"}},
+	}
+	for _, tt := range tests {
+		request, err := http.NewRequest("GET", "/services/mongodb?:name=mongodb&"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = serviceInfo(recorder, request, s.token)
+		c.Assert(err, check.IsNil)
+		var instances []map[string]interface{}
+		err = json.Unmarshal(recorder.Body.Bytes(), &instances)
+		c.Assert(err, check.IsNil)
+		var names []string
+		for _, si := range instances {
+			names = append(names, si["Name"].(string))
+		}
+		sort.Strings(names)
+		c.Assert(names, check.DeepEquals, tt.expected, check.Commentf("query %q", tt.query))
+	}
+}
+
+func (s *ConsumptionSuite) TestServicePlansHandlerSearch(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "small", "description": "small database", "limits": {"storage": "1GB"}}, {"name": "big", "description": "big database", "limits": {"storage": "100GB"}}]`))
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "mysql2", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/services/mysql2/plans?:name=mysql2&search=100gb", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = servicePlans(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	var plans []service.Plan
+	err = json.Unmarshal(recorder.Body.Bytes(), &plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []service.Plan{
+		{Name: "big", Description: "big database", Limits: map[string]string{"storage": "100GB"}},
+	})
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyRecordsStatus(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	se := service.Service{Name: "foo", Endpoint: map[string]string{"production": ts.URL}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "foo-instance", ServiceName: "foo", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/services/foo/proxy/foo-instance?:service=foo&:instance=foo-instance&callback=/resources/foo-instance/cache", nil)
+	c.Assert(err, check.IsNil)
+	recorder := &closeNotifierResponseRecorder{httptest.NewRecorder()}
+	err = serviceInstanceProxy(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusAccepted)
+	c.Assert(eventtest.EventDesc{
+		Target: serviceInstanceTarget("foo", "foo-instance"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service-instance.update.proxy",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":service", "value": "foo"},
+			{"name": ":instance", "value": "foo-instance"},
+			{"name": "callback", "value": "/resources/foo-instance/cache"},
+			{"name": "method", "value": "DELETE"},
+		},
+		EndCustomData: map[string]interface{}{
+			"path":   "/resources/foo-instance/cache",
+			"status": http.StatusAccepted,
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyRules(c *check.C) {
+	var proxied []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Method+" "+r.URL.RequestURI())
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:       "foo",
+		Endpoint:   map[string]string{"production": ts.URL},
+		OwnerTeams: []string{"admin-team"},
+		ProxyRules: []service.ProxyRule{
+			{Methods: []string{"GET"}, Path: "/resources/{instance}/stats"},
+			{Path: "/resources/{instance}/*", Admin: true},
+		},
+	}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	si := service.ServiceInstance{Name: "foo-instance", ServiceName: "foo", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "proxyuser", permission.Permission{
+		Scheme:  permission.PermServiceInstanceUpdateProxy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	tests := []struct {
+		method   string
+		callback string
+		err      error
+		code     int
+	}{
+		{"GET", "/resources/foo-instance/stats", nil, 0},
+		{"POST", "/resources/foo-instance/stats", permission.ErrUnauthorized, 0},
+		{"GET", "/resources/other-instance/stats", nil, http.StatusForbidden},
+		{"GET", "/resources/foo-instance/../other-instance/stats", nil, http.StatusForbidden},
+		{"GET", "/resources/foo-instance/stats%3Fverbose%3D1", nil, 0},
+		{"GET", "/resources/foo-instance%252F..%252Fother-instance/stats", nil, http.StatusBadRequest},
+		{"GET", "/resources/foo-instance/%252E%252E/other-instance/stats", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		url := "/services/foo/proxy/foo-instance?:service=foo&:instance=foo-instance&callback=" + tt.callback
+		request, err := http.NewRequest(tt.method, url, nil)
+		c.Assert(err, check.IsNil)
+		recorder := &closeNotifierResponseRecorder{httptest.NewRecorder()}
+		err = serviceInstanceProxy(recorder, request, token)
+		if tt.code != 0 {
+			c.Assert(err, check.NotNil)
+			e, ok := err.(*errors.HTTP)
+			c.Assert(ok, check.Equals, true)
+			c.Assert(e.Code, check.Equals, tt.code)
+		} else {
+			c.Assert(err, check.Equals, tt.err)
+		}
+	}
+	c.Assert(proxied, check.DeepEquals, []string{"GET /resources/foo-instance/stats", "GET /resources/foo-instance/stats?verbose=1"})
+	request, err := http.NewRequest("POST", "/services/foo/proxy/foo-instance?:service=foo&:instance=foo-instance&callback=/resources/foo-instance/stats", nil)
+	c.Assert(err, check.IsNil)
+	recorder := &closeNotifierResponseRecorder{httptest.NewRecorder()}
+	err = serviceInstanceProxy(recorder, request, s.token)
+	c.Assert(err, check.IsNil)
+	c.Assert(proxied, check.DeepEquals, []string{"GET /resources/foo-instance/stats", "GET /resources/foo-instance/stats?verbose=1", "POST /resources/foo-instance/stats"})
+}
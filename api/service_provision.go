@@ -8,11 +8,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/service"
 )
 
@@ -30,6 +34,15 @@ func serviceValidate(s service.Service) error {
 	if endpoint, ok := s.Endpoint["production"]; !ok || endpoint == "" {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Service production endpoint is required"}
 	}
+	switch s.Protocol {
+	case "", service.ProtocolTsuru:
+	case service.ProtocolOSB:
+		if s.BrokerServiceID == "" {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Service broker id is required for Open Service Broker services"}
+		}
+	default:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid service protocol %q", s.Protocol)}
+	}
 	return nil
 }
 
@@ -52,6 +65,7 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if err != nil {
 		return err
 	}
+	services = filterServices(services, r)
 	sInstances, err := service.GetServiceInstancesByServices(services)
 	if err != nil {
 		return err
@@ -59,6 +73,8 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	results := make([]service.ServiceModel, len(services))
 	for i, s := range services {
 		results[i].Service = s.Name
+		results[i].Tags = s.Tags
+		results[i].Categories = s.Categories
 		for _, si := range sInstances {
 			if si.ServiceName == s.Name {
 				results[i].Instances = append(results[i].Instances, si.Name)
@@ -92,23 +108,18 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 //   409: Service already exists
 func serviceCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	s := service.Service{
-		Name:     r.FormValue("id"),
-		Username: r.FormValue("username"),
-		Endpoint: map[string]string{"production": r.FormValue("endpoint")},
-		Password: r.FormValue("password"),
-	}
-	team := r.FormValue("team")
-	if team == "" {
-		team, err = permission.TeamForPermission(t, permission.PermServiceCreate)
-		if err == permission.ErrTooManyTeams {
-			return &errors.HTTP{
-				Code:    http.StatusBadRequest,
-				Message: "You must provide a team responsible for this service in the manifest file.",
-			}
-		}
-		if err != nil {
-			return err
-		}
+		Name:            r.FormValue("id"),
+		Username:        r.FormValue("username"),
+		Endpoint:        map[string]string{"production": r.FormValue("endpoint")},
+		Password:        r.FormValue("password"),
+		Protocol:        r.FormValue("protocol"),
+		BrokerServiceID: r.FormValue("broker-service"),
+	}
+	s.Tags = r.Form["tag"]
+	s.Categories = r.Form["category"]
+	team, err := serviceOwnerTeam(r, t)
+	if err != nil {
+		return err
 	}
 	s.OwnerTeams = []string{team}
 	err = serviceValidate(s)
@@ -146,6 +157,97 @@ func serviceCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 	return nil
 }
 
+func serviceOwnerTeam(r *http.Request, t auth.Token) (string, error) {
+	team := r.FormValue("team")
+	if team != "" {
+		return team, nil
+	}
+	team, err := permission.TeamForPermission(t, permission.PermServiceCreate)
+	if err == permission.ErrTooManyTeams {
+		return "", &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "You must provide a team responsible for this service in the manifest file.",
+		}
+	}
+	return team, err
+}
+
+// title: service broker import
+// path: /services/brokers
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Services created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: All services already exist
+func serviceBrokerImport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	endpoint := r.FormValue("endpoint")
+	if endpoint == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Service broker endpoint is required"}
+	}
+	team, err := serviceOwnerTeam(r, t)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceCreate,
+		permission.Context(permission.CtxTeam, team),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	requestID := context.GetRequestID(r, requestIDHeader)
+	services, err := service.ImportBrokerCatalog(endpoint, r.FormValue("username"), r.FormValue("password"), requestID)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	// Every service is validated before creating any of them, the same way
+	// services are validated in serviceCreate.
+	for i := range services {
+		services[i].OwnerTeams = []string{team}
+		err = serviceValidate(services[i])
+		if err != nil {
+			return err
+		}
+	}
+	delete(r.Form, "password")
+	created := []string{}
+	for i := range services {
+		s := &services[i]
+		err = createBrokerService(s, r, t)
+		if err == service.ErrServiceAlreadyExists {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		created = append(created, s.Name)
+	}
+	if len(created) == 0 && len(services) > 0 {
+		return &errors.HTTP{Code: http.StatusConflict, Message: service.ErrServiceAlreadyExists.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(created)
+}
+
+func createBrokerService(s *service.Service, r *http.Request, t auth.Token) (err error) {
+	evt, err := event.New(&event.Opts{
+		Target:     serviceTarget(s.Name),
+		Kind:       permission.PermServiceCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermServiceReadEvents, contextsForServiceProvision(s)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return s.Create()
+}
+
 // title: service update
 // path: /services/{name}
 // method: PUT
@@ -189,12 +291,34 @@ func serviceUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 		return err
 	}
 	defer func() { evt.Done(err) }()
+	if s.Endpoint["production"] != d.Endpoint["production"] {
+		s.Plans = nil
+		s.PlansUpdatedAt = time.Time{}
+	}
 	s.Endpoint = d.Endpoint
 	s.Password = d.Password
 	s.Username = d.Username
+	// Tags and categories are only replaced when sent, an empty value
+	// clears them.
+	if tags, ok := r.Form["tag"]; ok {
+		s.Tags = nonEmptyValues(tags)
+	}
+	if categories, ok := r.Form["category"]; ok {
+		s.Categories = nonEmptyValues(categories)
+	}
 	return s.Update()
 }
 
+func nonEmptyValues(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // title: service delete
 // path: /services/{name}
 // method: DELETE
@@ -257,6 +381,7 @@ func serviceProxy(w http.ResponseWriter, r *http.Request, t auth.Token) (err err
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
+	path := r.URL.Query().Get("callback")
 	if r.Method != httpMethodGet && r.Method != httpMethodHead {
 		evt, err := event.New(&event.Opts{
 			Target: serviceTarget(s.Name),
@@ -271,9 +396,10 @@ func serviceProxy(w http.ResponseWriter, r *http.Request, t auth.Token) (err err
 		if err != nil {
 			return err
 		}
-		defer func() { evt.Done(err) }()
+		proxyWriter := &proxyResponseWriter{ResponseWriter: w}
+		w = proxyWriter
+		defer func() { evt.DoneCustomData(err, proxyWriter.customData(path)) }()
 	}
-	path := r.URL.Query().Get("callback")
 	return service.Proxy(&s, path, w, r)
 }
 
@@ -412,6 +538,97 @@ func serviceAddDoc(w http.ResponseWriter, r *http.Request, t auth.Token) (err er
 	return s.Update()
 }
 
+// title: change service pools
+// path: /services/{name}/pools
+// consume: application/x-www-form-urlencoded
+// method: PUT
+// responses:
+//   200: Pools updated
+//   400: Invalid pool
+//   401: Unauthorized
+//   404: Service not found
+func serviceSetPools(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	serviceName := r.URL.Query().Get(":name")
+	s, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceUpdatePools,
+		contextsForServiceProvision(&s)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	pools := r.Form["pool"]
+	for _, poolName := range pools {
+		_, err = provision.GetPoolByName(poolName)
+		if err == provision.ErrPoolNotFound {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Pool %q not found.", poolName)}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceTarget(s.Name),
+		Kind:       permission.PermServiceUpdatePools,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermServiceReadEvents, contextsForServiceProvision(&s)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	s.Pools = pools
+	return s.Update()
+}
+
+// title: service proxy rules
+// path: /services/{name}/proxy-rules
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Rules updated
+//   400: Invalid rule
+//   401: Unauthorized
+//   404: Service not found
+func serviceSetProxyRules(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	serviceName := r.URL.Query().Get(":name")
+	s, err := getService(serviceName)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermServiceUpdateProxyRules,
+		contextsForServiceProvision(&s)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var rules []service.ProxyRule
+	for _, value := range r.Form["rule"] {
+		rule, parseErr := service.ParseProxyRule(value)
+		if parseErr != nil {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: parseErr.Error()}
+		}
+		rules = append(rules, rule)
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     serviceTarget(s.Name),
+		Kind:       permission.PermServiceUpdateProxyRules,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermServiceReadEvents, contextsForServiceProvision(&s)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return s.SetProxyRules(rules)
+}
+
 func getService(name string) (service.Service, error) {
 	s := service.Service{Name: name}
 	err := s.Get()
@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"github.com/tsuru/tsuru/service"
 	"golang.org/x/crypto/bcrypt"
@@ -154,6 +155,26 @@ func (s *ProvisionSuite) TestServiceCreate(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *ProvisionSuite) TestServiceCreateWithTagsAndCategories(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("username", "test")
+	v.Set("password", "xxxx")
+	v.Set("endpoint", "someservice.com")
+	v.Set("team", s.team.Name)
+	v["tag"] = []string{"sql", "database"}
+	v.Set("category", "storage")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var rService service.Service
+	err := s.conn.Services().FindId("some_service").One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.Tags, check.DeepEquals, []string{"sql", "database"})
+	c.Assert(rService.Categories, check.DeepEquals, []string{"storage"})
+}
+
 func (s *ProvisionSuite) TestServiceCreateNameExists(c *check.C) {
 	recorder, request := s.makeRequestToCreateHandler(c)
 	s.m.ServeHTTP(recorder, request)
@@ -241,6 +262,150 @@ func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestWithoutId(c *check.C)
 	c.Assert(recorder.Body.String(), check.Equals, "Service id is required\n")
 }
 
+func (s *ProvisionSuite) TestCreateHandlerBrokerService(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "mysql")
+	v.Set("username", "user")
+	v.Set("password", "secret")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.tsuru.io")
+	v.Set("protocol", "osb")
+	v.Set("broker-service", "svc-1")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var rService service.Service
+	err := s.conn.Services().FindId("mysql").One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.Protocol, check.Equals, service.ProtocolOSB)
+	c.Assert(rService.BrokerServiceID, check.Equals, "svc-1")
+}
+
+func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestWithoutBrokerService(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "mysql")
+	v.Set("password", "secret")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "broker.tsuru.io")
+	v.Set("protocol", "osb")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Service broker id is required for Open Service Broker services\n")
+}
+
+func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestWithInvalidProtocol(c *check.C) {
+	v := url.Values{}
+	v.Set("id", "some_service")
+	v.Set("password", "xxxx")
+	v.Set("team", "tsuruteam")
+	v.Set("endpoint", "someservice.com")
+	v.Set("protocol", "soap")
+	recorder, request := s.makeRequest("POST", "/services", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid service protocol \"soap\"\n")
+}
+
+func (s *ProvisionSuite) TestServiceBrokerImport(c *check.C) {
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"services": [
+			{"id": "svc-1", "name": "mysql", "description": "MySQL", "bindable": true, "plans": [{"id": "p1", "name": "small"}]},
+			{"id": "svc-2", "name": "redis", "description": "Redis", "bindable": true, "plans": [{"id": "p2", "name": "small"}]}
+		]}`))
+	}))
+	defer broker.Close()
+	err := s.conn.Services().Insert(service.Service{Name: "redis", OwnerTeams: []string{s.team.Name}})
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("endpoint", broker.URL)
+	v.Set("username", "user")
+	v.Set("password", "secret")
+	v.Set("team", s.team.Name)
+	recorder, request := s.makeRequest("POST", "/1.1/services/brokers", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var created []string
+	err = json.Unmarshal(recorder.Body.Bytes(), &created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created, check.DeepEquals, []string{"mysql"})
+	var rService service.Service
+	err = s.conn.Services().FindId("mysql").One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.Protocol, check.Equals, service.ProtocolOSB)
+	c.Assert(rService.BrokerServiceID, check.Equals, "svc-1")
+	c.Assert(rService.Doc, check.Equals, "MySQL")
+	c.Assert(rService.OwnerTeams, check.DeepEquals, []string{s.team.Name})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceTarget("mysql"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "endpoint", "value": broker.URL},
+			{"name": "username", "value": "user"},
+			{"name": "team", "value": s.team.Name},
+		},
+	}, eventtest.HasEvent)
+	c.Assert(eventtest.EventDesc{
+		Target: serviceTarget("redis"),
+		Kind:   "service.create",
+	}, check.Not(eventtest.HasEvent))
+}
+
+func (s *ProvisionSuite) TestServiceBrokerImportInvalidService(c *check.C) {
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"services": [
+			{"id": "svc-1", "name": "mysql", "description": "MySQL", "bindable": true, "plans": [{"id": "p1", "name": "small"}]}
+		]}`))
+	}))
+	defer broker.Close()
+	v := url.Values{}
+	v.Set("endpoint", broker.URL)
+	v.Set("team", s.team.Name)
+	recorder, request := s.makeRequest("POST", "/1.1/services/brokers", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Service password is required\n")
+	n, err := s.conn.Services().FindId("mysql").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+func (s *ProvisionSuite) TestServiceBrokerImportBrokerError(c *check.C) {
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer broker.Close()
+	v := url.Values{}
+	v.Set("endpoint", broker.URL)
+	v.Set("team", s.team.Name)
+	recorder, request := s.makeRequest("POST", "/1.1/services/brokers", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, "Failed to get broker catalog: broker returned status 401.*")
+}
+
+func (s *ProvisionSuite) TestServiceBrokerImportUnauthorized(c *check.C) {
+	v := url.Values{}
+	v.Set("endpoint", "broker.tsuru.io")
+	v.Set("team", "otherteam")
+	recorder, request := s.makeRequest("POST", "/1.1/services/brokers", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *ProvisionSuite) TestServiceUpdate(c *check.C) {
 	service := service.Service{
 		Name:       "mysqlapi",
@@ -275,6 +440,42 @@ func (s *ProvisionSuite) TestServiceUpdate(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *ProvisionSuite) TestServiceUpdateKeepsTagsAndCategories(c *check.C) {
+	srv := service.Service{
+		Name:       "mysqlapi",
+		Endpoint:   map[string]string{"production": "sqlapi.com"},
+		OwnerTeams: []string{s.team.Name},
+		Password:   "oldold",
+		Tags:       []string{"sql"},
+		Categories: []string{"databases"},
+	}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": srv.Name})
+	v := url.Values{}
+	v.Set("password", "yyyy")
+	v.Set("endpoint", "sqlapi.com")
+	recorder, request := s.makeRequest("PUT", "/services/mysqlapi", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var rService service.Service
+	err = s.conn.Services().FindId(srv.Name).One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.Tags, check.DeepEquals, []string{"sql"})
+	c.Assert(rService.Categories, check.DeepEquals, []string{"databases"})
+	v["tag"] = []string{"mysql", "relational"}
+	v["category"] = []string{""}
+	recorder, request = s.makeRequest("PUT", "/services/mysqlapi", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = s.conn.Services().FindId(srv.Name).One(&rService)
+	c.Assert(err, check.IsNil)
+	c.Assert(rService.Tags, check.DeepEquals, []string{"mysql", "relational"})
+	c.Assert(rService.Categories, check.HasLen, 0)
+}
+
 func (s *ProvisionSuite) TestUpdateHandlerReturnsBadRequestWithoutPassword(c *check.C) {
 	v := url.Values{}
 	v.Set("id", "some_service")
@@ -815,6 +1016,66 @@ func (s *ProvisionSuite) TestAddDoc(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *ProvisionSuite) TestServiceSetPools(c *check.C) {
+	err := provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	se := service.Service{Name: "some_service", OwnerTeams: []string{s.team.Name}}
+	err = se.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	v := url.Values{}
+	v.Add("pool", "pool1")
+	recorder, request := s.makeRequest("PUT", "/1.1/services/some_service/pools", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var serv service.Service
+	err = s.conn.Services().FindId("some_service").One(&serv)
+	c.Assert(err, check.IsNil)
+	c.Assert(serv.Pools, check.DeepEquals, []string{"pool1"})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceTarget("some_service"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service.update.pools",
+		StartCustomData: []map[string]interface{}{
+			{"name": "pool", "value": "pool1"},
+		},
+	}, eventtest.HasEvent)
+	recorder, request = s.makeRequest("PUT", "/1.1/services/some_service/pools", "", c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	serv = service.Service{}
+	err = s.conn.Services().FindId("some_service").One(&serv)
+	c.Assert(err, check.IsNil)
+	c.Assert(serv.Pools, check.IsNil)
+}
+
+func (s *ProvisionSuite) TestServiceSetPoolsInvalidPool(c *check.C) {
+	se := service.Service{Name: "some_service", OwnerTeams: []string{s.team.Name}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	v := url.Values{}
+	v.Add("pool", "unknown")
+	recorder, request := s.makeRequest("PUT", "/1.1/services/some_service/pools", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Pool \"unknown\" not found.\n")
+}
+
+func (s *ProvisionSuite) TestServiceSetPoolsUserHasNoAccess(c *check.C) {
+	se := service.Service{Name: "Mysql"}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	recorder, request := s.makeRequest("PUT", "/1.1/services/Mysql/pools", "pool=pool1", c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *ProvisionSuite) TestAddDocUserHasNoAccess(c *check.C) {
 	se := service.Service{Name: "Mysql"}
 	se.Create()
@@ -826,3 +1087,46 @@ func (s *ProvisionSuite) TestAddDocUserHasNoAccess(c *check.C) {
 	s.m.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
+
+func (s *ProvisionSuite) TestServiceSetProxyRules(c *check.C) {
+	se := service.Service{Name: "mysql", OwnerTeams: []string{s.team.Name}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	v := url.Values{"rule": []string{"GET /resources/{instance}/stats", "* /resources/{instance}/* admin"}}
+	recorder, request := s.makeRequest("PUT", "/services/mysql/proxy-rules", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = se.Get()
+	c.Assert(err, check.IsNil)
+	c.Assert(se.ProxyRules, check.DeepEquals, []service.ProxyRule{
+		{Methods: []string{"GET"}, Path: "/resources/{instance}/stats"},
+		{Path: "/resources/{instance}/*", Admin: true},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: serviceTarget("mysql"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "service.update.proxy-rules",
+		StartCustomData: []map[string]interface{}{
+			{"name": "rule", "value": []string{"GET /resources/{instance}/stats", "* /resources/{instance}/* admin"}},
+		},
+	}, eventtest.HasEvent)
+	recorder, request = s.makeRequest("PUT", "/services/mysql/proxy-rules", "", c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = se.Get()
+	c.Assert(err, check.IsNil)
+	c.Assert(se.ProxyRules, check.IsNil)
+}
+
+func (s *ProvisionSuite) TestServiceSetProxyRulesInvalidRule(c *check.C) {
+	se := service.Service{Name: "mysql", OwnerTeams: []string{s.team.Name}}
+	err := se.Create()
+	c.Assert(err, check.IsNil)
+	v := url.Values{"rule": []string{"/resources"}}
+	recorder, request := s.makeRequest("PUT", "/services/mysql/proxy-rules", v.Encode(), c)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
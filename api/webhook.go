@@ -0,0 +1,244 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func decodeWebhook(r *http.Request) (*webhook.Webhook, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var w webhook.Webhook
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	err = dec.DecodeValues(&w, r.Form)
+	if err != nil {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse webhook: %s", err)}
+	}
+	return &w, nil
+}
+
+func webhookErrorToHTTP(err error) error {
+	switch err {
+	case webhook.ErrWebhookNotFound:
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	case webhook.ErrWebhookAlreadyExists:
+		return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
+}
+
+// title: webhook list
+// path: /events/webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teams, err := permission.ListContextValues(t, permission.PermWebhookRead, false)
+	if err != nil {
+		return err
+	}
+	webhooks, err := webhook.List(teams)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(webhooks)
+}
+
+// title: webhook info
+// path: /events/webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	webhookName := r.URL.Query().Get(":name")
+	wh, err := webhook.Find(webhookName)
+	if err != nil {
+		return webhookErrorToHTTP(err)
+	}
+	if !permission.Check(t, permission.PermWebhookRead,
+		permission.Context(permission.CtxTeam, wh.TeamOwner),
+	) {
+		return permission.ErrUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(wh)
+}
+
+// title: webhook create
+// path: /events/webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook created
+//   400: Invalid webhook
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	if wh.TeamOwner == "" {
+		wh.TeamOwner, err = permission.TeamForPermission(t, permission.PermWebhookCreate)
+		if err != nil {
+			return err
+		}
+	}
+	if !permission.Check(t, permission.PermWebhookCreate,
+		permission.Context(permission.CtxTeam, wh.TeamOwner),
+	) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:       permission.PermWebhookCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, wh.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookErrorToHTTP(webhook.Create(wh))
+}
+
+// title: webhook update
+// path: /events/webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid webhook
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	wh.Name = r.URL.Query().Get(":name")
+	existing, err := webhook.Find(wh.Name)
+	if err != nil {
+		return webhookErrorToHTTP(err)
+	}
+	if wh.TeamOwner == "" {
+		wh.TeamOwner = existing.TeamOwner
+	}
+	if !permission.Check(t, permission.PermWebhookUpdate,
+		permission.Context(permission.CtxTeam, existing.TeamOwner),
+	) || !permission.Check(t, permission.PermWebhookUpdate,
+		permission.Context(permission.CtxTeam, wh.TeamOwner),
+	) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:       permission.PermWebhookUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed: event.Allowed(permission.PermWebhookReadEvents,
+			permission.Context(permission.CtxTeam, existing.TeamOwner),
+			permission.Context(permission.CtxTeam, wh.TeamOwner),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookErrorToHTTP(webhook.Update(wh))
+}
+
+// title: webhook delete
+// path: /events/webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook deleted
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	webhookName := r.URL.Query().Get(":name")
+	wh, err := webhook.Find(webhookName)
+	if err != nil {
+		return webhookErrorToHTTP(err)
+	}
+	if !permission.Check(t, permission.PermWebhookDelete,
+		permission.Context(permission.CtxTeam, wh.TeamOwner),
+	) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:       permission.PermWebhookDelete,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookReadEvents, permission.Context(permission.CtxTeam, wh.TeamOwner)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookErrorToHTTP(webhook.Delete(wh.Name))
+}
+
+// title: webhook deliveries
+// path: /events/webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   404: Webhook not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	webhookName := r.URL.Query().Get(":name")
+	wh, err := webhook.Find(webhookName)
+	if err != nil {
+		return webhookErrorToHTTP(err)
+	}
+	if !permission.Check(t, permission.PermWebhookRead,
+		permission.Context(permission.CtxTeam, wh.TeamOwner),
+	) {
+		return permission.ErrUnauthorized
+	}
+	deliveries, err := webhook.ListDeliveries(wh.Name)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
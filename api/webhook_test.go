@@ -0,0 +1,231 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestWebhookList(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(&webhook.Webhook{Name: "wh2", TeamOwner: "otherteam", URL: "http://b.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	req, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result []webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.HasLen, 1)
+	c.Assert(result[0].Name, check.Equals, "wh1")
+}
+
+func (s *S) TestWebhookListEmpty(c *check.C) {
+	token := userWithPermission(c)
+	req, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestWebhookInfo(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("GET", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var result webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com", Method: "POST"})
+}
+
+func (s *S) TestWebhookInfoNotFound(c *check.C) {
+	req, err := http.NewRequest("GET", "/events/webhooks/unknown", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookCreate(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("name=wh1&url=http://a.com/hook&method=PUT&eventfilter.kindnames.0=app.deploy&headers.X-Token.0=abc")
+	req, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("%s", recorder.Body.String()))
+	wh, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(wh.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(wh.URL, check.Equals, "http://a.com/hook")
+	c.Assert(wh.Method, check.Equals, "PUT")
+	c.Assert(wh.EventFilter.KindNames, check.DeepEquals, []string{"app.deploy"})
+	c.Assert(wh.Headers.Get("X-Token"), check.Equals, "abc")
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "wh1"},
+			{"name": "url", "value": "http://a.com/hook"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookCreateInvalid(c *check.C) {
+	body := strings.NewReader("name=wh1&url=ftp://a.com&teamowner=" + s.team.Name)
+	req, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "webhook url must be a valid http or https url\n")
+}
+
+func (s *S) TestWebhookCreateAlreadyExists(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=wh1&url=http://b.com&teamowner=" + s.team.Name)
+	req, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestWebhookCreateUnauthorized(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	body := strings.NewReader("name=wh1&url=http://a.com&teamowner=" + s.team.Name)
+	req, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookUpdate(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("url=http://b.com&eventfilter.erroronly=true")
+	req, err := http.NewRequest("PUT", "/events/webhooks/wh1", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("%s", recorder.Body.String()))
+	wh, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(wh.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(wh.URL, check.Equals, "http://b.com")
+	c.Assert(wh.EventFilter.ErrorOnly, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "webhook.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": "url", "value": "http://b.com"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookUpdateNotFound(c *check.C) {
+	body := strings.NewReader("url=http://b.com")
+	req, err := http.NewRequest("PUT", "/events/webhooks/unknown", body)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookDelete(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookDelete,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	req, err := http.NewRequest("DELETE", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Find("wh1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.delete",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookDeleteUnauthorized(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookDelete,
+		Context: permission.Context(permission.CtxTeam, "otherteam"),
+	})
+	req, err := http.NewRequest("DELETE", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookDeliveriesEmpty(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", TeamOwner: s.team.Name, URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("GET", "/events/webhooks/wh1/deliveries", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, req)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
@@ -224,11 +224,13 @@ var addRouterBackend = action.Action{
 		if err != nil {
 			return nil, err
 		}
+		span := router.StartSpan(ctx.Span, "AddBackend", app.GetName())
 		if optsRouter, ok := r.(router.OptsRouter); ok {
 			err = optsRouter.AddBackendOpts(app.GetName(), app.GetRouterOpts())
 		} else {
 			err = r.AddBackend(app.GetName())
 		}
+		span.FinishWithError(err)
 		return app, err
 	},
 	Backward: func(ctx action.BWContext) {
@@ -238,7 +240,9 @@ var addRouterBackend = action.Action{
 			log.Errorf("[add-router-backend rollback] unable to get app router: %s", err)
 			return
 		}
+		span := router.StartSpan(ctx.Span, "RemoveBackend", app.GetName())
 		err = r.RemoveBackend(app.GetName())
+		span.FinishWithError(err)
 		if err != nil {
 			log.Errorf("[add-router-backend rollback] unable to remove router backend: %s", err)
 		}
@@ -581,7 +585,9 @@ var setNewCNamesToProvisioner = action.Action{
 		}
 		var cnamesDone []string
 		for _, cname := range cnames {
+			span := router.StartSpan(ctx.Span, "SetCName", app.Name).SetTag("router.cname", cname)
 			err := cnameRouter.SetCName(cname, app.Name)
+			span.FinishWithError(err)
 			if err != nil {
 				for _, c := range cnamesDone {
 					cnameRouter.UnsetCName(c, app.Name)
@@ -711,7 +717,9 @@ var unsetCNameFromProvisioner = action.Action{
 		}
 		var cnamesDone []string
 		for _, cname := range cnames {
+			span := router.StartSpan(ctx.Span, "UnsetCName", app.Name).SetTag("router.cname", cname)
 			err := cnameRouter.UnsetCName(cname, app.Name)
+			span.FinishWithError(err)
 			if err != nil {
 				for _, c := range cnamesDone {
 					cnameRouter.SetCName(c, app.Name)
@@ -29,6 +29,7 @@ import (
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -122,11 +123,21 @@ type App struct {
 	Pool           string
 	Description    string
 	RouterOpts     map[string]string
+	LogDrains      []LogDrain   `bson:"log_drains,omitempty"`
+	LogLimits      AppLogLimits `bson:"log_limits,omitempty"`
+	// Span is the span of the operation changing the app, like an API
+	// request, parent of the pipelines run on the app.
+	Span *tracing.Span `bson:"-" json:"-"`
 
 	quota.Quota
 	provisioner provision.Provisioner
 }
 
+// TraceSpan returns the span of the operation changing the app.
+func (app *App) TraceSpan() *tracing.Span {
+	return app.Span
+}
+
 func (app *App) getProvisioner() (provision.Provisioner, error) {
 	if app.provisioner == nil {
 		if app.Pool == "" {
@@ -179,6 +190,17 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	result["teamowner"] = app.TeamOwner
 	result["plan"] = app.Plan
 	result["lock"] = app.Lock
+	if len(app.LogDrains) > 0 {
+		drains := make([]LogDrain, len(app.LogDrains))
+		for i, d := range app.LogDrains {
+			d.URL = d.DisplayURL()
+			drains[i] = d
+		}
+		result["logDrains"] = drains
+	}
+	if app.LogLimits != (AppLogLimits{}) {
+		result["logLimits"] = app.LogLimits
+	}
 	return json.Marshal(&result)
 }
 
@@ -189,6 +211,11 @@ type Applog struct {
 	Source  string
 	AppName string
 	Unit    string
+	// Level is the severity level of structured logs, e.g. "error".
+	Level string `bson:",omitempty" json:",omitempty"`
+	// Fields holds the remaining fields of structured logs, messages
+	// written by the app as JSON objects.
+	Fields map[string]interface{} `bson:",omitempty" json:",omitempty"`
 }
 
 // AcquireApplicationLock acquires an application lock by setting the lock
@@ -303,7 +330,7 @@ func CreateApp(app *App, user *auth.User) error {
 		&setAppIp,
 	}
 	pipeline := action.NewPipeline(actions...)
-	err = pipeline.Execute(app, user)
+	err = pipeline.ExecuteWithSpan(app.Span.Context(), app, user)
 	if err != nil {
 		return &AppCreationError{app: app.Name, Err: err}
 	}
@@ -344,7 +371,7 @@ func (app *App) Update(updateData App, w io.Writer) error {
 			&restartApp,
 			&removeOldBackend,
 		}
-		err = action.NewPipeline(actions...).Execute(app, &oldPlan, w)
+		err = action.NewPipeline(actions...).ExecuteWithSpan(app.Span.Context(), app, &oldPlan, w)
 		if err != nil {
 			return err
 		}
@@ -380,7 +407,7 @@ func (app *App) unbind() error {
 		msg += fmt.Sprintf("- %s (%s)", instanceName, reason.Error())
 	}
 	for _, instance := range instances {
-		err = instance.UnbindApp(app, true, nil)
+		err = instance.UnbindApp(app, true, nil, "")
 		if err != nil {
 			addMsg(instance.Name, err)
 		}
@@ -454,13 +481,12 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to release app quota", err)
 	}
-	logConn, err := db.LogConn()
+	logStorage, err := logStorageForPool(app.Pool)
 	if err == nil {
-		defer logConn.Close()
-		err = logConn.Logs(appName).DropCollection()
+		err = logStorage.Remove(appName)
 	}
 	if err != nil {
-		logErr("Unable to remove logs collection", err)
+		logErr("Unable to remove logs", err)
 	}
 	conn, err := db.Conn()
 	if err == nil {
@@ -541,7 +567,7 @@ func (app *App) AddUnits(n uint, process string, writer io.Writer) error {
 	err := action.NewPipeline(
 		&reserveUnitsToAdd,
 		&provisionAddUnits,
-	).Execute(app, n, writer, process)
+	).ExecuteWithSpan(app.Span.Context(), app, n, writer, process)
 	rebuild.RoutesRebuildOrEnqueue(app.Name)
 	return err
 }
@@ -1222,7 +1248,7 @@ func (app *App) AddCName(cnames ...string) error {
 		&saveCNames,
 		&updateApp,
 	}
-	err := action.NewPipeline(actions...).Execute(app, cnames)
+	err := action.NewPipeline(actions...).ExecuteWithSpan(app.Span.Context(), app, cnames)
 	rebuild.RoutesRebuildOrEnqueue(app.Name)
 	return err
 }
@@ -1234,7 +1260,7 @@ func (app *App) RemoveCName(cnames ...string) error {
 		&removeCNameFromDatabase,
 		&removeCNameFromApp,
 	}
-	err := action.NewPipeline(actions...).Execute(app, cnames)
+	err := action.NewPipeline(actions...).ExecuteWithSpan(app.Span.Context(), app, cnames)
 	rebuild.RoutesRebuildOrEnqueue(app.Name)
 	return err
 }
@@ -1387,7 +1413,7 @@ func (app *App) RemoveInstance(instanceApp bind.InstanceApp, writer io.Writer) e
 // user can filter where the message come from.
 func (app *App) Log(message, source, unit string) error {
 	messages := strings.Split(message, "\n")
-	logs := make([]interface{}, 0, len(messages))
+	logs := make([]*Applog, 0, len(messages))
 	for _, msg := range messages {
 		if msg != "" {
 			l := Applog{
@@ -1397,24 +1423,46 @@ func (app *App) Log(message, source, unit string) error {
 				AppName: app.Name,
 				Unit:    unit,
 			}
-			logs = append(logs, l)
+			l.parseStructured()
+			logs = append(logs, &l)
 		}
 	}
-	if len(logs) > 0 {
-		notify(app.Name, logs)
-		conn, err := db.LogConn()
-		if err != nil {
-			return err
-		}
-		defer conn.Close()
-		return conn.Logs(app.Name).Insert(logs...)
+	return app.writeLogs(logs)
+}
+
+// writeLogs publishes the logs to the listeners and drains of the app and
+// stores them.
+func (app *App) writeLogs(logs []*Applog) error {
+	if len(logs) == 0 {
+		return nil
 	}
-	return nil
+	notifyLogs := make([]interface{}, len(logs))
+	for i := range logs {
+		notifyLogs[i] = logs[i]
+	}
+	notify(app.Name, notifyLogs)
+	logDrains.forward(app.Name, logs...)
+	logStorage, err := logStorageForPool(app.Pool)
+	if err != nil {
+		return err
+	}
+	return logStorage.Insert(app.Name, logs...)
 }
 
 // LastLogs returns a list of the last `lines` log of the app, matching the
-// fields in the log instance received as an example.
+// fields in the log instance received as an example. The level and each of
+// the fields in the example must match the structured fields of the logs.
 func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+	return app.SearchLogs(newLogFilter(&filterLog, lines))
+}
+
+// SearchLogs returns the last filter.Lines logs of the app matching the
+// filter, from the log storage configured for the pool of the app.
+func (app *App) SearchLogs(filter *LogFilter) ([]Applog, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
 	prov, err := app.getProvisioner()
 	if err != nil {
 		return nil, err
@@ -1431,28 +1479,11 @@ func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
 			return nil, stderr.New(doc)
 		}
 	}
-	conn, err := db.LogConn()
+	logStorage, err := logStorageForPool(app.Pool)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
-	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
-	if err != nil {
-		return nil, err
-	}
-	l := len(logs)
-	for i := 0; i < l/2; i++ {
-		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
-	}
-	return logs, nil
+	return logStorage.List(app.Name, filter)
 }
 
 type Filter struct {
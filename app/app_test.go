@@ -32,6 +32,7 @@ import (
 	"github.com/tsuru/tsuru/router/routertest"
 	"github.com/tsuru/tsuru/safe"
 	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/tracing"
 	"github.com/tsuru/tsuru/tsurutest"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
@@ -505,6 +506,34 @@ func (s *S) TestAddUnits(c *check.C) {
 	}
 }
 
+func (s *S) TestAddUnitsTracing(c *check.C) {
+	exporter := &tracing.RecordingExporter{}
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+	request := tracing.StartSpan("PUT /apps/{app}/units", tracing.SpanContext{})
+	app := App{
+		Name: "warpaint", Platform: "python",
+		Quota:     quota.Unlimited,
+		TeamOwner: s.team.Name,
+		Span:      request,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	var pipelines []*tracing.SpanData
+	for _, span := range exporter.Spans() {
+		if span.Operation == "pipeline" {
+			pipelines = append(pipelines, span)
+		}
+	}
+	c.Assert(pipelines, check.HasLen, 2)
+	for _, span := range pipelines {
+		c.Assert(span.Context.TraceID, check.Equals, request.Context().TraceID)
+		c.Assert(span.ParentID, check.Equals, request.Context().SpanID)
+	}
+}
+
 func (s *S) TestAddUnitsWithWriter(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "python",
@@ -2357,6 +2386,34 @@ func (s *S) TestLastLogsUnitFilter(c *check.C) {
 	}
 }
 
+func (s *S) TestLastLogsLevelAndFieldFilter(c *check.C) {
+	app := App{
+		Name:     "app3",
+		Platform: "vougan",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	app.Log(`{"level": "info", "msg": "request done", "status": 200}`, "app", "rdaneel")
+	app.Log(`{"level": "ERROR", "msg": "request failed", "status": 500}`, "app", "rdaneel")
+	app.Log(`{"severity": "error", "message": "db down", "component": "db"}`, "app", "rdaneel")
+	app.Log("plain error", "app", "rdaneel")
+	logs, err := app.LastLogs(10, Applog{Level: "error"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "request failed")
+	c.Assert(logs[1].Message, check.Equals, "db down")
+	logs, err = app.LastLogs(10, Applog{Level: "error", Fields: map[string]interface{}{"status": "500"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "request failed")
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]interface{}{"status": float64(500)})
+	logs, err = app.LastLogs(10, Applog{Fields: map[string]interface{}{"component": "db"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "db down")
+}
+
 func (s *S) TestLastLogsEmpty(c *check.C) {
 	app := App{
 		Name:     "app33",
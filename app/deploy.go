@@ -15,6 +15,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router/rebuild"
@@ -208,6 +209,8 @@ func (o *DeployOptions) GetKind() (kind DeployKind) {
 // Deploy runs a deployment of an application. It will first try to run an
 // archive based deploy (if opts.ArchiveURL is not empty), and then fallback to
 // the Git based deployment.
+var deployDuration = metrics.NewHistogram("tsuru_deploy_duration_seconds", "Duration of deploys, by kind and status.", metrics.LongBuckets, "kind", "status")
+
 func Deploy(opts DeployOptions) (string, error) {
 	if opts.Event == nil {
 		return "", fmt.Errorf("missing event in deploy opts")
@@ -231,7 +234,9 @@ func Deploy(opts DeployOptions) (string, error) {
 	logWriter.Async()
 	defer logWriter.Close()
 	opts.Event.SetLogWriter(io.MultiWriter(&tsuruIo.NoErrorWriter{Writer: opts.OutputStream}, &logWriter))
+	start := time.Now()
 	imageId, err := deployToProvisioner(&opts, opts.Event)
+	deployDuration.Observe(time.Since(start).Seconds(), string(opts.GetKind()), metrics.Status(err))
 	rebuild.RoutesRebuildOrEnqueue(opts.App.Name)
 	if err != nil {
 		return "", err
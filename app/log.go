@@ -7,16 +7,35 @@ package app
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/queue"
 )
 
 var LogPubSubQueuePrefix = "pubsub:"
 var bulkMaxWaitTime = time.Second
 
+// logBacklog counts the logs received by all the dispatchers and not yet
+// published.
+var logBacklog int64
+
+func init() {
+	metrics.NewGaugeFunc("tsuru_log_dispatcher_backlog", "Number of app logs waiting to be dispatched.", func() float64 {
+		return float64(atomic.LoadInt64(&logBacklog))
+	})
+}
+
+var (
+	logLevelKeys   = []string{"level", "severity", "lvl"}
+	logMessageKeys = []string{"msg", "message"}
+	logLevelAlias  = map[string]string{"warning": "warn", "err": "error"}
+)
+
 type LogListener struct {
 	c <-chan Applog
 	q queue.PubSubQ
@@ -27,6 +46,26 @@ func logQueueName(appName string) string {
 }
 
 func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
+	return NewFilteredLogListener(a, newLogFilter(&filterLog, 0))
+}
+
+// NewFilteredLogListener returns a listener of the new logs of the app
+// matching the filter. The date range, the cursor and the number of lines
+// of the filter are ignored.
+func NewFilteredLogListener(a *App, filter *LogFilter) (*LogListener, error) {
+	filter = &LogFilter{
+		Source: filter.Source,
+		Unit:   filter.Unit,
+		Level:  filter.Level,
+		Fields: filter.Fields,
+		Text:   filter.Text,
+		Grep:   filter.Grep,
+		Invert: filter.Invert,
+	}
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
 	factory, err := queue.Factory()
 	if err != nil {
 		return nil, err
@@ -49,8 +88,7 @@ func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
 				log.Errorf("Unparsable log message, ignoring: %s", string(msg))
 				continue
 			}
-			if (filterLog.Source == "" || filterLog.Source == applog.Source) &&
-				(filterLog.Unit == "" || filterLog.Unit == applog.Unit) {
+			if filter.matches(&applog) {
 				c <- applog
 			}
 		}
@@ -121,8 +159,10 @@ func NewlogDispatcher(chanSize, numberGoroutines int) *logDispatcher {
 func (d *logDispatcher) runWriter() {
 	notifyMessages := make([]interface{}, 1)
 	for msgWithDispatcher := range d.msgCh {
+		atomic.AddInt64(&logBacklog, -1)
 		notifyMessages[0] = msgWithDispatcher.msg
 		notify(msgWithDispatcher.msg.AppName, notifyMessages)
+		logDrains.forward(msgWithDispatcher.msg.AppName, msgWithDispatcher.msg)
 		select {
 		case msgWithDispatcher.dispatcher.toFlush <- msgWithDispatcher.msg:
 		case <-msgWithDispatcher.dispatcher.done:
@@ -131,7 +171,13 @@ func (d *logDispatcher) runWriter() {
 	}
 }
 
+// Send queues the log to be published and stored, unless the app exceeded
+// the log limits of its plan, in which case the log is dropped.
 func (d *logDispatcher) Send(msg *Applog) {
+	msg.parseStructured()
+	if !logLimiters.allow(msg) {
+		return
+	}
 	appName := msg.AppName
 	appD, ok := d.dispatchers[appName]
 	if !ok {
@@ -139,6 +185,7 @@ func (d *logDispatcher) Send(msg *Applog) {
 		d.dispatchers[appName] = appD
 	}
 	msgWithDispatcher := &msgLog{dispatcher: appD, msg: msg}
+	atomic.AddInt64(&logBacklog, 1)
 	d.msgCh <- msgWithDispatcher
 }
 
@@ -148,12 +195,18 @@ func (d *logDispatcher) Stop() {
 		close(appD.done)
 	}
 	close(d.msgCh)
+	// Writers stop once the dispatchers are done, the logs left behind are
+	// discarded.
+	for range d.msgCh {
+		atomic.AddInt64(&logBacklog, -1)
+	}
 }
 
 type appLogDispatcher struct {
 	appName string
 	done    chan bool
 	toFlush chan *Applog
+	storage LogStorage
 }
 
 func newAppLogDispatcher(appName string) *appLogDispatcher {
@@ -170,7 +223,7 @@ func (d *appLogDispatcher) runFlusher() {
 	t := time.NewTimer(bulkMaxWaitTime)
 	pos := 0
 	sz := 200
-	bulkBuffer := make([]interface{}, sz)
+	bulkBuffer := make([]*Applog, sz)
 	for {
 		var flush bool
 		select {
@@ -189,14 +242,15 @@ func (d *appLogDispatcher) runFlusher() {
 			t.Reset(bulkMaxWaitTime)
 		}
 		if flush {
-			conn, err := db.LogConn()
-			if err != nil {
-				log.Errorf("[log flusher] unable to connect to mongodb: %s", err)
-				continue
+			if d.storage == nil {
+				storage, err := logStorageForApp(d.appName)
+				if err != nil {
+					log.Errorf("[log flusher] unable to get log storage: %s", err)
+					continue
+				}
+				d.storage = storage
 			}
-			coll := conn.Logs(d.appName)
-			err = coll.Insert(bulkBuffer[:pos]...)
-			coll.Close()
+			err := d.storage.Insert(d.appName, bulkBuffer[:pos]...)
 			if err != nil {
 				log.Errorf("[log flusher] unable to insert logs: %s", err)
 				continue
@@ -205,3 +259,87 @@ func (d *appLogDispatcher) runFlusher() {
 		}
 	}
 }
+
+// parseStructured detects messages written as JSON objects, extracting the
+// severity level and the message from them and keeping the remaining keys as
+// fields. Messages that aren't JSON objects are left untouched.
+func (l *Applog) parseStructured() {
+	if l.Level != "" {
+		l.Level = normalizeLogLevel(l.Level)
+	}
+	msg := strings.TrimSpace(l.Message)
+	if l.Fields != nil || !strings.HasPrefix(msg, "{") {
+		return
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(msg), &fields) != nil {
+		return
+	}
+	for _, key := range logLevelKeys {
+		if level, ok := fields[key].(string); ok {
+			delete(fields, key)
+			if l.Level == "" {
+				l.Level = normalizeLogLevel(level)
+			}
+			break
+		}
+	}
+	for _, key := range logMessageKeys {
+		if message, ok := fields[key].(string); ok {
+			delete(fields, key)
+			l.Message = message
+			break
+		}
+	}
+	if len(fields) > 0 {
+		l.Fields = sanitizeLogFields(fields).(map[string]interface{})
+	}
+}
+
+func normalizeLogLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if alias, ok := logLevelAlias[level]; ok {
+		return alias
+	}
+	return level
+}
+
+// sanitizeLogFields replaces the characters not allowed in the keys of
+// documents stored in mongodb.
+func sanitizeLogFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(v))
+		for key, fieldValue := range v {
+			key = strings.Replace(key, ".", "_", -1)
+			if strings.HasPrefix(key, "$") {
+				key = "_" + key[1:]
+			}
+			sanitized[key] = sanitizeLogFields(fieldValue)
+		}
+		return sanitized
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitizeLogFields(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+// logFieldValues returns the values matching a field filter, filters given as
+// strings also match numbers and booleans with the same representation.
+func logFieldValues(value interface{}) []interface{} {
+	values := []interface{}{value}
+	str, ok := value.(string)
+	if !ok {
+		return values
+	}
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		values = append(values, f)
+	}
+	if str == "true" || str == "false" {
+		values = append(values, str == "true")
+	}
+	return values
+}
@@ -258,3 +258,48 @@ loop:
 	}
 	dispatcher.Stop()
 }
+
+func (s *S) TestApplogParseStructured(c *check.C) {
+	l := Applog{Message: `{"level": "Warning", "msg": "slow request", "path": "/", "user.id": 7, "req": {"$id": "x"}}`}
+	l.parseStructured()
+	c.Assert(l.Level, check.Equals, "warn")
+	c.Assert(l.Message, check.Equals, "slow request")
+	c.Assert(l.Fields, check.DeepEquals, map[string]interface{}{
+		"path":    "/",
+		"user_id": float64(7),
+		"req":     map[string]interface{}{"_id": "x"},
+	})
+	l = Applog{Message: `{"lvl": "debug"}`}
+	l.parseStructured()
+	c.Assert(l.Level, check.Equals, "debug")
+	c.Assert(l.Message, check.Equals, `{"lvl": "debug"}`)
+	c.Assert(l.Fields, check.IsNil)
+	for _, msg := range []string{"plain message", "{not json", `{"level": "info"} trailing`} {
+		l = Applog{Message: msg}
+		l.parseStructured()
+		c.Assert(l, check.DeepEquals, Applog{Message: msg})
+	}
+}
+
+func (s *S) TestLogFilterMatches(c *check.C) {
+	now := time.Now()
+	l := Applog{
+		Date:    now,
+		Message: "Request failed",
+		Source:  "app",
+		Unit:    "u1",
+		Level:   "error",
+		Fields:  map[string]interface{}{"status": float64(500)},
+	}
+	c.Assert((&LogFilter{}).matches(&l), check.Equals, true)
+	c.Assert((&LogFilter{Source: "app", Level: "ERR"}).matches(&l), check.Equals, true)
+	c.Assert((&LogFilter{Fields: map[string]interface{}{"status": "500"}}).matches(&l), check.Equals, true)
+	c.Assert((&LogFilter{Since: now, Until: now, Text: "request"}).matches(&l), check.Equals, true)
+	c.Assert((&LogFilter{Level: "info"}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Unit: "u2"}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Fields: map[string]interface{}{"status": "200"}}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Fields: map[string]interface{}{"path": "/"}}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Since: now.Add(time.Second)}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Until: now.Add(-time.Second)}).matches(&l), check.Equals, false)
+	c.Assert((&LogFilter{Text: "done"}).matches(&l), check.Equals, false)
+}
@@ -0,0 +1,582 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	LogDrainFormatJSON   = "json"
+	LogDrainFormatNDJSON = "ndjson"
+
+	defaultLogDrainBufferSize = 1000
+	logDrainBatchSize         = 100
+	logDrainRefreshInterval   = 30 * time.Second
+	logDrainStatusInterval    = 10 * time.Second
+	logDrainMinBackoff        = time.Second
+	logDrainMaxBackoff        = time.Minute
+	logDrainDialTimeout       = 5 * time.Second
+	logDrainWriteTimeout      = 10 * time.Second
+)
+
+var (
+	ErrLogDrainAlreadyExists = errors.New("log drain already exists")
+	ErrLogDrainNotFound      = errors.New("log drain not found")
+
+	logDrainBatchWaitTime = time.Second
+	logDrains             = &logDrainManager{}
+)
+
+// LogDrain forwards the logs of an app to an external destination. The URL
+// scheme selects the protocol: syslog+tcp, syslog+udp and syslog+tls send
+// RFC 5424 messages, while http and https post batches of logs encoded in
+// Format, either a JSON array or newline delimited JSON.
+type LogDrain struct {
+	URL    string `json:"url"`
+	Format string `bson:",omitempty" json:"format,omitempty"`
+	// LastError and LastErrorAt describe the last failure forwarding logs
+	// to the drain, and Dropped counts the logs discarded because the
+	// drain couldn't keep up with the app.
+	LastError   string    `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	LastErrorAt time.Time `bson:"last_error_at,omitempty" json:"lastErrorAt,omitempty"`
+	Dropped     int64     `bson:",omitempty" json:"dropped,omitempty"`
+}
+
+// Validate checks the URL and the format of the drain, setting the default
+// format of HTTP drains.
+func (d *LogDrain) Validate() error {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid log drain URL %q", d.URL)
+	}
+	switch u.Scheme {
+	case "syslog+tcp", "syslog+udp", "syslog+tls":
+		if d.Format != "" {
+			return fmt.Errorf("syslog log drains don't support formats")
+		}
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return fmt.Errorf("invalid log drain URL %q: the port is required", d.URL)
+		}
+	case "http", "https":
+		if d.Format == "" {
+			d.Format = LogDrainFormatJSON
+		}
+		if d.Format != LogDrainFormatJSON && d.Format != LogDrainFormatNDJSON {
+			return fmt.Errorf("invalid log drain format %q, expected %q or %q", d.Format, LogDrainFormatJSON, LogDrainFormatNDJSON)
+		}
+	default:
+		return fmt.Errorf("invalid log drain URL %q: unsupported scheme %q", d.URL, u.Scheme)
+	}
+	return nil
+}
+
+// DisplayURL returns the URL of the drain without the password it may
+// contain, so it's safe to show to users and to store in events.
+func (d *LogDrain) DisplayURL() string {
+	u, err := url.Parse(d.URL)
+	if err != nil || u.User == nil {
+		return d.URL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// AddLogDrain adds a drain forwarding the logs of the app.
+func (app *App) AddLogDrain(drain LogDrain) error {
+	err := drain.Validate()
+	if err != nil {
+		return err
+	}
+	drain.LastError, drain.LastErrorAt, drain.Dropped = "", time.Time{}, 0
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "log_drains.url": bson.M{"$ne": drain.URL}},
+		bson.M{"$push": bson.M{"log_drains": drain}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrLogDrainAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+	app.LogDrains = append(app.LogDrains, drain)
+	logDrains.reload(app.Name)
+	return nil
+}
+
+// RemoveLogDrain removes the drain with the given URL from the app.
+func (app *App) RemoveLogDrain(drainURL string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(
+		bson.M{"name": app.Name, "log_drains.url": drainURL},
+		bson.M{"$pull": bson.M{"log_drains": bson.M{"url": drainURL}}},
+	)
+	if err == mgo.ErrNotFound {
+		return ErrLogDrainNotFound
+	}
+	if err != nil {
+		return err
+	}
+	for i, d := range app.LogDrains {
+		if d.URL == drainURL {
+			app.LogDrains = append(app.LogDrains[:i], app.LogDrains[i+1:]...)
+			break
+		}
+	}
+	logDrains.reload(app.Name)
+	return nil
+}
+
+// logDrainWriter sends batches of logs to a drain.
+type logDrainWriter interface {
+	write(logs []*Applog) error
+	close()
+}
+
+func newLogDrainWriter(drain *LogDrain) (logDrainWriter, error) {
+	u, err := url.Parse(drain.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "syslog+tcp", "syslog+udp", "syslog+tls":
+		return &syslogDrainWriter{network: u.Scheme[len("syslog+"):], addr: u.Host}, nil
+	case "http", "https":
+		return &httpDrainWriter{url: drain.URL, format: drain.Format, client: tsuruNet.Dial5Full60ClientNoKeepAlive}, nil
+	}
+	return nil, fmt.Errorf("unsupported log drain scheme %q", u.Scheme)
+}
+
+type syslogDrainWriter struct {
+	network string
+	addr    string
+	conn    net.Conn
+}
+
+// syslogSeverities maps log levels to syslog severities, logs without level
+// are sent as notice.
+var syslogSeverities = map[string]int{
+	"emerg":    0,
+	"alert":    1,
+	"crit":     2,
+	"critical": 2,
+	"fatal":    2,
+	"error":    3,
+	"warn":     4,
+	"notice":   5,
+	"info":     6,
+	"debug":    7,
+	"trace":    7,
+}
+
+// formatSyslog formats the log as a RFC 5424 message, using the user-level
+// facility. The app is the hostname, the source is the app-name and the unit
+// is the procid.
+func formatSyslog(l *Applog) string {
+	severity, ok := syslogSeverities[l.Level]
+	if !ok {
+		severity = 5
+	}
+	nilValue := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		8+severity,
+		l.Date.UTC().Format(time.RFC3339Nano),
+		nilValue(l.AppName),
+		nilValue(l.Source),
+		nilValue(l.Unit),
+		l.Message,
+	)
+}
+
+func (w *syslogDrainWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: logDrainDialTimeout}
+	if w.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", w.addr, &tls.Config{})
+	}
+	return dialer.Dial(w.network, w.addr)
+}
+
+func (w *syslogDrainWriter) write(logs []*Applog) error {
+	if w.conn == nil {
+		conn, err := w.dial()
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(logDrainWriteTimeout))
+	var err error
+	if w.network == "udp" {
+		for _, l := range logs {
+			if _, err = w.conn.Write([]byte(formatSyslog(l))); err != nil {
+				break
+			}
+		}
+	} else {
+		// TCP and TLS transports use octet counting framing, as described
+		// in RFC 6587.
+		var buf bytes.Buffer
+		for _, l := range logs {
+			msg := formatSyslog(l)
+			fmt.Fprintf(&buf, "%d %s", len(msg), msg)
+		}
+		_, err = w.conn.Write(buf.Bytes())
+	}
+	if err != nil {
+		w.close()
+	}
+	return err
+}
+
+func (w *syslogDrainWriter) close() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+type httpDrainWriter struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+func (w *httpDrainWriter) write(logs []*Applog) error {
+	var body bytes.Buffer
+	contentType := "application/json"
+	if w.format == LogDrainFormatNDJSON {
+		contentType = "application/x-ndjson"
+		encoder := json.NewEncoder(&body)
+		for _, l := range logs {
+			if err := encoder.Encode(l); err != nil {
+				return err
+			}
+		}
+	} else if err := json.NewEncoder(&body).Encode(logs); err != nil {
+		return err
+	}
+	rsp, err := w.client.Post(w.url, contentType, &body)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("log drain returned status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+func (w *httpDrainWriter) close() {}
+
+// logDrainSender forwards the logs of an app to one of its drains. Logs are
+// buffered up to a limit, and dropped while the drain can't keep up, backing
+// off after each failure. While failing, the batch is kept and its oldest logs
+// are dropped to make room for new ones.
+type logDrainSender struct {
+	appName string
+	drain   LogDrain
+	writer  logDrainWriter
+	ch      chan *Applog
+	done    chan struct{}
+	dropped int64
+}
+
+func newLogDrainSender(appName string, drain LogDrain) (*logDrainSender, error) {
+	writer, err := newLogDrainWriter(&drain)
+	if err != nil {
+		return nil, err
+	}
+	size, _ := config.GetInt("app-logs:drains:buffer-size")
+	if size <= 0 {
+		size = defaultLogDrainBufferSize
+	}
+	s := &logDrainSender{
+		appName: appName,
+		drain:   drain,
+		writer:  writer,
+		ch:      make(chan *Applog, size),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *logDrainSender) send(l *Applog) {
+	select {
+	case s.ch <- l:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// stop stops forwarding logs, storing the number of logs dropped since the
+// last status update.
+func (s *logDrainSender) stop() {
+	close(s.done)
+}
+
+func (s *logDrainSender) run() {
+	defer s.writer.close()
+	defer s.flushDropped()
+	batch := make([]*Applog, 0, logDrainBatchSize)
+	backoff := logDrainMinBackoff
+	timer := time.NewTimer(logDrainBatchWaitTime)
+	defer timer.Stop()
+	var lastErr string
+	var lastUpdate time.Time
+	for {
+		select {
+		case <-s.done:
+			return
+		case l := <-s.ch:
+			if len(batch) == logDrainBatchSize {
+				copy(batch, batch[1:])
+				batch = batch[:len(batch)-1]
+				atomic.AddInt64(&s.dropped, 1)
+			}
+			batch = append(batch, l)
+			if len(batch) < logDrainBatchSize {
+				continue
+			}
+		case <-timer.C:
+			timer.Reset(logDrainBatchWaitTime)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		err := s.writer.write(batch)
+		if err == nil {
+			batch = batch[:0]
+			backoff = logDrainMinBackoff
+			if lastErr != "" || (atomic.LoadInt64(&s.dropped) > 0 && time.Since(lastUpdate) > logDrainStatusInterval) {
+				lastErr = ""
+				lastUpdate = time.Now()
+				s.updateStatus(nil)
+			}
+			continue
+		}
+		log.Errorf("[log drain] unable to forward logs of app %s to %s: %s", s.appName, s.drain.DisplayURL(), err)
+		if err.Error() != lastErr || time.Since(lastUpdate) > logDrainStatusInterval {
+			lastErr = err.Error()
+			lastUpdate = time.Now()
+			s.updateStatus(err)
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > logDrainMaxBackoff {
+			backoff = logDrainMaxBackoff
+		}
+	}
+}
+
+// updateStatus stores the last error of the drain, along with the number of
+// logs dropped since the last update.
+func (s *logDrainSender) updateStatus(sendErr error) {
+	update := bson.M{}
+	if sendErr == nil {
+		update["$unset"] = bson.M{"log_drains.$.last_error": "", "log_drains.$.last_error_at": ""}
+	} else {
+		update["$set"] = bson.M{"log_drains.$.last_error": sendErr.Error(), "log_drains.$.last_error_at": time.Now().UTC()}
+	}
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		update["$inc"] = bson.M{"log_drains.$.dropped": dropped}
+	}
+	s.updateDrain(update)
+}
+
+// flushDropped stores the number of logs dropped since the last update.
+func (s *logDrainSender) flushDropped() {
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		s.updateDrain(bson.M{"$inc": bson.M{"log_drains.$.dropped": dropped}})
+	}
+}
+
+func (s *logDrainSender) updateDrain(update bson.M) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[log drain] unable to update status of %s: %s", s.drain.DisplayURL(), err)
+		return
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": s.appName, "log_drains.url": s.drain.URL}, update)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("[log drain] unable to update status of %s: %s", s.drain.DisplayURL(), err)
+	}
+}
+
+// logDrainManager keeps the senders of the drains of each app. The drains of
+// all apps are reloaded periodically in background, so changes made through
+// other API servers are noticed, and the senders are replaced as a whole, so
+// forwarding logs never waits for the database.
+type logDrainManager struct {
+	mu       sync.RWMutex
+	apps     map[string][]*logDrainSender
+	reloadMu sync.Mutex
+	once     sync.Once
+}
+
+func (m *logDrainManager) sendersFor(appName string) []*logDrainSender {
+	m.once.Do(m.start)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.apps[appName]
+}
+
+func (m *logDrainManager) start() {
+	go func() {
+		for {
+			m.reloadAll()
+			time.Sleep(logDrainRefreshInterval)
+		}
+	}()
+}
+
+// reloadAll loads the drains of all apps with a single query, replacing the
+// senders of every app.
+func (m *logDrainManager) reloadAll() {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[log drain] unable to load drains: %s", err)
+		return
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{"log_drains.0": bson.M{"$exists": true}}).Select(bson.M{"name": 1, "log_drains": 1}).All(&apps)
+	if err != nil {
+		log.Errorf("[log drain] unable to load drains: %s", err)
+		return
+	}
+	drains := make(map[string][]LogDrain, len(apps))
+	for _, a := range apps {
+		drains[a.Name] = a.LogDrains
+	}
+	m.update(drains, true)
+}
+
+// reload loads the drains of a single app, after they're changed through
+// this API server.
+func (m *logDrainManager) reload(appName string) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[log drain] unable to load drains of app %s: %s", appName, err)
+		return
+	}
+	defer conn.Close()
+	var a App
+	err = conn.Apps().Find(bson.M{"name": appName}).Select(bson.M{"log_drains": 1}).One(&a)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("[log drain] unable to load drains of app %s: %s", appName, err)
+		return
+	}
+	m.update(map[string][]LogDrain{appName: a.LogDrains}, false)
+}
+
+// update replaces the senders of the given apps, keeping the ones whose
+// drains didn't change. When all is true, the senders of apps missing from
+// drains are removed. It must be called with reloadMu held.
+func (m *logDrainManager) update(drains map[string][]LogDrain, all bool) {
+	m.mu.RLock()
+	current := m.apps
+	m.mu.RUnlock()
+	apps := make(map[string][]*logDrainSender, len(current))
+	for appName, senders := range current {
+		if _, ok := drains[appName]; ok {
+			continue
+		}
+		if all {
+			for _, s := range senders {
+				s.stop()
+			}
+			continue
+		}
+		apps[appName] = senders
+	}
+	for appName, appDrains := range drains {
+		if senders := updateSenders(appName, current[appName], appDrains); len(senders) > 0 {
+			apps[appName] = senders
+		}
+	}
+	m.mu.Lock()
+	m.apps = apps
+	m.mu.Unlock()
+}
+
+func updateSenders(appName string, current []*logDrainSender, drains []LogDrain) []*logDrainSender {
+	existing := make(map[string]*logDrainSender, len(current))
+	for _, s := range current {
+		existing[s.drain.URL] = s
+	}
+	var senders []*logDrainSender
+	for _, drain := range drains {
+		if s, ok := existing[drain.URL]; ok {
+			delete(existing, drain.URL)
+			if s.drain.Format == drain.Format {
+				senders = append(senders, s)
+				continue
+			}
+			s.stop()
+		}
+		s, err := newLogDrainSender(appName, drain)
+		if err != nil {
+			log.Errorf("[log drain] invalid drain %s of app %s: %s", drain.DisplayURL(), appName, err)
+			continue
+		}
+		senders = append(senders, s)
+	}
+	for _, s := range existing {
+		s.stop()
+	}
+	return senders
+}
+
+// forward sends the logs of the app to all of its drains.
+func (m *logDrainManager) forward(appName string, logs ...*Applog) {
+	for _, s := range m.sendersFor(appName) {
+		for _, l := range logs {
+			s.send(l)
+		}
+	}
+}
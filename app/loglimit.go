@@ -0,0 +1,362 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	logLimitRefreshInterval = 30 * time.Second
+	logLimitIdleTimeout     = 10 * time.Minute
+)
+
+var (
+	logLimitSyncInterval   = 5 * time.Second
+	logLimitReportInterval = time.Minute
+	logLimiters            = &logLimitManager{apps: map[string]*appLogLimiter{}}
+)
+
+// logLimits are the limits enforced on the logs received from the units of
+// an app. Zero values mean no limit.
+type logLimits struct {
+	linesPerSecond int
+	bytesPerDay    int64
+}
+
+// AppLogLimits overrides the log limits of the plan for one app. Zero values
+// use the limits of the plan.
+type AppLogLimits struct {
+	LinesPerSecond int   `json:"loglinespersecond,omitempty"`
+	BytesPerDay    int64 `json:"logbytesperday,omitempty"`
+}
+
+// SetLogLimits changes the log limits of the app, overriding the limits of
+// its plan.
+func (app *App) SetLogLimits(limits AppLogLimits) error {
+	if limits.LinesPerSecond < 0 {
+		return &errors.ValidationError{Message: "log lines per second must not be negative"}
+	}
+	if limits.BytesPerDay < 0 {
+		return &errors.ValidationError{Message: "log bytes per day must not be negative"}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"log_limits": limits}})
+	if err == mgo.ErrNotFound {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+	app.LogLimits = limits
+	logLimiters.setLimits(app.Name, app.logLimits())
+	return nil
+}
+
+// logLimits returns the log limits of the app, falling back to the limits of
+// its plan for the ones not set in the app.
+func (app *App) logLimits() logLimits {
+	limits := app.Plan.logLimits()
+	if app.LogLimits.LinesPerSecond > 0 {
+		limits.linesPerSecond = app.LogLimits.LinesPerSecond
+	}
+	if app.LogLimits.BytesPerDay > 0 {
+		limits.bytesPerDay = app.LogLimits.BytesPerDay
+	}
+	return limits
+}
+
+// logLimits returns the log limits of apps using the plan, falling back to
+// the limits in app-logs:limits for the ones not set in the plan.
+func (plan *Plan) logLimits() logLimits {
+	limits := logLimits{
+		linesPerSecond: plan.LogLinesPerSecond,
+		bytesPerDay:    plan.LogBytesPerDay,
+	}
+	if limits.linesPerSecond == 0 {
+		limits.linesPerSecond, _ = config.GetInt("app-logs:limits:lines-per-second")
+	}
+	if limits.bytesPerDay == 0 {
+		bytesPerDay, _ := config.GetInt("app-logs:limits:bytes-per-day")
+		limits.bytesPerDay = int64(bytesPerDay)
+	}
+	return limits
+}
+
+// appLogLimiter enforces the log limits of one app. The rate of lines is
+// limited by a token bucket holding up to one second of lines, while the
+// bytes of each day are counted locally and periodically added to the
+// app_log_quotas collection, so the quota is shared by all API servers. The
+// usage of past days is expired by the database.
+type appLogLimiter struct {
+	appName  string
+	pool     string
+	limits   logLimits
+	loadedAt time.Time
+	usedAt   time.Time
+
+	tokens   float64
+	filledAt time.Time
+
+	day          string
+	usedBytes    int64
+	pendingBytes int64
+
+	droppedByRate  int64
+	droppedByQuota int64
+	reportedAt     time.Time
+}
+
+func logQuotaDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func (l *appLogLimiter) allow(msg *Applog, now time.Time) bool {
+	l.usedAt = now
+	if l.limits.linesPerSecond > 0 {
+		rate := float64(l.limits.linesPerSecond)
+		if l.filledAt.IsZero() {
+			l.tokens = rate
+		} else {
+			l.tokens += now.Sub(l.filledAt).Seconds() * rate
+			if l.tokens > rate {
+				l.tokens = rate
+			}
+		}
+		l.filledAt = now
+		if l.tokens < 1 {
+			l.droppedByRate++
+			return false
+		}
+	}
+	if day := logQuotaDay(now); day != l.day {
+		l.day = day
+		l.usedBytes = 0
+		l.pendingBytes = 0
+	}
+	size := int64(len(msg.Message))
+	if l.limits.bytesPerDay > 0 && l.usedBytes+l.pendingBytes+size > l.limits.bytesPerDay {
+		l.droppedByQuota++
+		return false
+	}
+	if l.limits.linesPerSecond > 0 {
+		l.tokens--
+	}
+	l.pendingBytes += size
+	return true
+}
+
+// droppedMessage returns the message reporting the logs dropped since the
+// last report, resetting the counters.
+func (l *appLogLimiter) droppedMessage() string {
+	var msg string
+	switch {
+	case l.droppedByRate > 0 && l.droppedByQuota > 0:
+		msg = fmt.Sprintf("%d log messages dropped: exceeded the limit of %d lines per second and %d bytes per day", l.droppedByRate+l.droppedByQuota, l.limits.linesPerSecond, l.limits.bytesPerDay)
+	case l.droppedByRate > 0:
+		msg = fmt.Sprintf("%d log messages dropped: exceeded the limit of %d lines per second", l.droppedByRate, l.limits.linesPerSecond)
+	case l.droppedByQuota > 0:
+		msg = fmt.Sprintf("%d log messages dropped: exceeded the limit of %d bytes per day", l.droppedByQuota, l.limits.bytesPerDay)
+	}
+	l.droppedByRate = 0
+	l.droppedByQuota = 0
+	return msg
+}
+
+// logLimitManager keeps the limiters of each app. The limits are loaded from
+// the app and its plan in background, and reloaded periodically so changes
+// are noticed, while apps whose limits weren't loaded yet use the limits in
+// app-logs:limits. Limiters of removed apps and of apps without logs for
+// logLimitIdleTimeout are discarded.
+type logLimitManager struct {
+	mu   sync.Mutex
+	apps map[string]*appLogLimiter
+	once sync.Once
+}
+
+// allow reports whether the log may be stored, counting the logs dropped
+// because of the limits of the app.
+func (m *logLimitManager) allow(msg *Applog) bool {
+	m.once.Do(func() { go m.run() })
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.apps[msg.AppName]
+	if !ok {
+		l = &appLogLimiter{appName: msg.AppName, limits: (&Plan{}).logLimits()}
+		m.apps[msg.AppName] = l
+		go m.loadLimits([]string{msg.AppName})
+	}
+	return l.allow(msg, time.Now())
+}
+
+// loadLimits loads the pool and the limits of the given apps, without
+// holding the lock while querying the database.
+func (m *logLimitManager) loadLimits(appNames []string) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[log limits] unable to load limits of apps: %s", err)
+		return
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(bson.M{"name": bson.M{"$in": appNames}}).Select(bson.M{"name": 1, "pool": 1, "plan": 1, "log_limits": 1}).All(&apps)
+	if err != nil {
+		log.Errorf("[log limits] unable to load limits of apps: %s", err)
+		return
+	}
+	byName := make(map[string]*App, len(apps))
+	for i := range apps {
+		byName[apps[i].Name] = &apps[i]
+	}
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, appName := range appNames {
+		a := byName[appName]
+		if a == nil {
+			delete(m.apps, appName)
+			continue
+		}
+		l, ok := m.apps[appName]
+		if !ok {
+			l = &appLogLimiter{appName: appName}
+			m.apps[appName] = l
+		}
+		l.pool = a.Pool
+		l.limits = a.logLimits()
+		l.loadedAt = now
+	}
+}
+
+// setLimits changes the limits of the app, if it has a limiter.
+func (m *logLimitManager) setLimits(appName string, limits logLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.apps[appName]; ok {
+		l.limits = limits
+	}
+}
+
+// reloadLimits reloads the limits loaded longer than logLimitRefreshInterval
+// ago.
+func (m *logLimitManager) reloadLimits() {
+	var appNames []string
+	m.mu.Lock()
+	for appName, l := range m.apps {
+		if time.Since(l.loadedAt) > logLimitRefreshInterval {
+			appNames = append(appNames, appName)
+		}
+	}
+	m.mu.Unlock()
+	if len(appNames) > 0 {
+		m.loadLimits(appNames)
+	}
+}
+
+func (m *logLimitManager) run() {
+	for range time.Tick(logLimitSyncInterval) {
+		m.reloadLimits()
+		m.sync()
+	}
+}
+
+type logLimitSync struct {
+	limiter *appLogLimiter
+	day     string
+	bytes   int64
+	dropped string
+}
+
+// sync adds the bytes accepted since the last sync to the daily usage of each
+// app, and writes the number of dropped logs to the logs of the apps.
+func (m *logLimitManager) sync() {
+	var pending []logLimitSync
+	now := time.Now()
+	m.mu.Lock()
+	for appName, l := range m.apps {
+		idle := now.Sub(l.usedAt) > logLimitIdleTimeout
+		if idle && l.pendingBytes == 0 && l.droppedByRate+l.droppedByQuota == 0 {
+			delete(m.apps, appName)
+			continue
+		}
+		s := logLimitSync{limiter: l, day: l.day, bytes: l.pendingBytes}
+		if now.Sub(l.reportedAt) >= logLimitReportInterval {
+			if s.dropped = l.droppedMessage(); s.dropped != "" {
+				l.reportedAt = now
+			}
+		}
+		if s.bytes == 0 && s.dropped == "" {
+			continue
+		}
+		l.pendingBytes = 0
+		pending = append(pending, s)
+	}
+	m.mu.Unlock()
+	for _, s := range pending {
+		if s.bytes > 0 {
+			used, err := addLogQuotaUsage(s.limiter.appName, s.day, s.bytes)
+			if err != nil {
+				log.Errorf("[log limits] unable to update log usage of app %s: %s", s.limiter.appName, err)
+			} else {
+				m.mu.Lock()
+				if s.limiter.day == s.day {
+					s.limiter.usedBytes = used
+				}
+				m.mu.Unlock()
+			}
+		}
+		if s.dropped != "" {
+			a := App{Name: s.limiter.appName, Pool: s.limiter.pool}
+			err := a.writeLogs([]*Applog{{
+				Date:    now.UTC(),
+				Message: s.dropped,
+				Source:  "tsuru",
+				AppName: a.Name,
+				Unit:    "api",
+				Level:   "warn",
+			}})
+			if err != nil {
+				log.Errorf("[log limits] unable to report dropped logs of app %s: %s", a.Name, err)
+			}
+		}
+	}
+}
+
+// addLogQuotaUsage adds bytes to the usage of the app in the day, returning
+// the bytes used by the app in the day across all API servers.
+func addLogQuotaUsage(appName, day string, bytes int64) (int64, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var usage struct {
+		Bytes int64
+	}
+	// date is only used to expire the usage of past days.
+	date, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return 0, err
+	}
+	_, err = conn.AppLogQuotas().Find(bson.M{"_id": appName + "/" + day}).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"bytes": bytes}, "$set": bson.M{"app": appName, "day": day, "date": date}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &usage)
+	return usage.Bytes, err
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestPlanLogLimits(c *check.C) {
+	config.Set("app-logs:limits:lines-per-second", 100)
+	config.Set("app-logs:limits:bytes-per-day", 1024)
+	defer config.Unset("app-logs:limits")
+	plan := Plan{LogLinesPerSecond: 10}
+	c.Assert(plan.logLimits(), check.Equals, logLimits{linesPerSecond: 10, bytesPerDay: 1024})
+	plan = Plan{LogBytesPerDay: 2048}
+	c.Assert(plan.logLimits(), check.Equals, logLimits{linesPerSecond: 100, bytesPerDay: 2048})
+	config.Unset("app-logs:limits")
+	plan = Plan{}
+	c.Assert(plan.logLimits(), check.Equals, logLimits{})
+}
+
+func (s *S) TestAppLogLimiterLinesPerSecond(c *check.C) {
+	l := &appLogLimiter{appName: "myapp", limits: logLimits{linesPerSecond: 3}}
+	now := time.Date(2016, 10, 18, 12, 30, 0, 0, time.UTC)
+	msg := &Applog{Message: "hello"}
+	for i := 0; i < 3; i++ {
+		c.Assert(l.allow(msg, now), check.Equals, true)
+	}
+	c.Assert(l.allow(msg, now), check.Equals, false)
+	c.Assert(l.allow(msg, now.Add(100*time.Millisecond)), check.Equals, false)
+	c.Assert(l.allow(msg, now.Add(400*time.Millisecond)), check.Equals, true)
+	c.Assert(l.allow(msg, now.Add(10*time.Second)), check.Equals, true)
+	c.Assert(l.allow(msg, now.Add(10*time.Second)), check.Equals, true)
+	c.Assert(l.allow(msg, now.Add(10*time.Second)), check.Equals, true)
+	c.Assert(l.allow(msg, now.Add(10*time.Second)), check.Equals, false)
+	c.Assert(l.droppedByRate, check.Equals, int64(3))
+	c.Assert(l.droppedMessage(), check.Equals, "3 log messages dropped: exceeded the limit of 3 lines per second")
+	c.Assert(l.droppedMessage(), check.Equals, "")
+}
+
+func (s *S) TestAppLogLimiterBytesPerDay(c *check.C) {
+	l := &appLogLimiter{appName: "myapp", limits: logLimits{bytesPerDay: 10}}
+	now := time.Date(2016, 10, 18, 23, 59, 0, 0, time.UTC)
+	c.Assert(l.allow(&Applog{Message: "hello"}, now), check.Equals, true)
+	c.Assert(l.allow(&Applog{Message: "world!"}, now), check.Equals, false)
+	c.Assert(l.allow(&Applog{Message: "world"}, now), check.Equals, true)
+	c.Assert(l.allow(&Applog{Message: "!"}, now), check.Equals, false)
+	c.Assert(l.pendingBytes, check.Equals, int64(10))
+	c.Assert(l.droppedMessage(), check.Equals, "2 log messages dropped: exceeded the limit of 10 bytes per day")
+	l.usedBytes, l.pendingBytes = 10, 0
+	c.Assert(l.allow(&Applog{Message: "!"}, now), check.Equals, false)
+	c.Assert(l.allow(&Applog{Message: "!"}, now.Add(time.Minute)), check.Equals, true)
+	c.Assert(l.day, check.Equals, "2016-10-19")
+	c.Assert(l.usedBytes, check.Equals, int64(0))
+	c.Assert(l.pendingBytes, check.Equals, int64(1))
+}
+
+func (s *S) TestLogLimitManagerSync(c *check.C) {
+	a := App{Name: "noisy", Plan: Plan{Name: "small", LogLinesPerSecond: 2}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	m := &logLimitManager{apps: map[string]*appLogLimiter{}}
+	m.once.Do(func() {})
+	m.loadLimits([]string{a.Name})
+	for i := 0; i < 5; i++ {
+		m.allow(&Applog{AppName: a.Name, Message: "hello"})
+	}
+	day := logQuotaDay(time.Now())
+	defer s.conn.AppLogQuotas().RemoveId(a.Name + "/" + day)
+	m.sync()
+	var usage struct {
+		App   string
+		Day   string
+		Date  time.Time
+		Bytes int64
+	}
+	err = s.conn.AppLogQuotas().FindId(a.Name + "/" + day).One(&usage)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage.App, check.Equals, a.Name)
+	c.Assert(usage.Day, check.Equals, day)
+	c.Assert(usage.Date.UTC().Format("2006-01-02"), check.Equals, day)
+	c.Assert(usage.Bytes, check.Equals, int64(10))
+	indexes, err := s.conn.AppLogQuotas().Indexes()
+	c.Assert(err, check.IsNil)
+	var expireAfter time.Duration
+	for _, index := range indexes {
+		if len(index.Key) == 1 && index.Key[0] == "date" {
+			expireAfter = index.ExpireAfter
+		}
+	}
+	c.Assert(expireAfter, check.Equals, 48*time.Hour)
+	c.Assert(m.apps[a.Name].usedBytes, check.Equals, int64(10))
+	logs, err := a.LastLogs(10, Applog{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Source, check.Equals, "tsuru")
+	c.Assert(logs[0].Level, check.Equals, "warn")
+	c.Assert(strings.HasPrefix(logs[0].Message, "3 log messages dropped"), check.Equals, true)
+	m.sync()
+	count, err := s.conn.AppLogQuotas().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	logs, err = a.LastLogs(10, Applog{})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+}
+
+func (s *S) TestLogLimitManagerLoadsLimitsInBackground(c *check.C) {
+	config.Set("app-logs:limits:lines-per-second", 100)
+	defer config.Unset("app-logs:limits")
+	a := App{Name: "noisy", Pool: "pool1", Plan: Plan{Name: "small", LogLinesPerSecond: 2}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	m := &logLimitManager{apps: map[string]*appLogLimiter{}}
+	m.once.Do(func() {})
+	c.Assert(m.allow(&Applog{AppName: a.Name, Message: "hello"}), check.Equals, true)
+	timeout := time.After(5 * time.Second)
+	for {
+		m.mu.Lock()
+		l := *m.apps[a.Name]
+		m.mu.Unlock()
+		if !l.loadedAt.IsZero() {
+			c.Assert(l.limits, check.Equals, logLimits{linesPerSecond: 2})
+			c.Assert(l.pool, check.Equals, "pool1")
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for the limits to be loaded")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	err = s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"plan.loglinespersecond": 5}})
+	c.Assert(err, check.IsNil)
+	m.reloadLimits()
+	c.Assert(m.apps[a.Name].limits.linesPerSecond, check.Equals, 2)
+	m.apps[a.Name].loadedAt = time.Now().Add(-2 * logLimitRefreshInterval)
+	m.reloadLimits()
+	c.Assert(m.apps[a.Name].limits.linesPerSecond, check.Equals, 5)
+}
+
+func (s *S) TestAppLogLimits(c *check.C) {
+	config.Set("app-logs:limits:lines-per-second", 100)
+	config.Set("app-logs:limits:bytes-per-day", 1024)
+	defer config.Unset("app-logs:limits")
+	a := App{Plan: Plan{LogLinesPerSecond: 10}}
+	c.Assert(a.logLimits(), check.Equals, logLimits{linesPerSecond: 10, bytesPerDay: 1024})
+	a.LogLimits = AppLogLimits{LinesPerSecond: 5}
+	c.Assert(a.logLimits(), check.Equals, logLimits{linesPerSecond: 5, bytesPerDay: 1024})
+	a.LogLimits = AppLogLimits{BytesPerDay: 2048}
+	c.Assert(a.logLimits(), check.Equals, logLimits{linesPerSecond: 10, bytesPerDay: 2048})
+}
+
+func (s *S) TestAppSetLogLimits(c *check.C) {
+	a := App{Name: "noisy", Plan: Plan{Name: "small", LogLinesPerSecond: 2}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	logLimiters.mu.Lock()
+	logLimiters.apps[a.Name] = &appLogLimiter{appName: a.Name, limits: a.logLimits()}
+	logLimiters.mu.Unlock()
+	defer func() {
+		logLimiters.mu.Lock()
+		delete(logLimiters.apps, a.Name)
+		logLimiters.mu.Unlock()
+	}()
+	err = a.SetLogLimits(AppLogLimits{LinesPerSecond: 20, BytesPerDay: 4096})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogLimits, check.Equals, AppLogLimits{LinesPerSecond: 20, BytesPerDay: 4096})
+	logLimiters.mu.Lock()
+	limits := logLimiters.apps[a.Name].limits
+	logLimiters.mu.Unlock()
+	c.Assert(limits, check.Equals, logLimits{linesPerSecond: 20, bytesPerDay: 4096})
+	err = a.SetLogLimits(AppLogLimits{LinesPerSecond: -1})
+	c.Assert(err, check.ErrorMatches, "log lines per second must not be negative")
+	err = (&App{Name: "unknown"}).SetLogLimits(AppLogLimits{})
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestLogLimitManagerEvictsLimiters(c *check.C) {
+	a := App{Name: "noisy", Plan: Plan{Name: "small"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	m := &logLimitManager{apps: map[string]*appLogLimiter{}}
+	m.once.Do(func() {})
+	m.loadLimits([]string{a.Name, "removed"})
+	c.Assert(m.apps, check.HasLen, 1)
+	m.apps["removed"] = &appLogLimiter{appName: "removed", usedAt: time.Now()}
+	m.loadLimits([]string{"removed"})
+	c.Assert(m.apps["removed"], check.IsNil)
+	m.apps[a.Name].usedAt = time.Now().Add(-2 * logLimitIdleTimeout)
+	m.apps[a.Name].droppedByRate = 1
+	m.sync()
+	c.Assert(m.apps[a.Name], check.NotNil)
+	m.sync()
+	c.Assert(m.apps, check.HasLen, 0)
+}
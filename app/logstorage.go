@@ -0,0 +1,421 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultLogStorage = "mongodb"
+
+// LogStorage is a backend storing the logs of apps.
+type LogStorage interface {
+	// Insert stores the logs of the app.
+	Insert(appName string, logs ...*Applog) error
+	// List returns the last filter.Lines logs of the app matching the
+	// filter, sorted from the oldest to the newest.
+	List(appName string, filter *LogFilter) ([]Applog, error)
+	// Remove removes all the logs of the app.
+	Remove(appName string) error
+}
+
+// LogFilter selects the logs returned by a LogStorage. Empty fields match
+// any log.
+type LogFilter struct {
+	Source string
+	Unit   string
+	Level  string
+	Fields map[string]interface{}
+	// Since and Until limit the date of the logs, both are inclusive.
+	Since time.Time
+	Until time.Time
+	// Text is searched in the message of the logs, ignoring case.
+	Text string
+	// Grep is a regular expression, in the syntax of the regexp package,
+	// matched against the message of the logs, Invert selects the logs not
+	// matching it instead. Storages don't support this syntax, so logs are
+	// matched by tsuru, reading at most logGrepMaxScan logs per search.
+	Grep   string
+	Invert bool
+	// Cursor continues a previous search, selecting the logs older than the
+	// ones already returned. See NextLogCursor.
+	Cursor string
+	Lines  int
+
+	grep   *regexp.Regexp
+	cursor *logCursor
+	// scanCursor points to the last log read by a search stopped at
+	// logGrepMaxScan.
+	scanCursor *logCursor
+}
+
+var errInvalidLogCursor = errors.New("invalid log cursor")
+
+// logCursor points to the oldest log returned by a search: the next page has
+// the logs up to date, skipping the first skip logs, which were already
+// returned.
+type logCursor struct {
+	date time.Time
+	skip int
+}
+
+func parseLogCursor(value string) (*logCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidLogCursor
+	}
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) != 2 {
+		return nil, errInvalidLogCursor
+	}
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidLogCursor
+	}
+	skip, err := strconv.Atoi(parts[1])
+	if err != nil || skip < 0 {
+		return nil, errInvalidLogCursor
+	}
+	return &logCursor{date: time.Unix(0, nsec).UTC(), skip: skip}, nil
+}
+
+func (c *logCursor) String() string {
+	value := fmt.Sprintf("%d:%d", c.date.UnixNano(), c.skip)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// Validate checks the regular expression and the cursor of the filter.
+func (f *LogFilter) Validate() error {
+	if f.Grep != "" && f.grep == nil {
+		re, err := regexp.Compile(f.Grep)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q: %s", f.Grep, err)
+		}
+		f.grep = re
+	}
+	if f.Invert && f.Grep == "" {
+		return errors.New("invert requires a regular expression")
+	}
+	if f.Cursor != "" && f.cursor == nil {
+		cursor, err := parseLogCursor(f.Cursor)
+		if err != nil {
+			return err
+		}
+		f.cursor = cursor
+	}
+	return nil
+}
+
+// until returns the date of the newest log selected by the filter, combining
+// Until with the cursor, and the number of logs to skip at that date.
+func (f *LogFilter) until() (time.Time, int) {
+	if f.cursor == nil || (!f.Until.IsZero() && f.Until.Before(f.cursor.date)) {
+		return f.Until, 0
+	}
+	return f.cursor.date, f.cursor.skip
+}
+
+// NextLogCursor returns the cursor selecting the page of logs older than the
+// logs returned by a search with the filter, or an empty string when there
+// are no more logs. Searches using Grep stopped before finding filter.Lines
+// logs continue from the last log read.
+func NextLogCursor(filter *LogFilter, logs []Applog) string {
+	if filter.scanCursor != nil {
+		return filter.scanCursor.String()
+	}
+	if len(logs) == 0 || len(logs) < filter.Lines {
+		return ""
+	}
+	cursor := logCursor{date: logs[0].Date}
+	for _, l := range logs {
+		if !l.Date.Equal(cursor.date) {
+			break
+		}
+		cursor.skip++
+	}
+	if filter.cursor != nil && filter.cursor.date.Equal(cursor.date) {
+		cursor.skip += filter.cursor.skip
+	}
+	return cursor.String()
+}
+
+func newLogFilter(example *Applog, lines int) *LogFilter {
+	return &LogFilter{
+		Source: example.Source,
+		Unit:   example.Unit,
+		Level:  example.Level,
+		Fields: example.Fields,
+		Lines:  lines,
+	}
+}
+
+func (f *LogFilter) matches(l *Applog) bool {
+	if (f.Source != "" && f.Source != l.Source) ||
+		(f.Unit != "" && f.Unit != l.Unit) ||
+		(f.Level != "" && normalizeLogLevel(f.Level) != l.Level) ||
+		(!f.Since.IsZero() && l.Date.Before(f.Since)) ||
+		(!f.Until.IsZero() && l.Date.After(f.Until)) ||
+		(f.Text != "" && !strings.Contains(strings.ToLower(l.Message), strings.ToLower(f.Text))) ||
+		(f.grep != nil && f.grep.MatchString(l.Message) == f.Invert) {
+		return false
+	}
+	if until, _ := f.until(); !until.IsZero() && l.Date.After(until) {
+		return false
+	}
+	for key, value := range f.Fields {
+		fieldValue, ok := l.Fields[key]
+		if !ok || fmt.Sprint(fieldValue) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+const logGrepBatchSize = 1000
+
+var logGrepMaxScan = 10000
+
+// logGrep selects the logs matching the regular expression of a filter from
+// logs read from the newest to the oldest, skipping the first matching logs
+// already returned by a previous search.
+type logGrep struct {
+	filter  *LogFilter
+	skip    int
+	scanned int
+	logs    []Applog
+	// lastDate is the date of the last log read and lastDateMatches the
+	// number of matching logs with this date, including skipped logs.
+	lastDate        time.Time
+	lastDateMatches int
+}
+
+// add adds the log if it matches, returning false when no more logs should
+// be read.
+func (g *logGrep) add(l *Applog) bool {
+	g.scanned++
+	if !l.Date.Equal(g.lastDate) {
+		g.lastDate = l.Date
+		g.lastDateMatches = 0
+	}
+	if g.filter.grep.MatchString(l.Message) != g.filter.Invert {
+		g.lastDateMatches++
+		if g.skip > 0 {
+			g.skip--
+		} else {
+			g.logs = append(g.logs, *l)
+		}
+	}
+	if g.filter.Lines > 0 && len(g.logs) >= g.filter.Lines {
+		return false
+	}
+	if g.scanned < logGrepMaxScan {
+		return true
+	}
+	cursor := &logCursor{date: l.Date, skip: g.lastDateMatches}
+	if prev := g.filter.cursor; prev != nil && prev.date.Equal(cursor.date) && prev.skip == cursor.skip {
+		// All logs read have the cursor date, the next search would read
+		// them again, so the remaining logs with this date are skipped.
+		cursor = &logCursor{date: cursor.date.Add(-time.Nanosecond)}
+	}
+	g.filter.scanCursor = cursor
+	return false
+}
+
+type logStorageFactory func(configPrefix string) (LogStorage, error)
+
+var (
+	logStorageFactories = map[string]logStorageFactory{}
+	logStoragesMu       sync.Mutex
+	logStorages         = map[string]LogStorage{}
+)
+
+// RegisterLogStorage registers a new type of log storage.
+func RegisterLogStorage(storageType string, factory logStorageFactory) {
+	logStorageFactories[storageType] = factory
+}
+
+func init() {
+	RegisterLogStorage(defaultLogStorage, func(string) (LogStorage, error) {
+		return &mongodbLogStorage{}, nil
+	})
+}
+
+// logStorageForPool returns the storage configured for the logs of apps in
+// the pool, in app-logs:pools:<pool>, falling back to app-logs:storage and
+// to mongodb. Storages are configured in app-logs:storages:<name>, and a
+// storage without configuration is an instance of the type with its name.
+func logStorageForPool(pool string) (LogStorage, error) {
+	name, _ := config.GetString("app-logs:pools:" + pool)
+	if name == "" {
+		name, _ = config.GetString("app-logs:storage")
+	}
+	if name == "" {
+		name = defaultLogStorage
+	}
+	logStoragesMu.Lock()
+	defer logStoragesMu.Unlock()
+	if storage, ok := logStorages[name]; ok {
+		return storage, nil
+	}
+	prefix := "app-logs:storages:" + name
+	storageType, _ := config.GetString(prefix + ":type")
+	if storageType == "" {
+		storageType = name
+	}
+	factory, ok := logStorageFactories[storageType]
+	if !ok {
+		return nil, fmt.Errorf("unknown log storage type %q for log storage %q", storageType, name)
+	}
+	storage, err := factory(prefix)
+	if err != nil {
+		return nil, err
+	}
+	logStorages[name] = storage
+	return storage, nil
+}
+
+// logStorageForApp returns the storage for the logs of the app with the
+// given name.
+func logStorageForApp(appName string) (LogStorage, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var a App
+	err = conn.Apps().Find(bson.M{"name": appName}).Select(bson.M{"pool": 1}).One(&a)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find app %q: %s", appName, err)
+	}
+	return logStorageForPool(a.Pool)
+}
+
+// resetLogStorages discards the storages already created, so they're created
+// again with the current configuration.
+func resetLogStorages() {
+	logStoragesMu.Lock()
+	defer logStoragesMu.Unlock()
+	logStorages = map[string]LogStorage{}
+}
+
+// mongodbLogStorage stores the logs of each app in a capped collection in the
+// log database.
+type mongodbLogStorage struct{}
+
+func (s *mongodbLogStorage) Insert(appName string, logs ...*Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	docs := make([]interface{}, len(logs))
+	for i := range logs {
+		docs[i] = logs[i]
+	}
+	return conn.Logs(appName).Insert(docs...)
+}
+
+func (s *mongodbLogStorage) List(appName string, filter *LogFilter) ([]Applog, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	q := bson.M{}
+	if filter.Source != "" {
+		q["source"] = filter.Source
+	}
+	if filter.Unit != "" {
+		q["unit"] = filter.Unit
+	}
+	if filter.Level != "" {
+		q["level"] = normalizeLogLevel(filter.Level)
+	}
+	for key, value := range filter.Fields {
+		q["fields."+key] = bson.M{"$in": logFieldValues(value)}
+	}
+	until, skip := filter.until()
+	if !filter.Since.IsZero() || !until.IsZero() {
+		dateQuery := bson.M{}
+		if !filter.Since.IsZero() {
+			dateQuery["$gte"] = filter.Since
+		}
+		if !until.IsZero() {
+			dateQuery["$lte"] = until
+		}
+		q["date"] = dateQuery
+	}
+	if filter.Text != "" {
+		q["message"] = bson.RegEx{Pattern: regexp.QuoteMeta(filter.Text), Options: "i"}
+	}
+	coll := conn.Logs(appName)
+	query := coll.Find(q)
+	if _, ok := q["date"]; ok {
+		// Searches by date use the date index instead of scanning the
+		// whole collection in insertion order.
+		coll.EnsureIndex(mgo.Index{Key: []string{"-date", "-_id"}})
+		query = query.Sort("-date", "-_id")
+	} else {
+		query = query.Sort("-$natural")
+	}
+	if filter.grep != nil {
+		grep := logGrep{filter: filter, skip: skip, logs: []Applog{}}
+		iter := query.Batch(logGrepBatchSize).Iter()
+		for {
+			var l Applog
+			if !iter.Next(&l) || !grep.add(&l) {
+				break
+			}
+		}
+		err = iter.Close()
+		if err != nil {
+			return nil, err
+		}
+		reverseLogs(grep.logs)
+		return grep.logs, nil
+	}
+	logs := []Applog{}
+	err = query.Skip(skip).Limit(filter.Lines).All(&logs)
+	if err != nil {
+		return nil, err
+	}
+	reverseLogs(logs)
+	return logs, nil
+}
+
+func (s *mongodbLogStorage) Remove(appName string) error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Logs(appName).DropCollection()
+}
+
+func reverseLogs(logs []Applog) {
+	l := len(logs)
+	for i := 0; i < l/2; i++ {
+		logs[i], logs[l-1-i] = logs[l-1-i], logs[i]
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+const defaultElasticsearchLogIndexPrefix = "tsuru-logs"
+
+func init() {
+	RegisterLogStorage("elasticsearch", newElasticsearchLogStorage)
+}
+
+// elasticsearchLogStorage stores the logs of each app in an index of an
+// Elasticsearch compatible server, using its HTTP API.
+type elasticsearchLogStorage struct {
+	url         string
+	indexPrefix string
+	username    string
+	password    string
+	client      *http.Client
+	mu          sync.Mutex
+	indexes     map[string]bool
+}
+
+type elasticsearchLog struct {
+	Date    time.Time              `json:"date"`
+	Message string                 `json:"message"`
+	Source  string                 `json:"source"`
+	AppName string                 `json:"app"`
+	Unit    string                 `json:"unit"`
+	Level   string                 `json:"level,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+var elasticsearchLogMapping = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"fields": map[string]interface{}{
+					"path_match":         "fields.*",
+					"match_mapping_type": "string",
+					"mapping":            map[string]string{"type": "keyword"},
+				},
+			},
+		},
+		"properties": map[string]interface{}{
+			"date": map[string]string{"type": "date"},
+			"message": map[string]interface{}{
+				"type": "text",
+				"fields": map[string]interface{}{
+					"raw": map[string]interface{}{"type": "keyword", "ignore_above": 8191},
+				},
+			},
+			"source": map[string]string{"type": "keyword"},
+			"app":    map[string]string{"type": "keyword"},
+			"unit":   map[string]string{"type": "keyword"},
+			"level":  map[string]string{"type": "keyword"},
+		},
+	},
+}
+
+func newElasticsearchLogStorage(configPrefix string) (LogStorage, error) {
+	url, err := config.GetString(configPrefix + ":url")
+	if err != nil {
+		return nil, fmt.Errorf("config key %q is required for elasticsearch log storages", configPrefix+":url")
+	}
+	indexPrefix, _ := config.GetString(configPrefix + ":index-prefix")
+	if indexPrefix == "" {
+		indexPrefix = defaultElasticsearchLogIndexPrefix
+	}
+	username, _ := config.GetString(configPrefix + ":username")
+	password, _ := config.GetString(configPrefix + ":password")
+	return &elasticsearchLogStorage{
+		url:         strings.TrimRight(url, "/"),
+		indexPrefix: indexPrefix,
+		username:    username,
+		password:    password,
+		client:      tsuruNet.Dial5Full60ClientNoKeepAlive,
+		indexes:     map[string]bool{},
+	}, nil
+}
+
+func (s *elasticsearchLogStorage) index(appName string) string {
+	return s.indexPrefix + "-" + appName
+}
+
+func (s *elasticsearchLogStorage) do(method, path string, body []byte, contentType string, result interface{}) (int, error) {
+	req, err := http.NewRequest(method, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return rsp.StatusCode, err
+	}
+	if rsp.StatusCode >= http.StatusBadRequest {
+		return rsp.StatusCode, fmt.Errorf("elasticsearch returned status %d: %s", rsp.StatusCode, data)
+	}
+	if result != nil {
+		err = json.Unmarshal(data, result)
+	}
+	return rsp.StatusCode, err
+}
+
+// ensureIndex creates the index of the app with the mapping of the logs, so
+// source, unit, level and string fields can be filtered by exact values.
+func (s *elasticsearchLogStorage) ensureIndex(appName string) error {
+	index := s.index(appName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexes[index] {
+		return nil
+	}
+	body, err := json.Marshal(elasticsearchLogMapping)
+	if err != nil {
+		return err
+	}
+	code, err := s.do("PUT", "/"+index, body, "application/json", nil)
+	if err != nil && (code != http.StatusBadRequest || !strings.Contains(err.Error(), "already_exists")) {
+		return err
+	}
+	s.indexes[index] = true
+	return nil
+}
+
+func (s *elasticsearchLogStorage) Insert(appName string, logs ...*Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	err := s.ensureIndex(appName)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, l := range logs {
+		encoder.Encode(map[string]interface{}{"index": map[string]string{}})
+		encoder.Encode(elasticsearchLog{
+			Date:    l.Date,
+			Message: l.Message,
+			Source:  l.Source,
+			AppName: l.AppName,
+			Unit:    l.Unit,
+			Level:   l.Level,
+			Fields:  l.Fields,
+		})
+	}
+	var result struct {
+		Errors bool
+		Items  []map[string]struct {
+			Error interface{}
+		}
+	}
+	_, err = s.do("POST", "/"+s.index(appName)+"/_bulk", body.Bytes(), "application/x-ndjson", &result)
+	if err != nil {
+		return err
+	}
+	if result.Errors {
+		for _, item := range result.Items {
+			for _, action := range item {
+				if action.Error != nil {
+					return fmt.Errorf("elasticsearch failed to index logs: %v", action.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *elasticsearchLogStorage) List(appName string, filter *LogFilter) ([]Applog, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	conditions := []interface{}{}
+	term := func(field string, value interface{}) {
+		conditions = append(conditions, map[string]interface{}{
+			"term": map[string]interface{}{field: value},
+		})
+	}
+	if filter.Source != "" {
+		term("source", filter.Source)
+	}
+	if filter.Unit != "" {
+		term("unit", filter.Unit)
+	}
+	if filter.Level != "" {
+		term("level", normalizeLogLevel(filter.Level))
+	}
+	for key, value := range filter.Fields {
+		term("fields."+key, value)
+	}
+	until, skip := filter.until()
+	if !filter.Since.IsZero() || !until.IsZero() {
+		dateRange := map[string]interface{}{}
+		if !filter.Since.IsZero() {
+			dateRange["gte"] = filter.Since
+		}
+		if !until.IsZero() {
+			dateRange["lte"] = until
+		}
+		conditions = append(conditions, map[string]interface{}{
+			"range": map[string]interface{}{"date": dateRange},
+		})
+	}
+	query := map[string]interface{}{"filter": conditions}
+	if filter.Text != "" {
+		query["must"] = map[string]interface{}{
+			"match": map[string]interface{}{
+				"message": map[string]interface{}{"query": filter.Text, "operator": "and"},
+			},
+		}
+	}
+	search := map[string]interface{}{
+		"query": map[string]interface{}{"bool": query},
+		"sort":  []interface{}{map[string]string{"date": "desc"}},
+	}
+	if filter.grep != nil {
+		grep := logGrep{filter: filter, skip: skip, logs: []Applog{}}
+		for from := 0; ; from += logGrepBatchSize {
+			search["from"] = from
+			search["size"] = logGrepBatchSize
+			logs, err := s.search(appName, search)
+			if err != nil {
+				return nil, err
+			}
+			i := 0
+			for i < len(logs) && grep.add(&logs[i]) {
+				i++
+			}
+			if i < len(logs) || len(logs) < logGrepBatchSize {
+				break
+			}
+		}
+		reverseLogs(grep.logs)
+		return grep.logs, nil
+	}
+	if skip > 0 {
+		search["from"] = skip
+	}
+	if filter.Lines > 0 {
+		search["size"] = filter.Lines
+	}
+	logs, err := s.search(appName, search)
+	if err != nil {
+		return nil, err
+	}
+	reverseLogs(logs)
+	return logs, nil
+}
+
+// search returns the logs found by the search, sorted as requested.
+func (s *elasticsearchLogStorage) search(appName string, search map[string]interface{}) ([]Applog, error) {
+	body, err := json.Marshal(search)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source elasticsearchLog `json:"_source"`
+			}
+		}
+	}
+	code, err := s.do("POST", "/"+s.index(appName)+"/_search", body, "application/json", &result)
+	if code == http.StatusNotFound {
+		return []Applog{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]Applog, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		logs[i] = Applog{
+			Date:    hit.Source.Date,
+			Message: hit.Source.Message,
+			Source:  hit.Source.Source,
+			AppName: hit.Source.AppName,
+			Unit:    hit.Source.Unit,
+			Level:   hit.Source.Level,
+			Fields:  hit.Source.Fields,
+		}
+	}
+	return logs, nil
+}
+
+func (s *elasticsearchLogStorage) Remove(appName string) error {
+	index := s.index(appName)
+	code, err := s.do("DELETE", "/"+index, nil, "", nil)
+	if err != nil && code != http.StatusNotFound {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.indexes, index)
+	s.mu.Unlock()
+	return nil
+}
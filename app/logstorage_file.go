@@ -0,0 +1,223 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	defaultFileLogMaxSize  = 100 << 20
+	defaultFileLogMaxFiles = 5
+	fileLogName            = "app.log"
+)
+
+func init() {
+	RegisterLogStorage("file", newFileLogStorage)
+}
+
+// fileLogStorage stores the logs of each app in local files, one JSON encoded
+// log per line. The current file, app.log, is rotated to app.log.1 once it
+// reaches the maximum size, and only the newest maxFiles files are kept.
+//
+// Each app has its own lock, held for writing while logs are appended or
+// rotated. Listing only holds it while opening the files, which are read
+// afterwards: rotation renames files, so the open files remain valid.
+type fileLogStorage struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	mu       sync.Mutex
+	locks    map[string]*sync.RWMutex
+}
+
+func newFileLogStorage(configPrefix string) (LogStorage, error) {
+	dir, err := config.GetString(configPrefix + ":dir")
+	if err != nil {
+		return nil, fmt.Errorf("config key %q is required for file log storages", configPrefix+":dir")
+	}
+	maxSize, _ := config.GetInt(configPrefix + ":max-size")
+	if maxSize <= 0 {
+		maxSize = defaultFileLogMaxSize
+	}
+	maxFiles, _ := config.GetInt(configPrefix + ":max-files")
+	if maxFiles <= 0 {
+		maxFiles = defaultFileLogMaxFiles
+	}
+	return &fileLogStorage{dir: dir, maxSize: int64(maxSize), maxFiles: maxFiles}, nil
+}
+
+func (s *fileLogStorage) appDir(appName string) string {
+	return filepath.Join(s.dir, filepath.Base(appName))
+}
+
+func (s *fileLogStorage) appLock(appName string) *sync.RWMutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks == nil {
+		s.locks = map[string]*sync.RWMutex{}
+	}
+	lock := s.locks[appName]
+	if lock == nil {
+		lock = &sync.RWMutex{}
+		s.locks[appName] = lock
+	}
+	return lock
+}
+
+// files returns the log files of the app, from the oldest to the newest.
+func (s *fileLogStorage) files(appName string) []string {
+	files := make([]string, 0, s.maxFiles)
+	for i := s.maxFiles - 1; i > 0; i-- {
+		files = append(files, filepath.Join(s.appDir(appName), fmt.Sprintf("%s.%d", fileLogName, i)))
+	}
+	return append(files, filepath.Join(s.appDir(appName), fileLogName))
+}
+
+func (s *fileLogStorage) rotate(appName string) error {
+	files := s.files(appName)
+	for i := 1; i < len(files); i++ {
+		err := os.Rename(files[i], files[i-1])
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileLogStorage) Insert(appName string, logs ...*Applog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	lock := s.appLock(appName)
+	lock.Lock()
+	defer lock.Unlock()
+	err := os.MkdirAll(s.appDir(appName), 0755)
+	if err != nil {
+		return err
+	}
+	current := filepath.Join(s.appDir(appName), fileLogName)
+	if info, err := os.Stat(current); err == nil && info.Size() >= s.maxSize {
+		err = s.rotate(appName)
+		if err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(current, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, l := range logs {
+		err = encoder.Encode(l)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (s *fileLogStorage) List(appName string, filter *LogFilter) ([]Applog, error) {
+	err := filter.Validate()
+	if err != nil {
+		return nil, err
+	}
+	// Logs are read from the oldest to the newest, so the newest logs
+	// already returned by the cursor are dropped at the end.
+	_, skip := filter.until()
+	limit := filter.Lines
+	if limit > 0 {
+		limit += skip
+	}
+	files, err := s.openFiles(appName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.file.Close()
+		}
+	}()
+	logs := []Applog{}
+	for _, f := range files {
+		scanner := bufio.NewScanner(io.LimitReader(f.file, f.size))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var l Applog
+			if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+				log.Errorf("[file log storage] ignoring unparsable log in %s: %s", f.file.Name(), err)
+				continue
+			}
+			if !filter.matches(&l) {
+				continue
+			}
+			logs = append(logs, l)
+			if limit > 0 && len(logs) > limit {
+				logs = logs[1:]
+			}
+		}
+		err = scanner.Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if skip >= len(logs) {
+		return []Applog{}, nil
+	}
+	return logs[:len(logs)-skip], nil
+}
+
+type openLogFile struct {
+	file *os.File
+	size int64
+}
+
+// openFiles opens the existing log files of the app, from the oldest to the
+// newest, along with their sizes, so logs appended while they're read are
+// ignored.
+func (s *fileLogStorage) openFiles(appName string) ([]openLogFile, error) {
+	lock := s.appLock(appName)
+	lock.RLock()
+	defer lock.RUnlock()
+	var files []openLogFile
+	for _, name := range s.files(appName) {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			var info os.FileInfo
+			info, err = file.Stat()
+			if err == nil {
+				files = append(files, openLogFile{file: file, size: info.Size()})
+				continue
+			}
+			file.Close()
+		}
+		for _, f := range files {
+			f.file.Close()
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+func (s *fileLogStorage) Remove(appName string) error {
+	lock := s.appLock(appName)
+	lock.Lock()
+	defer lock.Unlock()
+	return os.RemoveAll(s.appDir(appName))
+}
@@ -0,0 +1,383 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogStorageForPool(c *check.C) {
+	defer resetLogStorages()
+	defer config.Unset("app-logs")
+	storage, err := logStorageForPool("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &mongodbLogStorage{})
+	resetLogStorages()
+	config.Set("app-logs:storage", "files")
+	config.Set("app-logs:pools:pool2", "elasticsearch")
+	config.Set("app-logs:storages:files:type", "file")
+	config.Set("app-logs:storages:files:dir", c.MkDir())
+	config.Set("app-logs:storages:elasticsearch:url", "http://localhost:9200/")
+	storage, err = logStorageForPool("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &fileLogStorage{})
+	other, err := logStorageForPool("pool3")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Equals, storage)
+	storage, err = logStorageForPool("pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(storage, check.FitsTypeOf, &elasticsearchLogStorage{})
+	c.Assert(storage.(*elasticsearchLogStorage).url, check.Equals, "http://localhost:9200")
+	c.Assert(storage.(*elasticsearchLogStorage).indexPrefix, check.Equals, "tsuru-logs")
+}
+
+func (s *S) TestLogStorageForPoolInvalid(c *check.C) {
+	defer resetLogStorages()
+	defer config.Unset("app-logs")
+	config.Set("app-logs:storage", "unknown")
+	_, err := logStorageForPool("pool1")
+	c.Assert(err, check.ErrorMatches, `unknown log storage type "unknown" for log storage "unknown"`)
+	config.Set("app-logs:storage", "file")
+	_, err = logStorageForPool("pool1")
+	c.Assert(err, check.ErrorMatches, `config key "app-logs:storages:file:dir" is required for file log storages`)
+}
+
+func (s *S) TestFileLogStorage(c *check.C) {
+	storage := &fileLogStorage{dir: c.MkDir(), maxSize: 300, maxFiles: 3}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 10; i++ {
+		l := &Applog{
+			Date:    now.Add(time.Duration(i) * time.Minute),
+			Message: "message " + strconv.Itoa(i),
+			Source:  "app",
+			AppName: "myapp",
+			Unit:    "u" + strconv.Itoa(i%2),
+		}
+		err := storage.Insert("myapp", l)
+		c.Assert(err, check.IsNil)
+	}
+	files, err := filepath.Glob(filepath.Join(storage.dir, "myapp", "app.log*"))
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 3)
+	logs, err := storage.List("myapp", &LogFilter{Lines: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "message 8")
+	c.Assert(logs[1].Message, check.Equals, "message 9")
+	c.Assert(logs[1].Date.Equal(now.Add(9*time.Minute)), check.Equals, true)
+	logs, err = storage.List("myapp", &LogFilter{Unit: "u1", Since: now.Add(6 * time.Minute), Until: now.Add(8 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "message 7")
+	logs, err = storage.List("myapp", &LogFilter{Text: "MESSAGE 9"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	logs, err = storage.List("otherapp", &LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.DeepEquals, []Applog{})
+	err = storage.Remove("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(storage.dir, "myapp"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestFileLogStorageListDoesntWaitForOtherApps(c *check.C) {
+	storage := &fileLogStorage{dir: c.MkDir(), maxSize: 1 << 20, maxFiles: 2}
+	err := storage.Insert("myapp", &Applog{Message: "hello", AppName: "myapp"})
+	c.Assert(err, check.IsNil)
+	lock := storage.appLock("otherapp")
+	lock.Lock()
+	defer lock.Unlock()
+	logs, err := storage.List("myapp", &LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	err = storage.Insert("myapp", &Applog{Message: "world", AppName: "myapp"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestFileLogStorageListWhileRotating(c *check.C) {
+	storage := &fileLogStorage{dir: c.MkDir(), maxSize: 200, maxFiles: 100}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			storage.Insert("myapp", &Applog{Message: "message " + strconv.Itoa(i), AppName: "myapp"})
+		}
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		logs, err := storage.List("myapp", &LogFilter{})
+		c.Assert(err, check.IsNil)
+		for i := range logs {
+			c.Assert(logs[i].Message, check.Equals, "message "+strconv.Itoa(i))
+		}
+	}
+}
+
+type fakeElasticsearch struct {
+	sync.Mutex
+	docs     []elasticsearchLog
+	requests []string
+	search   map[string]interface{}
+}
+
+func (f *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == "PUT":
+		w.Write([]byte(`{"acknowledged": true}`))
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			if i%2 == 1 {
+				var doc elasticsearchLog
+				json.Unmarshal(scanner.Bytes(), &doc)
+				f.docs = append(f.docs, doc)
+			}
+		}
+		w.Write([]byte(`{"errors": false, "items": []}`))
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &f.search)
+		var hits []map[string]interface{}
+		for i := len(f.docs) - 1; i >= 0; i-- {
+			hits = append(hits, map[string]interface{}{"_source": f.docs[i]})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"hits": map[string]interface{}{"hits": hits}})
+	case r.Method == "DELETE":
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *S) TestElasticsearchLogStorage(c *check.C) {
+	es := &fakeElasticsearch{}
+	server := httptest.NewServer(es)
+	defer server.Close()
+	storage := &elasticsearchLogStorage{
+		url:         server.URL,
+		indexPrefix: "logs",
+		client:      http.DefaultClient,
+		indexes:     map[string]bool{},
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	err := storage.Insert("myapp",
+		&Applog{Date: now, Message: "first", Source: "app", AppName: "myapp", Unit: "u1"},
+		&Applog{Date: now.Add(time.Second), Message: "second", Source: "app", AppName: "myapp", Unit: "u1", Level: "error", Fields: map[string]interface{}{"status": float64(500)}},
+	)
+	c.Assert(err, check.IsNil)
+	err = storage.Insert("myapp", &Applog{Date: now.Add(2 * time.Second), Message: "third", AppName: "myapp"})
+	c.Assert(err, check.IsNil)
+	c.Assert(es.docs, check.HasLen, 3)
+	logs, err := storage.List("myapp", &LogFilter{Level: "ERR", Text: "second", Since: now, Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "first")
+	c.Assert(logs[1].Level, check.Equals, "error")
+	c.Assert(logs[1].Fields, check.DeepEquals, map[string]interface{}{"status": float64(500)})
+	c.Assert(logs[2].Message, check.Equals, "third")
+	c.Assert(es.search["size"], check.Equals, float64(10))
+	query := es.search["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	c.Assert(query["filter"], check.HasLen, 2)
+	c.Assert(query["filter"].([]interface{})[0], check.DeepEquals, map[string]interface{}{
+		"term": map[string]interface{}{"level": "error"},
+	})
+	c.Assert(query["must"], check.NotNil)
+	cursor := NextLogCursor(&LogFilter{Lines: 3}, logs)
+	logs, err = storage.List("myapp", &LogFilter{Cursor: cursor, Lines: 3})
+	c.Assert(err, check.IsNil)
+	c.Assert(es.search["from"], check.Equals, float64(1))
+	logs, err = storage.List("myapp", &LogFilter{Grep: "^(first|third)$", Invert: true, Lines: 3})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "second")
+	c.Assert(es.search["from"], check.Equals, float64(0))
+	c.Assert(es.search["size"], check.Equals, float64(logGrepBatchSize))
+	query = es.search["query"].(map[string]interface{})["bool"].(map[string]interface{})
+	c.Assert(query, check.DeepEquals, map[string]interface{}{"filter": []interface{}{}})
+	err = storage.Remove("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(es.requests, check.DeepEquals, []string{
+		"PUT /logs-myapp",
+		"POST /logs-myapp/_bulk",
+		"POST /logs-myapp/_bulk",
+		"POST /logs-myapp/_search",
+		"POST /logs-myapp/_search",
+		"POST /logs-myapp/_search",
+		"DELETE /logs-myapp",
+	})
+}
+
+func (s *S) TestLogFilterValidate(c *check.C) {
+	filter := &LogFilter{Grep: "time(out|d out)", Invert: true}
+	c.Assert(filter.Validate(), check.IsNil)
+	c.Assert(filter.matches(&Applog{Message: "connection timeout"}), check.Equals, false)
+	c.Assert(filter.matches(&Applog{Message: "request done"}), check.Equals, true)
+	filter = &LogFilter{Grep: "time(out"}
+	c.Assert(filter.Validate(), check.ErrorMatches, `invalid regular expression "time\(out": .*`)
+	filter = &LogFilter{Invert: true}
+	c.Assert(filter.Validate(), check.ErrorMatches, "invert requires a regular expression")
+	filter = &LogFilter{Cursor: "not a cursor"}
+	c.Assert(filter.Validate(), check.Equals, errInvalidLogCursor)
+}
+
+func (s *S) TestLogGrep(c *check.C) {
+	filter := &LogFilter{Grep: "timeout", Lines: 2}
+	c.Assert(filter.Validate(), check.IsNil)
+	grep := logGrep{filter: filter, skip: 1}
+	c.Assert(grep.add(&Applog{Message: "timeout 3"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Message: "done 2"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Message: "timeout 1"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Message: "timeout 0"}), check.Equals, false)
+	c.Assert(grep.logs, check.DeepEquals, []Applog{{Message: "timeout 1"}, {Message: "timeout 0"}})
+	oldMaxScan := logGrepMaxScan
+	logGrepMaxScan = 3
+	defer func() { logGrepMaxScan = oldMaxScan }()
+	grep = logGrep{filter: &LogFilter{Grep: "timeout", Invert: true}}
+	c.Assert(grep.filter.Validate(), check.IsNil)
+	c.Assert(grep.add(&Applog{Message: "timeout 2"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Message: "done 1"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Message: "done 0"}), check.Equals, false)
+	c.Assert(grep.logs, check.HasLen, 2)
+}
+
+func (s *S) TestNextLogCursor(c *check.C) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	logs := []Applog{{Date: now}, {Date: now}, {Date: now.Add(time.Second)}}
+	filter := &LogFilter{Lines: 3}
+	cursor := NextLogCursor(filter, logs)
+	parsed, err := parseLogCursor(cursor)
+	c.Assert(err, check.IsNil)
+	c.Assert(parsed.date.Equal(now), check.Equals, true)
+	c.Assert(parsed.skip, check.Equals, 2)
+	c.Assert(NextLogCursor(&LogFilter{Lines: 4}, logs), check.Equals, "")
+	filter = &LogFilter{Cursor: cursor, Lines: 2}
+	c.Assert(filter.Validate(), check.IsNil)
+	parsed, err = parseLogCursor(NextLogCursor(filter, []Applog{{Date: now}, {Date: now}}))
+	c.Assert(err, check.IsNil)
+	c.Assert(parsed.skip, check.Equals, 4)
+}
+
+func (s *S) TestNextLogCursorScanLimit(c *check.C) {
+	oldMaxScan := logGrepMaxScan
+	logGrepMaxScan = 3
+	defer func() { logGrepMaxScan = oldMaxScan }()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	filter := &LogFilter{Grep: "timeout", Lines: 5}
+	c.Assert(filter.Validate(), check.IsNil)
+	grep := logGrep{filter: filter}
+	c.Assert(grep.add(&Applog{Date: now.Add(time.Second), Message: "timeout 2"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Date: now, Message: "timeout 1"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Date: now, Message: "done 0"}), check.Equals, false)
+	reverseLogs(grep.logs)
+	parsed, err := parseLogCursor(NextLogCursor(filter, grep.logs))
+	c.Assert(err, check.IsNil)
+	c.Assert(parsed.date.Equal(now), check.Equals, true)
+	c.Assert(parsed.skip, check.Equals, 1)
+	filter = &LogFilter{Grep: "timeout", Lines: 5, Cursor: parsed.String()}
+	c.Assert(filter.Validate(), check.IsNil)
+	grep = logGrep{filter: filter, skip: 1}
+	c.Assert(grep.add(&Applog{Date: now, Message: "timeout 1"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Date: now, Message: "done 0"}), check.Equals, true)
+	c.Assert(grep.add(&Applog{Date: now, Message: "done -1"}), check.Equals, false)
+	c.Assert(grep.logs, check.HasLen, 0)
+	parsed, err = parseLogCursor(NextLogCursor(filter, grep.logs))
+	c.Assert(err, check.IsNil)
+	c.Assert(parsed.date.Equal(now.Add(-time.Nanosecond)), check.Equals, true)
+	c.Assert(parsed.skip, check.Equals, 0)
+}
+
+func (s *S) TestFileLogStorageCursorAndGrep(c *check.C) {
+	storage := &fileLogStorage{dir: c.MkDir(), maxSize: 1 << 20, maxFiles: 2}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 6; i++ {
+		msg := "request done"
+		if i%2 == 0 {
+			msg = "request timeout"
+		}
+		err := storage.Insert("myapp", &Applog{Date: now.Add(time.Duration(i/2) * time.Second), Message: msg + " " + strconv.Itoa(i), AppName: "myapp"})
+		c.Assert(err, check.IsNil)
+	}
+	var messages []string
+	filter := &LogFilter{Lines: 2}
+	for {
+		logs, err := storage.List("myapp", filter)
+		c.Assert(err, check.IsNil)
+		for i := len(logs) - 1; i >= 0; i-- {
+			messages = append(messages, logs[i].Message)
+		}
+		filter.Cursor = NextLogCursor(filter, logs)
+		if filter.Cursor == "" {
+			break
+		}
+		filter = &LogFilter{Lines: 2, Cursor: filter.Cursor}
+	}
+	c.Assert(messages, check.DeepEquals, []string{
+		"request done 5", "request timeout 4", "request done 3",
+		"request timeout 2", "request done 1", "request timeout 0",
+	})
+	logs, err := storage.List("myapp", &LogFilter{Grep: "time[o]ut [24]", Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	logs, err = storage.List("myapp", &LogFilter{Grep: "timeout", Invert: true, Until: now.Add(time.Second), Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[1].Message, check.Equals, "request done 3")
+}
+
+func (s *S) TestLastLogsGrepAndCursor(c *check.C) {
+	app := App{Name: "app3", Platform: "vougan", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 5; i++ {
+		app.Log("request timeout "+strconv.Itoa(i), "app", "rdaneel")
+		app.Log("request done "+strconv.Itoa(i), "app", "rdaneel")
+		time.Sleep(2 * time.Millisecond)
+	}
+	logs, err := app.SearchLogs(&LogFilter{Grep: "timeout [0-2]", Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	logs, err = app.SearchLogs(&LogFilter{Grep: "timeout", Invert: true, Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 5)
+	c.Assert(logs[0].Message, check.Equals, "request done 0")
+	var messages []string
+	filter := &LogFilter{Since: time.Now().Add(-time.Hour), Lines: 3}
+	for {
+		logs, err = app.SearchLogs(filter)
+		c.Assert(err, check.IsNil)
+		for _, l := range logs {
+			messages = append(messages, l.Message)
+		}
+		cursor := NextLogCursor(filter, logs)
+		if cursor == "" {
+			break
+		}
+		filter = &LogFilter{Since: filter.Since, Cursor: cursor, Lines: 3}
+	}
+	c.Assert(messages, check.HasLen, 10)
+	sort.Strings(messages)
+	c.Assert(messages[0], check.Equals, "request done 0")
+	c.Assert(messages[9], check.Equals, "request timeout 4")
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultMetricsInterval = time.Minute
+	defaultMetricsHistory  = time.Hour
+	metricsCollectWorkers  = 10
+)
+
+// ResourceMetrics is the resource usage of the units of a process of an app,
+// aggregated at a point in time.
+type ResourceMetrics struct {
+	ID      string    `bson:"_id" json:"-"`
+	App     string    `json:"app"`
+	Process string    `json:"process"`
+	Date    time.Time `json:"date"`
+	Units   int       `json:"units"`
+	// CPU is the sum of the usage of CPU by the units, in percent of one
+	// CPU.
+	CPU float64 `json:"cpu"`
+	// Memory and MemoryLimit are the sum of the memory used by the units
+	// and of their limits, in bytes.
+	Memory      int64 `json:"memory"`
+	MemoryLimit int64 `json:"memoryLimit"`
+	// NetworkRx and NetworkTx are the bytes received and sent by the units
+	// per second, since the previous sample.
+	NetworkRx float64 `json:"networkRx"`
+	NetworkTx float64 `json:"networkTx"`
+	// Counters keeps the network counters of each unit, used to calculate
+	// the rates of the next sample.
+	Counters []unitCounters `json:"-"`
+}
+
+type unitCounters struct {
+	ID        string
+	Date      time.Time
+	NetworkRx int64
+	NetworkTx int64
+}
+
+// ResourceMetrics returns the resource usage history of the app, optionally
+// filtered by process, sorted by date.
+func (app *App) ResourceMetrics(process string) ([]ResourceMetrics, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{"app": app.Name}
+	if process != "" {
+		query["process"] = process
+	}
+	var metrics []ResourceMetrics
+	err = conn.AppMetrics().Find(query).Sort("date", "process").All(&metrics)
+	return metrics, err
+}
+
+// aggregateUnitsMetrics aggregates the samples of the units of an app per
+// process. The network rates are calculated from the counters kept in the
+// previous sample of each process, units without a previous sample are not
+// included in the rates.
+func aggregateUnitsMetrics(appName string, date time.Time, units []provision.UnitMetrics, previous map[string]ResourceMetrics) []ResourceMetrics {
+	processes := map[string]*ResourceMetrics{}
+	var names []string
+	for _, u := range units {
+		m, ok := processes[u.ProcessName]
+		if !ok {
+			m = &ResourceMetrics{
+				ID:      fmt.Sprintf("%s/%s/%d", appName, u.ProcessName, date.Unix()),
+				App:     appName,
+				Process: u.ProcessName,
+				Date:    date,
+			}
+			processes[u.ProcessName] = m
+			names = append(names, u.ProcessName)
+		}
+		m.Units++
+		m.CPU += u.CPU
+		m.Memory += u.Memory
+		m.MemoryLimit += u.MemoryLimit
+		m.Counters = append(m.Counters, unitCounters{
+			ID:        u.ID,
+			Date:      u.Date,
+			NetworkRx: u.NetworkRx,
+			NetworkTx: u.NetworkTx,
+		})
+		for _, prev := range previous[u.ProcessName].Counters {
+			if prev.ID != u.ID {
+				continue
+			}
+			seconds := u.Date.Sub(prev.Date).Seconds()
+			if seconds > 0 && u.NetworkRx >= prev.NetworkRx && u.NetworkTx >= prev.NetworkTx {
+				m.NetworkRx += float64(u.NetworkRx-prev.NetworkRx) / seconds
+				m.NetworkTx += float64(u.NetworkTx-prev.NetworkTx) / seconds
+			}
+			break
+		}
+	}
+	sort.Strings(names)
+	result := make([]ResourceMetrics, len(names))
+	for i, name := range names {
+		result[i] = *processes[name]
+	}
+	return result
+}
+
+// collectAppMetrics samples the units of the app and stores the metrics of
+// each process.
+func collectAppMetrics(a *App, date time.Time) error {
+	prov, err := a.getProvisioner()
+	if err != nil {
+		return err
+	}
+	metricsProv, ok := prov.(provision.UnitMetricsProvisioner)
+	if !ok {
+		return nil
+	}
+	units, err := metricsProv.UnitsMetrics(a)
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.AppMetrics()
+	previous := map[string]ResourceMetrics{}
+	for _, u := range units {
+		if _, ok := previous[u.ProcessName]; ok {
+			continue
+		}
+		var m ResourceMetrics
+		err = coll.Find(bson.M{"app": a.Name, "process": u.ProcessName, "date": bson.M{"$lt": date}}).Sort("-date").One(&m)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		previous[u.ProcessName] = m
+	}
+	for _, m := range aggregateUnitsMetrics(a.Name, date, units, previous) {
+		_, err = coll.UpsertId(m.ID, m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimMetricsCollection reports whether this API server should collect the
+// metrics of the interval starting at date, so only one server samples the
+// units in each interval.
+func claimMetricsCollection(date time.Time) (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	_, err = conn.Collection("app_metrics_collector").Find(bson.M{
+		"_id":  "collector",
+		"date": bson.M{"$lt": date},
+	}).Apply(mgo.Change{Update: bson.M{"$set": bson.M{"date": date}}, Upsert: true}, nil)
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type metricsCollector struct {
+	interval time.Duration
+	history  time.Duration
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (c *metricsCollector) collect(now time.Time) error {
+	date := now.Truncate(c.interval)
+	claimed, err := claimMetricsCollection(date)
+	if err != nil || !claimed {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var apps []App
+	err = conn.Apps().Find(nil).All(&apps)
+	if err != nil {
+		return err
+	}
+	appsCh := make(chan *App)
+	var wg sync.WaitGroup
+	for i := 0; i < metricsCollectWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range appsCh {
+				if err := collectAppMetrics(a, date); err != nil {
+					log.Errorf("[app metrics] unable to collect metrics of app %s: %s", a.Name, err)
+				}
+			}
+		}()
+	}
+	for i := range apps {
+		appsCh <- &apps[i]
+	}
+	close(appsCh)
+	wg.Wait()
+	_, err = conn.AppMetrics().RemoveAll(bson.M{"date": bson.M{"$lt": now.Add(-c.history)}})
+	return err
+}
+
+func (c *metricsCollector) start() {
+	c.doneCh = make(chan struct{})
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			err := c.collect(time.Now().UTC())
+			if err != nil {
+				log.Errorf("[app metrics] %s", err)
+			}
+			select {
+			case <-c.doneCh:
+				return
+			case <-time.After(c.interval):
+			}
+		}
+	}()
+}
+
+func (c *metricsCollector) Shutdown() {
+	close(c.doneCh)
+	c.wg.Wait()
+}
+
+func (c *metricsCollector) String() string {
+	return "app metrics collector"
+}
+
+// InitializeMetricsCollector starts sampling the resource usage of the units
+// of all apps. The config entry app-metrics:interval sets the interval, in
+// seconds, between samples, app-metrics:history sets for how long, in
+// seconds, samples are kept and app-metrics:disabled disables the collector.
+func InitializeMetricsCollector() error {
+	if disabled, _ := config.GetBool("app-metrics:disabled"); disabled {
+		return nil
+	}
+	c := &metricsCollector{interval: defaultMetricsInterval, history: defaultMetricsHistory}
+	if seconds, err := config.GetInt("app-metrics:interval"); err == nil && seconds > 0 {
+		c.interval = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := config.GetInt("app-metrics:history"); err == nil && seconds > 0 {
+		c.history = time.Duration(seconds) * time.Second
+	}
+	c.start()
+	shutdown.Register(c)
+	return nil
+}
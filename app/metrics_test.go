@@ -0,0 +1,152 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAggregateUnitsMetrics(c *check.C) {
+	date := time.Date(2016, 10, 18, 12, 30, 0, 0, time.UTC)
+	units := []provision.UnitMetrics{
+		{ID: "u1", ProcessName: "web", Date: date, CPU: 10, Memory: 100, MemoryLimit: 200, NetworkRx: 3000, NetworkTx: 1200},
+		{ID: "u2", ProcessName: "worker", Date: date, CPU: 50, Memory: 300, MemoryLimit: 400, NetworkRx: 10, NetworkTx: 20},
+		{ID: "u3", ProcessName: "web", Date: date, CPU: 5, Memory: 50, MemoryLimit: 200, NetworkRx: 500, NetworkTx: 500},
+	}
+	previous := map[string]ResourceMetrics{
+		"web": {Counters: []unitCounters{
+			{ID: "u1", Date: date.Add(-time.Minute), NetworkRx: 600, NetworkTx: 600},
+			{ID: "u0", Date: date.Add(-time.Minute), NetworkRx: 100, NetworkTx: 100},
+		}},
+	}
+	metrics := aggregateUnitsMetrics("myapp", date, units, previous)
+	c.Assert(metrics, check.DeepEquals, []ResourceMetrics{
+		{
+			ID:          "myapp/web/1476793800",
+			App:         "myapp",
+			Process:     "web",
+			Date:        date,
+			Units:       2,
+			CPU:         15,
+			Memory:      150,
+			MemoryLimit: 400,
+			NetworkRx:   40,
+			NetworkTx:   10,
+			Counters: []unitCounters{
+				{ID: "u1", Date: date, NetworkRx: 3000, NetworkTx: 1200},
+				{ID: "u3", Date: date, NetworkRx: 500, NetworkTx: 500},
+			},
+		},
+		{
+			ID:          "myapp/worker/1476793800",
+			App:         "myapp",
+			Process:     "worker",
+			Date:        date,
+			Units:       1,
+			CPU:         50,
+			Memory:      300,
+			MemoryLimit: 400,
+			Counters: []unitCounters{
+				{ID: "u2", Date: date, NetworkRx: 10, NetworkTx: 20},
+			},
+		},
+	})
+}
+
+func (s *S) TestAggregateUnitsMetricsRestartedUnit(c *check.C) {
+	date := time.Date(2016, 10, 18, 12, 30, 0, 0, time.UTC)
+	units := []provision.UnitMetrics{
+		{ID: "u1", ProcessName: "web", Date: date, NetworkRx: 10, NetworkTx: 10},
+	}
+	previous := map[string]ResourceMetrics{
+		"web": {Counters: []unitCounters{
+			{ID: "u1", Date: date.Add(-time.Minute), NetworkRx: 600, NetworkTx: 600},
+		}},
+	}
+	metrics := aggregateUnitsMetrics("myapp", date, units, previous)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[0].NetworkRx, check.Equals, float64(0))
+	c.Assert(metrics[0].NetworkTx, check.Equals, float64(0))
+}
+
+func (s *S) TestCollectAppMetrics(c *check.C) {
+	a := App{Name: "metered", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 2, "web", nil)
+	s.provisioner.AddUnits(&a, 1, "worker", nil)
+	date := time.Now().UTC().Truncate(time.Minute)
+	err = collectAppMetrics(&a, date)
+	c.Assert(err, check.IsNil)
+	err = collectAppMetrics(&a, date.Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	metrics, err := a.ResourceMetrics("")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 4)
+	c.Assert(metrics[0].Process, check.Equals, "web")
+	c.Assert(metrics[0].Date.Equal(date), check.Equals, true)
+	c.Assert(metrics[0].Units, check.Equals, 2)
+	c.Assert(metrics[0].CPU, check.Equals, float64(20))
+	c.Assert(metrics[0].Memory, check.Equals, int64(128<<20))
+	c.Assert(metrics[0].MemoryLimit, check.Equals, int64(512<<20))
+	c.Assert(metrics[1].Process, check.Equals, "worker")
+	c.Assert(metrics[1].Units, check.Equals, 1)
+	c.Assert(metrics[2].Date.Equal(date.Add(time.Minute)), check.Equals, true)
+	metrics, err = a.ResourceMetrics("worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	c.Assert(metrics[0].Process, check.Equals, "worker")
+	c.Assert(metrics[1].Process, check.Equals, "worker")
+}
+
+func (s *S) TestCollectAppMetricsSameIntervalReplacesSample(c *check.C) {
+	a := App{Name: "metered", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	date := time.Now().UTC().Truncate(time.Minute)
+	err = collectAppMetrics(&a, date)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	err = collectAppMetrics(&a, date)
+	c.Assert(err, check.IsNil)
+	metrics, err := a.ResourceMetrics("")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[0].Units, check.Equals, 2)
+}
+
+func (s *S) TestClaimMetricsCollection(c *check.C) {
+	date := time.Now().UTC().Truncate(time.Minute)
+	claimed, err := claimMetricsCollection(date)
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+	claimed, err = claimMetricsCollection(date)
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, false)
+	claimed, err = claimMetricsCollection(date.Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(claimed, check.Equals, true)
+}
+
+func (s *S) TestMetricsCollectorRemovesOldSamples(c *check.C) {
+	a := App{Name: "metered", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	s.provisioner.AddUnits(&a, 1, "web", nil)
+	old := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Minute)
+	err = collectAppMetrics(&a, old)
+	c.Assert(err, check.IsNil)
+	collector := &metricsCollector{interval: time.Minute, history: time.Hour}
+	err = collector.collect(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	metrics, err := a.ResourceMetrics("")
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[0].Date.After(old), check.Equals, true)
+}
@@ -23,6 +23,11 @@ type Plan struct {
 	CpuShare int    `json:"cpushare"`
 	Default  bool   `json:"default,omitempty"`
 	Router   string `json:"router,omitempty"`
+	// LogLinesPerSecond and LogBytesPerDay limit the logs received from the
+	// units of each app using the plan. Zero values use the limits in the
+	// app-logs:limits config.
+	LogLinesPerSecond int   `json:"loglinespersecond,omitempty"`
+	LogBytesPerDay    int64 `json:"logbytesperday,omitempty"`
 }
 
 type PlanValidationError struct{ field string }
@@ -49,6 +54,12 @@ func (plan *Plan) Save() error {
 	if plan.Memory > 0 && plan.Memory < 4194304 {
 		return ErrLimitOfMemory
 	}
+	if plan.LogLinesPerSecond < 0 {
+		return PlanValidationError{"log lines per second"}
+	}
+	if plan.LogBytesPerDay < 0 {
+		return PlanValidationError{"log bytes per day"}
+	}
 	if plan.Router != "" {
 		_, err := router.Get(plan.Router)
 		if err != nil {
@@ -74,11 +74,22 @@ func (s *S) TestPlanAddInvalid(c *check.C) {
 			Swap:     1024,
 			CpuShare: 100,
 		},
+		{
+			Name:              "plan1",
+			CpuShare:          100,
+			LogLinesPerSecond: -1,
+		},
+		{
+			Name:           "plan1",
+			CpuShare:       100,
+			LogBytesPerDay: -1,
+		},
 	}
-	expectedError := []error{PlanValidationError{"name"}, ErrLimitOfCpuShare, PlanValidationError{"router"}, ErrLimitOfMemory}
+	expectedError := []error{PlanValidationError{"name"}, ErrLimitOfCpuShare, PlanValidationError{"router"}, ErrLimitOfMemory,
+		PlanValidationError{"log lines per second"}, PlanValidationError{"log bytes per day"}}
 	for i, p := range invalidPlans {
 		err := p.Save()
-		c.Assert(err, check.FitsTypeOf, expectedError[i])
+		c.Assert(err, check.DeepEquals, expectedError[i])
 	}
 }
 
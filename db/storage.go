@@ -13,10 +13,12 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/metrics"
 	"gopkg.in/mgo.v2"
 )
 
@@ -25,6 +27,8 @@ const (
 	DefaultDatabaseName = "tsuru"
 )
 
+var connectionErrors = metrics.NewCounter("tsuru_mongodb_connection_errors_total", "Number of failed connections to MongoDB, by database.", "database")
+
 type Storage struct {
 	*storage.Storage
 }
@@ -75,6 +79,9 @@ func Conn() (*Storage, error) {
 	)
 	url, dbname := DbConfig("")
 	strg.Storage, err = storage.Open(url, dbname)
+	if err != nil {
+		connectionErrors.Inc("main")
+	}
 	return &strg, err
 }
 
@@ -85,6 +92,9 @@ func LogConn() (*LogStorage, error) {
 	)
 	url, dbname := DbConfig("logdb-")
 	strg.Storage, err = storage.Open(url, dbname)
+	if err != nil {
+		connectionErrors.Inc("logs")
+	}
 	return &strg, err
 }
 
@@ -210,6 +220,24 @@ func (s *Storage) Limiter() *storage.Collection {
 	return s.Collection("limiter")
 }
 
+// AppLogQuotas returns the collection counting the bytes of logs received
+// from each app per day. Documents expire two days after the start of their
+// day.
+func (s *Storage) AppLogQuotas() *storage.Collection {
+	c := s.Collection("app_log_quotas")
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}, ExpireAfter: 48 * time.Hour})
+	return c
+}
+
+// AppMetrics returns the collection keeping the resource usage history of
+// the processes of apps.
+func (s *Storage) AppMetrics() *storage.Collection {
+	c := s.Collection("app_metrics")
+	c.EnsureIndex(mgo.Index{Key: []string{"app", "process", "-date"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}})
+	return c
+}
+
 func (s *Storage) Events() *storage.Collection {
 	ownerIndex := mgo.Index{Key: []string{"owner"}}
 	kindIndex := mgo.Index{Key: []string{"kind"}}
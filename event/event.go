@@ -18,6 +18,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/safe"
 	"gopkg.in/mgo.v2"
@@ -68,6 +69,8 @@ var (
 	TargetTypePlatform        = TargetType("platform")
 	TargetTypePlan            = TargetType("plan")
 	TargetTypeNodeContainer   = TargetType("node-container")
+	TargetTypeWebhook         = TargetType("webhook")
+	TargetTypeEvent           = TargetType("event")
 )
 
 const (
@@ -283,6 +286,12 @@ func (ap *AllowedPermission) GetBSON() (interface{}, error) {
 	}, nil
 }
 
+// AllowedBy returns whether any of the permissions in perms grants access to
+// the event, following the same rules used when listing events.
+func (ap *AllowedPermission) AllowedBy(perms []permission.Permission) bool {
+	return permissionsMatch(perms, ap)
+}
+
 func (e *Event) String() string {
 	return fmt.Sprintf("%s(%s) running %q start by %s at %s",
 		e.Target.Type,
@@ -315,7 +324,9 @@ type Filter struct {
 
 	Limit int
 	Skip  int
-	Sort  string
+	// Sort is a comma separated list of fields, as accepted by
+	// mgo.Query.Sort.
+	Sort string
 }
 
 func (f *Filter) PruneUserValues() {
@@ -508,7 +519,7 @@ func List(filter *Filter) ([]Event, error) {
 	}
 	defer conn.Close()
 	coll := conn.Events()
-	find := coll.Find(query).Sort(sort)
+	find := coll.Find(query).Sort(strings.Split(sort, ",")...)
 	if limit > 0 {
 		find = find.Limit(limit)
 	}
@@ -695,6 +706,7 @@ func newEvt(opts *Opts) (*Event, error) {
 			if !opts.DisableLock {
 				updater.addCh <- &opts.Target
 			}
+			publish(StreamCreated, evt.eventData, "")
 			return &evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -751,6 +763,35 @@ func (e *Event) DoneCustomData(evtErr error, customData interface{}) error {
 	return e.done(evtErr, customData, false)
 }
 
+// Detach stops refreshing the event lock in the current process, keeping the
+// event running. The event may then be loaded with GetByID and finished by
+// any process, which must call KeepAlive periodically to avoid the event
+// being considered expired.
+func (e *Event) Detach() error {
+	updater.start()
+	updater.removeCh <- &e.Target
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Events().Update(bson.M{"_id": e.ID, "uniqueid": e.UniqueID}, bson.M{
+		"$set": bson.M{"log": e.logBuffer.String(), "lockupdatetime": time.Now().UTC()},
+	})
+}
+
+// KeepAlive refreshes the lock of a detached event.
+func (e *Event) KeepAlive() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Events().Update(bson.M{"_id": e.ID, "uniqueid": e.UniqueID, "running": true}, bson.M{
+		"$set": bson.M{"lockupdatetime": time.Now().UTC()},
+	})
+}
+
 func (e *Event) SetLogWriter(w io.Writer) {
 	e.logWriter = w
 }
@@ -769,18 +810,21 @@ func (e *Event) SetOtherCustomData(data interface{}) error {
 
 func (e *Event) Logf(format string, params ...interface{}) {
 	log.Debugf(fmt.Sprintf("%s(%s)[%s] %s", e.Target.Type, e.Target.Value, e.Kind, format), params...)
-	format += "\n"
+	msg := fmt.Sprintf(format+"\n", params...)
 	if e.logWriter != nil {
-		fmt.Fprintf(e.logWriter, format, params...)
+		io.WriteString(e.logWriter, msg)
 	}
-	fmt.Fprintf(&e.logBuffer, format, params...)
+	e.logBuffer.WriteString(msg)
+	publishLog(e.eventData, msg)
 }
 
 func (e *Event) Write(data []byte) (int, error) {
 	if e.logWriter != nil {
 		e.logWriter.Write(data)
 	}
-	return e.logBuffer.Write(data)
+	n, err := e.logBuffer.Write(data)
+	publishLog(e.eventData, string(data))
+	return n, err
 }
 
 func (e *Event) TryCancel(reason, owner string) error {
@@ -808,6 +852,9 @@ func (e *Event) TryCancel(reason, owner string) error {
 	if err == mgo.ErrNotFound {
 		return ErrEventNotFound
 	}
+	if err == nil {
+		publish(StreamUpdated, e.eventData, "")
+	}
 	return err
 }
 
@@ -832,6 +879,9 @@ func (e *Event) AckCancel() (bool, error) {
 	if err == mgo.ErrNotFound {
 		return false, nil
 	}
+	if err == nil {
+		publish(StreamUpdated, e.eventData, "")
+	}
 	return err == nil, err
 }
 
@@ -864,6 +914,7 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 			log.Errorf("[events] error marking event as done - %#v: %s", e, err)
 		}
 	}()
+	updater.start()
 	updater.removeCh <- &e.Target
 	conn, err := db.Conn()
 	if err != nil {
@@ -874,31 +925,45 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 	if abort {
 		return coll.RemoveId(e.ID)
 	}
+	status := "success"
 	if evtErr != nil {
 		e.Error = evtErr.Error()
+		status = "error"
 	} else if e.CancelInfo.Canceled {
 		e.Error = "canceled by user request"
+		status = "canceled"
 	}
+	eventsFinished.Inc(e.Kind.Name, status)
 	e.EndTime = time.Now().UTC()
 	e.EndCustomData, err = makeBSONRaw(customData)
 	if err != nil {
 		return err
 	}
 	e.Running = false
-	e.Log = e.logBuffer.String()
+	if e.logBuffer.Len() > 0 {
+		e.Log = e.logBuffer.String()
+	}
 	var dbEvt Event
 	err = coll.FindId(e.ID).One(&dbEvt.eventData)
 	if err == nil {
 		e.OtherCustomData = dbEvt.OtherCustomData
 	}
 	if len(e.ID.ObjId) != 0 {
-		return coll.UpdateId(e.ID, e.eventData)
+		err = coll.UpdateId(e.ID, e.eventData)
+	} else {
+		defer coll.RemoveId(e.ID)
+		e.ID = eventID{ObjId: e.UniqueID}
+		err = coll.Insert(e.eventData)
 	}
-	defer coll.RemoveId(e.ID)
-	e.ID = eventID{ObjId: e.UniqueID}
-	return coll.Insert(e.eventData)
+	if err == nil {
+		flushLog(e.UniqueID)
+		publish(StreamFinished, e.eventData, "")
+	}
+	return err
 }
 
+var eventsFinished = metrics.NewCounter("tsuru_events_total", "Number of finished events, by kind and status.", "kind", "status")
+
 type lockUpdater struct {
 	addCh    chan *Target
 	removeCh chan *Target
@@ -0,0 +1,93 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/fs"
+)
+
+var fsystem fs.Fs
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+// archive writes events to a gzip compressed file, one JSON document per line
+// (NDJSON). The file is only created when the first event is added.
+type archive struct {
+	dir      string
+	fileName string
+	file     fs.File
+	gz       *gzip.Writer
+	enc      *json.Encoder
+	count    int
+}
+
+func newArchive(dir string, now time.Time) *archive {
+	return &archive{
+		dir:      dir,
+		fileName: filepath.Join(dir, "events-"+now.Format("20060102T150405Z")+".ndjson.gz"),
+	}
+}
+
+func (a *archive) open() error {
+	err := filesystem().MkdirAll(a.dir, 0750)
+	if err != nil {
+		return err
+	}
+	// Concatenated gzip members are still a valid gzip file, so appending is
+	// safe even if the file already exists.
+	a.file, err = filesystem().OpenFile(a.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	a.gz = gzip.NewWriter(a.file)
+	a.enc = json.NewEncoder(a.gz)
+	return nil
+}
+
+func (a *archive) add(evt *event.Event) error {
+	if a.file == nil {
+		err := a.open()
+		if err != nil {
+			return err
+		}
+	}
+	err := a.enc.Encode(evt)
+	if err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+func (a *archive) Flush() error {
+	if a.gz == nil {
+		return nil
+	}
+	return a.gz.Flush()
+}
+
+func (a *archive) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	closeErr := a.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,298 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package retention removes finished events older than the retention
+// configured for their kind or target type, optionally archiving them before
+// removal.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	eventKind = "event-retention"
+
+	defaultInterval = time.Hour
+)
+
+var (
+	// BatchSize is the maximum number of events archived and removed at once.
+	BatchSize = 1000
+
+	eventsRemoved  = metrics.NewCounter("tsuru_event_retention_removed_total", "Number of events removed by the retention rules, by rule.", "rule")
+	eventsArchived = metrics.NewCounter("tsuru_event_retention_archived_total", "Number of events archived before being removed.")
+	retentionRuns  = metrics.NewCounter("tsuru_event_retention_runs_total", "Number of runs of the event retention, by status.", "status")
+)
+
+type rule struct {
+	name       string
+	kind       string
+	targetType string
+	maxAge     time.Duration
+}
+
+// specificity is used to choose between rules matching the same event, rules
+// with both kind and target type win over rules with only the kind, which win
+// over rules with only the target type.
+func (r *rule) specificity() int {
+	s := 0
+	if r.kind != "" {
+		s += 2
+	}
+	if r.targetType != "" {
+		s++
+	}
+	return s
+}
+
+func (r *rule) selector() bson.M {
+	query := bson.M{}
+	if r.kind != "" {
+		query["kind.name"] = r.kind
+	}
+	if r.targetType != "" {
+		query["target.type"] = r.targetType
+	}
+	return query
+}
+
+type policy struct {
+	rules       []rule
+	archivePath string
+}
+
+// query returns the query matching the expired events for the rule at
+// index i, which are finished events older than the rule max age not matched
+// by any more specific rule.
+func (p *policy) query(i int, now time.Time) bson.M {
+	r := &p.rules[i]
+	query := r.selector()
+	query["running"] = false
+	query["endtime"] = bson.M{"$lt": now.Add(-r.maxAge)}
+	var nor []bson.M
+	for j := range p.rules {
+		if p.rules[j].specificity() > r.specificity() {
+			nor = append(nor, p.rules[j].selector())
+		}
+	}
+	if len(nor) > 0 {
+		query["$nor"] = nor
+	}
+	return query
+}
+
+func loadPolicy() (*policy, error) {
+	rulesConfig, err := config.Get("event:retention:rules")
+	if err != nil {
+		return nil, nil
+	}
+	rulesMap, ok := rulesConfig.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid value for config key 'event:retention:rules'")
+	}
+	var names []string
+	for key := range rulesMap {
+		names = append(names, fmt.Sprint(key))
+	}
+	sort.Strings(names)
+	p := &policy{}
+	seen := map[string]string{}
+	for _, name := range names {
+		prefix := "event:retention:rules:" + name
+		days, err := config.GetInt(prefix + ":days")
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("config key '%s:days' must be a positive integer", prefix)
+		}
+		r := rule{name: name, maxAge: time.Duration(days) * 24 * time.Hour}
+		r.kind, _ = config.GetString(prefix + ":kind")
+		r.targetType, _ = config.GetString(prefix + ":target-type")
+		key := r.kind + "/" + r.targetType
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("event retention rules %q and %q match the same events", other, name)
+		}
+		seen[key] = name
+		p.rules = append(p.rules, r)
+	}
+	p.archivePath, _ = config.GetString("event:retention:archive-path")
+	return p, nil
+}
+
+// Result holds the number of events removed by each rule in a run.
+type Result struct {
+	Deleted  map[string]int
+	Archives []string
+}
+
+func (p *policy) run(now time.Time) (*Result, error) {
+	result := &Result{Deleted: map[string]int{}}
+	var arch *archive
+	if p.archivePath != "" {
+		arch = newArchive(p.archivePath, now)
+		defer func() {
+			if arch.count > 0 {
+				result.Archives = append(result.Archives, arch.fileName)
+			}
+		}()
+		defer arch.Close()
+	}
+	for i := range p.rules {
+		n, err := p.expire(i, now, arch)
+		if n > 0 {
+			result.Deleted[p.rules[i].name] = n
+			eventsRemoved.Add(float64(n), p.rules[i].name)
+		}
+		if err != nil {
+			return result, fmt.Errorf("unable to expire events for rule %q: %s", p.rules[i].name, err)
+		}
+	}
+	return result, nil
+}
+
+func (p *policy) expire(i int, now time.Time, arch *archive) (int, error) {
+	query := p.query(i, now)
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	if arch == nil {
+		info, err := coll.RemoveAll(query)
+		if err != nil {
+			return 0, err
+		}
+		return info.Removed, nil
+	}
+	total := 0
+	for {
+		evts, err := event.List(&event.Filter{
+			Raw:            query,
+			Sort:           "endtime",
+			Limit:          BatchSize,
+			IncludeRemoved: true,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(evts) == 0 {
+			return total, nil
+		}
+		ids := make([]bson.ObjectId, len(evts))
+		for j := range evts {
+			err = arch.add(&evts[j])
+			if err != nil {
+				return total, err
+			}
+			ids[j] = evts[j].UniqueID
+		}
+		// Events are only removed after being written to the archive, a
+		// failure flushing it keeps them in the database.
+		err = arch.Flush()
+		if err != nil {
+			return total, err
+		}
+		eventsArchived.Add(float64(len(evts)))
+		info, err := coll.RemoveAll(bson.M{"uniqueid": bson.M{"$in": ids}})
+		if err != nil {
+			return total, err
+		}
+		total += info.Removed
+	}
+}
+
+func runOnce(p *policy) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeEvent, Value: "retention"},
+		InternalKind: eventKind,
+		Allowed:      event.Allowed(permission.PermDebug),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[event retention] skipping, already running in another instance")
+			return
+		}
+		log.Errorf("[event retention] unable to create event: %s", err)
+		return
+	}
+	result, err := p.run(time.Now().UTC())
+	if err != nil {
+		retentionRuns.Inc("error")
+		log.Errorf("[event retention] %s", err)
+	} else {
+		retentionRuns.Inc("success")
+	}
+	if len(result.Deleted) == 0 && err == nil {
+		// Avoids filling the collection with events about nothing being
+		// removed.
+		evt.Abort()
+		return
+	}
+	evt.DoneCustomData(err, result)
+}
+
+type worker struct {
+	policy   *policy
+	interval time.Duration
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (w *worker) start() {
+	w.doneCh = make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			runOnce(w.policy)
+			select {
+			case <-w.doneCh:
+				return
+			case <-time.After(w.interval):
+			}
+		}
+	}()
+}
+
+func (w *worker) Shutdown() {
+	close(w.doneCh)
+	w.wg.Wait()
+}
+
+func (w *worker) String() string {
+	return "event retention"
+}
+
+// Initialize reads the event:retention config entry and starts removing
+// expired events periodically.
+func Initialize() error {
+	p, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	if p == nil || len(p.rules) == 0 {
+		return nil
+	}
+	interval := defaultInterval
+	if seconds, err := config.GetInt("event:retention:interval"); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	w := &worker{policy: p, interval: interval}
+	w.start()
+	shutdown.Register(w)
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// newEvent creates a finished event that ended the given number of days ago.
+func newEvent(c *check.C, targetType event.TargetType, kind *permission.PermissionScheme, daysAgo int) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target:      event.Target{Type: targetType, Value: bson.NewObjectId().Hex()},
+		Kind:        kind,
+		RawOwner:    event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+		Allowed:     event.Allowed(permission.PermAppReadEvents),
+		DisableLock: true,
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	endTime := time.Now().UTC().Add(-time.Duration(daysAgo) * 24 * time.Hour)
+	err = conn.Events().Update(bson.M{"uniqueid": evt.UniqueID}, bson.M{"$set": bson.M{"endtime": endTime}})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func remainingIDs(c *check.C) []bson.ObjectId {
+	evts, err := event.List(&event.Filter{IncludeRemoved: true, Sort: "uniqueid"})
+	c.Assert(err, check.IsNil)
+	var ids []bson.ObjectId
+	for i := range evts {
+		ids = append(ids, evts[i].UniqueID)
+	}
+	return ids
+}
+
+func (s *S) TestLoadPolicy(c *check.C) {
+	config.Set("event:retention:archive-path", "/var/lib/tsuru/events")
+	config.Set("event:retention:rules:deploy:kind", "app.deploy")
+	config.Set("event:retention:rules:deploy:days", 365)
+	config.Set("event:retention:rules:healer:target-type", "node")
+	config.Set("event:retention:rules:healer:days", 30)
+	p, err := loadPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.DeepEquals, &policy{
+		archivePath: "/var/lib/tsuru/events",
+		rules: []rule{
+			{name: "deploy", kind: "app.deploy", maxAge: 365 * 24 * time.Hour},
+			{name: "healer", targetType: "node", maxAge: 30 * 24 * time.Hour},
+		},
+	})
+}
+
+func (s *S) TestLoadPolicyNotConfigured(c *check.C) {
+	p, err := loadPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(p, check.IsNil)
+}
+
+func (s *S) TestLoadPolicyInvalidDays(c *check.C) {
+	config.Set("event:retention:rules:deploy:kind", "app.deploy")
+	_, err := loadPolicy()
+	c.Assert(err, check.ErrorMatches, `config key 'event:retention:rules:deploy:days' must be a positive integer`)
+}
+
+func (s *S) TestLoadPolicyDuplicatedRules(c *check.C) {
+	config.Set("event:retention:rules:a:kind", "app.deploy")
+	config.Set("event:retention:rules:a:days", 1)
+	config.Set("event:retention:rules:b:kind", "app.deploy")
+	config.Set("event:retention:rules:b:days", 2)
+	_, err := loadPolicy()
+	c.Assert(err, check.ErrorMatches, `event retention rules "a" and "b" match the same events`)
+}
+
+func (s *S) TestPolicyQuery(c *check.C) {
+	now := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+	p := &policy{rules: []rule{
+		{name: "default", maxAge: 10 * 24 * time.Hour},
+		{name: "deploy", kind: "app.deploy", maxAge: 24 * time.Hour},
+		{name: "nodes", targetType: "node", maxAge: 24 * time.Hour},
+	}}
+	c.Assert(p.query(0, now), check.DeepEquals, bson.M{
+		"running": false,
+		"endtime": bson.M{"$lt": now.Add(-10 * 24 * time.Hour)},
+		"$nor":    []bson.M{{"kind.name": "app.deploy"}, {"target.type": "node"}},
+	})
+	c.Assert(p.query(1, now), check.DeepEquals, bson.M{
+		"kind.name": "app.deploy",
+		"running":   false,
+		"endtime":   bson.M{"$lt": now.Add(-24 * time.Hour)},
+	})
+	c.Assert(p.query(2, now), check.DeepEquals, bson.M{
+		"target.type": "node",
+		"running":     false,
+		"endtime":     bson.M{"$lt": now.Add(-24 * time.Hour)},
+		"$nor":        []bson.M{{"kind.name": "app.deploy"}},
+	})
+}
+
+func (s *S) TestPolicyRun(c *check.C) {
+	newEvent(c, event.TargetTypeApp, permission.PermAppDeploy, 40)
+	newDeploy := newEvent(c, event.TargetTypeApp, permission.PermAppDeploy, 20)
+	newEvent(c, event.TargetTypeApp, permission.PermAppUpdateEnvSet, 15)
+	newOther := newEvent(c, event.TargetTypeApp, permission.PermAppUpdateEnvSet, 5)
+	running, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: "running"},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+		Allowed:  event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer running.Done(nil)
+	p := &policy{rules: []rule{
+		{name: "default", maxAge: 10 * 24 * time.Hour},
+		{name: "deploy", kind: "app.deploy", maxAge: 30 * 24 * time.Hour},
+	}}
+	removed := eventsRemoved.Value("deploy")
+	result, err := p.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &Result{Deleted: map[string]int{"default": 1, "deploy": 1}})
+	c.Assert(eventsRemoved.Value("deploy"), check.Equals, removed+1)
+	c.Assert(remainingIDs(c), check.DeepEquals, []bson.ObjectId{newDeploy.UniqueID, newOther.UniqueID, running.UniqueID})
+}
+
+func (s *S) TestPolicyRunWithArchive(c *check.C) {
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() { fsystem = nil }()
+	BatchSize = 1
+	defer func() { BatchSize = 1000 }()
+	old1 := newEvent(c, event.TargetTypeNode, permission.PermAppDeploy, 40)
+	old2 := newEvent(c, event.TargetTypeNode, permission.PermAppDeploy, 35)
+	recent := newEvent(c, event.TargetTypeNode, permission.PermAppDeploy, 1)
+	p := &policy{
+		archivePath: "/var/lib/tsuru/events",
+		rules:       []rule{{name: "nodes", targetType: "node", maxAge: 30 * 24 * time.Hour}},
+	}
+	archivedCount := eventsArchived.Value()
+	result, err := p.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Deleted, check.DeepEquals, map[string]int{"nodes": 2})
+	c.Assert(eventsArchived.Value(), check.Equals, archivedCount+2)
+	c.Assert(result.Archives, check.HasLen, 1)
+	c.Assert(remainingIDs(c), check.DeepEquals, []bson.ObjectId{recent.UniqueID})
+	c.Assert(rfs.HasAction("mkdirall /var/lib/tsuru/events with mode 0750"), check.Equals, true)
+	f, err := rfs.Open(result.Archives[0])
+	c.Assert(err, check.IsNil)
+	gz, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	scanner := bufio.NewScanner(gz)
+	var archived []bson.ObjectId
+	for scanner.Scan() {
+		var evt event.Event
+		err = json.Unmarshal(scanner.Bytes(), &evt)
+		c.Assert(err, check.IsNil)
+		archived = append(archived, evt.UniqueID)
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	c.Assert(archived, check.DeepEquals, []bson.ObjectId{old1.UniqueID, old2.UniqueID})
+}
+
+func (s *S) TestArchiveFileName(c *check.C) {
+	now := time.Date(2016, 10, 1, 12, 30, 0, 0, time.UTC)
+	a := newArchive("/var/lib/tsuru/events", now)
+	c.Assert(a.fileName, check.Equals, "/var/lib/tsuru/events/events-20161001T123000Z.ndjson.gz")
+}
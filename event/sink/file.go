@@ -0,0 +1,59 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/fs"
+)
+
+var fsystem fs.Fs
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+func init() {
+	Register("file", newFileSink)
+}
+
+// fileSink appends messages to a file, one JSON document per line (NDJSON).
+type fileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newFileSink(name, prefix string) (Sink, error) {
+	path, err := config.GetString(prefix + ":path")
+	if err != nil {
+		return nil, fmt.Errorf("config key '%s:path' not found", prefix)
+	}
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Send(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := filesystem().OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestFileSinkSend(c *check.C) {
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() { fsystem = nil }()
+	config.Set("event:sinks:audit:path", "/var/log/events.json")
+	defer config.Unset("event:sinks")
+	sink, err := newFileSink("audit", "event:sinks:audit")
+	c.Assert(err, check.IsNil)
+	evt := &event.Event{}
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	err = sink.Send(&Message{Status: StatusStarted, Event: evt})
+	c.Assert(err, check.IsNil)
+	err = sink.Send(&Message{Status: StatusFinished, Event: evt})
+	c.Assert(err, check.IsNil)
+	c.Assert(rfs.HasAction("openfile /var/log/events.json with mode 0640"), check.Equals, true)
+	f, err := rfs.Open("/var/log/events.json")
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(f)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	var msg map[string]interface{}
+	err = json.Unmarshal([]byte(lines[1]), &msg)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg["Status"], check.Equals, "finished")
+}
@@ -0,0 +1,307 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sink forwards events stored by the event package to external
+// destinations, like SIEM systems, as they start and finish.
+//
+// Each configured sink keeps a checkpoint in MongoDB with the time and the id of
+// the last forwarded event, delivery is retried from this checkpoint until the sink
+// accepts the message, which means that every event is delivered at least
+// once.
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	StatusStarted  = Status("started")
+	StatusFinished = Status("finished")
+)
+
+var (
+	// Interval between two runs looking for new events.
+	Interval = 10 * time.Second
+	// Delay applied before forwarding an event, it avoids missing events
+	// inserted with a slightly older timestamp by other tsuru API instances.
+	Delay = 5 * time.Second
+	// Maximum number of events read from the database at once.
+	BatchSize = 100
+
+	sinks         = make(map[string]sinkFactory)
+	internalSinks []*configuredSink
+)
+
+type sinkFactory func(name, configPrefix string) (Sink, error)
+
+// Sink is the interface that must be implemented by event destinations.
+type Sink interface {
+	Send(msg *Message) error
+}
+
+type Status string
+
+// Message is the data sent to sinks, it holds the event and whether it has
+// just started or finished.
+type Message struct {
+	Status Status
+	Time   time.Time
+	Event  *event.Event
+}
+
+// Register registers a new sink type.
+func Register(sinkType string, factory sinkFactory) {
+	sinks[sinkType] = factory
+}
+
+// AddInternal adds a sink used by tsuru itself. Internal sinks receive every
+// event, regardless of the event:sinks config entry. It must be called before
+// Initialize.
+func AddInternal(name string, s Sink) {
+	// Config keys can't contain ":", so internal names never collide with
+	// configured sinks.
+	internalSinks = append(internalSinks, &configuredSink{name: "internal:" + name, sink: s})
+}
+
+type checkpoint struct {
+	Name      string `bson:"_id"`
+	StartTime time.Time
+	StartID   bson.ObjectId `bson:",omitempty"`
+	EndTime   time.Time
+	EndID     bson.ObjectId `bson:",omitempty"`
+}
+
+type configuredSink struct {
+	name        string
+	sink        Sink
+	kinds       []string
+	targetTypes []string
+}
+
+func (s *configuredSink) String() string {
+	return s.name
+}
+
+func (s *configuredSink) run(now time.Time) error {
+	until := now.Add(-Delay)
+	cp, err := s.checkpoint(until)
+	if err != nil {
+		return err
+	}
+	err = s.forward(StatusStarted, "starttime", "startid", cp.StartTime, cp.StartID, until)
+	if err != nil {
+		return err
+	}
+	return s.forward(StatusFinished, "endtime", "endid", cp.EndTime, cp.EndID, until)
+}
+
+// forward sends the events after the (since, sinceID) checkpoint, ordered by
+// time and unique id, so events sharing the same timestamp are never skipped
+// when a batch ends among them.
+func (s *configuredSink) forward(status Status, field, idField string, since time.Time, sinceID bson.ObjectId, until time.Time) (err error) {
+	query := bson.M{field: bson.M{"$gt": since, "$lte": until}}
+	if sinceID != "" {
+		query[field] = bson.M{"$gte": since, "$lte": until}
+		query["$or"] = []bson.M{
+			{field: bson.M{"$gt": since}},
+			{"uniqueid": bson.M{"$gt": sinceID}},
+		}
+	}
+	if len(s.kinds) > 0 {
+		query["kind.name"] = bson.M{"$in": s.kinds}
+	}
+	if len(s.targetTypes) > 0 {
+		query["target.type"] = bson.M{"$in": s.targetTypes}
+	}
+	evts, err := event.List(&event.Filter{
+		Raw:            query,
+		Sort:           field + ",uniqueid",
+		Limit:          BatchSize,
+		IncludeRemoved: true,
+	})
+	if err != nil {
+		return err
+	}
+	evtTime := func(evt *event.Event) time.Time {
+		if status == StatusStarted {
+			return evt.StartTime
+		}
+		return evt.EndTime
+	}
+	var last *event.Event
+	defer func() {
+		if last == nil {
+			return
+		}
+		saveErr := s.saveCheckpoint(field, evtTime(last), idField, last.UniqueID)
+		if err == nil {
+			err = saveErr
+		}
+	}()
+	for i := range evts {
+		evt := &evts[i]
+		t := evtTime(evt)
+		err = s.sink.Send(&Message{Status: status, Time: t, Event: evt})
+		if err != nil {
+			return fmt.Errorf("unable to send event %s: %s", evt.UniqueID.Hex(), err)
+		}
+		last = evt
+	}
+	return nil
+}
+
+func (s *configuredSink) checkpoint(initial time.Time) (*checkpoint, error) {
+	coll, err := checkpointsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var cp checkpoint
+	err = coll.FindId(s.name).One(&cp)
+	if err == mgo.ErrNotFound {
+		// New sinks only receive events created after they're configured.
+		cp = checkpoint{Name: s.name, StartTime: initial, EndTime: initial}
+		err = coll.Insert(cp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (s *configuredSink) saveCheckpoint(field string, t time.Time, idField string, id bson.ObjectId) error {
+	coll, err := checkpointsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.UpdateId(s.name, bson.M{"$set": bson.M{field: t, idField: id}})
+}
+
+func checkpointsCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("event_sinks"), nil
+}
+
+func getConfiguredSink(name string) (*configuredSink, error) {
+	prefix := "event:sinks:" + name
+	sinkType, err := config.GetString(prefix + ":type")
+	if err != nil {
+		return nil, fmt.Errorf("config key '%s:type' not found", prefix)
+	}
+	factory, ok := sinks[sinkType]
+	if !ok {
+		return nil, fmt.Errorf("unknown event sink: %q.", sinkType)
+	}
+	sink, err := factory(name, prefix)
+	if err != nil {
+		return nil, err
+	}
+	kinds, _ := config.GetList(prefix + ":kinds")
+	targetTypes, _ := config.GetList(prefix + ":target-types")
+	return &configuredSink{
+		name:        name,
+		sink:        sink,
+		kinds:       kinds,
+		targetTypes: targetTypes,
+	}, nil
+}
+
+func listConfigured() ([]*configuredSink, error) {
+	sinksConfig, err := config.Get("event:sinks")
+	if err != nil {
+		return nil, nil
+	}
+	sinksMap, ok := sinksConfig.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid value for config key 'event:sinks'")
+	}
+	var names []string
+	for key := range sinksMap {
+		names = append(names, fmt.Sprint(key))
+	}
+	sort.Strings(names)
+	configured := make([]*configuredSink, len(names))
+	for i, name := range names {
+		configured[i], err = getConfiguredSink(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return configured, nil
+}
+
+type dispatcher struct {
+	sinks  []*configuredSink
+	doneCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (d *dispatcher) runOnce() {
+	now := time.Now().UTC()
+	for _, s := range d.sinks {
+		err := s.run(now)
+		if err != nil {
+			log.Errorf("[event sink %s] %s", s, err)
+		}
+	}
+}
+
+func (d *dispatcher) start() {
+	d.doneCh = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			d.runOnce()
+			select {
+			case <-d.doneCh:
+				return
+			case <-time.After(Interval):
+			}
+		}
+	}()
+}
+
+func (d *dispatcher) Shutdown() {
+	close(d.doneCh)
+	d.wg.Wait()
+}
+
+func (d *dispatcher) String() string {
+	return "event sinks"
+}
+
+// Initialize reads the sinks configured under the event:sinks config key and
+// starts forwarding events to them and to internal sinks.
+func Initialize() error {
+	configured, err := listConfigured()
+	if err != nil {
+		return err
+	}
+	configured = append(configured, internalSinks...)
+	if len(configured) == 0 {
+		return nil
+	}
+	d := &dispatcher{sinks: configured}
+	d.start()
+	shutdown.Register(d)
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeSink struct {
+	msgs   []Message
+	failOn int
+}
+
+func (s *fakeSink) Send(msg *Message) error {
+	if s.failOn > 0 && len(s.msgs)+1 == s.failOn {
+		s.failOn = 0
+		return errors.New("send failure")
+	}
+	s.msgs = append(s.msgs, *msg)
+	return nil
+}
+
+func (s *fakeSink) summary() []string {
+	var result []string
+	for _, m := range s.msgs {
+		result = append(result, string(m.Status)+" "+m.Event.Target.Value)
+	}
+	return result
+}
+
+func newEvent(c *check.C, targetType event.TargetType, value string) *event.Event {
+	// Events are stored with millisecond precision, sleeping ensures they're
+	// ordered.
+	time.Sleep(10 * time.Millisecond)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: targetType, Value: value},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+		Allowed:  event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestConfiguredSinkRun(c *check.C) {
+	fake := &fakeSink{}
+	cs := &configuredSink{name: "mysink", sink: fake}
+	err := cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	evt1 := newEvent(c, event.TargetTypeApp, "app1")
+	evt2 := newEvent(c, event.TargetTypeApp, "app2")
+	err = evt1.Done(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.summary(), check.DeepEquals, []string{
+		"started app1", "started app2", "finished app1",
+	})
+	err = evt2.Done(errors.New("my error"))
+	c.Assert(err, check.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.summary(), check.DeepEquals, []string{
+		"started app1", "started app2", "finished app1", "finished app2",
+	})
+	c.Assert(fake.msgs[3].Event.Error, check.Equals, "my error")
+	c.Assert(fake.msgs[3].Time.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestConfiguredSinkRunIgnoresEventsBeforeCreation(c *check.C) {
+	evt := newEvent(c, event.TargetTypeApp, "app1")
+	err := evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	fake := &fakeSink{}
+	cs := &configuredSink{name: "mysink", sink: fake}
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.msgs, check.HasLen, 0)
+}
+
+func (s *S) TestConfiguredSinkRunRetriesAfterFailure(c *check.C) {
+	fake := &fakeSink{failOn: 2}
+	cs := &configuredSink{name: "mysink", sink: fake}
+	err := cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	newEvent(c, event.TargetTypeApp, "app1")
+	newEvent(c, event.TargetTypeApp, "app2")
+	time.Sleep(10 * time.Millisecond)
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.ErrorMatches, `unable to send event .*: send failure`)
+	c.Assert(fake.summary(), check.DeepEquals, []string{"started app1"})
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.summary(), check.DeepEquals, []string{"started app1", "started app2"})
+}
+
+func (s *S) TestConfiguredSinkRunSameTimestampFullBatch(c *check.C) {
+	defer func(size int) { BatchSize = size }(BatchSize)
+	BatchSize = 2
+	fake := &fakeSink{}
+	cs := &configuredSink{name: "mysink", sink: fake}
+	err := cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	newEvent(c, event.TargetTypeApp, "app1")
+	newEvent(c, event.TargetTypeApp, "app2")
+	newEvent(c, event.TargetTypeApp, "app3")
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	_, err = conn.Events().UpdateAll(nil, bson.M{"$set": bson.M{"starttime": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		err = cs.run(time.Now().UTC())
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(fake.summary(), check.DeepEquals, []string{"started app1", "started app2", "started app3"})
+}
+
+func (s *S) TestConfiguredSinkRunFilters(c *check.C) {
+	fake := &fakeSink{}
+	cs := &configuredSink{name: "mysink", sink: fake, targetTypes: []string{"pool"}}
+	err := cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	newEvent(c, event.TargetTypeApp, "app1")
+	newEvent(c, event.TargetTypePool, "pool1")
+	time.Sleep(10 * time.Millisecond)
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.summary(), check.DeepEquals, []string{"started pool1"})
+	cs = &configuredSink{name: "othersink", sink: fake, kinds: []string{"app.deploy"}}
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	newEvent(c, event.TargetTypePool, "pool2")
+	time.Sleep(10 * time.Millisecond)
+	err = cs.run(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	c.Assert(fake.summary(), check.DeepEquals, []string{"started pool1"})
+}
+
+func (s *S) TestListConfigured(c *check.C) {
+	config.Set("event:sinks:siem:type", "webhook")
+	config.Set("event:sinks:siem:url", "http://localhost:1234")
+	config.Set("event:sinks:siem:kinds", []interface{}{"app.deploy"})
+	config.Set("event:sinks:audit:type", "file")
+	config.Set("event:sinks:audit:path", "/var/log/events.json")
+	config.Set("event:sinks:audit:target-types", []interface{}{"app", "pool"})
+	configured, err := listConfigured()
+	c.Assert(err, check.IsNil)
+	c.Assert(configured, check.HasLen, 2)
+	c.Assert(configured[0].name, check.Equals, "audit")
+	c.Assert(configured[0].sink, check.DeepEquals, &fileSink{path: "/var/log/events.json"})
+	c.Assert(configured[0].targetTypes, check.DeepEquals, []string{"app", "pool"})
+	c.Assert(configured[1].name, check.Equals, "siem")
+	c.Assert(configured[1].kinds, check.DeepEquals, []string{"app.deploy"})
+}
+
+func (s *S) TestListConfiguredInvalidType(c *check.C) {
+	config.Set("event:sinks:siem:type", "carrier-pigeon")
+	_, err := listConfigured()
+	c.Assert(err, check.ErrorMatches, `unknown event sink: "carrier-pigeon".`)
+}
+
+func (s *S) TestListConfiguredNoSinks(c *check.C) {
+	configured, err := listConfigured()
+	c.Assert(err, check.IsNil)
+	c.Assert(configured, check.HasLen, 0)
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+)
+
+const (
+	syslogSeverityError = 3
+	syslogSeverityInfo  = 6
+
+	defaultSyslogFacility = 16 // local0
+)
+
+func init() {
+	Register("syslog", newSyslogSink)
+}
+
+// syslogSink sends messages formatted according to RFC5424. The address must
+// use one of the udp, tcp or tls schemes. Messages sent over tcp and tls use
+// octet counting framing, as described in RFC6587.
+type syslogSink struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+func newSyslogSink(name, prefix string) (Sink, error) {
+	rawAddr, err := config.GetString(prefix + ":address")
+	if err != nil {
+		return nil, fmt.Errorf("config key '%s:address' not found", prefix)
+	}
+	addr, err := url.Parse(rawAddr)
+	if err != nil {
+		return nil, err
+	}
+	switch addr.Scheme {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("invalid scheme for syslog address %q, must be one of udp, tcp or tls", rawAddr)
+	}
+	facility, err := config.GetInt(prefix + ":facility")
+	if err != nil {
+		facility = defaultSyslogFacility
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d", facility)
+	}
+	tag, _ := config.GetString(prefix + ":tag")
+	if tag == "" {
+		tag = "tsuru"
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{
+		network:  addr.Scheme,
+		address:  addr.Host,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+	}, nil
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, nil)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+func (s *syslogSink) format(msg *Message) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	severity := syslogSeverityInfo
+	if msg.Status == StatusFinished && msg.Event.Error != "" {
+		severity = syslogSeverityError
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s - %s - ",
+		s.facility*8+severity,
+		msg.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.tag,
+		msg.Status,
+	)
+	line := append([]byte(header), data...)
+	if s.network != "udp" {
+		line = append([]byte(fmt.Sprintf("%d ", len(line))), line...)
+	}
+	return line, nil
+}
+
+func (s *syslogSink) Send(msg *Message) error {
+	line, err := s.format(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		s.conn, err = s.dial()
+		if err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err = s.conn.Write(line)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
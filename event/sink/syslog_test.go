@@ -0,0 +1,75 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSyslogSinkSendUDP(c *check.C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	config.Set("event:sinks:sys:address", "udp://"+conn.LocalAddr().String())
+	defer config.Unset("event:sinks")
+	sink, err := newSyslogSink("sys", "event:sinks:sys")
+	c.Assert(err, check.IsNil)
+	evt := &event.Event{}
+	evt.Error = "my error"
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	err = sink.Send(&Message{Status: StatusFinished, Time: now, Event: evt})
+	c.Assert(err, check.IsNil)
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, check.IsNil)
+	hostname, _ := os.Hostname()
+	line := string(buf[:n])
+	c.Assert(strings.HasPrefix(line, "<131>1 2016-10-01T12:00:00Z "+hostname+" tsuru - finished - {"), check.Equals, true)
+	c.Assert(strings.Contains(line, `"Error":"my error"`), check.Equals, true)
+}
+
+func (s *S) TestSyslogSinkSendTCP(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('}')
+		received <- line
+	}()
+	config.Set("event:sinks:sys:address", "tcp://"+l.Addr().String())
+	config.Set("event:sinks:sys:facility", 1)
+	config.Set("event:sinks:sys:tag", "mytsuru")
+	defer config.Unset("event:sinks")
+	sink, err := newSyslogSink("sys", "event:sinks:sys")
+	c.Assert(err, check.IsNil)
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	err = sink.Send(&Message{Status: StatusStarted, Time: now, Event: &event.Event{}})
+	c.Assert(err, check.IsNil)
+	line := <-received
+	parts := strings.SplitN(line, " ", 2)
+	c.Assert(strings.HasPrefix(parts[1], "<14>1 2016-10-01T12:00:00Z "), check.Equals, true)
+	c.Assert(strings.Contains(parts[1], " mytsuru - started - "), check.Equals, true)
+}
+
+func (s *S) TestNewSyslogSinkInvalidAddress(c *check.C) {
+	config.Set("event:sinks:sys:address", "http://localhost:514")
+	defer config.Unset("event:sinks")
+	_, err := newSyslogSink("sys", "event:sinks:sys")
+	c.Assert(err, check.ErrorMatches, `invalid scheme for syslog address "http://localhost:514", must be one of udp, tcp or tls`)
+}
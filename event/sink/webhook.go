@@ -0,0 +1,72 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/tsuru/config"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+func init() {
+	Register("webhook", newWebhookSink)
+}
+
+// webhookSink sends each message as a JSON document in the body of a POST
+// request.
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookSink(name, prefix string) (Sink, error) {
+	url, err := config.GetString(prefix + ":url")
+	if err != nil {
+		return nil, fmt.Errorf("config key '%s:url' not found", prefix)
+	}
+	headers := map[string]string{}
+	rawHeaders, _ := config.Get(prefix + ":headers")
+	if headersMap, ok := rawHeaders.(map[interface{}]interface{}); ok {
+		for k, v := range headersMap {
+			headers[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+	}
+	return &webhookSink{
+		url:     url,
+		headers: headers,
+		client:  tsuruNet.Dial5Full60ClientNoKeepAlive,
+	}, nil
+}
+
+func (s *webhookSink) Send(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return fmt.Errorf("invalid status code from webhook %s: %d - %s", s.url, rsp.StatusCode, body)
+	}
+	return nil
+}
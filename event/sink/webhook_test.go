@@ -0,0 +1,68 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestWebhookSinkSend(c *check.C) {
+	var received *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+	config.Set("event:sinks:siem:url", srv.URL+"/events")
+	config.Set("event:sinks:siem:headers:X-Token", "abc")
+	defer config.Unset("event:sinks")
+	sink, err := newWebhookSink("siem", "event:sinks:siem")
+	c.Assert(err, check.IsNil)
+	evt := &event.Event{}
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	now := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	err = sink.Send(&Message{Status: StatusStarted, Time: now, Event: evt})
+	c.Assert(err, check.IsNil)
+	c.Assert(received.Method, check.Equals, "POST")
+	c.Assert(received.URL.Path, check.Equals, "/events")
+	c.Assert(received.Header.Get("Content-Type"), check.Equals, "application/json")
+	c.Assert(received.Header.Get("X-Token"), check.Equals, "abc")
+	var data map[string]interface{}
+	err = json.Unmarshal(body, &data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data["Status"], check.Equals, "started")
+	c.Assert(data["Time"], check.Equals, "2016-10-01T12:00:00Z")
+	c.Assert(data["Event"].(map[string]interface{})["Target"], check.DeepEquals, map[string]interface{}{
+		"Type": "app", "Value": "myapp",
+	})
+}
+
+func (s *S) TestWebhookSinkSendInvalidStatus(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("my error"))
+	}))
+	defer srv.Close()
+	config.Set("event:sinks:siem:url", srv.URL)
+	defer config.Unset("event:sinks")
+	sink, err := newWebhookSink("siem", "event:sinks:siem")
+	c.Assert(err, check.IsNil)
+	err = sink.Send(&Message{Status: StatusStarted, Event: &event.Event{}})
+	c.Assert(err, check.ErrorMatches, `invalid status code from webhook .*: 500 - my error`)
+}
+
+func (s *S) TestNewWebhookSinkMissingURL(c *check.C) {
+	_, err := newWebhookSink("siem", "event:sinks:siem")
+	c.Assert(err, check.ErrorMatches, `config key 'event:sinks:siem:url' not found`)
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	StreamCreated  = StreamMessageType("created")
+	StreamUpdated  = StreamMessageType("updated")
+	StreamLog      = StreamMessageType("log")
+	StreamFinished = StreamMessageType("finished")
+)
+
+var (
+	StreamPubSubQueueName = "pubsub:events"
+	// LogPublishInterval is the interval used to coalesce the log output of
+	// running events, so writing to an event log doesn't publish a message
+	// for every line.
+	LogPublishInterval = 500 * time.Millisecond
+)
+
+type StreamMessageType string
+
+// StreamMessage is published every time an event is created, updated or
+// finished. Messages of type StreamLog hold the log output written to a
+// running event in the Log field, the Log field of the event itself is not
+// sent in them.
+type StreamMessage struct {
+	Type  StreamMessageType
+	Event *Event
+	Log   string
+}
+
+func publish(msgType StreamMessageType, data eventData, logData string) {
+	if msgType == StreamLog {
+		data.Log = ""
+	}
+	msg := StreamMessage{Type: msgType, Event: &Event{eventData: data}, Log: logData}
+	factory, err := queue.Factory()
+	if err != nil {
+		log.Errorf("[events] error publishing event %s: %s", data.UniqueID.Hex(), err)
+		return
+	}
+	pubSubQ, err := factory.PubSub(StreamPubSubQueueName)
+	if err != nil {
+		log.Errorf("[events] error publishing event %s: %s", data.UniqueID.Hex(), err)
+		return
+	}
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		log.Errorf("[events] error publishing event %s: %s", data.UniqueID.Hex(), err)
+		return
+	}
+	err = pubSubQ.Pub(bytes)
+	if err != nil {
+		log.Errorf("[events] error publishing event %s: %s", data.UniqueID.Hex(), err)
+	}
+}
+
+type pendingLog struct {
+	data eventData
+	buf  bytes.Buffer
+}
+
+var logPublisher = struct {
+	sync.Mutex
+	pending map[bson.ObjectId]*pendingLog
+	// flushMu ensures logs are published in order, and before the event is
+	// published as finished.
+	flushMu sync.Mutex
+}{pending: make(map[bson.ObjectId]*pendingLog)}
+
+// publishLog buffers the log output of the event, it's published in a single
+// message after LogPublishInterval.
+func publishLog(data eventData, msg string) {
+	logPublisher.Lock()
+	defer logPublisher.Unlock()
+	p := logPublisher.pending[data.UniqueID]
+	if p == nil {
+		p = &pendingLog{}
+		logPublisher.pending[data.UniqueID] = p
+		id := data.UniqueID
+		time.AfterFunc(LogPublishInterval, func() { flushLog(id) })
+	}
+	p.data = data
+	p.buf.WriteString(msg)
+}
+
+// flushLog publishes the log output of the event buffered by publishLog.
+func flushLog(id bson.ObjectId) {
+	logPublisher.flushMu.Lock()
+	defer logPublisher.flushMu.Unlock()
+	logPublisher.Lock()
+	p := logPublisher.pending[id]
+	delete(logPublisher.pending, id)
+	logPublisher.Unlock()
+	if p != nil {
+		publish(StreamLog, p.data, p.buf.String())
+	}
+}
+
+// Listener receives stream messages for events matching a filter as they're
+// published by any tsuru API instance.
+type Listener struct {
+	c         <-chan StreamMessage
+	q         queue.PubSubQ
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener subscribes to the event stream. Only the Target, KindType,
+// KindName, OwnerType, OwnerName, Running, ErrorOnly, AllowedTargets and
+// Permissions fields in the filter are considered.
+func NewListener(filter *Filter) (*Listener, error) {
+	if filter == nil {
+		filter = &Filter{}
+	}
+	factory, err := queue.Factory()
+	if err != nil {
+		return nil, err
+	}
+	pubSubQ, err := factory.PubSub(StreamPubSubQueueName)
+	if err != nil {
+		return nil, err
+	}
+	subChan, err := pubSubQ.Sub()
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan StreamMessage, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(c)
+		// The subscription is drained until it's closed by Close, even after
+		// the listener is done.
+		for data := range subChan {
+			select {
+			case <-done:
+				continue
+			default:
+			}
+			var msg StreamMessage
+			err := json.Unmarshal(data, &msg)
+			if err != nil || msg.Event == nil {
+				log.Errorf("[events] unparsable stream message, ignoring: %s", string(data))
+				continue
+			}
+			if filter.matches(msg.Event) {
+				select {
+				case c <- msg:
+				case <-done:
+				}
+			}
+		}
+	}()
+	return &Listener{c: c, q: pubSubQ, done: done}, nil
+}
+
+func (l *Listener) ListenChan() <-chan StreamMessage {
+	return l.c
+}
+
+func (l *Listener) Close() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Recovered panic closing listener (possible double close): %v", r)
+		}
+	}()
+	l.closeOnce.Do(func() { close(l.done) })
+	err = l.q.UnSub()
+	return
+}
+
+// matches is the in memory counterpart of toQuery, used to filter streamed
+// events.
+func (f *Filter) matches(e *Event) bool {
+	if f.Permissions != nil && !permissionsMatch(f.Permissions, &e.Allowed) {
+		return false
+	}
+	if f.AllowedTargets != nil {
+		var found bool
+		for _, at := range f.AllowedTargets {
+			if at.Type == e.Target.Type && (at.Values == nil || contains(at.Values, e.Target.Value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Target.Type != "" && f.Target.Type != e.Target.Type {
+		return false
+	}
+	if f.Target.Value != "" && f.Target.Value != e.Target.Value {
+		return false
+	}
+	if f.KindType != "" && f.KindType != e.Kind.Type {
+		return false
+	}
+	if f.KindName != "" && f.KindName != e.Kind.Name {
+		return false
+	}
+	if f.OwnerType != "" && f.OwnerType != e.Owner.Type {
+		return false
+	}
+	if f.OwnerName != "" && f.OwnerName != e.Owner.Name {
+		return false
+	}
+	if f.Running != nil && *f.Running != e.Running {
+		return false
+	}
+	if f.ErrorOnly && e.Error == "" {
+		return false
+	}
+	return true
+}
+
+func permissionsMatch(perms []permission.Permission, allowed *AllowedPermission) bool {
+	for _, p := range perms {
+		name := p.Scheme.FullName()
+		if !strings.HasPrefix(allowed.Scheme, name) {
+			continue
+		}
+		if p.Context.CtxType == permission.CtxGlobal {
+			return true
+		}
+		for _, ctx := range allowed.Contexts {
+			if ctx.CtxType == p.Context.CtxType && ctx.Value == p.Context.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestFilterMatches(c *check.C) {
+	evt := &Event{eventData: eventData{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    Kind{Type: KindTypePermission, Name: "app.update.env.set"},
+		Owner:   Owner{Type: OwnerTypeUser, Name: "me@me.com"},
+		Running: true,
+		Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "myapp"), permission.Context(permission.CtxTeam, "t1")),
+	}}
+	trueValue, falseValue := true, false
+	tests := []struct {
+		f        Filter
+		expected bool
+	}{
+		{Filter{}, true},
+		{Filter{Target: Target{Type: TargetTypeApp}}, true},
+		{Filter{Target: Target{Type: TargetTypeNode}}, false},
+		{Filter{Target: Target{Type: TargetTypeApp, Value: "other"}}, false},
+		{Filter{KindType: KindTypeInternal}, false},
+		{Filter{KindName: "app.update.env.set"}, true},
+		{Filter{KindName: "app.deploy"}, false},
+		{Filter{OwnerType: OwnerTypeApp}, false},
+		{Filter{OwnerName: "me@me.com"}, true},
+		{Filter{OwnerName: "other@me.com"}, false},
+		{Filter{Running: &trueValue}, true},
+		{Filter{Running: &falseValue}, false},
+		{Filter{ErrorOnly: true}, false},
+		{Filter{AllowedTargets: []TargetFilter{}}, false},
+		{Filter{AllowedTargets: []TargetFilter{{Type: TargetTypeApp}}}, true},
+		{Filter{AllowedTargets: []TargetFilter{{Type: TargetTypeApp, Values: []string{"a", "myapp"}}}}, true},
+		{Filter{AllowedTargets: []TargetFilter{{Type: TargetTypeApp, Values: []string{"a"}}}}, false},
+		{Filter{Permissions: []permission.Permission{}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAll, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxTeam, "t1")},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxApp, "myapp")},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "t2")},
+		}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermNode, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, false},
+	}
+	for i, tt := range tests {
+		c.Assert(tt.f.matches(evt), check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+	evt.Error = "failed"
+	c.Assert((&Filter{ErrorOnly: true}).matches(evt), check.Equals, true)
+}
+
+func (s *S) TestListener(c *check.C) {
+	l, err := NewListener(&Filter{Target: Target{Type: TargetTypeApp, Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	// Waits for the redis subscription before publishing messages.
+	time.Sleep(100 * time.Millisecond)
+	other, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "otherapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = other.Done(nil)
+	c.Assert(err, check.IsNil)
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("hello %s", "world")
+	err = evt.Done(errors.New("myerr"))
+	c.Assert(err, check.IsNil)
+	var msgs []StreamMessage
+	timeout := time.After(5 * time.Second)
+	for len(msgs) < 3 {
+		select {
+		case msg := <-l.ListenChan():
+			msgs = append(msgs, msg)
+		case <-timeout:
+			c.Fatalf("timeout waiting for messages, received: %#v", msgs)
+		}
+	}
+	c.Assert(msgs[0].Type, check.Equals, StreamCreated)
+	c.Assert(msgs[0].Event.UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(msgs[0].Event.Running, check.Equals, true)
+	c.Assert(msgs[1].Type, check.Equals, StreamLog)
+	c.Assert(msgs[1].Log, check.Equals, "hello world\n")
+	c.Assert(msgs[1].Event.Log, check.Equals, "")
+	c.Assert(msgs[2].Type, check.Equals, StreamFinished)
+	c.Assert(msgs[2].Event.Running, check.Equals, false)
+	c.Assert(msgs[2].Event.Error, check.Equals, "myerr")
+	c.Assert(msgs[2].Event.Log, check.Equals, "hello world\n")
+}
+
+func (s *S) TestListenerCoalescesLogs(c *check.C) {
+	l, err := NewListener(&Filter{Target: Target{Type: TargetTypeApp, Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	time.Sleep(100 * time.Millisecond)
+	evt, err := New(&Opts{
+		Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	evt.Logf("line 1")
+	evt.Write([]byte("line 2\n"))
+	var msgs []StreamMessage
+	timeout := time.After(5 * time.Second)
+	for len(msgs) < 2 {
+		select {
+		case msg := <-l.ListenChan():
+			msgs = append(msgs, msg)
+		case <-timeout:
+			c.Fatalf("timeout waiting for messages, received: %#v", msgs)
+		}
+	}
+	c.Assert(msgs[1].Type, check.Equals, StreamLog)
+	c.Assert(msgs[1].Log, check.Equals, "line 1\nline 2\n")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestListenerCloseWithoutReading(c *check.C) {
+	l, err := NewListener(nil)
+	c.Assert(err, check.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		evt, err := New(&Opts{
+			Target:  Target{Type: TargetTypeApp, Value: "myapp"},
+			Kind:    permission.PermAppUpdateEnvSet,
+			Owner:   s.token,
+			Allowed: Allowed(permission.PermAppReadEvents),
+		})
+		c.Assert(err, check.IsNil)
+		err = evt.Done(nil)
+		c.Assert(err, check.IsNil)
+	}
+	time.Sleep(100 * time.Millisecond)
+	err = l.Close()
+	c.Assert(err, check.IsNil)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-l.ListenChan():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			c.Fatal("timeout waiting for listener to stop")
+		}
+	}
+}
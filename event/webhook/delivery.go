@@ -0,0 +1,223 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	deliveryTaskName = "event-webhook-delivery"
+
+	maxResponseBodySize = 4096
+)
+
+var (
+	// MaxAttempts is the maximum number of delivery attempts for each event.
+	MaxAttempts = 5
+	// RetryInterval is the base interval between attempts, it doubles after
+	// each failed attempt.
+	RetryInterval = 10 * time.Second
+	// MaxListedDeliveries limits how many deliveries are returned by
+	// ListDeliveries.
+	MaxListedDeliveries = 100
+)
+
+type DeliveryRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+}
+
+type DeliveryResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Delivery records a single attempt of sending a webhook request.
+type Delivery struct {
+	ID       bson.ObjectId `bson:"_id"`
+	Webhook  string
+	EventID  bson.ObjectId
+	Attempt  int
+	Time     time.Time
+	Duration time.Duration
+	Request  DeliveryRequest
+	Response DeliveryResponse
+	Error    string
+}
+
+func deliveriesCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("webhook_deliveries")
+	coll.EnsureIndex(mgo.Index{Key: []string{"webhook", "-time"}})
+	return coll, nil
+}
+
+// ListDeliveries returns the most recent delivery attempts for a webhook.
+func ListDeliveries(name string) ([]Delivery, error) {
+	coll, err := deliveriesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var deliveries []Delivery
+	err = coll.Find(bson.M{"webhook": name}).Sort("-time").Limit(MaxListedDeliveries).All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func enqueueDelivery(name string, eventID bson.ObjectId, attempt int) error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	params := monsterqueue.JobParams{
+		"webhook": name,
+		"eventID": eventID.Hex(),
+		"attempt": attempt,
+	}
+	if attempt > 1 {
+		// Retries are delayed by the queue instead of sleeping in the task,
+		// so they don't hold a queue worker.
+		return queue.EnqueueAfter(deliveryTaskName, params, RetryInterval*time.Duration(1<<uint(attempt-2)))
+	}
+	_, err = q.Enqueue(deliveryTaskName, params)
+	return err
+}
+
+func deliver(w *Webhook, evt *event.Event, attempt int) (*Delivery, error) {
+	d := &Delivery{
+		ID:      bson.NewObjectId(),
+		Webhook: w.Name,
+		EventID: evt.UniqueID,
+		Attempt: attempt,
+		Time:    time.Now().UTC(),
+	}
+	body, err := w.renderBody(evt)
+	if err != nil {
+		return d, err
+	}
+	req, err := http.NewRequest(w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return d, err
+	}
+	for k, values := range w.Headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if w.Body == "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	d.Request = DeliveryRequest{
+		Method: req.Method,
+		URL:    w.URL,
+		Header: req.Header,
+		Body:   string(body),
+	}
+	rsp, err := httpClient.Do(req)
+	d.Duration = time.Since(d.Time)
+	if err != nil {
+		return d, err
+	}
+	defer rsp.Body.Close()
+	rspBody, _ := ioutil.ReadAll(&io.LimitedReader{R: rsp.Body, N: maxResponseBodySize})
+	d.Response = DeliveryResponse{
+		StatusCode: rsp.StatusCode,
+		Header:     rsp.Header,
+		Body:       string(rspBody),
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return d, fmt.Errorf("invalid status code %d", rsp.StatusCode)
+	}
+	return d, nil
+}
+
+func runDelivery(name string, eventID bson.ObjectId, attempt int) error {
+	w, err := Find(name)
+	if err != nil {
+		return err
+	}
+	evt, err := event.GetByID(eventID)
+	if err != nil {
+		return err
+	}
+	d, err := deliver(w, evt, attempt)
+	if err != nil {
+		d.Error = err.Error()
+	}
+	coll, collErr := deliveriesCollection()
+	if collErr != nil {
+		log.Errorf("[webhook %s] unable to record delivery: %s", name, collErr)
+		return err
+	}
+	defer coll.Close()
+	collErr = coll.Insert(d)
+	if collErr != nil {
+		log.Errorf("[webhook %s] unable to record delivery: %s", name, collErr)
+	}
+	return err
+}
+
+type deliveryTask struct{}
+
+func (t *deliveryTask) Name() string {
+	return deliveryTaskName
+}
+
+func (t *deliveryTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	name, _ := params["webhook"].(string)
+	rawEventID, _ := params["eventID"].(string)
+	var attempt int
+	switch v := params["attempt"].(type) {
+	case int:
+		attempt = v
+	case int64:
+		attempt = int(v)
+	case float64:
+		attempt = int(v)
+	}
+	if name == "" || !bson.IsObjectIdHex(rawEventID) || attempt <= 0 {
+		job.Error(errors.New("invalid parameters, expected webhook, eventID and attempt"))
+		return
+	}
+	eventID := bson.ObjectIdHex(rawEventID)
+	err := runDelivery(name, eventID, attempt)
+	if err == nil {
+		job.Success(nil)
+		return
+	}
+	if err != ErrWebhookNotFound && err != event.ErrEventNotFound && attempt < MaxAttempts {
+		qErr := enqueueDelivery(name, eventID, attempt+1)
+		if qErr != nil {
+			log.Errorf("[webhook %s] unable to enqueue retry: %s", name, qErr)
+		}
+	}
+	job.Error(err)
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event/sink"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+)
+
+func waitDeliveries(c *check.C, name string, n int) []Delivery {
+	timeout := time.After(10 * time.Second)
+	for {
+		deliveries, err := ListDeliveries(name)
+		c.Assert(err, check.IsNil)
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timeout waiting for %d deliveries of %s", n, name)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *S) TestDeliver(c *check.C) {
+	var body string
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		header = r.Header
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	evt := newEvent(c, "myapp", "t1")
+	w := &Webhook{
+		Name:    "w1",
+		URL:     srv.URL,
+		Method:  "POST",
+		Headers: http.Header{"X-Token": {"abc"}},
+		Body:    "{{.Target.Value}}",
+	}
+	d, err := deliver(w, evt, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.Equals, "myapp")
+	c.Assert(header.Get("X-Token"), check.Equals, "abc")
+	c.Assert(d.Webhook, check.Equals, "w1")
+	c.Assert(d.EventID, check.Equals, evt.UniqueID)
+	c.Assert(d.Request.Body, check.Equals, "myapp")
+	c.Assert(d.Response.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(d.Response.Body, check.Equals, "ok")
+}
+
+func (s *S) TestDeliverInvalidStatus(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	evt := newEvent(c, "myapp", "t1")
+	w := &Webhook{Name: "w1", URL: srv.URL, Method: "POST"}
+	d, err := deliver(w, evt, 2)
+	c.Assert(err, check.ErrorMatches, "invalid status code 500")
+	c.Assert(d.Attempt, check.Equals, 2)
+	c.Assert(d.Response.StatusCode, check.Equals, http.StatusInternalServerError)
+}
+
+func (s *S) TestDeliverInternalAddress(c *check.C) {
+	config.Set("event:webhooks:allow-internal-addresses", false)
+	defer config.Set("event:webhooks:allow-internal-addresses", true)
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	evt := newEvent(c, "myapp", "t1")
+	w := &Webhook{Name: "w1", URL: srv.URL, Method: "POST"}
+	d, err := deliver(w, evt, 1)
+	c.Assert(err, check.ErrorMatches, `.*resolves to internal address 127\.0\.0\.1`)
+	c.Assert(called, check.Equals, false)
+	c.Assert(d.Response.StatusCode, check.Equals, 0)
+}
+
+func (s *S) TestDispatcherSendDeliversMatchingWebhooks(c *check.C) {
+	calls := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- r.URL.Path
+	}))
+	defer srv.Close()
+	addTeamMember(c, "t1@tsuru.io", "t1", "webhook.read", "app.read.events")
+	addTeamMember(c, "t2@tsuru.io", "t2", "webhook.read", "app.read.events")
+	err := Create(&Webhook{Name: "w1", TeamOwner: "t1", URL: srv.URL + "/w1"})
+	c.Assert(err, check.IsNil)
+	err = Create(&Webhook{Name: "w2", TeamOwner: "t2", URL: srv.URL + "/w2"})
+	c.Assert(err, check.IsNil)
+	q, err := queue.Queue()
+	c.Assert(err, check.IsNil)
+	err = q.RegisterTask(&deliveryTask{})
+	c.Assert(err, check.IsNil)
+	evt := newEvent(c, "myapp", "t1")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	d := &dispatcher{}
+	err = d.Send(&sink.Message{Status: sink.StatusStarted, Event: evt})
+	c.Assert(err, check.IsNil)
+	err = d.Send(&sink.Message{Status: sink.StatusFinished, Event: evt})
+	c.Assert(err, check.IsNil)
+	deliveries := waitDeliveries(c, "w1", 1)
+	c.Assert(<-calls, check.Equals, "/w1")
+	c.Assert(calls, check.HasLen, 0)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].EventID, check.Equals, evt.UniqueID)
+	c.Assert(deliveries[0].Error, check.Equals, "")
+	deliveries, err = ListDeliveries("w2")
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 0)
+}
+
+func (s *S) TestDeliveryTaskRetries(c *check.C) {
+	MaxAttempts = 2
+	defer func() { MaxAttempts = 5 }()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{Name: "w1", TeamOwner: "t1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	q, err := queue.Queue()
+	c.Assert(err, check.IsNil)
+	err = q.RegisterTask(&deliveryTask{})
+	c.Assert(err, check.IsNil)
+	evt := newEvent(c, "myapp", "t1")
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = enqueueDelivery("w1", evt.UniqueID, 1)
+	c.Assert(err, check.IsNil)
+	deliveries := waitDeliveries(c, "w1", 2)
+	c.Assert(deliveries, check.HasLen, 2)
+	c.Assert(deliveries[0].Attempt, check.Equals, 2)
+	c.Assert(deliveries[1].Attempt, check.Equals, 1)
+	c.Assert(deliveries[0].Error, check.Equals, "invalid status code 502")
+}
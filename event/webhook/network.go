@@ -0,0 +1,112 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tsuru/config"
+)
+
+// internalNetworks lists loopback, private, link-local (including cloud
+// metadata services) and other non routable networks, webhooks are not
+// allowed to reach them unless event:webhooks:allow-internal-addresses is
+// set.
+var internalNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Dial:                dialWebhook,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: -1,
+	},
+	Timeout: time.Minute,
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func allowInternalAddresses() bool {
+	allow, _ := config.GetBool("event:webhooks:allow-internal-addresses")
+	return allow
+}
+
+func isInternalIP(ip net.IP) bool {
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost returns an error if host is, or resolves to, an internal address.
+// Lookup errors are ignored here, they're checked again when dialing.
+func checkHost(host string) error {
+	if allowInternalAddresses() {
+		return nil
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips, _ = net.LookupIP(host)
+	}
+	for _, ip := range ips {
+		if isInternalIP(ip) {
+			return fmt.Errorf("webhook host %q resolves to internal address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// dialWebhook resolves the address and dials the first resolved IP, refusing
+// internal addresses. Dialing the checked IP, instead of the host name,
+// prevents DNS rebinding and also covers redirects.
+func dialWebhook(network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if allowInternalAddresses() {
+		return dialer.Dial(network, addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if isInternalIP(ip) {
+			return nil, fmt.Errorf("webhook host %q resolves to internal address %s", host, ip)
+		}
+	}
+	return dialer.Dial(network, net.JoinHostPort(ips[0].String(), port))
+}
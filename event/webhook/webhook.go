@@ -0,0 +1,303 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook implements user managed webhooks, which are HTTP requests
+// sent by tsuru when events matching a filter finish.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/sink"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookAlreadyExists = errors.New("webhook already exists")
+
+	nameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-_]*$`)
+)
+
+type Webhook struct {
+	Name        string `bson:"_id"`
+	Description string
+	TeamOwner   string
+	EventFilter EventFilter
+	URL         string
+	Method      string
+	Headers     http.Header
+	// Body is a text/template executed with the finished event.Event as
+	// data. The event encoded as JSON is sent when it's empty.
+	Body string
+}
+
+type EventFilter struct {
+	TargetTypes  []string
+	TargetValues []string
+	KindNames    []string
+	ErrorOnly    bool
+}
+
+func (w *Webhook) validate() error {
+	if !nameRegexp.MatchString(w.Name) {
+		return &tsuruErrors.ValidationError{Message: "invalid webhook name, it must start with a letter and contain only lower case letters, numbers, dashes or underscores"}
+	}
+	if w.TeamOwner == "" {
+		return &tsuruErrors.ValidationError{Message: "webhook team owner is mandatory"}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &tsuruErrors.ValidationError{Message: "webhook url must be a valid http or https url"}
+	}
+	host := u.Host
+	if h, _, splitErr := net.SplitHostPort(host); splitErr == nil {
+		host = h
+	}
+	if err = checkHost(strings.Trim(host, "[]")); err != nil {
+		return &tsuruErrors.ValidationError{Message: err.Error()}
+	}
+	if w.Method == "" {
+		w.Method = "POST"
+	}
+	if _, err = w.template(); err != nil {
+		return &tsuruErrors.ValidationError{Message: "invalid webhook body template: " + err.Error()}
+	}
+	return nil
+}
+
+func (w *Webhook) template() (*template.Template, error) {
+	return template.New(w.Name).Parse(w.Body)
+}
+
+func (w *Webhook) renderBody(evt *event.Event) ([]byte, error) {
+	if w.Body == "" {
+		return json.Marshal(evt)
+	}
+	tpl, err := w.template()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, evt)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns whether the webhook must be triggered by the event. Besides
+// the webhook filter, the event must be readable by every user able to read
+// the webhook and its deliveries, readers holds their permissions as returned
+// by readerPermissions.
+func (w *Webhook) Matches(evt *event.Event, readers [][]permission.Permission) bool {
+	f := w.EventFilter
+	if f.ErrorOnly && evt.Error == "" {
+		return false
+	}
+	if len(f.TargetTypes) > 0 && !contains(f.TargetTypes, string(evt.Target.Type)) {
+		return false
+	}
+	if len(f.TargetValues) > 0 && !contains(f.TargetValues, evt.Target.Value) {
+		return false
+	}
+	if len(f.KindNames) > 0 && !contains(f.KindNames, evt.Kind.Name) {
+		return false
+	}
+	if len(readers) == 0 {
+		return false
+	}
+	for _, perms := range readers {
+		if !evt.Allowed.AllowedBy(perms) {
+			return false
+		}
+	}
+	return true
+}
+
+// readerPermissions returns the permissions of each user allowed to read the
+// webhooks owned by team.
+func readerPermissions(team string) ([][]permission.Permission, error) {
+	users, err := auth.ListUsersWithPermissions(permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, team),
+	})
+	if err != nil {
+		return nil, err
+	}
+	readers := make([][]permission.Permission, len(users))
+	for i := range users {
+		readers[i], err = users[i].Permissions()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return readers, nil
+}
+
+func collection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("webhooks"), nil
+}
+
+func Create(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+func Update(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func Delete(name string) error {
+	coll, err := collection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func Find(name string) (*Webhook, error) {
+	coll, err := collection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var w Webhook
+	err = coll.FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns webhooks owned by the given teams, a nil teams slice returns
+// all webhooks.
+func List(teams []string) ([]Webhook, error) {
+	coll, err := collection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var query bson.M
+	if teams != nil {
+		query = bson.M{"teamowner": bson.M{"$in": teams}}
+	}
+	var webhooks []Webhook
+	err = coll.Find(query).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// dispatcher receives finished events from the event sink subsystem and
+// enqueues the delivery of all webhooks matching them.
+type dispatcher struct{}
+
+func (d *dispatcher) Send(msg *sink.Message) error {
+	if msg.Status != sink.StatusFinished {
+		return nil
+	}
+	webhooks, err := List(nil)
+	if err != nil {
+		return err
+	}
+	teamReaders := map[string][][]permission.Permission{}
+	for i := range webhooks {
+		team := webhooks[i].TeamOwner
+		readers, ok := teamReaders[team]
+		if !ok {
+			readers, err = readerPermissions(team)
+			if err != nil {
+				return err
+			}
+			teamReaders[team] = readers
+		}
+		if !webhooks[i].Matches(msg.Event, readers) {
+			continue
+		}
+		err = enqueueDelivery(webhooks[i].Name, msg.Event.UniqueID, 1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Initialize registers the delivery task in the queue and starts listening
+// for finished events. It must be called before sink.Initialize.
+func Initialize() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	err = q.RegisterTask(&deliveryTask{})
+	if err != nil {
+		return err
+	}
+	sink.AddInternal("webhooks", &dispatcher{})
+	return nil
+}
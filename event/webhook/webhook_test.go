@@ -0,0 +1,210 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func newEvent(c *check.C, value, team string) *event.Event {
+	// Events are stored with millisecond precision, sleeping ensures they're
+	// ordered.
+	time.Sleep(10 * time.Millisecond)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: value},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+		Allowed:  event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, team)),
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestValidate(c *check.C) {
+	tests := []struct {
+		w   Webhook
+		msg string
+	}{
+		{Webhook{Name: "Invalid", TeamOwner: "t", URL: "http://a.com"}, "invalid webhook name.*"},
+		{Webhook{Name: "w1", URL: "http://a.com"}, "webhook team owner is mandatory"},
+		{Webhook{Name: "w1", TeamOwner: "t", URL: "ftp://a.com"}, "webhook url must be a valid http or https url"},
+		{Webhook{Name: "w1", TeamOwner: "t", URL: "http://"}, "webhook url must be a valid http or https url"},
+		{Webhook{Name: "w1", TeamOwner: "t", URL: "http://a.com", Body: "{{"}, "invalid webhook body template: .*"},
+	}
+	for i, tt := range tests {
+		err := tt.w.validate()
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{}, check.Commentf("test %d", i))
+		c.Assert(err, check.ErrorMatches, tt.msg, check.Commentf("test %d", i))
+	}
+	w := Webhook{Name: "w1", TeamOwner: "t", URL: "https://a.com/hook"}
+	err := w.validate()
+	c.Assert(err, check.IsNil)
+	c.Assert(w.Method, check.Equals, "POST")
+}
+
+func (s *S) TestValidateInternalAddresses(c *check.C) {
+	config.Set("event:webhooks:allow-internal-addresses", false)
+	defer config.Set("event:webhooks:allow-internal-addresses", true)
+	urls := []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"https://192.168.0.1:8443/hook",
+		"http://[::1]/hook",
+	}
+	for _, u := range urls {
+		w := Webhook{Name: "w1", TeamOwner: "t", URL: u}
+		err := w.validate()
+		c.Assert(err, check.FitsTypeOf, &tsuruErrors.ValidationError{}, check.Commentf("url %s", u))
+		c.Assert(err, check.ErrorMatches, `webhook host ".*" resolves to internal address .*`, check.Commentf("url %s", u))
+	}
+	w := Webhook{Name: "w1", TeamOwner: "t", URL: "http://8.8.8.8/hook"}
+	c.Assert(w.validate(), check.IsNil)
+}
+
+func addTeamMember(c *check.C, email, team string, perms ...string) {
+	role, err := permission.NewRole("member-"+email, string(permission.CtxTeam), "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions(perms...)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Users().Insert(auth.User{
+		Email: email,
+		Roles: []auth.RoleInstance{{Name: role.Name, ContextValue: team}},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestMatches(c *check.C) {
+	evt := &event.Event{}
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	evt.Kind = event.Kind{Type: event.KindTypePermission, Name: "app.update.env.set"}
+	evt.Allowed = event.Allowed(permission.PermAppReadEvents,
+		permission.Context(permission.CtxTeam, "t1"),
+		permission.Context(permission.CtxApp, "myapp"),
+		permission.Context(permission.CtxPool, "p1"),
+	)
+	t1 := []permission.Permission{{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "t1")}}
+	t2 := []permission.Permission{{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxTeam, "t2")}}
+	pool := []permission.Permission{{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxPool, "p1")}}
+	global := []permission.Permission{{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, "")}}
+	otherScheme := []permission.Permission{{Scheme: permission.PermPoolReadEvents, Context: permission.Context(permission.CtxGlobal, "")}}
+	tests := []struct {
+		w        Webhook
+		readers  [][]permission.Permission
+		expected bool
+	}{
+		{Webhook{}, [][]permission.Permission{t1}, true},
+		{Webhook{}, [][]permission.Permission{t2}, false},
+		{Webhook{}, nil, false},
+		{Webhook{}, [][]permission.Permission{pool}, true},
+		{Webhook{}, [][]permission.Permission{global}, true},
+		{Webhook{}, [][]permission.Permission{otherScheme}, false},
+		{Webhook{}, [][]permission.Permission{t1, global}, true},
+		{Webhook{}, [][]permission.Permission{t1, t2}, false},
+		{Webhook{EventFilter: EventFilter{TargetTypes: []string{"app"}}}, [][]permission.Permission{t1}, true},
+		{Webhook{EventFilter: EventFilter{TargetTypes: []string{"node"}}}, [][]permission.Permission{t1}, false},
+		{Webhook{EventFilter: EventFilter{TargetValues: []string{"other", "myapp"}}}, [][]permission.Permission{t1}, true},
+		{Webhook{EventFilter: EventFilter{TargetValues: []string{"other"}}}, [][]permission.Permission{t1}, false},
+		{Webhook{EventFilter: EventFilter{KindNames: []string{"app.update.env.set"}}}, [][]permission.Permission{t1}, true},
+		{Webhook{EventFilter: EventFilter{KindNames: []string{"app.deploy"}}}, [][]permission.Permission{t1}, false},
+		{Webhook{EventFilter: EventFilter{ErrorOnly: true}}, [][]permission.Permission{t1}, false},
+	}
+	for i, tt := range tests {
+		c.Assert(tt.w.Matches(evt, tt.readers), check.Equals, tt.expected, check.Commentf("test %d", i))
+	}
+	evt.Error = "failed"
+	w := Webhook{EventFilter: EventFilter{ErrorOnly: true}}
+	c.Assert(w.Matches(evt, [][]permission.Permission{t1}), check.Equals, true)
+}
+
+func (s *S) TestReaderPermissions(c *check.C) {
+	addTeamMember(c, "reader@tsuru.io", "t1", "webhook.read", "app.read.events")
+	addTeamMember(c, "other@tsuru.io", "t2", "webhook.read")
+	addTeamMember(c, "creator@tsuru.io", "t1", "webhook.create")
+	readers, err := readerPermissions("t1")
+	c.Assert(err, check.IsNil)
+	c.Assert(readers, check.HasLen, 1)
+	c.Assert(permission.CheckFromPermList(readers[0], permission.PermAppReadEvents, permission.Context(permission.CtxTeam, "t1")), check.Equals, true)
+	readers, err = readerPermissions("t3")
+	c.Assert(err, check.IsNil)
+	c.Assert(readers, check.HasLen, 0)
+}
+
+func (s *S) TestRenderBody(c *check.C) {
+	evt := &event.Event{}
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	w := Webhook{Name: "w1", Body: `{"app": "{{.Target.Value}}"}`}
+	body, err := w.renderBody(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, `{"app": "myapp"}`)
+	w.Body = ""
+	body, err = w.renderBody(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Matches, `.*"Value":"myapp".*`)
+}
+
+func (s *S) TestCreateFindAndList(c *check.C) {
+	w1 := Webhook{Name: "w1", TeamOwner: "t1", URL: "http://a.com"}
+	err := Create(&w1)
+	c.Assert(err, check.IsNil)
+	w2 := Webhook{Name: "w2", TeamOwner: "t2", URL: "http://b.com", Method: "PUT"}
+	err = Create(&w2)
+	c.Assert(err, check.IsNil)
+	err = Create(&Webhook{Name: "w1", TeamOwner: "t2", URL: "http://c.com"})
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+	found, err := Find("w1")
+	c.Assert(err, check.IsNil)
+	c.Assert(*found, check.DeepEquals, Webhook{Name: "w1", TeamOwner: "t1", URL: "http://a.com", Method: "POST"})
+	_, err = Find("unknown")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	all, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 2)
+	c.Assert(all[0].Name, check.Equals, "w1")
+	c.Assert(all[1].Name, check.Equals, "w2")
+	filtered, err := List([]string{"t2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.HasLen, 1)
+	c.Assert(filtered[0].Name, check.Equals, "w2")
+	none, err := List([]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(none, check.HasLen, 0)
+}
+
+func (s *S) TestUpdate(c *check.C) {
+	err := Create(&Webhook{Name: "w1", TeamOwner: "t1", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = Update(&Webhook{Name: "w1", TeamOwner: "t2", URL: "http://b.com"})
+	c.Assert(err, check.IsNil)
+	found, err := Find("w1")
+	c.Assert(err, check.IsNil)
+	c.Assert(found.TeamOwner, check.Equals, "t2")
+	c.Assert(found.URL, check.Equals, "http://b.com")
+	err = Update(&Webhook{Name: "unknown", TeamOwner: "t2", URL: "http://b.com"})
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestDelete(c *check.C) {
+	err := Create(&Webhook{Name: "w1", TeamOwner: "t1", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	err = Delete("w1")
+	c.Assert(err, check.IsNil)
+	_, err = Find("w1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	err = Delete("w1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
@@ -17,6 +17,17 @@ const HealthCheckOK = "WORKING"
 
 var ErrDisabledComponent = errors.New("disabled component")
 
+// Warning is returned by checkers of components that are working, but in a
+// degraded state. The message is included in the result, which still has the
+// HealthCheckOK status.
+type Warning struct {
+	Message string
+}
+
+func (w *Warning) Error() string {
+	return w.Message
+}
+
 var checkers []healthChecker
 
 type healthChecker struct {
@@ -26,10 +37,11 @@ type healthChecker struct {
 
 // Result represents a result of a processed healthcheck call. It will contain
 // the name of the healthchecker and the status returned in the checker
-// call.
+// call, along with the warning reported by checkers of degraded components.
 type Result struct {
 	Name     string
 	Status   string
+	Warning  string
 	Duration time.Duration
 }
 
@@ -46,7 +58,15 @@ func Check() []Result {
 	results := make([]Result, 0, len(checkers))
 	for _, checker := range checkers {
 		startTime := time.Now()
-		if err := checker.check(); err != nil && err != ErrDisabledComponent {
+		err := checker.check()
+		if warning, ok := err.(*Warning); ok {
+			results = append(results, Result{
+				Name:     checker.name,
+				Status:   HealthCheckOK,
+				Warning:  warning.Message,
+				Duration: time.Since(startTime),
+			})
+		} else if err != nil && err != ErrDisabledComponent {
 			results = append(results, Result{
 				Name:     checker.name,
 				Status:   "fail - " + err.Error(),
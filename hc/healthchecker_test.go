@@ -23,13 +23,16 @@ func (HCSuite) TestCheck(c *check.C) {
 	AddChecker("success", successChecker)
 	AddChecker("failing", failingChecker)
 	AddChecker("disabled", disabledChecker)
+	AddChecker("degraded", degradedChecker)
 	expected := []Result{
 		{Name: "success", Status: HealthCheckOK},
 		{Name: "failing", Status: "fail - something went wrong"},
+		{Name: "degraded", Status: HealthCheckOK, Warning: "something is slow"},
 	}
 	result := Check()
 	expected[0].Duration = result[0].Duration
 	expected[1].Duration = result[1].Duration
+	expected[2].Duration = result[2].Duration
 	c.Assert(result, check.DeepEquals, expected)
 	c.Assert(result[0].Duration, check.Not(check.Equals), 0)
 	c.Assert(result[1].Duration, check.Not(check.Equals), 0)
@@ -46,3 +49,7 @@ func failingChecker() error {
 func disabledChecker() error {
 	return ErrDisabledComponent
 }
+
+func degradedChecker() error {
+	return &Warning{Message: "something is slow"}
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package http provides an IaaS that delegates the management of machines to
+// an external HTTP service, so new clouds may be supported without changing
+// tsuru.
+//
+// The service must implement the following endpoints, relative to the
+// configured url:
+//
+//	POST   /machines       creates a machine, see createRequest and
+//	                       machineResponse. It must only respond when the
+//	                       machine has an address.
+//	DELETE /machines/{id}  destroys the machine. Responding 404 means the
+//	                       machine is already gone.
+//	GET    /describe       returns, as plain text, the description of the
+//	                       parameters accepted by the service.
+//	GET    /healthcheck    responds 200 when the service is able to manage
+//	                       machines.
+//
+// Any response with a status code out of the 2xx range is an error, and its
+// body is used as the error message.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/net"
+)
+
+const defaultTimeout = 10 * time.Minute
+
+// infoTimeout is the timeout of requests that don't manage machines, like
+// health checks and descriptions.
+var infoTimeout = 10 * time.Second
+
+func init() {
+	iaas.RegisterIaasProvider("http", newHTTPIaaS)
+	hc.AddChecker("IaaS HTTP", iaas.BuildHealthCheck("http"))
+}
+
+// createRequest is the body sent to the service when creating a machine.
+type createRequest struct {
+	// Name is the name of the IaaS in tsuru.
+	Name string `json:"name"`
+	// Params are the params given by the user creating the machine.
+	Params map[string]string `json:"params"`
+	// UserData is the script to be run in the machine after its creation.
+	UserData string `json:"userData,omitempty"`
+}
+
+// machineResponse is the body returned by the service after creating a
+// machine. Port is optional and defaults to iaas:node-port.
+type machineResponse struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Port    int    `json:"port"`
+}
+
+type httpIaaS struct {
+	base iaas.UserDataIaaS
+}
+
+func newHTTPIaaS(name string) iaas.IaaS {
+	return &httpIaaS{base: iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "http", IaaSName: name}}}
+}
+
+func (i *httpIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	userData, err := i.base.ReadUserData()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(createRequest{
+		Name:     i.base.IaaSName,
+		Params:   params,
+		UserData: userData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := i.do("POST", "/machines", bytes.NewReader(body), i.timeout())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var machine machineResponse
+	err = json.NewDecoder(resp.Body).Decode(&machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse machine created by %s: %s", i.base.IaaSName, err)
+	}
+	if machine.ID == "" || machine.Address == "" {
+		return nil, fmt.Errorf("machine created by %s has no id or address", i.base.IaaSName)
+	}
+	return &iaas.Machine{
+		Id:      machine.ID,
+		Address: machine.Address,
+		Status:  machine.Status,
+		Port:    machine.Port,
+	}, nil
+}
+
+func (i *httpIaaS) DeleteMachine(m *iaas.Machine) error {
+	resp, err := i.do("DELETE", "/machines/"+url.QueryEscape(m.Id), nil, i.timeout())
+	if err != nil {
+		if httpErr, ok := err.(*requestError); ok && httpErr.code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (i *httpIaaS) Describe() string {
+	resp, err := i.do("GET", "/describe", nil, infoTimeout)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	desc, _ := ioutil.ReadAll(resp.Body)
+	return string(desc)
+}
+
+func (i *httpIaaS) HealthCheck() error {
+	resp, err := i.do("GET", "/healthcheck", nil, infoTimeout)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type requestError struct {
+	iaas    string
+	code    int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.iaas, e.code, e.message)
+}
+
+func (i *httpIaaS) timeout() time.Duration {
+	rawTimeout, _ := i.base.GetConfigString("timeout")
+	if seconds, _ := strconv.Atoi(rawTimeout); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultTimeout
+}
+
+func (i *httpIaaS) do(method, path string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	baseURL, _ := i.base.GetConfigString("url")
+	if baseURL == "" {
+		return nil, errors.New("url is required for the http iaas")
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token, _ := i.base.GetConfigString("token"); token != "" {
+		req.Header.Set("Authorization", "bearer "+token)
+	}
+	client := *net.Dial5Full300ClientNoKeepAlive
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, &requestError{iaas: i.base.IaaSName, code: resp.StatusCode, message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
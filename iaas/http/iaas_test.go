@@ -0,0 +1,196 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/iaas"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type httpSuite struct {
+	server  *httptest.Server
+	handler http.HandlerFunc
+}
+
+var _ = check.Suite(&httpSuite{})
+
+func (s *httpSuite) SetUpTest(c *check.C) {
+	s.handler = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handler(w, r)
+	}))
+	config.Set("iaas:http:url", s.server.URL)
+	config.Set("iaas:http:user-data", "")
+}
+
+func (s *httpSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+	config.Unset("iaas:http")
+	config.Unset("iaas:custom")
+}
+
+func (s *httpSuite) TestCreateMachine(c *check.C) {
+	var req createRequest
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/machines")
+		c.Check(r.Header.Get("Authorization"), check.Equals, "")
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		err := json.NewDecoder(r.Body).Decode(&req)
+		c.Check(err, check.IsNil)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": "m-1", "address": "10.0.0.1", "status": "running", "port": 2376}`)
+	}
+	i := newHTTPIaaS("http")
+	m, err := i.CreateMachine(map[string]string{"size": "large"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &iaas.Machine{Id: "m-1", Address: "10.0.0.1", Status: "running", Port: 2376})
+	c.Assert(req, check.DeepEquals, createRequest{Name: "http", Params: map[string]string{"size": "large"}})
+}
+
+func (s *httpSuite) TestCreateMachineCustomIaaS(c *check.C) {
+	config.Unset("iaas:http:url")
+	config.Set("iaas:custom:myiaas:url", s.server.URL)
+	config.Set("iaas:custom:myiaas:token", "secret")
+	config.Set("iaas:custom:myiaas:user-data", "")
+	var req createRequest
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("Authorization"), check.Equals, "bearer secret")
+		err := json.NewDecoder(r.Body).Decode(&req)
+		c.Check(err, check.IsNil)
+		fmt.Fprint(w, `{"id": "m-1", "address": "10.0.0.1"}`)
+	}
+	i := newHTTPIaaS("myiaas")
+	m, err := i.CreateMachine(map[string]string{})
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "m-1")
+	c.Assert(m.Port, check.Equals, 0)
+	c.Assert(req.Name, check.Equals, "myiaas")
+}
+
+func (s *httpSuite) TestCreateMachineError(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no capacity left", http.StatusServiceUnavailable)
+	}
+	i := newHTTPIaaS("http")
+	m, err := i.CreateMachine(map[string]string{})
+	c.Assert(m, check.IsNil)
+	c.Assert(err, check.ErrorMatches, "http returned 503: no capacity left")
+}
+
+func (s *httpSuite) TestCreateMachineNoAddress(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "m-1"}`)
+	}
+	i := newHTTPIaaS("http")
+	_, err := i.CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "machine created by http has no id or address")
+}
+
+func (s *httpSuite) TestCreateMachineNoURL(c *check.C) {
+	config.Unset("iaas:http:url")
+	i := newHTTPIaaS("http")
+	_, err := i.CreateMachine(map[string]string{})
+	c.Assert(err, check.ErrorMatches, "url is required for the http iaas")
+}
+
+func (s *httpSuite) TestDeleteMachine(c *check.C) {
+	var method, path string
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}
+	i := newHTTPIaaS("http")
+	err := i.DeleteMachine(&iaas.Machine{Id: "m-1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(method, check.Equals, "DELETE")
+	c.Assert(path, check.Equals, "/machines/m-1")
+}
+
+func (s *httpSuite) TestDeleteMachineNotFound(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+	i := newHTTPIaaS("http")
+	err := i.DeleteMachine(&iaas.Machine{Id: "m-1"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *httpSuite) TestDeleteMachineError(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "machine is locked", http.StatusConflict)
+	}
+	i := newHTTPIaaS("http")
+	err := i.DeleteMachine(&iaas.Machine{Id: "m-1"})
+	c.Assert(err, check.ErrorMatches, "http returned 409: machine is locked")
+}
+
+func (s *httpSuite) TestDescribe(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/describe")
+		fmt.Fprint(w, "size: the size of the machine\n")
+	}
+	i := newHTTPIaaS("http").(iaas.Describer)
+	c.Assert(i.Describe(), check.Equals, "size: the size of the machine\n")
+}
+
+func (s *httpSuite) TestDescribeError(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	i := newHTTPIaaS("http").(iaas.Describer)
+	c.Assert(i.Describe(), check.Equals, "")
+}
+
+func (s *httpSuite) TestHealthCheck(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/healthcheck")
+		w.WriteHeader(http.StatusOK)
+	}
+	i := newHTTPIaaS("http").(iaas.HealthChecker)
+	c.Assert(i.HealthCheck(), check.IsNil)
+}
+
+func (s *httpSuite) TestHealthCheckFailure(c *check.C) {
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "cloud unreachable", http.StatusInternalServerError)
+	}
+	i := newHTTPIaaS("http").(iaas.HealthChecker)
+	c.Assert(i.HealthCheck(), check.ErrorMatches, "http returned 500: cloud unreachable")
+}
+
+func (s *httpSuite) TestHealthCheckTimeout(c *check.C) {
+	defer func(t time.Duration) { infoTimeout = t }(infoTimeout)
+	infoTimeout = 50 * time.Millisecond
+	done := make(chan struct{})
+	defer close(done)
+	s.handler = func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	i := newHTTPIaaS("http").(iaas.HealthChecker)
+	t0 := time.Now()
+	c.Assert(i.HealthCheck(), check.NotNil)
+	c.Assert(time.Since(t0) < 5*time.Second, check.Equals, true)
+}
+
+func (s *httpSuite) TestTimeout(c *check.C) {
+	i := newHTTPIaaS("http").(*httpIaaS)
+	c.Assert(i.timeout(), check.Equals, defaultTimeout)
+	config.Set("iaas:http:timeout", 30)
+	c.Assert(i.timeout().Seconds(), check.Equals, float64(30))
+}
@@ -0,0 +1,320 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/net"
+)
+
+type keystoneName struct {
+	Name string `json:"name"`
+}
+
+type keystoneAuthRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User struct {
+					Name     string       `json:"name"`
+					Domain   keystoneName `json:"domain"`
+					Password string       `json:"password"`
+				} `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope struct {
+			Project struct {
+				Name   string       `json:"name"`
+				Domain keystoneName `json:"domain"`
+			} `json:"project"`
+		} `json:"scope"`
+	} `json:"auth"`
+}
+
+type keystoneAuthResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				RegionID  string `json:"region_id"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// authToken is a Keystone token scoped to the configured project, along with
+// the compute endpoint found in its catalog.
+type authToken struct {
+	id         string
+	expiresAt  time.Time
+	computeURL string
+}
+
+func (t *authToken) valid() bool {
+	return t != nil && time.Now().Add(time.Minute).Before(t.expiresAt)
+}
+
+type novaNetwork struct {
+	UUID string `json:"uuid"`
+}
+
+type novaServerRequest struct {
+	Server struct {
+		Name             string         `json:"name"`
+		ImageRef         string         `json:"imageRef"`
+		FlavorRef        string         `json:"flavorRef"`
+		KeyName          string         `json:"key_name,omitempty"`
+		AvailabilityZone string         `json:"availability_zone,omitempty"`
+		UserData         string         `json:"user_data,omitempty"`
+		Networks         []novaNetwork  `json:"networks,omitempty"`
+		SecurityGroups   []keystoneName `json:"security_groups,omitempty"`
+	} `json:"server"`
+}
+
+type novaAddress struct {
+	Addr    string `json:"addr"`
+	Version int    `json:"version"`
+	Type    string `json:"OS-EXT-IPS:type"`
+}
+
+type novaServer struct {
+	ID         string                   `json:"id"`
+	Status     string                   `json:"status"`
+	AccessIPv4 string                   `json:"accessIPv4"`
+	Addresses  map[string][]novaAddress `json:"addresses"`
+	Fault      *struct {
+		Message string `json:"message"`
+	} `json:"fault"`
+}
+
+// address returns the address used to reach the server. The accessIPv4 set
+// by the operator is preferred, followed by floating and fixed IPv4
+// addresses.
+func (s *novaServer) address() string {
+	if s.AccessIPv4 != "" {
+		return s.AccessIPv4
+	}
+	networks := make([]string, 0, len(s.Addresses))
+	for name := range s.Addresses {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	for _, addrType := range []string{"floating", "fixed"} {
+		for _, name := range networks {
+			for _, addr := range s.Addresses[name] {
+				if addr.Version == 4 && addr.Type == addrType {
+					return addr.Addr
+				}
+			}
+		}
+	}
+	for _, name := range networks {
+		for _, addr := range s.Addresses[name] {
+			if addr.Version == 4 {
+				return addr.Addr
+			}
+		}
+	}
+	return ""
+}
+
+type apiError struct {
+	code int
+	body string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("openstack: unexpected status code %d: %s", e.code, e.body)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.code == http.StatusNotFound
+}
+
+func (i *OpenStackIaaS) configOrDefault(name, defaultValue string) string {
+	value, _ := i.base.GetConfigString(name)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// token returns a valid token for the given region, authenticating against
+// Keystone v3 when the cached one is missing or about to expire. The lock
+// isn't held while authenticating, so a slow Keystone doesn't block requests
+// using other regions, concurrent callers may authenticate more than once.
+func (i *OpenStackIaaS) token(region string) (*authToken, error) {
+	i.tokensMu.Lock()
+	t := i.tokens[region]
+	i.tokensMu.Unlock()
+	if t.valid() {
+		return t, nil
+	}
+	t, err := i.authenticate(region)
+	if err != nil {
+		return nil, err
+	}
+	i.tokensMu.Lock()
+	i.tokens[region] = t
+	i.tokensMu.Unlock()
+	return t, nil
+}
+
+func (i *OpenStackIaaS) invalidateToken(region string) {
+	i.tokensMu.Lock()
+	defer i.tokensMu.Unlock()
+	delete(i.tokens, region)
+}
+
+func (i *OpenStackIaaS) authenticate(region string) (*authToken, error) {
+	authURL, err := i.base.GetConfigString("auth-url")
+	if err != nil || authURL == "" {
+		return nil, fmt.Errorf("openstack: auth-url is required")
+	}
+	var authReq keystoneAuthRequest
+	authReq.Auth.Identity.Methods = []string{"password"}
+	user := &authReq.Auth.Identity.Password.User
+	user.Name, _ = i.base.GetConfigString("username")
+	user.Password, _ = i.base.GetConfigString("password")
+	user.Domain.Name = i.configOrDefault("user-domain", "Default")
+	project := &authReq.Auth.Scope.Project
+	project.Name, _ = i.base.GetConfigString("project")
+	project.Domain.Name = i.configOrDefault("project-domain", "Default")
+	body, err := json.Marshal(authReq)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := i.request("POST", strings.TrimRight(authURL, "/")+"/auth/tokens", "", bytes.NewReader(body), infoTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var authResp keystoneAuthResponse
+	err = json.NewDecoder(resp.Body).Decode(&authResp)
+	if err != nil {
+		return nil, fmt.Errorf("openstack: unable to parse keystone response: %s", err)
+	}
+	t := authToken{id: resp.Header.Get("X-Subject-Token"), expiresAt: authResp.Token.ExpiresAt}
+	if t.id == "" {
+		return nil, fmt.Errorf("openstack: keystone response has no token")
+	}
+	for _, service := range authResp.Token.Catalog {
+		if service.Type != "compute" {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface != "public" {
+				continue
+			}
+			if region == "" || endpoint.Region == region || endpoint.RegionID == region {
+				t.computeURL = strings.TrimRight(endpoint.URL, "/")
+				return &t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("openstack: no public compute endpoint found in region %q", region)
+}
+
+// compute sends a request to Nova, authenticating again once if the cached
+// token is rejected, and decodes the response into result when it's not nil.
+func (i *OpenStackIaaS) compute(region, method, path string, timeout time.Duration, data, result interface{}) error {
+	var body []byte
+	if data != nil {
+		var err error
+		body, err = json.Marshal(data)
+		if err != nil {
+			return err
+		}
+	}
+	var resp *http.Response
+	for retry := true; ; retry = false {
+		t, err := i.token(region)
+		if err != nil {
+			return err
+		}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		resp, err = i.request(method, t.computeURL+path, t.id, reader, timeout)
+		if apiErr, ok := err.(*apiError); ok && apiErr.code == http.StatusUnauthorized && retry {
+			i.invalidateToken(region)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		return nil
+	}
+	err := json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("openstack: unable to parse response for %s %s: %s", method, path, err)
+	}
+	return nil
+}
+
+func (i *OpenStackIaaS) request(method, url, token string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	client := *net.Dial5Full300ClientNoKeepAlive
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, &apiError{code: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return resp, nil
+}
+
+func (i *OpenStackIaaS) getServer(region, id string) (*novaServer, error) {
+	var result struct {
+		Server novaServer `json:"server"`
+	}
+	err := i.compute(region, "GET", "/servers/"+id, defaultTimeout, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Server, nil
+}
+
+func (i *OpenStackIaaS) deleteServer(region, id string) error {
+	err := i.compute(region, "DELETE", "/servers/"+id, defaultTimeout, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/queue"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+// infoTimeout is the timeout of requests that don't manage machines, like
+// health checks and authentication.
+var infoTimeout = 10 * time.Second
+
+func init() {
+	iaas.RegisterIaasProvider("openstack", newOpenStackIaaS)
+	hc.AddChecker("OpenStack", iaas.BuildHealthCheck("openstack"))
+}
+
+type OpenStackIaaS struct {
+	base     iaas.UserDataIaaS
+	tokensMu sync.Mutex
+	tokens   map[string]*authToken
+}
+
+func newOpenStackIaaS(name string) iaas.IaaS {
+	return &OpenStackIaaS{
+		base:   iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "openstack", IaaSName: name}},
+		tokens: map[string]*authToken{},
+	}
+}
+
+func (i *OpenStackIaaS) Initialize() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	return q.RegisterTask(&openstackWaitTask{iaas: i})
+}
+
+func (i *OpenStackIaaS) Describe() string {
+	return `OpenStack IaaS required params:
+  flavor=<flavor id>                   Flavor of the server
+  image=<image id>                     Image used to boot the server
+
+Optional params:
+  name=<name>                          Name of the server, defaults to a random name
+  region=<region>                      Chosen region, defaults to the configured one
+  network=<id1,id2>                    Comma separated list of network uuids
+  security-group=<group1,group2>       Comma separated list of security group names
+  key-name=<key pair>                  Key pair injected in the server
+  availability-zone=<zone>             Availability zone of the server
+`
+}
+
+func (i *OpenStackIaaS) HealthCheck() error {
+	return i.compute(i.region(nil), "GET", "/flavors", infoTimeout, nil, nil)
+}
+
+func (i *OpenStackIaaS) region(params map[string]string) string {
+	if region := params["region"]; region != "" {
+		return region
+	}
+	region, _ := i.base.GetConfigString("region")
+	return region
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func randomName() (string, error) {
+	data := make([]byte, 6)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return "tsuru-" + hex.EncodeToString(data), nil
+}
+
+func (i *OpenStackIaaS) buildServerRequest(params map[string]string, userData string) (*novaServerRequest, error) {
+	for _, p := range []string{"flavor", "image"} {
+		if params[p] == "" {
+			return nil, fmt.Errorf("param %q is mandatory", p)
+		}
+	}
+	var req novaServerRequest
+	req.Server.Name = params["name"]
+	if req.Server.Name == "" {
+		var err error
+		req.Server.Name, err = randomName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Server.FlavorRef = params["flavor"]
+	req.Server.ImageRef = params["image"]
+	req.Server.KeyName = params["key-name"]
+	req.Server.AvailabilityZone = params["availability-zone"]
+	if userData != "" {
+		req.Server.UserData = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+	for _, network := range splitList(params["network"]) {
+		req.Server.Networks = append(req.Server.Networks, novaNetwork{UUID: network})
+	}
+	for _, group := range splitList(params["security-group"]) {
+		req.Server.SecurityGroups = append(req.Server.SecurityGroups, keystoneName{Name: group})
+	}
+	return &req, nil
+}
+
+func (i *OpenStackIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	userData, err := i.base.ReadUserData()
+	if err != nil {
+		return nil, err
+	}
+	req, err := i.buildServerRequest(params, userData)
+	if err != nil {
+		return nil, err
+	}
+	region := i.region(params)
+	var result struct {
+		Server novaServer `json:"server"`
+	}
+	err = i.compute(region, "POST", "/servers", defaultTimeout, req, &result)
+	if err != nil {
+		return nil, err
+	}
+	id := result.Server.ID
+	address, err := i.waitForAddress(region, id)
+	if err != nil {
+		return nil, err
+	}
+	return &iaas.Machine{
+		Id:      id,
+		Status:  "ACTIVE",
+		Address: address,
+	}, nil
+}
+
+func (i *OpenStackIaaS) waitForAddress(region, id string) (string, error) {
+	rawWait, _ := i.base.GetConfigString("wait-timeout")
+	maxWaitTime, _ := strconv.Atoi(rawWait)
+	if maxWaitTime == 0 {
+		maxWaitTime = 300
+	}
+	q, err := queue.Queue()
+	if err != nil {
+		return "", err
+	}
+	jobParams := monsterqueue.JobParams{
+		"region":    region,
+		"machineId": id,
+		"timeout":   maxWaitTime,
+	}
+	waitDuration := time.Duration(maxWaitTime) * time.Second
+	job, err := q.EnqueueWait((&openstackWaitTask{iaas: i}).Name(), jobParams, waitDuration)
+	if err != nil {
+		if err == monsterqueue.ErrQueueWaitTimeout {
+			return "", fmt.Errorf("openstack: time out after %v waiting for server %s to start", waitDuration, id)
+		}
+		return "", err
+	}
+	result, err := job.Result()
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+func (i *OpenStackIaaS) DeleteMachine(m *iaas.Machine) error {
+	return i.deleteServer(i.region(m.CreationParams), m.Id)
+}
@@ -0,0 +1,357 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+// fakeOpenStack is an HTTP stub of the Keystone v3 and Nova APIs.
+type fakeOpenStack struct {
+	sync.Mutex
+	server      *httptest.Server
+	auths       []keystoneAuthRequest
+	created     []novaServerRequest
+	deleted     []string
+	servers     map[string][]novaServer
+	rejectToken bool
+	tokens      int
+	hangAuth    chan struct{}
+}
+
+func (f *fakeOpenStack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.hangAuth != nil && r.URL.Path == "/v3/auth/tokens" {
+		<-f.hangAuth
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	if r.URL.Path == "/v3/auth/tokens" {
+		var req keystoneAuthRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.auths = append(f.auths, req)
+		f.tokens++
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", f.tokens))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [
+			{"type": "identity", "endpoints": [{"interface": "public", "region": "RegionOne", "url": "%[2]s/v3"}]},
+			{"type": "compute", "endpoints": [
+				{"interface": "internal", "region": "RegionOne", "url": "http://internal/compute"},
+				{"interface": "public", "region": "RegionOne", "url": "%[2]s/regionone/compute/"},
+				{"interface": "public", "region": "RegionTwo", "url": "%[2]s/regiontwo/compute"}
+			]}
+		]}}`, time.Now().Add(time.Hour).Format(time.RFC3339), f.server.URL)
+		return
+	}
+	if r.Header.Get("X-Auth-Token") == "" || f.rejectToken {
+		f.rejectToken = false
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/regionone/compute/servers":
+		var req novaServerRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.created = append(f.created, req)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"server": {"id": "srv-1"}}`)
+	case r.Method == "GET" && r.URL.Path == "/regionone/compute/flavors":
+		fmt.Fprint(w, `{"flavors": []}`)
+	case r.Method == "GET" && r.URL.Path == "/regionone/compute/servers/srv-1":
+		states := f.servers["srv-1"]
+		if len(states) == 0 {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if len(states) > 1 {
+			f.servers["srv-1"] = states[1:]
+		}
+		json.NewEncoder(w).Encode(map[string]novaServer{"server": states[0]})
+	case r.Method == "DELETE" && (r.URL.Path == "/regionone/compute/servers/srv-1" || r.URL.Path == "/regiontwo/compute/servers/srv-1"):
+		f.deleted = append(f.deleted, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+type S struct {
+	fake *fakeOpenStack
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	pollInterval = time.Millisecond
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.fake = &fakeOpenStack{servers: map[string][]novaServer{}}
+	s.fake.server = httptest.NewServer(s.fake)
+	config.Set("iaas:openstack:auth-url", s.fake.server.URL+"/v3")
+	config.Set("iaas:openstack:username", "tsuru")
+	config.Set("iaas:openstack:password", "secret")
+	config.Set("iaas:openstack:project", "apps")
+	config.Set("iaas:openstack:region", "RegionOne")
+	config.Set("iaas:openstack:user-data", "")
+	config.Set("queue:mongo-url", "127.0.0.1:27017")
+	config.Set("queue:mongo-database", "queue_openstack_iaas")
+	queue.ResetQueue()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.fake.server.Close()
+	config.Unset("iaas:openstack")
+	config.Unset("iaas:custom")
+}
+
+func activeServer() novaServer {
+	return novaServer{
+		ID:     "srv-1",
+		Status: "ACTIVE",
+		Addresses: map[string][]novaAddress{
+			"private": {
+				{Addr: "fd00::10", Version: 6, Type: "fixed"},
+				{Addr: "10.0.0.10", Version: 4, Type: "fixed"},
+			},
+		},
+	}
+}
+
+func (s *S) TestAuthenticate(c *check.C) {
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	t, err := i.authenticate("RegionOne")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.id, check.Equals, "token-1")
+	c.Assert(t.computeURL, check.Equals, s.fake.server.URL+"/regionone/compute")
+	c.Assert(t.valid(), check.Equals, true)
+	c.Assert(s.fake.auths, check.HasLen, 1)
+	auth := s.fake.auths[0].Auth
+	c.Assert(auth.Identity.Methods, check.DeepEquals, []string{"password"})
+	c.Assert(auth.Identity.Password.User.Name, check.Equals, "tsuru")
+	c.Assert(auth.Identity.Password.User.Password, check.Equals, "secret")
+	c.Assert(auth.Identity.Password.User.Domain.Name, check.Equals, "Default")
+	c.Assert(auth.Scope.Project.Name, check.Equals, "apps")
+	c.Assert(auth.Scope.Project.Domain.Name, check.Equals, "Default")
+	t, err = i.authenticate("RegionTwo")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.computeURL, check.Equals, s.fake.server.URL+"/regiontwo/compute")
+	_, err = i.authenticate("RegionThree")
+	c.Assert(err, check.ErrorMatches, `openstack: no public compute endpoint found in region "RegionThree"`)
+}
+
+func (s *S) TestAuthenticateCustomIaaS(c *check.C) {
+	config.Set("iaas:custom:dc2:user-domain", "ldap")
+	config.Set("iaas:custom:dc2:project", "infra")
+	i := newOpenStackIaaS("dc2").(*OpenStackIaaS)
+	_, err := i.authenticate("")
+	c.Assert(err, check.IsNil)
+	auth := s.fake.auths[0].Auth
+	c.Assert(auth.Identity.Password.User.Domain.Name, check.Equals, "ldap")
+	c.Assert(auth.Scope.Project.Name, check.Equals, "infra")
+}
+
+func (s *S) TestAuthenticateNoAuthURL(c *check.C) {
+	config.Unset("iaas:openstack:auth-url")
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	_, err := i.authenticate("")
+	c.Assert(err, check.ErrorMatches, "openstack: auth-url is required")
+}
+
+func (s *S) TestComputeReusesAndRenewsToken(c *check.C) {
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	err := i.HealthCheck()
+	c.Assert(err, check.IsNil)
+	err = i.HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.fake.auths, check.HasLen, 1)
+	s.fake.rejectToken = true
+	err = i.HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.fake.auths, check.HasLen, 2)
+	c.Assert(i.tokens["RegionOne"].id, check.Equals, "token-2")
+}
+
+func (s *S) TestHealthCheckFailure(c *check.C) {
+	config.Set("iaas:openstack:region", "RegionTwo")
+	i := newOpenStackIaaS("openstack").(iaas.HealthChecker)
+	err := i.HealthCheck()
+	c.Assert(err, check.ErrorMatches, "openstack: unexpected status code 404: not found")
+}
+
+func (s *S) TestHealthCheckTimeout(c *check.C) {
+	defer func(t time.Duration) { infoTimeout = t }(infoTimeout)
+	infoTimeout = 50 * time.Millisecond
+	s.fake.hangAuth = make(chan struct{})
+	defer close(s.fake.hangAuth)
+	i := newOpenStackIaaS("openstack").(iaas.HealthChecker)
+	done := make(chan error)
+	go func() {
+		done <- i.HealthCheck()
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, check.NotNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for health check")
+	}
+}
+
+func (s *S) TestTokenDoesNotHoldLockWhileAuthenticating(c *check.C) {
+	s.fake.hangAuth = make(chan struct{})
+	defer close(s.fake.hangAuth)
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	cached := &authToken{id: "cached", expiresAt: time.Now().Add(time.Hour)}
+	i.tokens["RegionTwo"] = cached
+	go i.token("RegionOne")
+	done := make(chan *authToken)
+	go func() {
+		t, _ := i.token("RegionTwo")
+		done <- t
+	}()
+	select {
+	case t := <-done:
+		c.Assert(t, check.Equals, cached)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for cached token")
+	}
+}
+
+func (s *S) TestBuildServerRequest(c *check.C) {
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	req, err := i.buildServerRequest(map[string]string{
+		"name":              "node1",
+		"flavor":            "m1.small",
+		"image":             "img-1",
+		"key-name":          "ops",
+		"availability-zone": "az1",
+		"network":           "net-1, net-2",
+		"security-group":    "default,docker",
+		"iaas":              "openstack",
+	}, "#!/bin/sh\n")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Server.Name, check.Equals, "node1")
+	c.Assert(req.Server.FlavorRef, check.Equals, "m1.small")
+	c.Assert(req.Server.ImageRef, check.Equals, "img-1")
+	c.Assert(req.Server.KeyName, check.Equals, "ops")
+	c.Assert(req.Server.AvailabilityZone, check.Equals, "az1")
+	c.Assert(req.Server.UserData, check.Equals, base64.StdEncoding.EncodeToString([]byte("#!/bin/sh\n")))
+	c.Assert(req.Server.Networks, check.DeepEquals, []novaNetwork{{UUID: "net-1"}, {UUID: "net-2"}})
+	c.Assert(req.Server.SecurityGroups, check.DeepEquals, []keystoneName{{Name: "default"}, {Name: "docker"}})
+}
+
+func (s *S) TestBuildServerRequestDefaultName(c *check.C) {
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	req, err := i.buildServerRequest(map[string]string{"flavor": "f", "image": "i"}, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Server.Name, check.Matches, "tsuru-[0-9a-f]{12}")
+	c.Assert(req.Server.UserData, check.Equals, "")
+	c.Assert(req.Server.Networks, check.IsNil)
+}
+
+func (s *S) TestBuildServerRequestMandatoryParams(c *check.C) {
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	_, err := i.buildServerRequest(map[string]string{"image": "i"}, "")
+	c.Assert(err, check.ErrorMatches, `param "flavor" is mandatory`)
+	_, err = i.buildServerRequest(map[string]string{"flavor": "f"}, "")
+	c.Assert(err, check.ErrorMatches, `param "image" is mandatory`)
+}
+
+func (s *S) TestWaitServer(c *check.C) {
+	s.fake.servers["srv-1"] = []novaServer{
+		{ID: "srv-1", Status: "BUILD"},
+		{ID: "srv-1", Status: "ACTIVE"},
+		activeServer(),
+	}
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	address, err := i.waitServer("RegionOne", "srv-1", time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(address, check.Equals, "10.0.0.10")
+}
+
+func (s *S) TestWaitServerError(c *check.C) {
+	server := novaServer{ID: "srv-1", Status: "ERROR"}
+	server.Fault = &struct {
+		Message string `json:"message"`
+	}{Message: "No valid host was found."}
+	s.fake.servers["srv-1"] = []novaServer{server}
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	_, err := i.waitServer("RegionOne", "srv-1", time.Minute)
+	c.Assert(err, check.ErrorMatches, "openstack: server srv-1 failed: No valid host was found.")
+}
+
+func (s *S) TestWaitServerTimeout(c *check.C) {
+	s.fake.servers["srv-1"] = []novaServer{{ID: "srv-1", Status: "BUILD"}}
+	i := newOpenStackIaaS("openstack").(*OpenStackIaaS)
+	_, err := i.waitServer("RegionOne", "srv-1", 10*time.Millisecond)
+	c.Assert(err, check.ErrorMatches, "hard timeout")
+}
+
+func (s *S) TestServerAddress(c *check.C) {
+	server := activeServer()
+	c.Assert(server.address(), check.Equals, "10.0.0.10")
+	server.Addresses["public"] = []novaAddress{{Addr: "200.0.0.10", Version: 4, Type: "floating"}}
+	c.Assert(server.address(), check.Equals, "200.0.0.10")
+	server.AccessIPv4 = "200.0.0.20"
+	c.Assert(server.address(), check.Equals, "200.0.0.20")
+	server = novaServer{Addresses: map[string][]novaAddress{"net": {{Addr: "10.0.0.30", Version: 4}}}}
+	c.Assert(server.address(), check.Equals, "10.0.0.30")
+	c.Assert((&novaServer{}).address(), check.Equals, "")
+}
+
+func (s *S) TestCreateMachine(c *check.C) {
+	s.fake.servers["srv-1"] = []novaServer{{ID: "srv-1", Status: "BUILD"}, activeServer()}
+	i := newOpenStackIaaS("openstack")
+	err := i.(iaas.InitializableIaaS).Initialize()
+	c.Assert(err, check.IsNil)
+	m, err := i.CreateMachine(map[string]string{"flavor": "m1.small", "image": "img-1", "network": "net-1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(m, check.DeepEquals, &iaas.Machine{Id: "srv-1", Status: "ACTIVE", Address: "10.0.0.10"})
+	c.Assert(s.fake.created, check.HasLen, 1)
+	c.Assert(s.fake.created[0].Server.FlavorRef, check.Equals, "m1.small")
+	c.Assert(s.fake.created[0].Server.Networks, check.DeepEquals, []novaNetwork{{UUID: "net-1"}})
+}
+
+func (s *S) TestCreateMachineFailureDestroysServer(c *check.C) {
+	s.fake.servers["srv-1"] = []novaServer{{ID: "srv-1", Status: "ERROR"}}
+	i := newOpenStackIaaS("openstack")
+	err := i.(iaas.InitializableIaaS).Initialize()
+	c.Assert(err, check.IsNil)
+	_, err = i.CreateMachine(map[string]string{"flavor": "m1.small", "image": "img-1"})
+	c.Assert(err, check.ErrorMatches, "openstack: server srv-1 failed: unknown error")
+	c.Assert(s.fake.deleted, check.DeepEquals, []string{"/regionone/compute/servers/srv-1"})
+}
+
+func (s *S) TestDeleteMachine(c *check.C) {
+	i := newOpenStackIaaS("openstack")
+	err := i.DeleteMachine(&iaas.Machine{Id: "srv-1", CreationParams: map[string]string{"region": "RegionTwo"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.fake.deleted, check.DeepEquals, []string{"/regiontwo/compute/servers/srv-1"})
+}
+
+func (s *S) TestDeleteMachineNotFound(c *check.C) {
+	i := newOpenStackIaaS("openstack")
+	err := i.DeleteMachine(&iaas.Machine{Id: "srv-2"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestDescribe(c *check.C) {
+	i := newOpenStackIaaS("openstack").(iaas.Describer)
+	c.Assert(i.Describe(), check.Matches, "(?s)OpenStack IaaS required params:.*flavor=.*image=.*")
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/log"
+)
+
+var pollInterval = time.Second
+
+type openstackWaitTask struct {
+	iaas *OpenStackIaaS
+}
+
+func (t *openstackWaitTask) Name() string {
+	return fmt.Sprintf("openstack-wait-machine-%s", t.iaas.base.IaaSName)
+}
+
+func (t *openstackWaitTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	region, _ := params["region"].(string)
+	machineId := params["machineId"].(string)
+	var timeout int
+	switch val := params["timeout"].(type) {
+	case int:
+		timeout = val
+	case float64:
+		timeout = int(val)
+	}
+	address, err := t.iaas.waitServer(region, machineId, time.Duration(2*timeout)*time.Second)
+	if err == nil {
+		if notifiedSuccess, _ := job.Success(address); notifiedSuccess {
+			return
+		}
+	}
+	log.Errorf("openstack: destroying server %s, it failed to start", machineId)
+	t.iaas.deleteServer(region, machineId)
+	if err != nil {
+		job.Error(err)
+	}
+}
+
+// waitServer waits for the server to become active and have an address,
+// returning that address.
+func (i *OpenStackIaaS) waitServer(region, id string, timeout time.Duration) (string, error) {
+	t0 := time.Now()
+	for {
+		if time.Since(t0) > timeout {
+			return "", errors.New("hard timeout")
+		}
+		log.Debugf("openstack: waiting for server %s to become active", id)
+		server, err := i.getServer(region, id)
+		if err != nil {
+			if isNotFound(err) {
+				return "", fmt.Errorf("openstack: server %s not found", id)
+			}
+			log.Debugf("openstack: api error: %s", err)
+			time.Sleep(pollInterval)
+			continue
+		}
+		switch server.Status {
+		case "ERROR":
+			msg := "unknown error"
+			if server.Fault != nil && server.Fault.Message != "" {
+				msg = server.Fault.Message
+			}
+			return "", fmt.Errorf("openstack: server %s failed: %s", id, msg)
+		case "ACTIVE":
+			if address := server.address(); address != "" {
+				return address, nil
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+}
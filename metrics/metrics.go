@@ -0,0 +1,300 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics keeps counters, histograms and gauges describing the
+// operation of tsuru, and writes them in the Prometheus text format.
+//
+// Metrics are usually declared as package level variables, next to the code
+// updating them:
+//
+//	var requests = metrics.NewCounter("tsuru_requests_total", "Number of requests.", "method")
+//
+//	requests.Inc("GET")
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultBuckets are the buckets used for latencies of requests, in
+	// seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// LongBuckets are the buckets used for durations of long running
+	// operations, like deploys, in seconds.
+	LongBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+)
+
+var registry = struct {
+	sync.Mutex
+	families map[string]*family
+}{families: map[string]*family{}}
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+func register(name, help, metricType string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.families[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	registry.families[name] = &family{help: help, metricType: metricType, metric: m}
+}
+
+type family struct {
+	help       string
+	metricType string
+	metric
+}
+
+type series struct {
+	labels []string
+	value  float64
+	// Fields used by histograms only.
+	counts []uint64
+	sum    float64
+}
+
+// vector keeps the series of a metric, one for each combination of label
+// values.
+type vector struct {
+	mu     sync.Mutex
+	labels []string
+	series map[string]*series
+}
+
+func newVector(labels []string) vector {
+	return vector{labels: labels, series: map[string]*series{}}
+}
+
+// get returns the series with the given label values, it must be called
+// with the lock held.
+func (v *vector) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series sorted by their label values, it must be called
+// with the lock held.
+func (v *vector) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*series, len(keys))
+	for i, key := range keys {
+		result[i] = v.series[key]
+	}
+	return result
+}
+
+func (v *vector) formatLabels(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, v.labels[i]+`="`+escapeLabel(value)+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+escapeLabel(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a metric whose value only increases, like the number of
+// requests.
+type Counter struct {
+	vector
+}
+
+// NewCounter creates and registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vector: newVector(labels)}
+	register(name, help, "counter", c)
+	return c
+}
+
+// Inc increments by one the counter with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the counter with the given label values.
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(values).value += delta
+}
+
+// Value returns the current value of the counter with the given label
+// values.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[strings.Join(values, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", name, c.formatLabels(s.labels, "", ""), formatFloat(s.value))
+	}
+}
+
+// Histogram samples observations, like the latency of requests, counting
+// them in buckets.
+type Histogram struct {
+	vector
+	buckets []float64
+}
+
+// NewHistogram creates and registers a histogram with the given buckets,
+// which must be sorted, and label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{vector: newVector(labels), buckets: buckets}
+	register(name, help, "histogram", h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets)+1)
+	}
+	i := sort.SearchFloat64s(h.buckets, value)
+	s.counts[i]++
+	s.sum += value
+}
+
+// Count returns the number of observations of the histogram with the given
+// label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var count uint64
+	if s, ok := h.series[strings.Join(values, "\xff")]; ok {
+		for _, c := range s.counts {
+			count += c
+		}
+	}
+	return count
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.sorted() {
+		if s.counts == nil {
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.formatLabels(s.labels, "le", formatFloat(bound)), cumulative)
+		}
+		cumulative += s.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.formatLabels(s.labels, "le", "+Inf"), cumulative)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, h.formatLabels(s.labels, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, h.formatLabels(s.labels, "", ""), cumulative)
+	}
+}
+
+type gaugeFunc func() float64
+
+func (f gaugeFunc) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f()))
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by f when the
+// metrics are collected, like the size of a queue.
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(name, help, "gauge", gaugeFunc(f))
+}
+
+// Write writes all the registered metrics to w in the Prometheus text
+// format.
+func Write(w io.Writer) error {
+	registry.Lock()
+	names := make([]string, 0, len(registry.families))
+	families := make(map[string]*family, len(registry.families))
+	for name, f := range registry.families {
+		names = append(names, name)
+		families[name] = f
+	}
+	registry.Unlock()
+	sort.Strings(names)
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		fmt.Fprintf(buf, "# HELP %s %s\n", name, escapeHelp(f.help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, f.metricType)
+		f.write(buf, name)
+	}
+	return buf.Flush()
+}
+
+// Status returns the value of the status label of an operation finished
+// with err, either "success" or "error".
+func Status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Handler returns a handler serving the registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	help = strings.Replace(help, `\`, `\\`, -1)
+	return strings.Replace(help, "\n", `\n`, -1)
+}
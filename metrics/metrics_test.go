@@ -0,0 +1,97 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TearDownTest(c *check.C) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.families = map[string]*family{}
+}
+
+func (s *S) TestCounter(c *check.C) {
+	counter := NewCounter("test_requests_total", "Number of requests.", "method", "path")
+	counter.Inc("GET", "/apps")
+	counter.Add(2, "GET", "/apps")
+	counter.Inc("POST", `/a"b\c`)
+	c.Assert(counter.Value("GET", "/apps"), check.Equals, 3.0)
+	c.Assert(counter.Value("DELETE", "/apps"), check.Equals, 0.0)
+	var buf bytes.Buffer
+	err := Write(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, `# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/apps"} 3
+test_requests_total{method="POST",path="/a\"b\\c"} 1
+`)
+}
+
+func (s *S) TestCounterInvalidLabels(c *check.C) {
+	counter := NewCounter("test_total", "Test.", "method")
+	c.Assert(func() { counter.Inc() }, check.PanicMatches, "metrics: expected 1 label values, got 0")
+}
+
+func (s *S) TestDuplicateMetric(c *check.C) {
+	NewCounter("test_total", "Test.")
+	c.Assert(func() { NewCounter("test_total", "Test.") }, check.PanicMatches, `metrics: duplicate metric "test_total"`)
+}
+
+func (s *S) TestHistogram(c *check.C) {
+	h := NewHistogram("test_duration_seconds", "Duration of tests.", []float64{0.5, 1}, "kind")
+	h.Observe(0.1, "unit")
+	h.Observe(0.5, "unit")
+	h.Observe(3, "unit")
+	c.Assert(h.Count("unit"), check.Equals, uint64(3))
+	c.Assert(h.Count("integration"), check.Equals, uint64(0))
+	var buf bytes.Buffer
+	err := Write(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, `# HELP test_duration_seconds Duration of tests.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="unit",le="0.5"} 2
+test_duration_seconds_bucket{kind="unit",le="1"} 2
+test_duration_seconds_bucket{kind="unit",le="+Inf"} 3
+test_duration_seconds_sum{kind="unit"} 3.6
+test_duration_seconds_count{kind="unit"} 3
+`)
+}
+
+func (s *S) TestHandler(c *check.C) {
+	NewGaugeFunc("test_queue_size", "Size of the\nqueue.", func() float64 { return 42 })
+	NewCounter("test_errors_total", "Number of errors.").Inc()
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/metrics", nil)
+	c.Assert(err, check.IsNil)
+	Handler().ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/plain; version=0.0.4")
+	c.Assert(recorder.Body.String(), check.Equals, `# HELP test_errors_total Number of errors.
+# TYPE test_errors_total counter
+test_errors_total 1
+# HELP test_queue_size Size of the\nqueue.
+# TYPE test_queue_size gauge
+test_queue_size 42
+`)
+}
+
+func (s *S) TestStatus(c *check.C) {
+	c.Assert(Status(nil), check.Equals, "success")
+	c.Assert(Status(errors.New("failed")), check.Equals, "error")
+}
@@ -58,6 +58,25 @@ var (
 	}
 )
 
+// ParseContext parses a context in the "type:value" format, e.g.
+// "app:myapp" or "team:admin". The global context may be written simply as
+// "global".
+func ParseContext(ctx string) (PermissionContext, error) {
+	parts := strings.SplitN(ctx, ":", 2)
+	ctxType, err := parseContext(parts[0])
+	if err != nil {
+		return PermissionContext{}, err
+	}
+	var value string
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+	if ctxType != CtxGlobal && value == "" {
+		return PermissionContext{}, fmt.Errorf("missing value for context type %q", ctxType)
+	}
+	return PermissionContext{CtxType: ctxType, Value: value}, nil
+}
+
 func parseContext(ctx string) (contextType, error) {
 	for _, t := range ContextTypes {
 		if string(t) == ctx {
@@ -147,6 +166,25 @@ func (p *Permission) String() string {
 	return fmt.Sprintf("%s(%s%s)", p.Scheme.FullName(), p.Context.CtxType, value)
 }
 
+func (p *Permission) allows(contexts []PermissionContext) bool {
+	if p.Context.CtxType == CtxGlobal {
+		return true
+	}
+	for _, ctx := range contexts {
+		if ctx.CtxType == p.Context.CtxType && ctx.Value == p.Context.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckResult describes whether a permission whose scheme is a parent of a
+// checked scheme grants access to the checked contexts.
+type CheckResult struct {
+	Permission Permission
+	Granted    bool
+}
+
 type Token interface {
 	Permissions() ([]Permission, error)
 }
@@ -203,20 +241,26 @@ func Check(token Token, scheme *PermissionScheme, contexts ...PermissionContext)
 
 func CheckFromPermList(perms []Permission, scheme *PermissionScheme, contexts ...PermissionContext) bool {
 	for _, perm := range perms {
-		if perm.Scheme.IsParent(scheme) {
-			if perm.Context.CtxType == CtxGlobal {
-				return true
-			}
-			for _, ctx := range contexts {
-				if ctx.CtxType == perm.Context.CtxType && ctx.Value == perm.Context.Value {
-					return true
-				}
-			}
+		if perm.Scheme.IsParent(scheme) && perm.allows(contexts) {
+			return true
 		}
 	}
 	return false
 }
 
+// ExplainFromPermList works like CheckFromPermList, but instead of a single
+// boolean it returns one result for each permission in perms whose scheme is
+// a parent of scheme, describing whether it grants access to contexts.
+func ExplainFromPermList(perms []Permission, scheme *PermissionScheme, contexts ...PermissionContext) []CheckResult {
+	var results []CheckResult
+	for _, perm := range perms {
+		if perm.Scheme.IsParent(scheme) {
+			results = append(results, CheckResult{Permission: perm, Granted: perm.allows(contexts)})
+		}
+	}
+	return results
+}
+
 func TeamForPermission(t Token, scheme *PermissionScheme) (string, error) {
 	allContexts := ContextsForPermission(t, scheme)
 	teams := make([]string, 0, len(allContexts))
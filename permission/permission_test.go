@@ -125,3 +125,45 @@ func (s *S) TestGetTeamForPermissionGlobalMustSpecifyTeam(c *check.C) {
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.Equals, ErrTooManyTeams)
 }
+
+func (s *S) TestExplainFromPermList(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermAppUpdate, Context: PermissionContext{CtxType: CtxTeam, Value: "team1"}},
+		{Scheme: PermAppDeploy, Context: PermissionContext{CtxType: CtxTeam, Value: "team3"}},
+		{Scheme: PermAppUpdateEnvUnset, Context: PermissionContext{CtxType: CtxGlobal}},
+	}
+	results := ExplainFromPermList(perms, PermAppUpdateEnvSet, PermissionContext{CtxType: CtxTeam, Value: "team3"})
+	c.Assert(results, check.DeepEquals, []CheckResult{
+		{Permission: perms[0], Granted: false},
+	})
+	results = ExplainFromPermList(perms, PermAppUpdateEnvUnset, PermissionContext{CtxType: CtxTeam, Value: "team1"})
+	c.Assert(results, check.DeepEquals, []CheckResult{
+		{Permission: perms[0], Granted: true},
+		{Permission: perms[2], Granted: true},
+	})
+	results = ExplainFromPermList(perms, PermAppCreate)
+	c.Assert(results, check.HasLen, 0)
+}
+
+func (s *S) TestParseContext(c *check.C) {
+	tests := []struct {
+		input string
+		ctx   PermissionContext
+		err   string
+	}{
+		{"global", PermissionContext{CtxType: CtxGlobal}, ""},
+		{"app:myapp", PermissionContext{CtxType: CtxApp, Value: "myapp"}, ""},
+		{"service-instance:mysql:db1", PermissionContext{CtxType: CtxServiceInstance, Value: "mysql:db1"}, ""},
+		{"team", PermissionContext{}, `missing value for context type "team"`},
+		{"invalid:x", PermissionContext{}, `invalid context type "invalid"`},
+	}
+	for _, tt := range tests {
+		ctx, err := ParseContext(tt.input)
+		if tt.err != "" {
+			c.Check(err, check.ErrorMatches, tt.err)
+		} else {
+			c.Check(err, check.IsNil)
+		}
+		c.Check(ctx, check.DeepEquals, tt.ctx)
+	}
+}
@@ -13,6 +13,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"app.update.description",
 	"app.update.log",
+	"app.update.log-drain.add",
+	"app.update.log-drain.remove",
 	"app.update.pool",
 	"app.update.unit.add",
 	"app.update.unit.remove",
@@ -32,6 +34,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.cname.remove",
 	"app.update.plan",
 	"app.update.bind",
+	"app.update.bind-request",
 	"app.update.events",
 	"app.update.unbind",
 	"app.deploy",
@@ -53,6 +56,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.admin.unlock",
 	"app.admin.routes",
 	"app.admin.quota",
+	"app.admin.log-limits",
 ).addWithCtx(
 	"node", []contextType{CtxPool},
 ).add(
@@ -94,6 +98,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"user.delete",
 	"user.read.events",
+	"user.read.permissions",
 	"user.update.token",
 	"user.update.quota",
 	"user.update.password",
@@ -111,6 +116,8 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"service.update.proxy",
 	"service.update.revoke-access",
 	"service.update.grant-access",
+	"service.update.pools",
+	"service.update.proxy-rules",
 	"service.update.doc",
 	"service.delete",
 ).addWithCtx(
@@ -120,13 +127,21 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"service-instance.read.events",
 	"service-instance.read.status",
+	"service-instance.read.backups",
 	"service-instance.delete",
 	"service-instance.update.proxy",
 	"service-instance.update.bind",
+	"service-instance.update.bind.rotate",
 	"service-instance.update.unbind",
 	"service-instance.update.grant",
+	"service-instance.update.bind-request",
 	"service-instance.update.revoke",
 	"service-instance.update.description",
+	"service-instance.update.plan",
+	"service-instance.update.parameters",
+	"service-instance.update.backup.create",
+	"service-instance.update.backup.restore",
+	"service-instance.update.backup.schedule",
 ).add(
 	"role.create",
 	"role.delete",
@@ -174,4 +189,12 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"nodecontainer.update",
 	"nodecontainer.update.upgrade",
 	"nodecontainer.delete",
+).addWithCtx(
+	"webhook", []contextType{CtxTeam},
+).add(
+	"webhook.create",
+	"webhook.read",
+	"webhook.read.events",
+	"webhook.update",
+	"webhook.delete",
 )
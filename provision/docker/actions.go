@@ -203,6 +203,7 @@ var createContainer = action.Action{
 		if args.buildingImage != "" {
 			building = true
 		}
+		cont.Span = ctx.Span
 		err := cont.Create(&container.CreateArgs{
 			ImageID:          args.imageID,
 			Commands:         args.commands,
@@ -292,6 +293,7 @@ var startContainer = action.Action{
 		}
 		c := ctx.Previous.(container.Container)
 		log.Debugf("starting container %s", c.ID)
+		c.Span = ctx.Span
 		err := c.Start(&container.StartArgs{
 			Provisioner: args.provisioner,
 			App:         args.app,
@@ -343,6 +345,7 @@ var provisionAddUnitsToHost = action.Action{
 		units := len(containers)
 		fmt.Fprintf(w, "\n---- Destroying %d created %s ----\n", units, pluralize("unit", units))
 		runInContainers(containers, func(cont *container.Container, _ chan *container.Container) error {
+			cont.Span = ctx.Span
 			err := cont.Remove(args.provisioner)
 			if err != nil {
 				log.Errorf("Error removing added container %s: %s", cont.ID, err.Error())
@@ -466,7 +469,9 @@ var addNewRoutes = action.Action{
 		if len(routesToAdd) == 0 {
 			return newContainers, nil
 		}
+		span := router.StartSpan(ctx.Span, "AddRoutes", args.app.GetName())
 		err = r.AddRoutes(args.app.GetName(), routesToAdd)
+		span.FinishWithError(err)
 		if err != nil {
 			r.RemoveRoutes(args.app.GetName(), routesToAdd)
 			return nil, err
@@ -499,7 +504,9 @@ var addNewRoutes = action.Action{
 		if len(routesToRemove) == 0 {
 			return
 		}
+		span := router.StartSpan(ctx.Span, "RemoveRoutes", args.app.GetName())
 		err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
+		span.FinishWithError(err)
 		if err != nil {
 			log.Errorf("[add-new-routes:Backward] Error removing route for [%v]: %s", routesToRemove, err.Error())
 			return
@@ -547,7 +554,9 @@ var setRouterHealthcheck = action.Action{
 			msg = fmt.Sprintf("%s, Body: %s", msg, hcData.Body)
 		}
 		fmt.Fprintf(writer, "\n---- Setting router healthcheck (%s) ----\n", msg)
+		span := router.StartSpan(ctx.Span, "SetHealthcheck", args.app.GetName())
 		err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
+		span.FinishWithError(err)
 		return newContainers, err
 	},
 	Backward: func(ctx action.BWContext) {
@@ -567,7 +576,9 @@ var setRouterHealthcheck = action.Action{
 			log.Errorf("[set-router-healthcheck:Backward] Error getting yaml data: %s", err.Error())
 		}
 		hcData := yamlData.Healthcheck.ToRouterHC()
+		span := router.StartSpan(ctx.Span, "SetHealthcheck", args.app.GetName())
 		err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
+		span.FinishWithError(err)
 		if err != nil {
 			log.Errorf("[set-router-healthcheck:Backward] Error setting healthcheck: %s", err.Error())
 		}
@@ -622,7 +633,9 @@ var removeOldRoutes = action.Action{
 		if len(routesToRemove) == 0 {
 			return
 		}
+		span := router.StartSpan(ctx.Span, "RemoveRoutes", args.app.GetName())
 		err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
+		span.FinishWithError(err)
 		if err != nil {
 			if !args.appDestroy {
 				r.AddRoutes(args.app.GetName(), routesToRemove)
@@ -656,7 +669,9 @@ var removeOldRoutes = action.Action{
 		if len(routesToAdd) == 0 {
 			return
 		}
+		span := router.StartSpan(ctx.Span, "AddRoutes", args.app.GetName())
 		err = r.AddRoutes(args.app.GetName(), routesToAdd)
+		span.FinishWithError(err)
 		if err != nil {
 			log.Errorf("[remove-old-routes:Backward] Error adding back route for [%v]: %s", routesToAdd, err.Error())
 			return
@@ -682,6 +697,7 @@ var provisionRemoveOldUnits = action.Action{
 		total := len(args.toRemove)
 		fmt.Fprintf(writer, "\n---- Removing %d old %s ----\n", total, pluralize("unit", total))
 		runInContainers(args.toRemove, func(c *container.Container, toRollback chan *container.Container) error {
+			c.Span = ctx.Span
 			err := c.Remove(args.provisioner)
 			if err != nil {
 				log.Errorf("Ignored error trying to remove old container %q: %s", c.ID, err)
@@ -779,6 +795,7 @@ var followLogsAndCommit = action.Action{
 			}
 		}
 		fmt.Fprintf(args.writer, "\n---- Building application image ----\n")
+		c.Span = ctx.Span
 		imageId, err := c.Commit(args.provisioner, args.writer)
 		if err != nil {
 			log.Errorf("error on commit container %s - %s", c.ID, err)
@@ -20,6 +20,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/docker/container"
@@ -34,6 +35,8 @@ const (
 	autoScaleEventKind = "autoscale"
 )
 
+var autoScaleActions = metrics.NewCounter("tsuru_autoscale_actions_total", "Number of actions taken by the node auto scaler, by action and status.", "action", "status")
+
 type errAppNotLocked struct {
 	app string
 }
@@ -249,6 +252,7 @@ func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
 	if sResult.ToAdd > 0 {
 		evt.Logf("running event \"add\" for %q: %#v", pool, sResult)
 		evtNodes, err = a.addMultipleNodes(evt, nodes, sResult.ToAdd)
+		autoScaleActions.Inc("add", metrics.Status(err))
 		if err != nil {
 			if len(evtNodes) == 0 {
 				retErr = err
@@ -260,6 +264,7 @@ func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
 		evt.Logf("running event \"remove\" for %q: %#v", pool, sResult)
 		evtNodes = sResult.ToRemove
 		err = a.removeMultipleNodes(evt, sResult.ToRemove)
+		autoScaleActions.Inc("remove", metrics.Status(err))
 		if err != nil {
 			retErr = err
 			return
@@ -312,6 +317,7 @@ func (a *autoScaleConfig) rebalanceIfNeeded(evt *event.Event, pool string, nodes
 		buf := safe.NewBuffer(nil)
 		writer := io.MultiWriter(buf, evt)
 		_, err := a.provisioner.rebalanceContainersByFilter(writer, nil, rebalanceFilter, false)
+		autoScaleActions.Inc("rebalance", metrics.Status(err))
 		if err != nil {
 			return fmt.Errorf("unable to rebalance containers: %s - log: %s", err.Error(), buf.String())
 		}
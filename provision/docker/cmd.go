@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/ajg/form"
 	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/cmd"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/provision/docker/container"
@@ -501,3 +503,87 @@ func (c *dockerLogInfo) Run(context *cmd.Context, client *cmd.Client) error {
 	}
 	return nil
 }
+
+type appMetricsCmd struct {
+	cmd.GuessingCommand
+	fs      *gnuflag.FlagSet
+	process string
+}
+
+func (c *appMetricsCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-metrics",
+		Usage: "app-metrics [-a/--app appname] [-p/--process processname]",
+		Desc: `Shows the recent resource usage of the units of an app, aggregated by
+process. CPU is shown in percent of one CPU, summed over the units of the
+process, and the network columns show the bytes received and sent per second.`,
+	}
+}
+
+func (c *appMetricsCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.process, "process", "", "Only show the metrics of this process.")
+		c.fs.StringVar(&c.process, "p", "", "Only show the metrics of this process.")
+	}
+	return c.fs
+}
+
+func (c *appMetricsCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/apps/%s/metrics", appName)
+	if c.process != "" {
+		path += "?" + url.Values{"process": {c.process}}.Encode()
+	}
+	u, err := cmd.GetURLVersion("1.1", path)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintf(context.Stdout, "No metrics available for app %q yet.\n", appName)
+		return nil
+	}
+	var metrics []app.ResourceMetrics
+	err = json.NewDecoder(response.Body).Decode(&metrics)
+	if err != nil {
+		return err
+	}
+	t := cmd.Table{Headers: cmd.Row([]string{"Date", "Process", "Units", "CPU", "Memory", "Network In", "Network Out"})}
+	for _, m := range metrics {
+		t.AddRow(cmd.Row([]string{
+			m.Date.Local().Format(time.Stamp),
+			m.Process,
+			strconv.Itoa(m.Units),
+			fmt.Sprintf("%.1f%%", m.CPU),
+			fmt.Sprintf("%s / %s", formatBytes(float64(m.Memory)), formatBytes(float64(m.MemoryLimit))),
+			formatBytes(m.NetworkRx) + "/s",
+			formatBytes(m.NetworkTx) + "/s",
+		}))
+	}
+	context.Stdout.Write(t.Bytes())
+	return nil
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
@@ -430,3 +430,53 @@ func (s *S) TestListAutoScaleHistoryCmdRun(c *check.C) {
 	expected = fmt.Sprintf(expected, startTStr, endTStr, startTStr, endTStr)
 	c.Assert(buf.String(), check.Equals, expected)
 }
+
+func (s *S) TestAppMetricsCmdRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	date := time.Date(2016, 10, 18, 12, 30, 0, 0, time.UTC)
+	result := fmt.Sprintf(`[{"app":"myapp","process":"web","date":%q,"units":2,"cpu":12.5,"memory":67108864,"memoryLimit":268435456,"networkRx":2048,"networkTx":100}]`, date.Format(time.RFC3339))
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.1/apps/myapp/metrics" && req.URL.Query().Get("process") == "web" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cm := appMetricsCmd{}
+	cm.Flags().Parse(true, []string{"-a", "myapp", "-p", "web"})
+	err := cm.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+-----------------+---------+-------+-------+------------------+------------+-------------+
+| Date            | Process | Units | CPU   | Memory           | Network In | Network Out |
++-----------------+---------+-------+-------+------------------+------------+-------------+
+| ` + date.Local().Format(time.Stamp) + ` | web     | 2     | 12.5% | 64.0MB / 256.0MB | 2.0KB/s    | 100B/s      |
++-----------------+---------+-------+-------+------------------+------------+-------------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppMetricsCmdRunNoContent(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.1/apps/myapp/metrics" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cm := appMetricsCmd{}
+	cm.Flags().Parse(true, []string{"-a", "myapp"})
+	err := cm.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "No metrics available for app \"myapp\" yet.\n")
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -74,6 +75,9 @@ type Container struct {
 	LockedUntil             time.Time
 	Routable                bool `bson:"-"`
 	ExposedPort             string
+	// Span is the span of the operation changing the container, parent of
+	// the spans tracing the docker calls involving the container.
+	Span *tracing.Span `bson:"-" json:"-"`
 }
 
 func (c *Container) ShortID() string {
@@ -176,8 +180,13 @@ func (c *Container) Create(args *CreateArgs) error {
 		ProcessName:   args.ProcessName,
 		ActionLimiter: args.Provisioner.ActionLimiter(),
 	}
+	span := c.startSpan("CreateContainer")
 	addr, cont, err := args.Provisioner.Cluster().CreateContainerSchedulerOpts(opts, schedulerOpts, net.StreamInactivityTimeout, nodeList...)
 	hostAddr := net.URLToHost(addr)
+	if err == nil {
+		span.SetTag("container.id", cont.ID).SetTag("peer.hostname", hostAddr)
+	}
+	span.FinishWithError(err)
 	if schedulerOpts.LimiterDone != nil {
 		schedulerOpts.LimiterDone()
 	}
@@ -291,7 +300,9 @@ func (c *Container) Remove(p DockerProvisioner) error {
 		log.Errorf("error on stop unit %s - %s", c.ID, err)
 	}
 	done := p.ActionLimiter().Start(c.HostAddr)
+	span := c.startSpan("RemoveContainer")
 	err = p.Cluster().RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
+	span.FinishWithError(err)
 	done()
 	if err != nil {
 		log.Errorf("Failed to remove container from docker: %s", err)
@@ -360,7 +371,11 @@ func (e *execErr) Error() string {
 	return fmt.Sprintf("unexpected exit code: %d", e.code)
 }
 
-func (c *Container) Exec(p DockerProvisioner, stdout, stderr io.Writer, cmd string, args ...string) error {
+func (c *Container) Exec(p DockerProvisioner, stdout, stderr io.Writer, cmd string, args ...string) (err error) {
+	span := c.startSpan("Exec")
+	defer func() {
+		span.FinishWithError(err)
+	}()
 	cmds := []string{"/bin/bash", "-lc", cmd}
 	cmds = append(cmds, args...)
 	execCreateOpts := docker.CreateExecOptions{
@@ -393,6 +408,37 @@ func (c *Container) Exec(p DockerProvisioner, stdout, stderr io.Writer, cmd stri
 	return nil
 }
 
+var statsTimeout = 10 * time.Second
+
+// Stats returns a single sample of the resource usage of the container.
+func (c *Container) Stats(p DockerProvisioner) (*docker.Stats, error) {
+	node, err := p.GetNodeByHost(c.HostAddr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := node.Client()
+	if err != nil {
+		return nil, err
+	}
+	statsCh := make(chan *docker.Stats, 1)
+	span := c.startSpan("Stats")
+	err = client.Stats(docker.StatsOptions{
+		ID:      c.ID,
+		Stats:   statsCh,
+		Stream:  false,
+		Timeout: statsTimeout,
+	})
+	span.FinishWithError(err)
+	if err != nil {
+		return nil, err
+	}
+	stats, ok := <-statsCh
+	if !ok {
+		return nil, fmt.Errorf("no stats received for container %s", c.ID)
+	}
+	return stats, nil
+}
+
 // Commits commits the container, creating an image in Docker. It then returns
 // the image identifier for usage in future container creation.
 func (c *Container) Commit(p DockerProvisioner, writer io.Writer) (string, error) {
@@ -405,7 +451,9 @@ func (c *Container) Commit(p DockerProvisioner, writer io.Writer) (string, error
 	tag := parts[len(parts)-1]
 	opts := docker.CommitContainerOptions{Container: c.ID, Repository: repository, Tag: tag}
 	done := p.ActionLimiter().Start(c.HostAddr)
+	span := c.startSpan("CommitContainer")
 	image, err := p.Cluster().CommitContainer(opts)
+	span.FinishWithError(err)
 	done()
 	if err != nil {
 		return "", log.WrapError(fmt.Errorf("error in commit container %s: %s", c.ID, err.Error()))
@@ -459,7 +507,9 @@ func (c *Container) Stop(p DockerProvisioner) error {
 		return nil
 	}
 	done := p.ActionLimiter().Start(c.HostAddr)
+	span := c.startSpan("StopContainer")
 	err := p.Cluster().StopContainer(c.ID, 10)
+	span.FinishWithError(err)
 	done()
 	if err != nil {
 		log.Errorf("error on stop container %s: %s", c.ID, err)
@@ -524,7 +574,9 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 
 func (c *Container) Start(args *StartArgs) error {
 	done := args.Provisioner.ActionLimiter().Start(c.HostAddr)
+	span := c.startSpan("StartContainer")
 	err := args.Provisioner.Cluster().StartContainer(c.ID, nil)
+	span.FinishWithError(err)
 	done()
 	if err != nil {
 		return err
@@ -536,6 +588,16 @@ func (c *Container) Start(args *StartArgs) error {
 	return c.SetStatus(args.Provisioner, initialStatus, false)
 }
 
+// startSpan starts a span, child of c.Span, tracing a call to the docker API
+// involving the container.
+func (c *Container) startSpan(operation string) *tracing.Span {
+	return c.Span.StartChild("docker "+operation).
+		SetTag("component", "docker").
+		SetTag("app", c.AppName).
+		SetTag("container.id", c.ID).
+		SetTag("peer.hostname", c.HostAddr)
+}
+
 func (c *Container) Logs(p DockerProvisioner, w io.Writer) (int, error) {
 	container, err := p.Cluster().InspectContainer(c.ID)
 	if err != nil {
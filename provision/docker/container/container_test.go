@@ -28,11 +28,28 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/router/routertest"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+func (s *S) TestContainerStartSpan(c *check.C) {
+	exporter := &tracing.RecordingExporter{}
+	tracing.SetExporter(exporter)
+	defer tracing.SetExporter(nil)
+	parent := tracing.StartSpan("pipeline", tracing.SpanContext{})
+	cont := Container{ID: "abc123", AppName: "myapp", HostAddr: "10.0.0.1", Span: parent}
+	cont.startSpan("StopContainer").Finish()
+	spans := exporter.Spans()
+	c.Assert(spans, check.HasLen, 1)
+	span := spans[0]
+	c.Assert(span.Operation, check.Equals, "docker StopContainer")
+	c.Assert(span.Context.TraceID, check.Equals, parent.Context().TraceID)
+	c.Assert(span.ParentID, check.Equals, parent.Context().SpanID)
+	c.Assert(span.Tags["container.id"], check.Equals, "abc123")
+}
+
 func (s *S) TestContainerShortID(c *check.C) {
 	container := Container{ID: "abc123"}
 	c.Check(container.ShortID(), check.Equals, container.ID)
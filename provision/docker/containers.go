@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 type appLocker struct {
@@ -115,7 +116,7 @@ func (p *dockerProvisioner) runReplaceUnitsPipeline(w io.Writer, a provision.App
 			&provisionUnbindOldUnits,
 		)
 	}
-	err := pipeline.Execute(args)
+	err := pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +144,7 @@ func (p *dockerProvisioner) runCreateUnitsPipeline(w io.Writer, a provision.App,
 		&setRouterHealthcheck,
 		&updateAppImage,
 	)
-	err := pipeline.Execute(args)
+	err := pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		return nil, err
 	}
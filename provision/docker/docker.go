@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/safe"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 func buildClusterStorage() (cluster.Storage, error) {
@@ -95,7 +96,7 @@ func (p *dockerProvisioner) deployPipeline(app provision.App, imageId string, co
 		provisioner:   p,
 		event:         evt,
 	}
-	err = pipeline.Execute(args)
+	err = pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		log.Errorf("error on execute deploy pipeline for app %s - %s", app.GetName(), err)
 		return "", err
@@ -138,7 +139,7 @@ func (p *dockerProvisioner) start(oldContainer *container.Container, app provisi
 		provisioner:      p,
 		exposedPort:      exposedPort,
 	}
-	err = pipeline.Execute(args)
+	err = pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		return nil, err
 	}
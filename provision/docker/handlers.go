@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/ajg/form"
+	clusterStorage "github.com/tsuru/docker-cluster/storage"
 	"github.com/tsuru/tsuru/api"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -25,8 +26,11 @@ import (
 	_ "github.com/tsuru/tsuru/iaas/cloudstack"
 	_ "github.com/tsuru/tsuru/iaas/digitalocean"
 	_ "github.com/tsuru/tsuru/iaas/ec2"
+	_ "github.com/tsuru/tsuru/iaas/http"
+	_ "github.com/tsuru/tsuru/iaas/openstack"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/provision/docker/healer"
 	"gopkg.in/mgo.v2"
@@ -40,6 +44,7 @@ func init() {
 	api.RegisterHandler("/docker/healing/node", "GET", api.AuthorizationRequiredHandler(nodeHealingRead))
 	api.RegisterHandler("/docker/healing/node", "POST", api.AuthorizationRequiredHandler(nodeHealingUpdate))
 	api.RegisterHandler("/docker/healing/node", "DELETE", api.AuthorizationRequiredHandler(nodeHealingDelete))
+	api.RegisterHandler("/docker/node/{address:.*}/health", "GET", api.AuthorizationRequiredHandler(nodeHealthHandler))
 	api.RegisterHandler("/docker/autoscale", "GET", api.AuthorizationRequiredHandler(autoScaleHistoryHandler))
 	api.RegisterHandler("/docker/autoscale/config", "GET", api.AuthorizationRequiredHandler(autoScaleGetConfig))
 	api.RegisterHandler("/docker/autoscale/run", "POST", api.AuthorizationRequiredHandler(autoScaleRunHandler))
@@ -725,3 +730,37 @@ func nodeHealingDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	}
 	return nil
 }
+
+// title: node health
+// path: /docker/node/{address}/health
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Not found
+func nodeHealthHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	address := r.URL.Query().Get(":address")
+	node, err := mainDockerProvisioner.Cluster().GetNode(address)
+	if err != nil {
+		if err == clusterStorage.ErrNoSuchNode {
+			return &errors.HTTP{
+				Code:    http.StatusNotFound,
+				Message: provision.ErrNodeNotFound.Error(),
+			}
+		}
+		return err
+	}
+	allowed := permission.Check(t, permission.PermNodeRead,
+		permission.Context(permission.CtxPool, node.Metadata[poolMetadataName]),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	health, err := healer.GetNodeHealth(&node)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(health)
+}
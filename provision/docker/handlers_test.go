@@ -1229,3 +1229,72 @@ func (s *HandlersSuite) TestNodeHealingConfigUpdateReadLimited(c *check.C) {
 		"p2": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(20), MaxUnresponsiveTimeInherited: true},
 	})
 }
+
+func (s *HandlersSuite) TestNodeHealthHandler(c *check.C) {
+	err := mainDockerProvisioner.Cluster().Register(cluster.Node{
+		Address:  "http://node1.company:2375",
+		Metadata: map[string]string{"pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC().Truncate(time.Second)
+	coll := s.conn.Collection("node_health_history")
+	defer coll.Close()
+	for i, ok := range []bool{true, false, true, true} {
+		err = coll.Insert(healer.NodeHealthReport{
+			Node:       "http://node1.company:2375",
+			Time:       now.Add(time.Duration(i-4) * time.Minute),
+			Successful: ok,
+			Checks:     []provision.NodeCheckResult{{Name: "ping", Err: "timeout", Successful: ok}},
+		})
+		c.Assert(err, check.IsNil)
+	}
+	request, err := http.NewRequest("GET", "/docker/node/http://node1.company:2375/health", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var health healer.NodeHealth
+	err = json.NewDecoder(recorder.Body).Decode(&health)
+	c.Assert(err, check.IsNil)
+	c.Assert(health.Address, check.Equals, "http://node1.company:2375")
+	c.Assert(health.Reports, check.Equals, 4)
+	c.Assert(health.Uptime, check.Equals, float64(75))
+	c.Assert(health.Flaps, check.Equals, 2)
+	c.Assert(health.Flapping, check.Equals, false)
+	c.Assert(health.FailingChecks, check.HasLen, 1)
+	c.Assert(health.FailingChecks[0].Failures, check.Equals, 1)
+	c.Assert(health.Changes, check.HasLen, 3)
+}
+
+func (s *HandlersSuite) TestNodeHealthHandlerNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/docker/node/http://notfound.company:2375/health", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestNodeHealthHandlerUnauthorized(c *check.C) {
+	err := mainDockerProvisioner.Cluster().Register(cluster.Node{
+		Address:  "http://node1.company:2375",
+		Metadata: map[string]string{"pool": "p1"},
+	})
+	c.Assert(err, check.IsNil)
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err = nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	t := createTokenForUser(limitedUser, "node.read", string(permission.CtxPool), "p2", c)
+	request, err := http.NewRequest("GET", "/docker/node/http://node1.company:2375/health", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
@@ -150,6 +150,12 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 		}
 		return fmt.Sprintf("%ds", *v)
 	}
+	flaps := func(v *int) string {
+		if v == nil || *v == 0 {
+			return "disabled"
+		}
+		return strconv.Itoa(*v)
+	}
 	baseConf := conf[""]
 	delete(conf, "")
 	fmt.Fprint(ctx.Stdout, "Default:\n")
@@ -158,6 +164,7 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	tbl.AddRow(cmd.Row{"Enabled", fmt.Sprintf("%v", baseConf.Enabled != nil && *baseConf.Enabled)})
 	tbl.AddRow(cmd.Row{"Max unresponsive time", v(baseConf.MaxUnresponsiveTime)})
 	tbl.AddRow(cmd.Row{"Max time since success", v(baseConf.MaxTimeSinceSuccess)})
+	tbl.AddRow(cmd.Row{"Max flaps", flaps(baseConf.MaxFlaps)})
 	fmt.Fprint(ctx.Stdout, tbl.String())
 	if len(conf) > 0 {
 		fmt.Fprintln(ctx.Stdout)
@@ -175,6 +182,7 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 		tbl.AddRow(cmd.Row{"Enabled", fmt.Sprintf("%v", poolConf.Enabled != nil && *poolConf.Enabled), strconv.FormatBool(poolConf.EnabledInherited)})
 		tbl.AddRow(cmd.Row{"Max unresponsive time", v(poolConf.MaxUnresponsiveTime), strconv.FormatBool(poolConf.MaxUnresponsiveTimeInherited)})
 		tbl.AddRow(cmd.Row{"Max time since success", v(poolConf.MaxTimeSinceSuccess), strconv.FormatBool(poolConf.MaxTimeSinceSuccessInherited)})
+		tbl.AddRow(cmd.Row{"Max flaps", flaps(poolConf.MaxFlaps), strconv.FormatBool(poolConf.MaxFlapsInherited)})
 		fmt.Fprint(ctx.Stdout, tbl.String())
 		if i < len(poolNames)-1 {
 			fmt.Fprintln(ctx.Stdout)
@@ -190,12 +198,13 @@ type SetNodeHealingConfigCmd struct {
 	pool            string
 	maxUnresponsive int
 	maxUnsuccessful int
+	maxFlaps        int
 }
 
 func (c *SetNodeHealingConfigCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-healing-update",
-		Usage: "docker-healing-update [-p/--pool pool] [--enable] [--disable] [--max-unresponsive <seconds>] [--max-unsuccessful <seconds>]",
+		Usage: "docker-healing-update [-p/--pool pool] [--enable] [--disable] [--max-unresponsive <seconds>] [--max-unsuccessful <seconds>] [--max-flaps <count>]",
 		Desc:  "Update node healing configuration",
 	}
 }
@@ -210,6 +219,7 @@ func (c *SetNodeHealingConfigCmd) Flags() *gnuflag.FlagSet {
 		c.fs.BoolVar(&c.disable, "disable", false, "Disable active node healing")
 		c.fs.IntVar(&c.maxUnresponsive, "max-unresponsive", -1, "Number of seconds tsuru will wait for the node to notify it's alive")
 		c.fs.IntVar(&c.maxUnsuccessful, "max-unsuccessful", -1, "Number of seconds tsuru will wait for the node to run successul checks")
+		c.fs.IntVar(&c.maxFlaps, "max-flaps", -1, "Number of status changes within the flapping window after which the node is healed")
 	}
 	return c.fs
 }
@@ -226,6 +236,9 @@ func (c *SetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	if c.maxUnsuccessful >= 0 {
 		v.Set("MaxTimeSinceSuccess", strconv.Itoa(c.maxUnsuccessful))
 	}
+	if c.maxFlaps >= 0 {
+		v.Set("MaxFlaps", strconv.Itoa(c.maxFlaps))
+	}
 	if c.enable {
 		v.Set("Enabled", strconv.FormatBool(true))
 	}
@@ -256,12 +269,13 @@ type DeleteNodeHealingConfigCmd struct {
 	enabled         bool
 	maxUnresponsive bool
 	maxUnsuccessful bool
+	maxFlaps        bool
 }
 
 func (c *DeleteNodeHealingConfigCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-healing-delete",
-		Usage: "docker-healing-delete [-p/--pool pool] [--enabled] [--max-unresponsive] [--max-unsuccessful]",
+		Usage: "docker-healing-delete [-p/--pool pool] [--enabled] [--max-unresponsive] [--max-unsuccessful] [--max-flaps]",
 		Desc: `Delete a node healing configuration entry.
 
 If [[--pool]] is provided the configuration entries from the specified pool
@@ -281,6 +295,7 @@ func (c *DeleteNodeHealingConfigCmd) Flags() *gnuflag.FlagSet {
 		c.fs.BoolVar(&c.enabled, "enabled", false, "Remove the 'enabled' configuration option")
 		c.fs.BoolVar(&c.maxUnresponsive, "max-unresponsive", false, "Remove the 'max-unresponsive' configuration option")
 		c.fs.BoolVar(&c.maxUnsuccessful, "max-unsuccessful", false, "Remove the 'max-unsuccessful' configuration option")
+		c.fs.BoolVar(&c.maxFlaps, "max-flaps", false, "Remove the 'max-flaps' configuration option")
 	}
 	return c.fs
 }
@@ -306,6 +321,9 @@ func (c *DeleteNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	if c.maxUnsuccessful {
 		v.Add("name", "MaxTimeSinceSuccess")
 	}
+	if c.maxFlaps {
+		v.Add("name", "MaxFlaps")
+	}
 	u, err := cmd.GetURL("/docker/healing/node?" + v.Encode())
 	if err != nil {
 		return err
@@ -320,3 +338,77 @@ func (c *DeleteNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	}
 	return err
 }
+
+type NodeHealthCmd struct{}
+
+func (c *NodeHealthCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "node-health",
+		Usage:   "node-health <address>",
+		Desc:    "Show the health history of a node, with its uptime, failing checks and status changes.",
+		MinArgs: 1,
+	}
+}
+
+func (c *NodeHealthCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/node/" + ctx.Args[0] + "/health")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var health NodeHealth
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Node: %s\n", health.Address)
+	if health.Reports == 0 {
+		fmt.Fprintln(ctx.Stdout, "No status reports received.")
+		return nil
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format(time.Stamp)
+	}
+	flapping := "no"
+	if health.Flapping {
+		flapping = "yes"
+	}
+	fmt.Fprintf(ctx.Stdout, "History since: %s\n", formatTime(health.Since))
+	fmt.Fprintf(ctx.Stdout, "Reports: %d\n", health.Reports)
+	fmt.Fprintf(ctx.Stdout, "Uptime: %.2f%%\n", health.Uptime)
+	fmt.Fprintf(ctx.Stdout, "Last success: %s\n", formatTime(health.LastSuccess))
+	fmt.Fprintf(ctx.Stdout, "Last update: %s\n", formatTime(health.LastUpdate))
+	fmt.Fprintf(ctx.Stdout, "Flapping: %s (%d status changes in the last %v)\n", flapping, health.Flaps, health.FlappingWindow)
+	if len(health.FailingChecks) > 0 {
+		fmt.Fprintln(ctx.Stdout, "\nFailing checks:")
+		tbl := cmd.NewTable()
+		tbl.Headers = cmd.Row{"Check", "Failures", "Last failure", "Last error"}
+		for _, check := range health.FailingChecks {
+			tbl.AddRow(cmd.Row{check.Name, strconv.Itoa(check.Failures), formatTime(check.LastFailure), check.LastError})
+		}
+		fmt.Fprint(ctx.Stdout, tbl.String())
+	}
+	fmt.Fprintln(ctx.Stdout, "\nStatus changes:")
+	tbl := cmd.NewTable()
+	tbl.Headers = cmd.Row{"Time", "Status"}
+	for _, change := range health.Changes {
+		status := "failing"
+		if change.Successful {
+			status = "ok"
+		}
+		tbl.AddRow(cmd.Row{formatTime(change.Time), status})
+	}
+	fmt.Fprint(ctx.Stdout, tbl.String())
+	return nil
+}
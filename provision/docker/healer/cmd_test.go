@@ -232,6 +232,7 @@ func (s *S) TestGetNodeHealingConfigCmd(c *check.C) {
 | Enabled                | true     |
 | Max unresponsive time  | 2s       |
 | Max time since success | disabled |
+| Max flaps              | disabled |
 +------------------------+----------+
 
 Pool "p1":
@@ -241,6 +242,7 @@ Pool "p1":
 | Enabled                | false    | false     |
 | Max unresponsive time  | 2s       | true      |
 | Max time since success | disabled | false     |
+| Max flaps              | disabled | false     |
 +------------------------+----------+-----------+
 
 Pool "p2":
@@ -250,6 +252,7 @@ Pool "p2":
 | Enabled                | true     | true      |
 | Max unresponsive time  | 3s       | false     |
 | Max time since success | disabled | false     |
+| Max flaps              | disabled | false     |
 +------------------------+----------+-----------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
@@ -276,6 +279,7 @@ func (s *S) TestGetNodeHealingConfigCmdEmpty(c *check.C) {
 | Enabled                | false    |
 | Max unresponsive time  | disabled |
 | Max time since success | disabled |
+| Max flaps              | disabled |
 +------------------------+----------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
@@ -324,3 +328,84 @@ func (s *S) TestSetNodeHealingConfigCmd(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Equals, "Node healing configuration successfully updated.\n")
 }
+
+func (s *S) TestNodeHealthCmdInfo(c *check.C) {
+	info := (&NodeHealthCmd{}).Info()
+	c.Assert(info.Name, check.Equals, "node-health")
+	c.Assert(info.MinArgs, check.Equals, 1)
+}
+
+func (s *S) TestNodeHealthCmd(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf, Args: []string{"http://n1:2375"}}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: `{
+"Address": "http://n1:2375",
+"Since": "2016-10-19T12:00:00Z",
+"LastSuccess": "2016-10-19T12:03:00Z",
+"LastUpdate": "2016-10-19T12:03:00Z",
+"Reports": 4,
+"Uptime": 75,
+"FailingChecks": [{"Name": "ping", "Failures": 1, "LastFailure": "2016-10-19T12:01:00Z", "LastError": "timeout"}],
+"Flaps": 2,
+"FlappingWindow": 3600000000000,
+"Flapping": false,
+"Changes": [
+	{"Time": "2016-10-19T12:00:00Z", "Successful": true},
+	{"Time": "2016-10-19T12:01:00Z", "Successful": false},
+	{"Time": "2016-10-19T12:02:00Z", "Successful": true}
+]
+}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/node/http://n1:2375/health" && req.Method == "GET"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := (&NodeHealthCmd{}).Run(&context, client)
+	c.Assert(err, check.IsNil)
+	at := func(minute int) string {
+		return time.Date(2016, 10, 19, 12, minute, 0, 0, time.UTC).Local().Format(time.Stamp)
+	}
+	expected := fmt.Sprintf(`Node: http://n1:2375
+History since: %[1]s
+Reports: 4
+Uptime: 75.00%%
+Last success: %[4]s
+Last update: %[4]s
+Flapping: no (2 status changes in the last 1h0m0s)
+
+Failing checks:
++-------+----------+-----------------+------------+
+| Check | Failures | Last failure    | Last error |
++-------+----------+-----------------+------------+
+| ping  | 1        | %[2]s | timeout    |
++-------+----------+-----------------+------------+
+
+Status changes:
++-----------------+---------+
+| Time            | Status  |
++-----------------+---------+
+| %[1]s | ok      |
+| %[2]s | failing |
+| %[3]s | ok      |
++-----------------+---------+
+`, at(0), at(1), at(2), at(3))
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
+func (s *S) TestNodeHealthCmdNoReports(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf, Args: []string{"http://n1:2375"}}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: `{"Address": "http://n1:2375", "Reports": 0}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/node/http://n1:2375/health"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	err := (&NodeHealthCmd{}).Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node: http://n1:2375\nNo status reports received.\n")
+}
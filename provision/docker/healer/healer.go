@@ -15,6 +15,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"gopkg.in/mgo.v2"
@@ -24,6 +25,8 @@ import (
 var (
 	consecutiveHealingsTimeframe        = 5 * time.Minute
 	consecutiveHealingsLimitInTimeframe = 3
+
+	healerActions = metrics.NewCounter("tsuru_healer_actions_total", "Number of nodes and containers healed, by kind and status.", "kind", "status")
 )
 
 type HealingEvent struct {
@@ -12,6 +12,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
@@ -132,6 +133,7 @@ func (h *ContainerHealer) healContainerIfNeeded(cont container.Container) error
 		return fmt.Errorf("Error trying to insert container healing event, healing aborted: %s", err.Error())
 	}
 	newCont, healErr := h.healContainer(cont)
+	healerActions.Inc("container", metrics.Status(healErr))
 	if healErr != nil {
 		healErr = fmt.Errorf("Error healing container %q: %s", cont.ID, healErr.Error())
 	}
@@ -18,6 +18,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/iaas"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
@@ -54,9 +55,11 @@ type NodeHealerConfig struct {
 	Enabled                      *bool
 	MaxTimeSinceSuccess          *int
 	MaxUnresponsiveTime          *int
+	MaxFlaps                     *int
 	EnabledInherited             bool
 	MaxTimeSinceSuccessInherited bool
 	MaxUnresponsiveTimeInherited bool
+	MaxFlapsInherited            bool
 }
 
 type nodeStatusData struct {
@@ -216,6 +219,7 @@ func (h *NodeHealer) tryHealingNode(node *cluster.Node, reason string, lastCheck
 	}
 	log.Errorf("initiating healing process for node %q due to: %s", node.Address, reason)
 	createdNode, evtErr = h.healNode(node)
+	healerActions.Inc("node", metrics.Status(evtErr))
 	return evtErr
 }
 
@@ -344,7 +348,15 @@ func (h *NodeHealer) UpdateNodeData(nodeData provision.NodeStatusData) error {
 			}),
 		},
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	return saveHealthReport(NodeHealthReport{
+		Node:       node.Address,
+		Time:       now,
+		Successful: isSuccess,
+		Checks:     nodeData.Checks,
+	})
 }
 
 func (h *NodeHealer) RunClusterHook(evt cluster.HookEvent, node *cluster.Node) error {
@@ -357,7 +369,7 @@ func (h *NodeHealer) RunClusterHook(evt cluster.HookEvent, node *cluster.Node) e
 	if err != nil && err != mgo.ErrNotFound {
 		return err
 	}
-	return nil
+	return removeHealthHistory(node.Address)
 }
 
 func healerConfig() *scopedconfig.ScopedConfig {
@@ -414,19 +426,25 @@ func (h *NodeHealer) shouldHealNode(node *cluster.Node) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	if queryPart == nil {
-		return false, nil
-	}
-	coll, err := nodeDataCollection()
-	if err != nil {
-		return false, fmt.Errorf("unable to get node data collection: %s", err)
+	if queryPart != nil {
+		coll, err := nodeDataCollection()
+		if err != nil {
+			return false, fmt.Errorf("unable to get node data collection: %s", err)
+		}
+		defer coll.Close()
+		count, err := coll.Find(queryPart).Count()
+		if err != nil {
+			return false, fmt.Errorf("unable to find nodes to heal: %s", err)
+		}
+		if count > 0 {
+			return true, nil
+		}
 	}
-	defer coll.Close()
-	count, err := coll.Find(queryPart).Count()
+	reason, err := flappingReason(node, configEntry)
 	if err != nil {
-		return false, fmt.Errorf("unable to find nodes to heal: %s", err)
+		return false, fmt.Errorf("unable to check if node is flapping: %s", err)
 	}
-	return count > 0, nil
+	return reason != "", nil
 }
 
 func (h *NodeHealer) findNodesForHealing() ([]nodeStatusData, map[string]*cluster.Node, error) {
@@ -489,13 +507,59 @@ func (h *NodeHealer) findNodesForHealing() ([]nodeStatusData, map[string]*cluste
 	return nodesStatus, nodesAddrMap, nil
 }
 
+func (h *NodeHealer) findFlappingNodes(nodes map[string]*cluster.Node) (map[string]string, error) {
+	var entries map[string]NodeHealerConfig
+	err := healerConfig().LoadAll(&entries)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for addr, n := range nodes {
+		entry, ok := entries[n.Metadata[poolMetadataName]]
+		if !ok {
+			entry = entries[""]
+		}
+		if entry.Enabled != nil && *entry.Enabled && entry.MaxFlaps != nil && *entry.MaxFlaps > 0 {
+			candidates = append(candidates, addr)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	window := flappingWindow()
+	reports, err := healthReports(candidates, time.Now().UTC().Add(-window))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find flapping nodes: %s", err)
+	}
+	reasons := map[string]string{}
+	for _, addr := range candidates {
+		entry, ok := entries[nodes[addr].Metadata[poolMetadataName]]
+		if !ok {
+			entry = entries[""]
+		}
+		if flaps := countFlaps(reports[addr], time.Time{}); flaps >= *entry.MaxFlaps {
+			reasons[addr] = flappingMessage(flaps, window)
+		}
+	}
+	return reasons, nil
+}
+
 func (h *NodeHealer) runActiveHealing() {
+	err := removeOldHealthReports(time.Now().UTC())
+	if err != nil {
+		log.Errorf("[node healer active] unable to remove old health reports: %s", err)
+	}
 	nodesStatus, nodesAddrMap, err := h.findNodesForHealing()
 	if err != nil {
 		log.Errorf("[node healer active] %s", err)
 		return
 	}
+	flapping, err := h.findFlappingNodes(nodesAddrMap)
+	if err != nil {
+		log.Errorf("[node healer active] %s", err)
+	}
 	for _, n := range nodesStatus {
+		delete(flapping, n.Address)
 		sinceUpdate := time.Since(n.LastUpdate)
 		sinceSuccess := time.Since(n.LastSuccess)
 		err = h.tryHealingNode(nodesAddrMap[n.Address],
@@ -506,6 +570,12 @@ func (h *NodeHealer) runActiveHealing() {
 			log.Errorf("[node healer active] %s", err)
 		}
 	}
+	for addr, reason := range flapping {
+		err = h.tryHealingNode(nodesAddrMap[addr], reason, nil)
+		if err != nil {
+			log.Errorf("[node healer active] %s", err)
+		}
+	}
 }
 
 func UpdateConfig(pool string, config NodeHealerConfig) error {
@@ -0,0 +1,268 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package healer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultHealthHistoryRetention = 24 * time.Hour
+	defaultFlappingWindow         = time.Hour
+	defaultMaxFlaps               = 4
+)
+
+// NodeHealthReport is a status report sent by a node, as kept in its health
+// history.
+type NodeHealthReport struct {
+	Node       string
+	Time       time.Time
+	Successful bool
+	Checks     []provision.NodeCheckResult
+}
+
+// NodeHealthChange is a point in the health history of a node where its
+// status changed.
+type NodeHealthChange struct {
+	Time       time.Time
+	Successful bool
+}
+
+// FailingCheck summarizes the failures of a check in the health history of a
+// node.
+type FailingCheck struct {
+	Name        string
+	Failures    int
+	LastFailure time.Time
+	LastError   string
+}
+
+// NodeHealth summarizes the health history of a node.
+type NodeHealth struct {
+	Address string
+	// Since is the time of the oldest report in the history.
+	Since       time.Time
+	LastSuccess time.Time
+	LastUpdate  time.Time
+	Reports     int
+	// Uptime is the percentage of successful reports in the history.
+	Uptime        float64
+	FailingChecks []FailingCheck
+	// Flaps is the number of status changes within FlappingWindow. The node
+	// is flapping when it reaches the max flaps of its pool.
+	Flaps          int
+	FlappingWindow time.Duration
+	Flapping       bool
+	Changes        []NodeHealthChange
+}
+
+func healthHistoryRetention() time.Duration {
+	if seconds, err := config.GetInt("docker:healing:history-retention"); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultHealthHistoryRetention
+}
+
+func flappingWindow() time.Duration {
+	if seconds, err := config.GetInt("docker:healing:flapping-window"); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultFlappingWindow
+}
+
+func maxFlaps(conf NodeHealerConfig) int {
+	if conf.MaxFlaps != nil && *conf.MaxFlaps > 0 {
+		return *conf.MaxFlaps
+	}
+	return defaultMaxFlaps
+}
+
+func nodeHealthCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("node_health_history")
+	coll.EnsureIndex(mgo.Index{Key: []string{"node", "time"}})
+	coll.EnsureIndex(mgo.Index{Key: []string{"time"}})
+	return coll, nil
+}
+
+func saveHealthReport(report NodeHealthReport) error {
+	coll, err := nodeHealthCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Insert(report)
+}
+
+func removeOldHealthReports(now time.Time) error {
+	coll, err := nodeHealthCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"time": bson.M{"$lt": now.Add(-healthHistoryRetention())}})
+	return err
+}
+
+func removeHealthHistory(address string) error {
+	coll, err := nodeHealthCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"node": address})
+	return err
+}
+
+// healthReports returns the reports of the given nodes sent after since,
+// sorted by time.
+func healthReports(addresses []string, since time.Time) (map[string][]NodeHealthReport, error) {
+	coll, err := nodeHealthCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var reports []NodeHealthReport
+	err = coll.Find(bson.M{
+		"node": bson.M{"$in": addresses},
+		"time": bson.M{"$gte": since},
+	}).Sort("time").All(&reports)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string][]NodeHealthReport{}
+	for _, r := range reports {
+		result[r.Node] = append(result[r.Node], r)
+	}
+	return result, nil
+}
+
+// countFlaps returns the number of status changes in reports, sorted by
+// time, sent after since.
+func countFlaps(reports []NodeHealthReport, since time.Time) int {
+	var flaps int
+	var previous *NodeHealthReport
+	for i := range reports {
+		if reports[i].Time.Before(since) {
+			continue
+		}
+		if previous != nil && previous.Successful != reports[i].Successful {
+			flaps++
+		}
+		previous = &reports[i]
+	}
+	return flaps
+}
+
+// summarizeNodeHealth summarizes the reports of a node, sorted by time.
+func summarizeNodeHealth(address string, reports []NodeHealthReport, now time.Time, window time.Duration, max int) NodeHealth {
+	health := NodeHealth{
+		Address:        address,
+		Reports:        len(reports),
+		FlappingWindow: window,
+		FailingChecks:  []FailingCheck{},
+		Changes:        []NodeHealthChange{},
+	}
+	if len(reports) == 0 {
+		return health
+	}
+	health.Since = reports[0].Time
+	health.LastUpdate = reports[len(reports)-1].Time
+	failing := map[string]*FailingCheck{}
+	var successful int
+	for i, r := range reports {
+		if r.Successful {
+			successful++
+			health.LastSuccess = r.Time
+		}
+		if i == 0 || reports[i-1].Successful != r.Successful {
+			health.Changes = append(health.Changes, NodeHealthChange{Time: r.Time, Successful: r.Successful})
+		}
+		for _, check := range r.Checks {
+			if check.Successful {
+				continue
+			}
+			f := failing[check.Name]
+			if f == nil {
+				f = &FailingCheck{Name: check.Name}
+				failing[check.Name] = f
+			}
+			f.Failures++
+			f.LastFailure = r.Time
+			f.LastError = check.Err
+		}
+	}
+	health.Uptime = float64(successful) * 100 / float64(len(reports))
+	for _, f := range failing {
+		health.FailingChecks = append(health.FailingChecks, *f)
+	}
+	sort.Sort(failingChecksList(health.FailingChecks))
+	health.Flaps = countFlaps(reports, now.Add(-window))
+	health.Flapping = health.Flaps >= max
+	return health
+}
+
+type failingChecksList []FailingCheck
+
+func (l failingChecksList) Len() int      { return len(l) }
+func (l failingChecksList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l failingChecksList) Less(i, j int) bool {
+	if l[i].Failures != l[j].Failures {
+		return l[i].Failures > l[j].Failures
+	}
+	return l[i].Name < l[j].Name
+}
+
+// GetNodeHealth returns the summary of the health history of the node.
+func GetNodeHealth(node *cluster.Node) (*NodeHealth, error) {
+	var conf NodeHealerConfig
+	err := healerConfig().Load(node.Metadata[poolMetadataName], &conf)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	reports, err := healthReports([]string{node.Address}, now.Add(-healthHistoryRetention()))
+	if err != nil {
+		return nil, err
+	}
+	health := summarizeNodeHealth(node.Address, reports[node.Address], now, flappingWindow(), maxFlaps(conf))
+	return &health, nil
+}
+
+// flappingReason returns the reason to heal the node when flapping is taken
+// into account in its pool and the node reached the max flaps, or an empty
+// string otherwise.
+func flappingReason(node *cluster.Node, conf NodeHealerConfig) (string, error) {
+	if conf.Enabled == nil || !*conf.Enabled || conf.MaxFlaps == nil || *conf.MaxFlaps <= 0 {
+		return "", nil
+	}
+	window := flappingWindow()
+	reports, err := healthReports([]string{node.Address}, time.Now().UTC().Add(-window))
+	if err != nil {
+		return "", err
+	}
+	flaps := countFlaps(reports[node.Address], time.Time{})
+	if flaps < *conf.MaxFlaps {
+		return "", nil
+	}
+	return flappingMessage(flaps, window), nil
+}
+
+func flappingMessage(flaps int, window time.Duration) string {
+	return fmt.Sprintf("%d status changes in the last %v", flaps, window)
+}
@@ -0,0 +1,169 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package healer
+
+import (
+	"time"
+
+	"github.com/fsouza/go-dockerclient/testing"
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+)
+
+func healthReportsFromStatus(start time.Time, status ...bool) []NodeHealthReport {
+	reports := make([]NodeHealthReport, len(status))
+	for i, ok := range status {
+		reports[i] = NodeHealthReport{
+			Node:       "http://n1:2375",
+			Time:       start.Add(time.Duration(i) * time.Minute),
+			Successful: ok,
+		}
+		if !ok {
+			reports[i].Checks = []provision.NodeCheckResult{
+				{Name: "docker", Successful: true},
+				{Name: "ping", Err: "timeout", Successful: false},
+			}
+		}
+	}
+	return reports
+}
+
+func (s *S) TestCountFlaps(c *check.C) {
+	start := time.Date(2016, 10, 19, 12, 0, 0, 0, time.UTC)
+	reports := healthReportsFromStatus(start, true, false, true, true, false, false, true)
+	c.Assert(countFlaps(reports, time.Time{}), check.Equals, 4)
+	c.Assert(countFlaps(reports, start.Add(3*time.Minute)), check.Equals, 2)
+	c.Assert(countFlaps(nil, time.Time{}), check.Equals, 0)
+}
+
+func (s *S) TestSummarizeNodeHealth(c *check.C) {
+	start := time.Date(2016, 10, 19, 12, 0, 0, 0, time.UTC)
+	reports := healthReportsFromStatus(start, true, false, true, true, false, false, true, true)
+	reports[5].Checks[1].Err = "connection refused"
+	now := start.Add(8 * time.Minute)
+	health := summarizeNodeHealth("http://n1:2375", reports, now, 5*time.Minute, 2)
+	c.Assert(health, check.DeepEquals, NodeHealth{
+		Address:     "http://n1:2375",
+		Since:       start,
+		LastSuccess: start.Add(7 * time.Minute),
+		LastUpdate:  start.Add(7 * time.Minute),
+		Reports:     8,
+		Uptime:      62.5,
+		FailingChecks: []FailingCheck{
+			{Name: "ping", Failures: 3, LastFailure: start.Add(5 * time.Minute), LastError: "connection refused"},
+		},
+		Flaps:          2,
+		FlappingWindow: 5 * time.Minute,
+		Flapping:       true,
+		Changes: []NodeHealthChange{
+			{Time: start, Successful: true},
+			{Time: start.Add(time.Minute), Successful: false},
+			{Time: start.Add(2 * time.Minute), Successful: true},
+			{Time: start.Add(4 * time.Minute), Successful: false},
+			{Time: start.Add(6 * time.Minute), Successful: true},
+		},
+	})
+	health = summarizeNodeHealth("http://n1:2375", reports, now, 5*time.Minute, 3)
+	c.Assert(health.Flapping, check.Equals, false)
+}
+
+func (s *S) TestSummarizeNodeHealthNoReports(c *check.C) {
+	health := summarizeNodeHealth("http://n1:2375", nil, time.Now(), time.Hour, 4)
+	c.Assert(health, check.DeepEquals, NodeHealth{
+		Address:        "http://n1:2375",
+		FlappingWindow: time.Hour,
+		FailingChecks:  []FailingCheck{},
+		Changes:        []NodeHealthChange{},
+	})
+}
+
+func (s *S) TestHealerUpdateNodeDataSavesHealthHistory(c *check.C) {
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner: p,
+	})
+	healer.Shutdown()
+	for _, ok := range []bool{true, false, true} {
+		err = healer.UpdateNodeData(provision.NodeStatusData{
+			Addrs:  []string{"127.0.0.1"},
+			Checks: []provision.NodeCheckResult{{Name: "ping", Successful: ok}},
+		})
+		c.Assert(err, check.IsNil)
+	}
+	node, err := p.Cluster().GetNode(node1.URL())
+	c.Assert(err, check.IsNil)
+	health, err := GetNodeHealth(&node)
+	c.Assert(err, check.IsNil)
+	c.Assert(health.Address, check.Equals, node1.URL())
+	c.Assert(health.Reports, check.Equals, 3)
+	c.Assert(health.Flaps, check.Equals, 2)
+	c.Assert(health.Flapping, check.Equals, false)
+	c.Assert(health.FailingChecks, check.HasLen, 1)
+	c.Assert(health.FailingChecks[0].Name, check.Equals, "ping")
+	err = healer.RunClusterHook(cluster.HookEventBeforeNodeUnregister, &node)
+	c.Assert(err, check.IsNil)
+	health, err = GetNodeHealth(&node)
+	c.Assert(err, check.IsNil)
+	c.Assert(health.Reports, check.Equals, 0)
+}
+
+func (s *S) TestRemoveOldHealthReports(c *check.C) {
+	config.Set("docker:healing:history-retention", 60)
+	defer config.Unset("docker:healing:history-retention")
+	now := time.Now().UTC()
+	err := saveHealthReport(NodeHealthReport{Node: "http://n1:2375", Time: now.Add(-2 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	err = saveHealthReport(NodeHealthReport{Node: "http://n1:2375", Time: now})
+	c.Assert(err, check.IsNil)
+	err = removeOldHealthReports(now)
+	c.Assert(err, check.IsNil)
+	reports, err := healthReports([]string{"http://n1:2375"}, time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(reports["http://n1:2375"], check.HasLen, 1)
+}
+
+func (s *S) TestShouldHealNodeFlapping(c *check.C) {
+	conf := healerConfig()
+	err := conf.SaveBase(NodeHealerConfig{Enabled: boolPtr(true), MaxFlaps: intPtr(2)})
+	c.Assert(err, check.IsNil)
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner: p,
+	})
+	healer.Shutdown()
+	node, err := p.Cluster().GetNode(node1.URL())
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	for i, ok := range []bool{true, false} {
+		err = saveHealthReport(NodeHealthReport{Node: node.Address, Time: now.Add(time.Duration(i) * time.Second), Successful: ok})
+		c.Assert(err, check.IsNil)
+	}
+	shouldHeal, err := healer.shouldHealNode(&node)
+	c.Assert(err, check.IsNil)
+	c.Assert(shouldHeal, check.Equals, false)
+	flapping, err := healer.findFlappingNodes(map[string]*cluster.Node{node.Address: &node})
+	c.Assert(err, check.IsNil)
+	c.Assert(flapping, check.HasLen, 0)
+	err = saveHealthReport(NodeHealthReport{Node: node.Address, Time: now.Add(2 * time.Second), Successful: true})
+	c.Assert(err, check.IsNil)
+	shouldHeal, err = healer.shouldHealNode(&node)
+	c.Assert(err, check.IsNil)
+	c.Assert(shouldHeal, check.Equals, true)
+	flapping, err = healer.findFlappingNodes(map[string]*cluster.Node{node.Address: &node})
+	c.Assert(err, check.IsNil)
+	c.Assert(flapping, check.DeepEquals, map[string]string{
+		node.Address: "2 status changes in the last 1h0m0s",
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -44,6 +45,7 @@ import (
 	_ "github.com/tsuru/tsuru/router/hipache"
 	_ "github.com/tsuru/tsuru/router/routertest"
 	_ "github.com/tsuru/tsuru/router/vulcand"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 var (
@@ -692,7 +694,7 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 		&provisionRemoveOldUnits,
 		&provisionUnbindOldUnits,
 	)
-	err = pipeline.Execute(args)
+	err = pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		return err
 	}
@@ -887,7 +889,7 @@ func (p *dockerProvisioner) RemoveUnits(a provision.App, units uint, processName
 		&provisionRemoveOldUnits,
 		&provisionUnbindOldUnits,
 	)
-	err = pipeline.Execute(args)
+	err = pipeline.ExecuteWithSpan(tracing.SpanOf(args.app).Context(), args)
 	if err != nil {
 		return fmt.Errorf("error removing routes, units weren't removed: %s", err)
 	}
@@ -965,6 +967,7 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&healer.GetNodeHealingConfigCmd{},
 		&healer.SetNodeHealingConfigCmd{},
 		&healer.DeleteNodeHealingConfigCmd{},
+		&healer.NodeHealthCmd{},
 		&autoScaleRunCmd{},
 		&listAutoScaleHistoryCmd{},
 		&autoScaleInfoCmd{},
@@ -972,6 +975,7 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&autoScaleDeleteRuleCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&appMetricsCmd{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
@@ -1179,6 +1183,78 @@ func (p *dockerProvisioner) MetricEnvs(app provision.App) map[string]string {
 	return envs
 }
 
+func (p *dockerProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetrics, error) {
+	containers, err := p.listRunnableContainersByApp(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		metrics []provision.UnitMetrics
+	)
+	for i := range containers {
+		wg.Add(1)
+		go func(c *container.Container) {
+			defer wg.Done()
+			stats, err := c.Stats(p)
+			if err != nil {
+				log.Errorf("[units metrics] unable to get stats of container %s: %s", c.ID, err)
+				return
+			}
+			m := unitMetrics(c, stats)
+			mu.Lock()
+			metrics = append(metrics, m)
+			mu.Unlock()
+		}(&containers[i])
+	}
+	wg.Wait()
+	sort.Sort(unitMetricsList(metrics))
+	return metrics, nil
+}
+
+// unitMetrics converts the stats of a container to the metrics of its unit,
+// calculating the usage of CPU the same way "docker stats" does.
+func unitMetrics(c *container.Container, stats *docker.Stats) provision.UnitMetrics {
+	m := provision.UnitMetrics{
+		ID:          c.ID,
+		ProcessName: c.ProcessName,
+		Date:        stats.Read,
+		Memory:      int64(stats.MemoryStats.Usage),
+		MemoryLimit: int64(stats.MemoryStats.Limit),
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if cache := stats.MemoryStats.Stats.Cache; cache < stats.MemoryStats.Usage {
+		m.Memory -= int64(cache)
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := len(stats.CPUStats.CPUUsage.PercpuUsage)
+		if cpus == 0 {
+			cpus = 1
+		}
+		m.CPU = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+	networks := stats.Networks
+	if len(networks) == 0 {
+		networks = map[string]docker.NetworkStats{"": stats.Network}
+	}
+	for _, n := range networks {
+		m.NetworkRx += int64(n.RxBytes)
+		m.NetworkTx += int64(n.TxBytes)
+	}
+	return m
+}
+
+type unitMetricsList []provision.UnitMetrics
+
+func (l unitMetricsList) Len() int           { return len(l) }
+func (l unitMetricsList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l unitMetricsList) Less(i, j int) bool { return l[i].ID < l[j].ID }
+
 func (p *dockerProvisioner) LogsEnabled(app provision.App) (bool, string, error) {
 	const (
 		logBackendsEnv      = "LOG_BACKENDS"
@@ -2007,6 +2007,7 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&healer.GetNodeHealingConfigCmd{},
 		&healer.SetNodeHealingConfigCmd{},
 		&healer.DeleteNodeHealingConfigCmd{},
+		&healer.NodeHealthCmd{},
 		&autoScaleRunCmd{},
 		&listAutoScaleHistoryCmd{},
 		&autoScaleInfoCmd{},
@@ -2014,6 +2015,7 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&autoScaleDeleteRuleCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&appMetricsCmd{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
@@ -2965,6 +2967,48 @@ func (s *S) TestMetricEnvs(c *check.C) {
 	c.Assert(envs, check.DeepEquals, expected)
 }
 
+func (s *S) TestUnitsMetrics(c *check.C) {
+	appInstance := &app.App{Name: "metered"}
+	cont1, err := s.newContainer(&newContainerOpts{AppName: appInstance.Name, ProcessName: "web", Status: "started"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont1)
+	cont2, err := s.newContainer(&newContainerOpts{AppName: appInstance.Name, ProcessName: "web", Status: "stopped"}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont2)
+	read := time.Date(2016, 10, 18, 12, 30, 0, 0, time.UTC)
+	s.server.PrepareStats(cont1.ID, func(id string) docker.Stats {
+		var stats docker.Stats
+		stats.Read = read
+		stats.MemoryStats.Usage = 100
+		stats.MemoryStats.Stats.Cache = 40
+		stats.MemoryStats.Limit = 200
+		stats.CPUStats.CPUUsage.TotalUsage = 300
+		stats.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150}
+		stats.CPUStats.SystemCPUUsage = 2000
+		stats.PreCPUStats.CPUUsage.TotalUsage = 200
+		stats.PreCPUStats.SystemCPUUsage = 1000
+		stats.Networks = map[string]docker.NetworkStats{
+			"eth0": {RxBytes: 10, TxBytes: 20},
+			"eth1": {RxBytes: 1, TxBytes: 2},
+		}
+		return stats
+	})
+	metrics, err := s.p.UnitsMetrics(appInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetrics{
+		{
+			ID:          cont1.ID,
+			ProcessName: "web",
+			Date:        read,
+			CPU:         20,
+			Memory:      60,
+			MemoryLimit: 200,
+			NetworkRx:   11,
+			NetworkTx:   22,
+		},
+	})
+}
+
 func (s *S) TestAddContainerDefaultProcess(c *check.C) {
 	customData := map[string]interface{}{
 		"processes": map[string]interface{}{
@@ -351,6 +351,30 @@ type MetricsProvisioner interface {
 	MetricEnvs(App) map[string]string
 }
 
+// UnitMetrics is a sample of the resource usage of a unit.
+type UnitMetrics struct {
+	ID          string
+	ProcessName string
+	Date        time.Time
+	// CPU is the usage of CPU by the unit, in percent of one CPU.
+	CPU float64
+	// Memory and MemoryLimit are in bytes.
+	Memory      int64
+	MemoryLimit int64
+	// NetworkRx and NetworkTx are the bytes received and sent by the unit
+	// since it was started.
+	NetworkRx int64
+	NetworkTx int64
+}
+
+// UnitMetricsProvisioner is a provisioner that samples the resource usage of
+// the units of apps.
+type UnitMetricsProvisioner interface {
+	// UnitsMetrics returns a sample of the resource usage of each unit of
+	// the app.
+	UnitsMetrics(App) ([]UnitMetrics, error)
+}
+
 // ShellProvisioner is a provisioner that allows opening a shell to existing
 // units.
 type ShellProvisioner interface {
@@ -520,6 +520,34 @@ func (p *FakeProvisioner) MetricEnvs(app provision.App) map[string]string {
 	}
 }
 
+// UnitsMetrics returns the same sample for each unit of the app: 10% of CPU,
+// 64MB of memory out of 256MB, 1KB received and 2KB sent.
+func (p *FakeProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetrics, error) {
+	if err := p.getError("UnitsMetrics"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return nil, errNotProvisioned
+	}
+	var metrics []provision.UnitMetrics
+	for _, u := range pApp.units {
+		metrics = append(metrics, provision.UnitMetrics{
+			ID:          u.ID,
+			ProcessName: u.ProcessName,
+			Date:        time.Now(),
+			CPU:         10,
+			Memory:      64 << 20,
+			MemoryLimit: 256 << 20,
+			NetworkRx:   1024,
+			NetworkTx:   2048,
+		})
+	}
+	return metrics, nil
+}
+
 // Restarts returns the number of restarts for a given app.
 func (p *FakeProvisioner) Restarts(a provision.App, process string) int {
 	p.mut.RLock()
@@ -0,0 +1,131 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const delayedBatchSize = 100
+
+type delayedJob struct {
+	ID     bson.ObjectId `bson:"_id"`
+	Task   string
+	Params monsterqueue.JobParams
+	RunAt  time.Time
+}
+
+// EnqueueAfter enqueues a job for the given task once delay has elapsed.
+// Delayed jobs are kept in the queue database until they're due, so no queue
+// worker is held while waiting and they survive restarts of tsuru.
+func EnqueueAfter(taskName string, params monsterqueue.JobParams, delay time.Duration) error {
+	if _, err := Queue(); err != nil {
+		return err
+	}
+	coll, err := delayedCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Insert(delayedJob{
+		ID:     bson.NewObjectId(),
+		Task:   taskName,
+		Params: params,
+		RunAt:  time.Now().UTC().Add(delay),
+	})
+}
+
+func delayedCollection() (*storage.Collection, error) {
+	url, _ := config.GetString("queue:mongo-url")
+	if url == "" {
+		url = "localhost:27017"
+	}
+	dbName, _ := config.GetString("queue:mongo-database")
+	conn, err := storage.Open(url, dbName)
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("tsuru_delayed_jobs")
+	coll.EnsureIndex(mgo.Index{Key: []string{"runat"}})
+	return coll, nil
+}
+
+// delayedJobs moves due delayed jobs to the queue.
+type delayedJobs struct {
+	queue    monsterqueue.Queue
+	interval time.Duration
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (d *delayedJobs) start() {
+	d.doneCh = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-d.doneCh:
+				return
+			case <-time.After(d.interval):
+			}
+			err := d.enqueueDue(time.Now().UTC())
+			if err != nil {
+				log.Errorf("[queue] unable to enqueue delayed jobs: %s", err)
+			}
+		}
+	}()
+}
+
+func (d *delayedJobs) stop() {
+	close(d.doneCh)
+	d.wg.Wait()
+}
+
+func (d *delayedJobs) enqueueDue(now time.Time) error {
+	coll, err := delayedCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	var jobs []delayedJob
+	err = coll.Find(bson.M{"runat": bson.M{"$lte": now}}).Sort("runat").Limit(delayedBatchSize).All(&jobs)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		// Removing the job first ensures only one tsuru instance enqueues it.
+		err = coll.RemoveId(job.ID)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = d.queue.Enqueue(job.Task, job.Params)
+		if err != nil {
+			log.Errorf("[queue] unable to enqueue delayed job for task %q: %s", job.Task, err)
+			coll.Insert(job)
+		}
+	}
+	return nil
+}
+
+func resetDelayedStorage() {
+	coll, err := delayedCollection()
+	if err != nil {
+		return
+	}
+	defer coll.Close()
+	coll.DropCollection()
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"gopkg.in/check.v1"
+)
+
+type paramsTask struct {
+	params chan monsterqueue.JobParams
+}
+
+func (t *paramsTask) Run(j monsterqueue.Job) {
+	t.params <- j.Parameters()
+	j.Success(nil)
+}
+
+func (t *paramsTask) Name() string {
+	return "params-task"
+}
+
+func (s *S) TestEnqueueAfter(c *check.C) {
+	q, err := Queue()
+	c.Assert(err, check.IsNil)
+	task := &paramsTask{params: make(chan monsterqueue.JobParams, 1)}
+	err = q.RegisterTask(task)
+	c.Assert(err, check.IsNil)
+	err = EnqueueAfter(task.Name(), monsterqueue.JobParams{"attempt": 2}, time.Hour)
+	c.Assert(err, check.IsNil)
+	queueData.RLock()
+	delayed := queueData.delayed
+	queueData.RUnlock()
+	err = delayed.enqueueDue(time.Now().UTC())
+	c.Assert(err, check.IsNil)
+	select {
+	case <-task.params:
+		c.Fatal("delayed job run before its time")
+	case <-time.After(100 * time.Millisecond):
+	}
+	err = delayed.enqueueDue(time.Now().UTC().Add(2 * time.Hour))
+	c.Assert(err, check.IsNil)
+	select {
+	case params := <-task.params:
+		c.Assert(params["attempt"], check.Equals, 2)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for delayed job")
+	}
+	coll, err := delayedCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/tsuru/monsterqueue"
 	"github.com/tsuru/monsterqueue/mongodb"
 	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/metrics"
 )
 
 // PubSubQ represents an implementation that allows Publishing and
@@ -53,29 +54,69 @@ func Factory() (PubSubFactory, error) {
 type queueInstanceData struct {
 	sync.RWMutex
 	instance monsterqueue.Queue
+	delayed  *delayedJobs
 }
 
 func (q *queueInstanceData) Shutdown() {
 	q.Lock()
 	defer q.Unlock()
 	if q.instance != nil {
-		q.instance.Stop()
+		q.stop()
 		q.instance = nil
 	}
 }
 
+// stop stops moving delayed jobs and processing the queue. It must be called
+// with the lock held.
+func (q *queueInstanceData) stop() {
+	if q.delayed != nil {
+		q.delayed.stop()
+		q.delayed = nil
+	}
+	q.instance.Stop()
+}
+
 func (q *queueInstanceData) String() string {
 	return "queued tasks"
 }
 
 var queueData queueInstanceData
 
+var (
+	taskLatency  = metrics.NewHistogram("tsuru_queue_task_latency_seconds", "Time between enqueueing and running tasks, by task name.", metrics.DefaultBuckets, "task")
+	taskDuration = metrics.NewHistogram("tsuru_queue_task_duration_seconds", "Duration of tasks, by task name.", metrics.LongBuckets, "task")
+)
+
+// instrumentedQueue records the latency and duration of the tasks registered
+// in the queue.
+type instrumentedQueue struct {
+	monsterqueue.Queue
+}
+
+func (q *instrumentedQueue) RegisterTask(task monsterqueue.Task) error {
+	return q.Queue.RegisterTask(&instrumentedTask{Task: task})
+}
+
+type instrumentedTask struct {
+	monsterqueue.Task
+}
+
+func (t *instrumentedTask) Run(job monsterqueue.Job) {
+	start := time.Now()
+	if enqueued := job.Status().Enqueued; !enqueued.IsZero() {
+		taskLatency.Observe(start.Sub(enqueued).Seconds(), t.Name())
+	}
+	t.Task.Run(job)
+	taskDuration.Observe(time.Since(start).Seconds(), t.Name())
+}
+
 func ResetQueue() {
 	queueData.Lock()
 	defer queueData.Unlock()
 	if queueData.instance != nil {
-		queueData.instance.Stop()
+		queueData.stop()
 		queueData.instance.ResetStorage()
+		resetDelayedStorage()
 		queueData.instance = nil
 	}
 }
@@ -102,8 +143,9 @@ func TestingWaitQueueTasks(n int, timeout time.Duration) error {
 			case <-time.After(10 * time.Millisecond):
 			}
 		}
-		queueData.instance.Stop()
+		queueData.stop()
 		queueData.instance.ResetStorage()
+		resetDelayedStorage()
 		queueData.instance = nil
 	}
 	return nil
@@ -136,11 +178,13 @@ func Queue() (monsterqueue.Queue, error) {
 		Database:         queueMongoDB,
 		PollingInterval:  time.Duration(pollingInterval * float64(time.Second)),
 	}
-	var err error
-	queueData.instance, err = mongodb.NewQueue(conf)
+	instance, err := mongodb.NewQueue(conf)
 	if err != nil {
 		return nil, fmt.Errorf("could not create queue instance, please check queue:mongo-url and queue:mongo-database config entries. error: %s", err)
 	}
+	queueData.instance = &instrumentedQueue{Queue: instance}
+	queueData.delayed = &delayedJobs{queue: queueData.instance, interval: conf.PollingInterval}
+	queueData.delayed.start()
 	shutdown.Register(&queueData)
 	go queueData.instance.ProcessLoop()
 	return queueData.instance, nil
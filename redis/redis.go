@@ -12,11 +12,14 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metrics"
 	"gopkg.in/redis.v3"
 )
 
 var (
 	ErrNoRedisConfig = errors.New("no redis configuration found with config prefix")
+
+	connectionErrors = metrics.NewCounter("tsuru_redis_connection_errors_total", "Number of failed connections to Redis.")
 )
 
 type baseClient interface {
@@ -98,6 +101,9 @@ func newRedisSentinel(addrs []string, master string, redisConfig *CommonConfig)
 		IdleTimeout:   redisConfig.IdleTimeout,
 	})
 	err := client.Ping().Err()
+	if err != nil {
+		connectionErrors.Inc()
+	}
 	return &ClientWrapper{Client: client}, err
 }
 
@@ -113,6 +119,9 @@ func redisCluster(addrs []string, redisConfig *CommonConfig) (Client, error) {
 		IdleTimeout:  redisConfig.IdleTimeout,
 	})
 	err := client.Ping().Err()
+	if err != nil {
+		connectionErrors.Inc()
+	}
 	return &ClusterClientWrapper{ClusterClient: client}, err
 }
 
@@ -130,6 +139,9 @@ func redisServer(addr string, redisConfig *CommonConfig) (Client, error) {
 		IdleTimeout:  redisConfig.IdleTimeout,
 	})
 	err := client.Ping().Err()
+	if err != nil {
+		connectionErrors.Inc()
+	}
 	return &ClientWrapper{Client: client}, err
 }
 
@@ -17,6 +17,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -57,6 +58,14 @@ func Type(name string) (string, string, error) {
 	return routerType, prefix, nil
 }
 
+// StartSpan starts a span, child of parent, tracing a call to a router
+// changing the given backend.
+func StartSpan(parent *tracing.Span, operation, backend string) *tracing.Span {
+	return parent.StartChild("router "+operation).
+		SetTag("component", "router").
+		SetTag("router.backend", backend)
+}
+
 // Get gets the named router from the registry.
 func Get(name string) (Router, error) {
 	routerType, prefix, err := Type(name)
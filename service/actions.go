@@ -29,7 +29,7 @@ var createServiceInstance = action.Action{
 		if !ok {
 			return nil, errors.New("First parameter must be a Service.")
 		}
-		endpoint, err := service.getClient("production")
+		endpoint, err := service.endpointClient("production")
 		if err != nil {
 			return nil, err
 		}
@@ -46,6 +46,10 @@ var createServiceInstance = action.Action{
 			return nil, errors.New("RequestID should be a string")
 		}
 		err = endpoint.Create(&instance, user, requestID)
+		if err == ErrInstancePending {
+			instance.State = InstanceStatePending
+			return instance, nil
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +60,7 @@ var createServiceInstance = action.Action{
 		if !ok {
 			return
 		}
-		endpoint, err := service.getClient("production")
+		endpoint, err := service.endpointClient("production")
 		if err != nil {
 			return
 		}
@@ -75,11 +79,15 @@ var createServiceInstance = action.Action{
 
 // insertServiceInstance is an action that inserts an instance in the database.
 //
-// The first argument in the context must be a Service Instance.
+// The instance returned by the previous action is inserted, if there's none
+// the second argument in the context must be a Service Instance.
 var insertServiceInstance = action.Action{
 	Name: "insert-service-instance",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
-		instance, ok := ctx.Params[1].(ServiceInstance)
+		instance, ok := ctx.Previous.(ServiceInstance)
+		if !ok {
+			instance, ok = ctx.Params[1].(ServiceInstance)
+		}
 		if !ok {
 			return nil, errors.New("Second parameter must be a ServiceInstance.")
 		}
@@ -110,6 +118,7 @@ type bindPipelineArgs struct {
 	writer          io.Writer
 	serviceInstance *ServiceInstance
 	shouldRestart   bool
+	requestID       string
 }
 
 var bindAppDBAction = &action.Action{
@@ -151,20 +160,20 @@ var bindAppEndpointAction = &action.Action{
 		if args == nil {
 			return nil, errors.New("invalid arguments for pipeline, expected *bindPipelineArgs")
 		}
-		endpoint, err := args.serviceInstance.Service().getClient("production")
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
 		if err != nil {
 			return nil, err
 		}
-		return endpoint.BindApp(args.serviceInstance, args.app)
+		return endpoint.BindApp(args.serviceInstance, args.app, args.requestID)
 	},
 	Backward: func(ctx action.BWContext) {
 		args, _ := ctx.Params[0].(*bindPipelineArgs)
-		endpoint, err := args.serviceInstance.Service().getClient("production")
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
 		if err != nil {
 			log.Errorf("[bind-app-endpoint backward] could not get endpoint: %s", err)
 			return
 		}
-		err = endpoint.UnbindApp(args.serviceInstance, args.app)
+		err = endpoint.UnbindApp(args.serviceInstance, args.app, args.requestID)
 		if err != nil {
 			log.Errorf("[bind-app-endpoint backward] failed to unbind unit: %s", err)
 		}
@@ -335,8 +344,8 @@ var unbindAppEndpoint = action.Action{
 		if args == nil {
 			return nil, errors.New("invalid arguments for pipeline, expected *bindPipelineArgs")
 		}
-		if endpoint, err := args.serviceInstance.Service().getClient("production"); err == nil {
-			err := endpoint.UnbindApp(args.serviceInstance, args.app)
+		if endpoint, err := args.serviceInstance.Service().endpointClient("production"); err == nil {
+			err := endpoint.UnbindApp(args.serviceInstance, args.app, args.requestID)
 			if err != nil && err != ErrInstanceNotFoundInAPI {
 				return nil, err
 			}
@@ -345,8 +354,8 @@ var unbindAppEndpoint = action.Action{
 	},
 	Backward: func(ctx action.BWContext) {
 		args, _ := ctx.Params[0].(*bindPipelineArgs)
-		if endpoint, err := args.serviceInstance.Service().getClient("production"); err == nil {
-			_, err := endpoint.BindApp(args.serviceInstance, args.app)
+		if endpoint, err := args.serviceInstance.Service().endpointClient("production"); err == nil {
+			_, err := endpoint.BindApp(args.serviceInstance, args.app, args.requestID)
 			if err != nil {
 				log.Errorf("[unbind-app-endpoint backward] failed to rebind app in endpoint: %s", err)
 			}
@@ -378,3 +387,130 @@ var removeBoundEnvs = action.Action{
 	},
 	MinParams: 1,
 }
+
+type updatePipelineArgs struct {
+	serviceInstance *ServiceInstance
+	updated         *ServiceInstance
+	requestID       string
+}
+
+// updateServiceInstanceEndpoint is an action that calls the service endpoint
+// to change the plan and parameters of an instance. On rollback the previous
+// plan and parameters are sent back to the service.
+var updateServiceInstanceEndpoint = &action.Action{
+	Name: "update-service-instance-endpoint",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args, _ := ctx.Params[0].(*updatePipelineArgs)
+		if args == nil {
+			return nil, errors.New("invalid arguments for pipeline, expected *updatePipelineArgs")
+		}
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
+		if err != nil {
+			return nil, err
+		}
+		return nil, endpoint.Update(args.updated, args.serviceInstance.PlanName, args.requestID)
+	},
+	Backward: func(ctx action.BWContext) {
+		args, _ := ctx.Params[0].(*updatePipelineArgs)
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
+		if err != nil {
+			log.Errorf("[update-service-instance-endpoint:Backward] unable to get endpoint: %s", err)
+			return
+		}
+		err = endpoint.Update(args.serviceInstance, args.updated.PlanName, args.requestID)
+		if err != nil {
+			log.Errorf("[update-service-instance-endpoint:Backward] unable to restore instance %q: %s", args.serviceInstance.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+var updateServiceInstanceDB = &action.Action{
+	Name: "update-service-instance-db",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args, _ := ctx.Params[0].(*updatePipelineArgs)
+		if args == nil {
+			return nil, errors.New("invalid arguments for pipeline, expected *updatePipelineArgs")
+		}
+		return nil, args.serviceInstance.update(bson.M{"$set": bson.M{
+			"plan_name":  args.updated.PlanName,
+			"parameters": args.updated.Parameters,
+		}})
+	},
+	MinParams: 1,
+}
+
+// rotateAppEndpointAction asks the service endpoint to issue new credentials
+// for the app. Both the previous and the new credentials are valid until the
+// previous ones are revoked. On rollback the new credentials are revoked.
+var rotateAppEndpointAction = &action.Action{
+	Name: "rotate-app-endpoint",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args, _ := ctx.Params[0].(*bindPipelineArgs)
+		if args == nil {
+			return nil, errors.New("invalid arguments for pipeline, expected *bindPipelineArgs")
+		}
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
+		if err != nil {
+			return nil, err
+		}
+		return endpoint.RotateApp(args.serviceInstance, args.app, args.requestID)
+	},
+	Backward: func(ctx action.BWContext) {
+		args, _ := ctx.Params[0].(*bindPipelineArgs)
+		endpoint, err := args.serviceInstance.Service().endpointClient("production")
+		if err != nil {
+			log.Errorf("[rotate-app-endpoint:Backward] unable to get endpoint: %s", err)
+			return
+		}
+		err = endpoint.DiscardAppRotation(args.serviceInstance, args.app, args.requestID)
+		if err != nil {
+			log.Errorf("[rotate-app-endpoint:Backward] unable to revoke new credentials of app %q: %s", args.app.GetName(), err)
+		}
+	},
+	MinParams: 1,
+}
+
+// setRotatedEnvsAction replaces the environment variables of the instance in
+// the app with the new credentials, restarting the app once. On rollback the
+// previous environment variables are restored.
+var setRotatedEnvsAction = &action.Action{
+	Name: "set-rotated-envs",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		args, _ := ctx.Params[0].(*bindPipelineArgs)
+		if args == nil {
+			return nil, errors.New("invalid arguments for pipeline, expected *bindPipelineArgs")
+		}
+		previous := map[string]string{}
+		for k, env := range args.app.InstanceEnv(args.serviceInstance.Name) {
+			previous[k] = env.Value
+		}
+		instance := bind.ServiceInstance{
+			Name: args.serviceInstance.Name,
+			Envs: ctx.Previous.(map[string]string),
+		}
+		return previous, args.app.AddInstance(
+			bind.InstanceApp{
+				ServiceName:   args.serviceInstance.ServiceName,
+				Instance:      instance,
+				ShouldRestart: args.shouldRestart,
+			}, args.writer)
+	},
+	Backward: func(ctx action.BWContext) {
+		args, _ := ctx.Params[0].(*bindPipelineArgs)
+		instance := bind.ServiceInstance{
+			Name: args.serviceInstance.Name,
+			Envs: ctx.FWResult.(map[string]string),
+		}
+		err := args.app.AddInstance(
+			bind.InstanceApp{
+				ServiceName:   args.serviceInstance.ServiceName,
+				Instance:      instance,
+				ShouldRestart: args.shouldRestart,
+			}, args.writer)
+		if err != nil {
+			log.Errorf("[set-rotated-envs backward] failed to restore previous envs: %s", err)
+		}
+	},
+	MinParams: 1,
+}
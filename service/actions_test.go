@@ -50,6 +50,35 @@ func (s *S) TestCreateServiceInstanceForward(c *check.C) {
 	c.Assert(atomic.LoadInt32(&requests), check.Equals, int32(1))
 }
 
+func (s *S) TestCreateServiceInstanceForwardPending(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	instance := ServiceInstance{Name: "mysql"}
+	ctx := action.FWContext{
+		Params: []interface{}{srv, instance, "my@user", ""},
+	}
+	r, err := createServiceInstance.Forward(ctx)
+	c.Assert(err, check.IsNil)
+	a, ok := r.(ServiceInstance)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(a.State, check.Equals, InstanceStatePending)
+	_, err = insertServiceInstance.Forward(action.FWContext{
+		Params:   ctx.Params,
+		Previous: r,
+	})
+	c.Assert(err, check.IsNil)
+	var dbInstance ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "mysql"}).One(&dbInstance)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.State, check.Equals, InstanceStatePending)
+}
+
 func (s *S) TestCreateServiceInstanceForwardInvalidParams(c *check.C) {
 	var requests int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -284,6 +313,29 @@ func (s *S) TestBindAppEndpointActionBackward(c *check.C) {
 	c.Assert(called, check.Equals, true)
 }
 
+func (s *S) TestRotateAppEndpointActionBackward(c *check.C) {
+	var method, path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	service := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := service.Create()
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().RemoveId(service.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	bwCtx := action.BWContext{
+		Params:   []interface{}{&bindPipelineArgs{app: a, serviceInstance: &si}},
+		FWResult: map[string]string{"ENV1": "NEWVAL1"},
+	}
+	rotateAppEndpointAction.Backward(bwCtx)
+	c.Assert(method, check.Equals, "DELETE")
+	c.Assert(path, check.Equals, "/resources/my-mysql/bind-app/credentials/new")
+}
+
 func (s *S) TestSetBoundEnvsActionName(c *check.C) {
 	c.Assert(setBoundEnvsAction.Name, check.Equals, "set-bound-envs")
 }
@@ -0,0 +1,406 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// BackupStatusPending is the status of backups, and restores, still
+	// running in the service.
+	BackupStatusPending = "pending"
+	// BackupStatusDone is the status of finished backups and restores.
+	BackupStatusDone = "done"
+	// BackupStatusFailed is the status of backups and restores the service
+	// failed to run.
+	BackupStatusFailed = "failed"
+
+	scheduledBackupKind = "service-instance-backup"
+
+	defaultBackupCheckInterval = time.Minute
+)
+
+var (
+	// BackupPollInterval is the interval between calls to the service
+	// checking the status of pending backups and restores.
+	BackupPollInterval = 5 * time.Second
+	// BackupTimeout is the maximum time waiting for the service to finish a
+	// backup or a restore.
+	BackupTimeout = 6 * time.Hour
+	// MinBackupInterval is the minimum interval between scheduled backups
+	// of an instance.
+	MinBackupInterval = time.Hour
+	// BackupShutdownTimeout is the maximum time waiting for scheduled backups
+	// to stop when tsuru is shutting down.
+	BackupShutdownTimeout = 30 * time.Second
+
+	ErrBackupCanceled        = errors.New("the operation was canceled")
+	ErrBackupInterrupted     = errors.New("tsuru stopped waiting for the operation, it will be retried")
+	ErrInvalidBackupInterval = fmt.Errorf("the backup interval must be at least %v", MinBackupInterval)
+)
+
+// Backup is a backup of a service instance, as reported by the service API.
+type Backup struct {
+	ID            string    `json:"id"`
+	Status        string    `json:"status"`
+	RestoreStatus string    `json:"restore_status,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Size          int64     `json:"size,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+func (b *Backup) status() string {
+	if b.Status == "" {
+		return BackupStatusDone
+	}
+	return b.Status
+}
+
+func (b *Backup) restoreStatus() string {
+	if b.RestoreStatus == "" {
+		return BackupStatusDone
+	}
+	return b.RestoreStatus
+}
+
+// Backups returns the backups of the instance kept by the service.
+func (si *ServiceInstance) Backups(requestID string) ([]Backup, error) {
+	endpoint, err := si.Service().endpointClient("production")
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.Backups(si, requestID)
+}
+
+// CreateBackup asks the service to back up the instance and waits until the
+// backup is done. Canceling the given event, which may be nil, cancels the
+// backup in the service.
+func (si *ServiceInstance) CreateBackup(evt *event.Event, w io.Writer, requestID string) (*Backup, error) {
+	return si.createBackup(evt, w, requestID, nil)
+}
+
+// createBackup is CreateBackup, it stops waiting for the backup with
+// ErrBackupInterrupted when the stop channel is closed.
+func (si *ServiceInstance) createBackup(evt *event.Event, w io.Writer, requestID string, stop <-chan struct{}) (*Backup, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	err := si.checkReady()
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := si.Service().endpointClient("production")
+	if err != nil {
+		return nil, err
+	}
+	backup, err := endpoint.CreateBackup(si, requestID)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(w, "Backup %q started.\n", backup.ID)
+	return si.waitBackup(endpoint, backup, evt, w, requestID, stop)
+}
+
+// resumeBackup waits for a backup started before, like createBackup does for
+// new backups.
+func (si *ServiceInstance) resumeBackup(backupID string, evt *event.Event, w io.Writer, requestID string, stop <-chan struct{}) (*Backup, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	endpoint, err := si.Service().endpointClient("production")
+	if err != nil {
+		return nil, err
+	}
+	backup, err := endpoint.Backup(si, backupID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(w, "Waiting for backup %q.\n", backup.ID)
+	return si.waitBackup(endpoint, backup, evt, w, requestID, stop)
+}
+
+func (si *ServiceInstance) waitBackup(endpoint ServiceClient, backup *Backup, evt *event.Event, w io.Writer, requestID string, stop <-chan struct{}) (*Backup, error) {
+	err := waitBackupOperation(evt, stop, backup.status(), func() (string, error) {
+		b, err := endpoint.Backup(si, backup.ID, requestID)
+		if err != nil {
+			return "", err
+		}
+		backup = b
+		return b.status(), nil
+	}, func() error {
+		return endpoint.CancelBackup(si, backup.ID, requestID)
+	})
+	if err != nil {
+		return backup, backupError(err, backup)
+	}
+	fmt.Fprintf(w, "Backup %q done.\n", backup.ID)
+	return backup, nil
+}
+
+// RestoreBackup asks the service to restore the instance from one of its
+// backups and waits until the restore is done. Canceling the given event,
+// which may be nil, cancels the restore in the service.
+func (si *ServiceInstance) RestoreBackup(backupID string, evt *event.Event, w io.Writer, requestID string) error {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	err := si.checkReady()
+	if err != nil {
+		return err
+	}
+	endpoint, err := si.Service().endpointClient("production")
+	if err != nil {
+		return err
+	}
+	backup, err := endpoint.RestoreBackup(si, backupID, requestID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Restore of backup %q started.\n", backupID)
+	err = waitBackupOperation(evt, nil, backup.restoreStatus(), func() (string, error) {
+		b, err := endpoint.Backup(si, backupID, requestID)
+		if err != nil {
+			return "", err
+		}
+		backup = b
+		return b.restoreStatus(), nil
+	}, func() error {
+		return endpoint.CancelRestore(si, backupID, requestID)
+	})
+	if err != nil {
+		return backupError(err, backup)
+	}
+	fmt.Fprintf(w, "Restore of backup %q done.\n", backupID)
+	return nil
+}
+
+func backupError(err error, backup *Backup) error {
+	if err == ErrBackupCanceled || err == ErrBackupInterrupted || backup == nil || backup.Error == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %s", err, backup.Error)
+}
+
+// waitBackupOperation polls the status of a backup or restore until it's no
+// longer pending, canceling it in the service when the event is canceled. It
+// returns ErrBackupInterrupted when the stop channel, which may be nil, is
+// closed.
+func waitBackupOperation(evt *event.Event, stop <-chan struct{}, status string, poll func() (string, error), cancel func() error) error {
+	deadline := time.Now().Add(BackupTimeout)
+	var err error
+	for status == BackupStatusPending {
+		if evt != nil {
+			canceled, ackErr := evt.AckCancel()
+			if ackErr != nil {
+				log.Errorf("[service backup] unable to check event cancelation: %s", ackErr)
+			}
+			if canceled {
+				err = cancel()
+				if err != nil {
+					return fmt.Errorf("unable to cancel the operation in the service: %s", err)
+				}
+				return ErrBackupCanceled
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %v waiting for the service", BackupTimeout)
+		}
+		select {
+		case <-stop:
+			return ErrBackupInterrupted
+		case <-time.After(BackupPollInterval):
+		}
+		status, err = poll()
+		if err != nil {
+			return err
+		}
+	}
+	if status == BackupStatusFailed {
+		return errors.New("the service reported the operation as failed")
+	}
+	return nil
+}
+
+// SetBackupInterval schedules periodic backups of the instance, a zero
+// interval disables them. The first backup runs after one interval.
+func (si *ServiceInstance) SetBackupInterval(interval time.Duration) error {
+	if interval == 0 {
+		err := si.update(bson.M{"$unset": bson.M{"backup_interval": "", "next_backup": "", "pending_backup": ""}})
+		if err != nil {
+			return err
+		}
+		si.BackupInterval = 0
+		si.NextBackup = time.Time{}
+		si.PendingBackup = ""
+		return nil
+	}
+	if interval < MinBackupInterval {
+		return ErrInvalidBackupInterval
+	}
+	next := time.Now().UTC().Add(interval)
+	err := si.update(bson.M{"$set": bson.M{"backup_interval": interval, "next_backup": next}})
+	if err != nil {
+		return err
+	}
+	si.BackupInterval = interval
+	si.NextBackup = next
+	return nil
+}
+
+// runScheduledBackups starts backups of all instances whose next backup is
+// due. Each instance is claimed before starting the backup, so multiple API
+// instances never back up the same instance twice.
+func runScheduledBackups(now time.Time, wg *sync.WaitGroup, stop <-chan struct{}) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var instances []ServiceInstance
+	err = conn.ServiceInstances().Find(bson.M{
+		"backup_interval": bson.M{"$gt": 0},
+		"next_backup":     bson.M{"$lte": now},
+	}).All(&instances)
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		si := &instances[i]
+		next := now.Add(si.BackupInterval)
+		err = conn.ServiceInstances().Update(bson.M{
+			"name":         si.Name,
+			"service_name": si.ServiceName,
+			"next_backup":  si.NextBackup,
+		}, bson.M{"$set": bson.M{"next_backup": next}})
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Errorf("[service backup] unable to schedule next backup of %s/%s: %s", si.ServiceName, si.Name, err)
+			continue
+		}
+		si.NextBackup = next
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runScheduledBackup(si, stop)
+		}()
+	}
+	return nil
+}
+
+func runScheduledBackup(si *ServiceInstance, stop <-chan struct{}) {
+	contexts := append(permission.Contexts(permission.CtxTeam, si.Teams),
+		permission.Context(permission.CtxServiceInstance, si.ServiceName+"/"+si.Name),
+	)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:        event.Target{Type: event.TargetTypeServiceInstance, Value: si.ServiceName + "/" + si.Name},
+		InternalKind:  scheduledBackupKind,
+		Allowed:       event.Allowed(permission.PermServiceInstanceReadEvents, contexts...),
+		Cancelable:    true,
+		AllowedCancel: event.Allowed(permission.PermServiceInstanceUpdateBackupCreate, contexts...),
+	})
+	if err != nil {
+		log.Errorf("[service backup] unable to create event for %s/%s: %s", si.ServiceName, si.Name, err)
+		return
+	}
+	var backup *Backup
+	if si.PendingBackup != "" {
+		backup, err = si.resumeBackup(si.PendingBackup, evt, evt, "", stop)
+	} else {
+		backup, err = si.createBackup(evt, evt, "", stop)
+	}
+	if err == ErrBackupInterrupted && backup != nil {
+		// The backup keeps running in the service, it's resumed in the next
+		// check, by this or another API instance.
+		updateErr := si.update(bson.M{"$set": bson.M{"next_backup": time.Now().UTC(), "pending_backup": backup.ID}})
+		if updateErr != nil {
+			log.Errorf("[service backup] unable to reschedule backup of %s/%s: %s", si.ServiceName, si.Name, updateErr)
+		}
+	} else if si.PendingBackup != "" {
+		updateErr := si.update(bson.M{"$unset": bson.M{"pending_backup": ""}})
+		if updateErr != nil {
+			log.Errorf("[service backup] unable to clear pending backup of %s/%s: %s", si.ServiceName, si.Name, updateErr)
+		}
+	}
+	if err != nil {
+		log.Errorf("[service backup] unable to back up %s/%s: %s", si.ServiceName, si.Name, err)
+	}
+	evt.DoneCustomData(err, backup)
+}
+
+type backupScheduler struct {
+	interval time.Duration
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (s *backupScheduler) start() {
+	s.doneCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			err := runScheduledBackups(time.Now().UTC(), &s.wg, s.doneCh)
+			if err != nil {
+				log.Errorf("[service backup] %s", err)
+			}
+			select {
+			case <-s.doneCh:
+				return
+			case <-time.After(s.interval):
+			}
+		}
+	}()
+}
+
+// Shutdown stops the scheduler, running backups stop waiting for the service
+// and are rescheduled. It waits at most BackupShutdownTimeout for them.
+func (s *backupScheduler) Shutdown() {
+	close(s.doneCh)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(BackupShutdownTimeout):
+		log.Errorf("[service backup] timeout after %v waiting for scheduled backups to stop", BackupShutdownTimeout)
+	}
+}
+
+func (s *backupScheduler) String() string {
+	return "service instance backups"
+}
+
+// InitializeBackupScheduler starts the scheduler of periodic backups of
+// service instances. The config entry services:backup:check-interval sets how
+// often, in seconds, instances are checked for due backups.
+func InitializeBackupScheduler() error {
+	interval := defaultBackupCheckInterval
+	if seconds, err := config.GetInt("services:backup:check-interval"); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	s := &backupScheduler{interval: interval}
+	s.start()
+	shutdown.Register(s)
+	return nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// fakeBackupAPI is a service API keeping a single backup, which is pending
+// until pendingCalls calls to its status are made.
+type fakeBackupAPI struct {
+	sync.Mutex
+	pendingCalls int
+	failed       bool
+	requests     []string
+}
+
+func (f *fakeBackupAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	status := BackupStatusDone
+	if f.pendingCalls > 0 {
+		status = BackupStatusPending
+		if r.Method == "GET" {
+			f.pendingCalls--
+		}
+	} else if f.failed {
+		status = BackupStatusFailed
+	}
+	switch {
+	case r.Method == "DELETE":
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/resources/my-db/backups" && r.Method == "GET":
+		w.Write([]byte(`[{"id":"b1","status":"done","created_at":"2016-10-10T10:00:00Z","size":42}]`))
+	case r.URL.Path == "/resources/my-db/backups":
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"b1","status":"` + status + `"}`))
+	case r.URL.Path == "/resources/my-db/backups/b1/restore":
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"b1","status":"done","restore_status":"` + status + `"}`))
+	default:
+		w.Write([]byte(`{"id":"b1","status":"` + status + `","restore_status":"` + status + `","error":"disk full"}`))
+	}
+}
+
+func (s *S) TestClientBackups(c *check.C) {
+	var api fakeBackupAPI
+	ts := httptest.NewServer(&api)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-db", ServiceName: "db"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	backups, err := client.Backups(&instance, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(backups, check.DeepEquals, []Backup{
+		{ID: "b1", Status: "done", CreatedAt: time.Date(2016, 10, 10, 10, 0, 0, 0, time.UTC), Size: 42},
+	})
+	c.Assert(api.requests, check.DeepEquals, []string{"GET /resources/my-db/backups"})
+}
+
+func (s *S) TestClientBackupNotSupported(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-db", ServiceName: "db"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	_, err := client.CreateBackup(&instance, "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+	_, err = client.Backups(&instance, "")
+	c.Assert(err, check.Equals, ErrBackupNotSupported)
+	_, err = client.Backup(&instance, "b1", "")
+	c.Assert(err, check.Equals, ErrBackupNotFound)
+	_, err = client.RestoreBackup(&instance, "b1", "")
+	c.Assert(err, check.Equals, ErrBackupNotFound)
+}
+
+func (s *S) TestClientBackupRequestFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-db", ServiceName: "db"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	_, err := client.CreateBackup(&instance, "")
+	c.Assert(err, check.ErrorMatches, `Failed to create a backup of the instance "db/my-db": Server failed to do its job.`)
+}
+
+func (s *S) TestWaitBackupOperation(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	statuses := []string{BackupStatusPending, BackupStatusDone}
+	var calls int
+	err := waitBackupOperation(nil, nil, BackupStatusPending, func() (string, error) {
+		calls++
+		return statuses[calls-1], nil
+	}, func() error {
+		c.Fatal("cancel should not be called")
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.Equals, 2)
+}
+
+func (s *S) TestWaitBackupOperationDone(c *check.C) {
+	err := waitBackupOperation(nil, nil, BackupStatusDone, func() (string, error) {
+		return "", errors.New("should not poll")
+	}, nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestWaitBackupOperationFailed(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	err := waitBackupOperation(nil, nil, BackupStatusPending, func() (string, error) {
+		return BackupStatusFailed, nil
+	}, nil)
+	c.Assert(err, check.ErrorMatches, "the service reported the operation as failed")
+}
+
+func (s *S) TestWaitBackupOperationInterrupted(c *check.C) {
+	stop := make(chan struct{})
+	close(stop)
+	err := waitBackupOperation(nil, stop, BackupStatusPending, func() (string, error) {
+		return "", errors.New("should not poll")
+	}, nil)
+	c.Assert(err, check.Equals, ErrBackupInterrupted)
+}
+
+func (s *S) TestWaitBackupOperationTimeout(c *check.C) {
+	defer func(d time.Duration) { BackupTimeout = d }(BackupTimeout)
+	BackupTimeout = -time.Second
+	err := waitBackupOperation(nil, nil, BackupStatusPending, func() (string, error) {
+		return BackupStatusPending, nil
+	}, nil)
+	c.Assert(err, check.ErrorMatches, "timeout after .* waiting for the service")
+}
+
+func (s *InstanceSuite) newBackupInstance(c *check.C, api *fakeBackupAPI) (*ServiceInstance, func()) {
+	ts := httptest.NewServer(api)
+	srv := Service{Name: "db", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	si := &ServiceInstance{Name: "my-db", ServiceName: "db", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	return si, ts.Close
+}
+
+func (s *InstanceSuite) TestCreateBackup(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	api := fakeBackupAPI{pendingCalls: 1}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	var buf bytes.Buffer
+	backup, err := si.CreateBackup(nil, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(backup.ID, check.Equals, "b1")
+	c.Assert(backup.Status, check.Equals, BackupStatusDone)
+	c.Assert(buf.String(), check.Equals, "Backup \"b1\" started.\nBackup \"b1\" done.\n")
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"POST /resources/my-db/backups",
+		"GET /resources/my-db/backups/b1",
+		"GET /resources/my-db/backups/b1",
+	})
+}
+
+func (s *InstanceSuite) TestCreateBackupFailed(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	api := fakeBackupAPI{pendingCalls: 1, failed: true}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	_, err := si.CreateBackup(nil, nil, "")
+	c.Assert(err, check.ErrorMatches, "the service reported the operation as failed: disk full")
+}
+
+func (s *InstanceSuite) TestCreateBackupCanceled(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	api := fakeBackupAPI{pendingCalls: 100}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	evt, err := event.NewInternal(&event.Opts{
+		Target:        event.Target{Type: event.TargetTypeServiceInstance, Value: "db/my-db"},
+		InternalKind:  scheduledBackupKind,
+		Allowed:       event.Allowed(permission.PermServiceInstanceReadEvents),
+		Cancelable:    true,
+		AllowedCancel: event.Allowed(permission.PermServiceInstanceUpdateBackupCreate),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.TryCancel("because", "admin@tsuru.io")
+	c.Assert(err, check.IsNil)
+	_, err = si.CreateBackup(evt, nil, "")
+	c.Assert(err, check.Equals, ErrBackupCanceled)
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"POST /resources/my-db/backups",
+		"DELETE /resources/my-db/backups/b1",
+	})
+	evt.Done(err)
+}
+
+func (s *InstanceSuite) TestRestoreBackup(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	api := fakeBackupAPI{pendingCalls: 1}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	var buf bytes.Buffer
+	err := si.RestoreBackup("b1", nil, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Restore of backup \"b1\" started.\nRestore of backup \"b1\" done.\n")
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"POST /resources/my-db/backups/b1/restore",
+		"GET /resources/my-db/backups/b1",
+		"GET /resources/my-db/backups/b1",
+	})
+}
+
+func (s *InstanceSuite) TestCreateBackupInstanceNotReady(c *check.C) {
+	si := ServiceInstance{Name: "my-db", ServiceName: "db", State: InstanceStatePending}
+	_, err := si.CreateBackup(nil, nil, "")
+	c.Assert(err, check.Equals, ErrInstanceNotReady)
+}
+
+func (s *InstanceSuite) TestSetBackupInterval(c *check.C) {
+	si := ServiceInstance{Name: "my-db", ServiceName: "db"}
+	err := si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.SetBackupInterval(time.Minute)
+	c.Assert(err, check.Equals, ErrInvalidBackupInterval)
+	err = si.SetBackupInterval(24 * time.Hour)
+	c.Assert(err, check.IsNil)
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.BackupInterval, check.Equals, 24*time.Hour)
+	c.Assert(dbInstance.NextBackup.After(time.Now().Add(23*time.Hour)), check.Equals, true)
+	err = si.SetBackupInterval(0)
+	c.Assert(err, check.IsNil)
+	dbInstance, err = GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.BackupInterval, check.Equals, time.Duration(0))
+	c.Assert(dbInstance.NextBackup.IsZero(), check.Equals, true)
+}
+
+func (s *InstanceSuite) TestRunScheduledBackups(c *check.C) {
+	api := fakeBackupAPI{}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	err := si.SetBackupInterval(24 * time.Hour)
+	c.Assert(err, check.IsNil)
+	other := ServiceInstance{Name: "other-db", ServiceName: "db"}
+	err = other.Create()
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	err = runScheduledBackups(time.Now().UTC(), &wg, nil)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+	c.Assert(api.requests, check.HasLen, 0)
+	now := time.Now().UTC().Add(25 * time.Hour)
+	err = runScheduledBackups(now, &wg, nil)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+	c.Assert(api.requests, check.DeepEquals, []string{"POST /resources/my-db/backups"})
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.NextBackup.Unix(), check.Equals, now.Add(24*time.Hour).Unix())
+	err = runScheduledBackups(now, &wg, nil)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+	c.Assert(api.requests, check.HasLen, 1)
+	evts, err := event.List(&event.Filter{KindName: scheduledBackupKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target.Value, check.Equals, "db/my-db")
+	c.Assert(evts[0].Error, check.Equals, "")
+}
+
+func (s *InstanceSuite) TestRunScheduledBackupsInterrupted(c *check.C) {
+	api := fakeBackupAPI{pendingCalls: 100}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	err := si.SetBackupInterval(24 * time.Hour)
+	c.Assert(err, check.IsNil)
+	stop := make(chan struct{})
+	close(stop)
+	var wg sync.WaitGroup
+	now := time.Now().UTC().Add(25 * time.Hour)
+	err = runScheduledBackups(now, &wg, stop)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.NextBackup.Before(now), check.Equals, true)
+	c.Assert(dbInstance.PendingBackup, check.Equals, "b1")
+	evts, err := event.List(&event.Filter{KindName: scheduledBackupKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Error, check.Equals, ErrBackupInterrupted.Error())
+}
+
+func (s *InstanceSuite) TestRunScheduledBackupsResumesPendingBackup(c *check.C) {
+	defer func(d time.Duration) { BackupPollInterval = d }(BackupPollInterval)
+	BackupPollInterval = time.Millisecond
+	api := fakeBackupAPI{pendingCalls: 2}
+	si, cleanup := s.newBackupInstance(c, &api)
+	defer cleanup()
+	err := si.SetBackupInterval(24 * time.Hour)
+	c.Assert(err, check.IsNil)
+	err = si.update(bson.M{"$set": bson.M{"pending_backup": "b1"}})
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	now := time.Now().UTC().Add(25 * time.Hour)
+	err = runScheduledBackups(now, &wg, nil)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"GET /resources/my-db/backups/b1",
+		"GET /resources/my-db/backups/b1",
+		"GET /resources/my-db/backups/b1",
+	})
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.PendingBackup, check.Equals, "")
+	c.Assert(dbInstance.NextBackup.Unix(), check.Equals, now.Add(24*time.Hour).Unix())
+	evts, err := event.List(&event.Filter{KindName: scheduledBackupKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Error, check.Equals, "")
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// BindRequestPending is the status of requests waiting for a decision
+	// of the team owning the instance.
+	BindRequestPending = "pending"
+	// BindRequestApproved is the status of approved requests, the requesting
+	// team has been granted access to the instance.
+	BindRequestApproved = "approved"
+	// BindRequestRejected is the status of rejected requests.
+	BindRequestRejected = "rejected"
+)
+
+var (
+	ErrBindRequestNotFound      = errors.New("bind request not found")
+	ErrBindRequestAlreadyExists = errors.New("there is already a pending bind request for this app")
+	ErrBindRequestNotPending    = errors.New("bind request has already been decided")
+	ErrTeamAlreadyHasAccess     = errors.New("team already has access to this service instance")
+)
+
+// BindRequest is a request from a team to bind one of its apps to a service
+// instance the team has no access to. Approving the request grants the team
+// access to the instance.
+type BindRequest struct {
+	ID           bson.ObjectId `bson:"_id"`
+	ServiceName  string        `bson:"service_name"`
+	InstanceName string        `bson:"instance_name"`
+	AppName      string        `bson:"app_name"`
+	Team         string
+	Requester    string
+	Message      string `bson:",omitempty"`
+	Status       string
+	CreatedAt    time.Time `bson:"created_at"`
+	DecidedBy    string    `bson:"decided_by,omitempty"`
+	DecidedAt    time.Time `bson:"decided_at,omitempty"`
+}
+
+func bindRequestsCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("service_instance_bind_requests")
+	coll.EnsureIndex(mgo.Index{Key: []string{"service_name", "instance_name", "status"}})
+	return coll, nil
+}
+
+// CreateBindRequest stores a new pending request for the given instance. Only
+// one pending request may exist for each app and instance.
+func CreateBindRequest(si *ServiceInstance, req *BindRequest) error {
+	for _, team := range si.Teams {
+		if team == req.Team {
+			return ErrTeamAlreadyHasAccess
+		}
+	}
+	coll, err := bindRequestsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	n, err := coll.Find(bson.M{
+		"service_name":  si.ServiceName,
+		"instance_name": si.Name,
+		"app_name":      req.AppName,
+		"status":        BindRequestPending,
+	}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrBindRequestAlreadyExists
+	}
+	req.ID = bson.NewObjectId()
+	req.ServiceName = si.ServiceName
+	req.InstanceName = si.Name
+	req.Status = BindRequestPending
+	req.CreatedAt = time.Now().UTC()
+	return coll.Insert(req)
+}
+
+// ListBindRequests returns the requests for the given instance, most recent
+// first. An empty status returns requests in any status.
+func ListBindRequests(serviceName, instanceName, status string) ([]BindRequest, error) {
+	coll, err := bindRequestsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{"service_name": serviceName, "instance_name": instanceName}
+	if status != "" {
+		query["status"] = status
+	}
+	var requests []BindRequest
+	err = coll.Find(query).Sort("-created_at").All(&requests)
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetBindRequest returns the request with the given id for the instance.
+func GetBindRequest(serviceName, instanceName, id string) (*BindRequest, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, ErrBindRequestNotFound
+	}
+	coll, err := bindRequestsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var req BindRequest
+	err = coll.Find(bson.M{
+		"_id":           bson.ObjectIdHex(id),
+		"service_name":  serviceName,
+		"instance_name": instanceName,
+	}).One(&req)
+	if err == mgo.ErrNotFound {
+		return nil, ErrBindRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Approve grants the requesting team access to the instance and marks the
+// request as approved.
+func (r *BindRequest) Approve(si *ServiceInstance, decidedBy string) error {
+	if r.Status != BindRequestPending {
+		return ErrBindRequestNotPending
+	}
+	hasAccess := false
+	for _, team := range si.Teams {
+		if team == r.Team {
+			hasAccess = true
+			break
+		}
+	}
+	if !hasAccess {
+		err := si.Grant(r.Team)
+		if err != nil {
+			return err
+		}
+	}
+	return r.decide(BindRequestApproved, decidedBy)
+}
+
+// Reject marks the request as rejected.
+func (r *BindRequest) Reject(decidedBy string) error {
+	if r.Status != BindRequestPending {
+		return ErrBindRequestNotPending
+	}
+	return r.decide(BindRequestRejected, decidedBy)
+}
+
+func (r *BindRequest) decide(status, decidedBy string) error {
+	coll, err := bindRequestsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	err = coll.Update(bson.M{"_id": r.ID, "status": BindRequestPending}, bson.M{
+		"$set": bson.M{"status": status, "decided_by": decidedBy, "decided_at": now},
+	})
+	if err == mgo.ErrNotFound {
+		return ErrBindRequestNotPending
+	}
+	if err != nil {
+		return err
+	}
+	r.Status = status
+	r.DecidedBy = decidedBy
+	r.DecidedAt = now
+	return nil
+}
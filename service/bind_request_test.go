@@ -0,0 +1,106 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/tsuru/tsuru/auth"
+	"gopkg.in/check.v1"
+)
+
+func (s *InstanceSuite) newSharedInstance(c *check.C) *ServiceInstance {
+	err := s.conn.Teams().Insert(&auth.Team{Name: "requester"})
+	c.Assert(err, check.IsNil)
+	si := &ServiceInstance{Name: "shared", ServiceName: "mysql", Teams: []string{s.team.Name}, TeamOwner: s.team.Name}
+	err = s.conn.ServiceInstances().Insert(si)
+	c.Assert(err, check.IsNil)
+	return si
+}
+
+func (s *InstanceSuite) TestCreateBindRequest(c *check.C) {
+	si := s.newSharedInstance(c)
+	req := BindRequest{AppName: "myapp", Team: "requester", Requester: "me@tsuru.io"}
+	err := CreateBindRequest(si, &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req.Status, check.Equals, BindRequestPending)
+	requests, err := ListBindRequests("mysql", "shared", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].ID, check.Equals, req.ID)
+	c.Assert(requests[0].AppName, check.Equals, "myapp")
+	c.Assert(requests[0].Team, check.Equals, "requester")
+	c.Assert(requests[0].Requester, check.Equals, "me@tsuru.io")
+	c.Assert(requests[0].Status, check.Equals, BindRequestPending)
+}
+
+func (s *InstanceSuite) TestCreateBindRequestDuplicated(c *check.C) {
+	si := s.newSharedInstance(c)
+	err := CreateBindRequest(si, &BindRequest{AppName: "myapp", Team: "requester"})
+	c.Assert(err, check.IsNil)
+	err = CreateBindRequest(si, &BindRequest{AppName: "myapp", Team: "requester"})
+	c.Assert(err, check.Equals, ErrBindRequestAlreadyExists)
+}
+
+func (s *InstanceSuite) TestCreateBindRequestTeamWithAccess(c *check.C) {
+	si := s.newSharedInstance(c)
+	err := CreateBindRequest(si, &BindRequest{AppName: "myapp", Team: s.team.Name})
+	c.Assert(err, check.Equals, ErrTeamAlreadyHasAccess)
+}
+
+func (s *InstanceSuite) TestListBindRequestsByStatus(c *check.C) {
+	si := s.newSharedInstance(c)
+	req := BindRequest{AppName: "myapp", Team: "requester"}
+	err := CreateBindRequest(si, &req)
+	c.Assert(err, check.IsNil)
+	err = CreateBindRequest(si, &BindRequest{AppName: "otherapp", Team: "requester"})
+	c.Assert(err, check.IsNil)
+	err = req.Reject("owner@tsuru.io")
+	c.Assert(err, check.IsNil)
+	requests, err := ListBindRequests("mysql", "shared", BindRequestPending)
+	c.Assert(err, check.IsNil)
+	c.Assert(requests, check.HasLen, 1)
+	c.Assert(requests[0].AppName, check.Equals, "otherapp")
+}
+
+func (s *InstanceSuite) TestGetBindRequestNotFound(c *check.C) {
+	_, err := GetBindRequest("mysql", "shared", "invalid")
+	c.Assert(err, check.Equals, ErrBindRequestNotFound)
+	_, err = GetBindRequest("mysql", "shared", "5a1c3f1d8f4d2b0001a1b2c3")
+	c.Assert(err, check.Equals, ErrBindRequestNotFound)
+}
+
+func (s *InstanceSuite) TestBindRequestApprove(c *check.C) {
+	si := s.newSharedInstance(c)
+	req := BindRequest{AppName: "myapp", Team: "requester"}
+	err := CreateBindRequest(si, &req)
+	c.Assert(err, check.IsNil)
+	err = req.Approve(si, "owner@tsuru.io")
+	c.Assert(err, check.IsNil)
+	dbReq, err := GetBindRequest("mysql", "shared", req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, BindRequestApproved)
+	c.Assert(dbReq.DecidedBy, check.Equals, "owner@tsuru.io")
+	dbInstance, err := GetServiceInstance("mysql", "shared")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.Teams, check.DeepEquals, []string{s.team.Name, "requester"})
+	err = req.Approve(si, "owner@tsuru.io")
+	c.Assert(err, check.Equals, ErrBindRequestNotPending)
+}
+
+func (s *InstanceSuite) TestBindRequestReject(c *check.C) {
+	si := s.newSharedInstance(c)
+	req := BindRequest{AppName: "myapp", Team: "requester"}
+	err := CreateBindRequest(si, &req)
+	c.Assert(err, check.IsNil)
+	err = req.Reject("owner@tsuru.io")
+	c.Assert(err, check.IsNil)
+	dbReq, err := GetBindRequest("mysql", "shared", req.ID.Hex())
+	c.Assert(err, check.IsNil)
+	c.Assert(dbReq.Status, check.Equals, BindRequestRejected)
+	dbInstance, err := GetServiceInstance("mysql", "shared")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.Teams, check.DeepEquals, []string{s.team.Name})
+	err = req.Reject("owner@tsuru.io")
+	c.Assert(err, check.Equals, ErrBindRequestNotPending)
+}
@@ -88,7 +88,7 @@ func (s *BindSuite) TestBindAppFailsWhenEndpointIsDown(c *check.C) {
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 1)
 	c.Assert(err, check.IsNil)
-	err = instance.BindApp(app, true, nil)
+	err = instance.BindApp(app, true, nil, "")
 	c.Assert(err, check.NotNil)
 }
 
@@ -105,7 +105,7 @@ func (s *BindSuite) TestBindAddsAppToTheServiceInstance(c *check.C) {
 	instance.Create()
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 1)
-	err = instance.BindApp(app, true, nil)
+	err = instance.BindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
 	c.Assert(instance.Apps, check.DeepEquals, []string{app.GetName()})
@@ -131,7 +131,7 @@ func (s *BindSuite) TestBindAppMultiUnits(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 2)
-	err = instance.BindApp(app, true, nil)
+	err = instance.BindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	err = tsurutest.WaitCondition(2e9, func() bool {
 		return atomic.LoadInt32(&calls) == 3
@@ -154,7 +154,7 @@ func (s *BindSuite) TestBindReturnConflictIfTheAppIsAlreadyBound(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 1)
-	err = instance.BindApp(app, true, nil)
+	err = instance.BindApp(app, true, nil, "")
 	c.Assert(err, check.Equals, ErrAppAlreadyBound)
 }
 
@@ -172,7 +172,7 @@ func (s *BindSuite) TestBindAppWithNoUnits(c *check.C) {
 	c.Assert(err, check.IsNil)
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 0)
-	err = instance.BindApp(app, true, nil)
+	err = instance.BindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	expectedInstances := []bind.ServiceInstance{
 		{
@@ -248,7 +248,7 @@ func (s *BindSuite) TestUnbindMultiUnits(c *check.C) {
 	}
 	instance.Create()
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
-	err = instance.UnbindApp(app, true, nil)
+	err = instance.UnbindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	err = tsurutest.WaitCondition(1e9, func() bool {
 		return atomic.LoadInt32(&calls) > 1
@@ -281,7 +281,7 @@ func (s *BindSuite) TestUnbindRemovesAppFromServiceInstance(c *check.C) {
 			Instance:      bind.ServiceInstance{Name: "my-mysql"},
 			ShouldRestart: true,
 		}, ioutil.Discard)
-	err = instance.UnbindApp(app, true, nil)
+	err = instance.UnbindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
 	c.Assert(instance.Apps, check.DeepEquals, []string{})
@@ -318,7 +318,7 @@ func (s *BindSuite) TestUnbindCallsTheUnbindMethodFromAPI(c *check.C) {
 	err = instance.Create()
 	c.Assert(err, check.IsNil)
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
-	err = instance.UnbindApp(app, true, nil)
+	err = instance.UnbindApp(app, true, nil, "")
 	c.Assert(err, check.IsNil)
 	err = tsurutest.WaitCondition(1e9, func() bool {
 		return atomic.LoadInt32(&called) > 0
@@ -339,6 +339,6 @@ func (s *BindSuite) TestUnbindReturnsPreconditionFailedIfTheAppIsNotBoundToTheIn
 	instance.Create()
 	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
 	app := provisiontest.NewFakeApp("painkiller", "python", 0)
-	err = instance.UnbindApp(app, true, nil)
+	err = instance.UnbindApp(app, true, nil, "")
 	c.Assert(err, check.Equals, ErrAppNotBound)
 }
@@ -0,0 +1,635 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app/bind"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/tracing"
+)
+
+const (
+	brokerAPIVersion = "2.12"
+
+	brokerStateInProgress = "in progress"
+	brokerStateSucceeded  = "succeeded"
+	brokerStateFailed     = "failed"
+)
+
+var (
+	// BrokerPollInterval is the interval between requests to the
+	// last_operation endpoint while waiting for instances to be updated or
+	// removed.
+	BrokerPollInterval = 2 * time.Second
+	// BrokerPollTimeout is the maximum time waiting for an instance to be
+	// updated or removed.
+	BrokerPollTimeout = 10 * time.Minute
+
+	ErrBrokerServiceNotFound = errors.New("service not found in the broker catalog")
+	ErrBrokerPlanMandatory   = errors.New("please specify the plan of the service instance")
+
+	envVarInvalidChars = regexp.MustCompile(`[^A-Z0-9_]`)
+)
+
+// BrokerCatalog is the response of the Open Service Broker catalog endpoint.
+type BrokerCatalog struct {
+	Services []BrokerService `json:"services"`
+}
+
+type BrokerService struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Bindable    bool         `json:"bindable"`
+	Tags        []string     `json:"tags,omitempty"`
+	Plans       []BrokerPlan `json:"plans"`
+}
+
+type BrokerPlan struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Schemas     *BrokerSchemas      `json:"schemas,omitempty"`
+	Metadata    *BrokerPlanMetadata `json:"metadata,omitempty"`
+}
+
+// BrokerPlanMetadata holds the conventional metadata fields of broker plans
+// used by tsuru.
+type BrokerPlanMetadata struct {
+	Costs []struct {
+		Amount map[string]float64 `json:"amount"`
+		Unit   string             `json:"unit"`
+	} `json:"costs,omitempty"`
+}
+
+// price returns the first cost of the plan, brokers may list costs in
+// multiple currencies.
+func (p *BrokerPlan) price() *PlanPrice {
+	if p.Metadata == nil || len(p.Metadata.Costs) == 0 {
+		return nil
+	}
+	cost := p.Metadata.Costs[0]
+	currencies := make([]string, 0, len(cost.Amount))
+	for currency := range cost.Amount {
+		currencies = append(currencies, currency)
+	}
+	if len(currencies) == 0 {
+		return nil
+	}
+	sort.Strings(currencies)
+	return &PlanPrice{
+		Amount:   cost.Amount[currencies[0]],
+		Currency: strings.ToUpper(currencies[0]),
+		Unit:     strings.ToLower(cost.Unit),
+	}
+}
+
+type BrokerSchemas struct {
+	ServiceInstance struct {
+		Create brokerInputSchema `json:"create"`
+		Update brokerInputSchema `json:"update"`
+	} `json:"service_instance"`
+}
+
+type brokerInputSchema struct {
+	Parameters *ParametersSchema `json:"parameters,omitempty"`
+}
+
+// parametersSchema returns the schema used to validate instance parameters,
+// the update schema is preferred as parameters are only sent on updates.
+func (p *BrokerPlan) parametersSchema() *ParametersSchema {
+	if p.Schemas == nil {
+		return nil
+	}
+	if p.Schemas.ServiceInstance.Update.Parameters != nil {
+		return p.Schemas.ServiceInstance.Update.Parameters
+	}
+	return p.Schemas.ServiceInstance.Create.Parameters
+}
+
+type brokerOperation struct {
+	Operation   string `json:"operation"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// brokerClient is a ServiceClient talking to an Open Service Broker. Each
+// tsuru service maps to one service in the broker catalog.
+type brokerClient struct {
+	endpoint  string
+	username  string
+	password  string
+	serviceID string
+}
+
+// brokerInstanceID returns a stable UUID identifying the instance in the
+// broker, derived from the service and instance names.
+func brokerInstanceID(instance *ServiceInstance) string {
+	return nameUUID("instance/" + instance.ServiceName + "/" + instance.Name)
+}
+
+func brokerBindingID(instance *ServiceInstance, appName string) string {
+	return nameUUID("binding/" + instance.ServiceName + "/" + instance.Name + "/" + appName)
+}
+
+// nameUUID returns a name based (version 5) UUID.
+func nameUUID(name string) string {
+	sum := sha1.Sum([]byte("tsuru/" + name))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// doRequest sends a request to the broker, traced as a child of the span of
+// the API request with the given ID, if any.
+func (c *brokerClient) doRequest(method, path, requestID string, query url.Values, body interface{}) (*http.Response, error) {
+	var reqBody *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+	u := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Broker-API-Version", brokerAPIVersion)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Close = true
+	span := tracing.StartClientSpan(req, tracing.RequestSpan(requestID))
+	span.SetTag("component", "service")
+	resp, err := net.Dial5Full300ClientNoKeepAlive.Do(req)
+	tracing.FinishClientSpan(span, resp, err)
+	return resp, err
+}
+
+func brokerError(action string, resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	var errData struct {
+		Error       string `json:"error"`
+		Description string `json:"description"`
+	}
+	msg := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &errData) == nil && errData.Description != "" {
+		msg = errData.Description
+	}
+	return fmt.Errorf("Failed to %s: broker returned status %d: %s", action, resp.StatusCode, msg)
+}
+
+func (c *brokerClient) Catalog(requestID string) (*BrokerCatalog, error) {
+	resp, err := c.doRequest("GET", "/v2/catalog", requestID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, brokerError("get broker catalog", resp)
+	}
+	var catalog BrokerCatalog
+	err = json.NewDecoder(resp.Body).Decode(&catalog)
+	if err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// HealthCheck checks whether the broker is responding by fetching its
+// catalog.
+func (c *brokerClient) HealthCheck() error {
+	_, err := c.Catalog("")
+	return err
+}
+
+func (c *brokerClient) service(requestID string) (*BrokerService, error) {
+	catalog, err := c.Catalog(requestID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range catalog.Services {
+		if catalog.Services[i].ID == c.serviceID {
+			return &catalog.Services[i], nil
+		}
+	}
+	return nil, ErrBrokerServiceNotFound
+}
+
+// planID returns the broker id of the instance plan. The only plan is used
+// for instances without a plan, if the service has exactly one plan.
+func (c *brokerClient) planID(instance *ServiceInstance, requestID string) (string, error) {
+	svc, err := c.service(requestID)
+	if err != nil {
+		return "", err
+	}
+	return svc.planID(instance.PlanName)
+}
+
+func (s *BrokerService) planID(name string) (string, error) {
+	if name == "" {
+		if len(s.Plans) == 1 {
+			return s.Plans[0].ID, nil
+		}
+		return "", ErrBrokerPlanMandatory
+	}
+	for _, p := range s.Plans {
+		if p.Name == name {
+			return p.ID, nil
+		}
+	}
+	return "", fmt.Errorf("plan %q not found in the broker catalog", name)
+}
+
+// waitOperation polls the last_operation endpoint until an asynchronous
+// operation on the instance finishes. The instance being gone means a
+// deprovision operation finished.
+func (c *brokerClient) waitOperation(instance *ServiceInstance, planID, requestID string, op *brokerOperation, deprovision bool) error {
+	path := "/v2/service_instances/" + brokerInstanceID(instance) + "/last_operation"
+	query := url.Values{"service_id": {c.serviceID}, "plan_id": {planID}}
+	if op.Operation != "" {
+		query.Set("operation", op.Operation)
+	}
+	timeout := time.After(BrokerPollTimeout)
+	for {
+		select {
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for broker operation on instance %q after %v", instance.Name, BrokerPollTimeout)
+		case <-time.After(BrokerPollInterval):
+		}
+		resp, err := c.doRequest("GET", path, requestID, query, nil)
+		if err != nil {
+			return err
+		}
+		if deprovision && resp.StatusCode == http.StatusGone {
+			resp.Body.Close()
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = brokerError("get last operation", resp)
+			resp.Body.Close()
+			return err
+		}
+		var last brokerOperation
+		err = json.NewDecoder(resp.Body).Decode(&last)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		switch last.State {
+		case brokerStateSucceeded:
+			return nil
+		case brokerStateFailed:
+			return fmt.Errorf("broker operation on instance %q failed: %s", instance.Name, last.Description)
+		}
+		log.Debugf("[broker] waiting operation on instance %q: %s", instance.Name, last.Description)
+	}
+}
+
+func (c *brokerClient) Create(instance *ServiceInstance, user, requestID string) error {
+	planID, err := c.planID(instance, requestID)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"service_id":        c.serviceID,
+		"plan_id":           planID,
+		"organization_guid": instance.TeamOwner,
+		"space_guid":        instance.TeamOwner,
+		"context": map[string]string{
+			"platform": "tsuru",
+			"team":     instance.TeamOwner,
+			"user":     user,
+			"instance": instance.Name,
+		},
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance)
+	resp, err := c.doRequest("PUT", path, requestID, url.Values{"accepts_incomplete": {"true"}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusAccepted:
+		return ErrInstancePending
+	case http.StatusConflict:
+		return ErrInstanceAlreadyExistsInAPI
+	}
+	return brokerError("create the instance "+instance.Name, resp)
+}
+
+func (c *brokerClient) Update(instance *ServiceInstance, previousPlan, requestID string) error {
+	svc, err := c.service(requestID)
+	if err != nil {
+		return err
+	}
+	planID, err := svc.planID(instance.PlanName)
+	if err != nil {
+		return err
+	}
+	previousPlanID, err := svc.planID(previousPlan)
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"service_id": c.serviceID,
+		"plan_id":    planID,
+		"parameters": instance.Parameters,
+		"previous_values": map[string]string{
+			"service_id": c.serviceID,
+			"plan_id":    previousPlanID,
+		},
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance)
+	resp, err := c.doRequest("PATCH", path, requestID, url.Values{"accepts_incomplete": {"true"}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusAccepted:
+		var op brokerOperation
+		json.NewDecoder(resp.Body).Decode(&op)
+		return c.waitOperation(instance, planID, requestID, &op, false)
+	}
+	return brokerError("update the instance "+instance.Name, resp)
+}
+
+func (c *brokerClient) Destroy(instance *ServiceInstance, requestID string) error {
+	planID, err := c.planID(instance, requestID)
+	if err != nil {
+		return err
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance)
+	query := url.Values{
+		"service_id":         {c.serviceID},
+		"plan_id":            {planID},
+		"accepts_incomplete": {"true"},
+	}
+	resp, err := c.doRequest("DELETE", path, requestID, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusAccepted:
+		var op brokerOperation
+		json.NewDecoder(resp.Body).Decode(&op)
+		return c.waitOperation(instance, planID, requestID, &op, true)
+	case http.StatusGone:
+		return ErrInstanceNotFoundInAPI
+	}
+	return brokerError("destroy the instance "+instance.Name, resp)
+}
+
+// credentialsToEnvs maps the binding credentials to environment variables,
+// named after the service and the credential key, e.g. the "uri" credential
+// of the "mysql" service is set in the MYSQL_URI variable. Values that are
+// not strings are encoded as JSON.
+func credentialsToEnvs(serviceName string, credentials map[string]interface{}) map[string]string {
+	envs := make(map[string]string, len(credentials))
+	for k, v := range credentials {
+		name := strings.ToUpper(serviceName + "_" + k)
+		name = envVarInvalidChars.ReplaceAllString(name, "_")
+		if str, ok := v.(string); ok {
+			envs[name] = str
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		envs[name] = string(data)
+	}
+	return envs
+}
+
+func (c *brokerClient) BindApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
+	planID, err := c.planID(instance, requestID)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"service_id": c.serviceID,
+		"plan_id":    planID,
+		"app_guid":   app.GetName(),
+		"bind_resource": map[string]string{
+			"app_guid": app.GetName(),
+		},
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance) + "/service_bindings/" + brokerBindingID(instance, app.GetName())
+	resp, err := c.doRequest("PUT", path, requestID, nil, body)
+	if err != nil {
+		log.Errorf(`Failed to bind app %q to service instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, err)
+		return nil, fmt.Errorf("%s api is down.", instance.Name)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		var result struct {
+			Credentials map[string]interface{} `json:"credentials"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		if err != nil {
+			return nil, err
+		}
+		return credentialsToEnvs(instance.ServiceName, result.Credentials), nil
+	case http.StatusNotFound, http.StatusGone:
+		return nil, ErrInstanceNotFoundInAPI
+	case http.StatusUnprocessableEntity:
+		return nil, ErrInstanceNotReady
+	}
+	return nil, brokerError(fmt.Sprintf(`bind the instance "%s/%s" to the app %q`, instance.ServiceName, instance.Name, app.GetName()), resp)
+}
+
+// BindUnit is a no-op, brokers only know about app bindings.
+func (c *brokerClient) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+func (c *brokerClient) UnbindApp(instance *ServiceInstance, app bind.App, requestID string) error {
+	planID, err := c.planID(instance, requestID)
+	if err != nil {
+		return err
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance) + "/service_bindings/" + brokerBindingID(instance, app.GetName())
+	query := url.Values{"service_id": {c.serviceID}, "plan_id": {planID}}
+	resp, err := c.doRequest("DELETE", path, requestID, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusGone:
+		return ErrInstanceNotFoundInAPI
+	}
+	return brokerError(fmt.Sprintf(`unbind the instance "%s/%s" from the app %q`, instance.ServiceName, instance.Name, app.GetName()), resp)
+}
+
+// RotateApp is not supported, the Open Service Broker API has no way to issue
+// new credentials for an existing binding.
+func (c *brokerClient) RotateApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
+	return nil, ErrRotationNotSupported
+}
+
+// RevokeApp is not supported, see RotateApp.
+func (c *brokerClient) RevokeApp(instance *ServiceInstance, app bind.App, requestID string) error {
+	return ErrRotationNotSupported
+}
+
+// DiscardAppRotation is not supported, see RotateApp.
+func (c *brokerClient) DiscardAppRotation(instance *ServiceInstance, app bind.App, requestID string) error {
+	return ErrRotationNotSupported
+}
+
+// UnbindUnit is a no-op, brokers only know about app bindings.
+func (c *brokerClient) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	return nil
+}
+
+// Status uses the last_operation endpoint, brokers have no endpoint
+// reporting the health of instances.
+func (c *brokerClient) Status(instance *ServiceInstance, requestID string) (string, error) {
+	planID, err := c.planID(instance, requestID)
+	if err != nil {
+		return "", err
+	}
+	path := "/v2/service_instances/" + brokerInstanceID(instance) + "/last_operation"
+	query := url.Values{"service_id": {c.serviceID}, "plan_id": {planID}}
+	resp, err := c.doRequest("GET", path, requestID, query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "not implemented for this service", nil
+	}
+	var op brokerOperation
+	err = json.NewDecoder(resp.Body).Decode(&op)
+	if err != nil {
+		return "", err
+	}
+	switch op.State {
+	case brokerStateInProgress:
+		return "pending", nil
+	case brokerStateFailed:
+		return "down", nil
+	}
+	return "up", nil
+}
+
+// Info returns no additional information, it's not part of the broker API.
+func (c *brokerClient) Info(instance *ServiceInstance, requestID string) ([]map[string]string, error) {
+	return nil, nil
+}
+
+// CreateBackup is not supported, backups are not part of the broker API.
+func (c *brokerClient) CreateBackup(instance *ServiceInstance, requestID string) (*Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+// Backups is not supported, see CreateBackup.
+func (c *brokerClient) Backups(instance *ServiceInstance, requestID string) ([]Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+// Backup is not supported, see CreateBackup.
+func (c *brokerClient) Backup(instance *ServiceInstance, backupID, requestID string) (*Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+// CancelBackup is not supported, see CreateBackup.
+func (c *brokerClient) CancelBackup(instance *ServiceInstance, backupID, requestID string) error {
+	return ErrBackupNotSupported
+}
+
+// RestoreBackup is not supported, see CreateBackup.
+func (c *brokerClient) RestoreBackup(instance *ServiceInstance, backupID, requestID string) (*Backup, error) {
+	return nil, ErrBackupNotSupported
+}
+
+// CancelRestore is not supported, see CreateBackup.
+func (c *brokerClient) CancelRestore(instance *ServiceInstance, backupID, requestID string) error {
+	return ErrBackupNotSupported
+}
+
+func (c *brokerClient) Plans(requestID string) ([]Plan, error) {
+	svc, err := c.service(requestID)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]Plan, len(svc.Plans))
+	for i, p := range svc.Plans {
+		plans[i] = Plan{Name: p.Name, Description: p.Description, Schema: p.parametersSchema(), Price: p.price()}
+	}
+	return plans, nil
+}
+
+func (c *brokerClient) Proxy(path string, w http.ResponseWriter, r *http.Request) error {
+	return errors.New("proxy is not supported by service brokers")
+}
+
+// ImportBrokerCatalog returns one service for each bindable service in the
+// catalog of the broker. The services are not stored in the database.
+func ImportBrokerCatalog(endpoint, username, password, requestID string) ([]Service, error) {
+	s := Service{Endpoint: map[string]string{"production": endpoint}, Username: username, Password: password}
+	cli, err := s.getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	broker := &brokerClient{endpoint: cli.endpoint, username: username, password: password}
+	catalog, err := broker.Catalog(requestID)
+	if err != nil {
+		return nil, err
+	}
+	var services []Service
+	for _, bs := range catalog.Services {
+		if !bs.Bindable {
+			continue
+		}
+		services = append(services, Service{
+			Name:            bs.Name,
+			Username:        username,
+			Password:        password,
+			Endpoint:        map[string]string{"production": endpoint},
+			Doc:             bs.Description,
+			Tags:            bs.Tags,
+			Protocol:        ProtocolOSB,
+			BrokerServiceID: bs.ID,
+		})
+	}
+	return services, nil
+}
@@ -0,0 +1,419 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/tracing"
+	"gopkg.in/check.v1"
+)
+
+const brokerCatalog = `{"services": [
+	{"id": "svc-1", "name": "mysql", "description": "MySQL databases", "bindable": true, "tags": ["sql", "database"], "plans": [
+		{"id": "plan-small", "name": "small", "description": "small database", "metadata": {"costs": [
+			{"amount": {"usd": 10.5, "eur": 9.9}, "unit": "MONTHLY"}
+		]}},
+		{"id": "plan-big", "name": "big", "description": "big database", "schemas": {"service_instance": {
+			"update": {"parameters": {"properties": {"size": {"type": "integer"}}}}
+		}}}
+	]},
+	{"id": "svc-2", "name": "logger", "description": "not bindable", "bindable": false, "plans": [
+		{"id": "plan-default", "name": "default"}
+	]}
+]}`
+
+type brokerRequest struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   map[string]interface{}
+}
+
+type fakeBroker struct {
+	sync.Mutex
+	requests      []brokerRequest
+	status        int
+	response      string
+	lastOperation []string
+}
+
+func (b *fakeBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.Lock()
+	defer b.Unlock()
+	if r.Header.Get("X-Broker-API-Version") == "" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	req := brokerRequest{method: r.Method, path: r.URL.Path, query: r.URL.RawQuery, header: r.Header}
+	data, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(data, &req.body)
+	b.requests = append(b.requests, req)
+	switch {
+	case r.URL.Path == "/v2/catalog":
+		w.Write([]byte(brokerCatalog))
+	case strings.HasSuffix(r.URL.Path, "/last_operation"):
+		if len(b.lastOperation) == 0 {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("{}"))
+			return
+		}
+		state := b.lastOperation[0]
+		b.lastOperation = b.lastOperation[1:]
+		w.Write([]byte(`{"state": "` + state + `", "description": "op ` + state + `"}`))
+	default:
+		status := b.status
+		if status == 0 {
+			status = http.StatusCreated
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(b.response))
+	}
+}
+
+func (b *fakeBroker) nonCatalogRequests() []brokerRequest {
+	b.Lock()
+	defer b.Unlock()
+	var reqs []brokerRequest
+	for _, r := range b.requests {
+		if r.path != "/v2/catalog" {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+func newTestBroker(b *fakeBroker) (*httptest.Server, *brokerClient) {
+	ts := httptest.NewServer(b)
+	return ts, &brokerClient{endpoint: ts.URL, username: "user", password: "secret", serviceID: "svc-1"}
+}
+
+func (s *S) TestNameUUID(c *check.C) {
+	id := nameUUID("instance/mysql/db")
+	c.Assert(id, check.Matches, `[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`)
+	c.Assert(nameUUID("instance/mysql/db"), check.Equals, id)
+	c.Assert(nameUUID("instance/mysql/db2"), check.Not(check.Equals), id)
+}
+
+func (s *S) TestEndpointClientProtocol(c *check.C) {
+	svc := Service{Name: "mysql", Endpoint: map[string]string{"production": "broker.tsuru.io"}, Username: "user", Password: "secret"}
+	cli, err := svc.endpointClient("production")
+	c.Assert(err, check.IsNil)
+	c.Assert(cli, check.FitsTypeOf, &Client{})
+	svc.Protocol = ProtocolOSB
+	svc.BrokerServiceID = "svc-1"
+	cli, err = svc.endpointClient("production")
+	c.Assert(err, check.IsNil)
+	c.Assert(cli, check.DeepEquals, &brokerClient{
+		endpoint:  "http://broker.tsuru.io",
+		username:  "user",
+		password:  "secret",
+		serviceID: "svc-1",
+	})
+}
+
+func (s *S) TestBrokerPlans(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{})
+	defer ts.Close()
+	plans, err := cli.Plans("")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []Plan{
+		{Name: "small", Description: "small database", Price: &PlanPrice{Amount: 9.9, Currency: "EUR", Unit: "monthly"}},
+		{Name: "big", Description: "big database", Schema: &ParametersSchema{
+			Properties: map[string]ParameterSchema{"size": {Type: "integer"}},
+		}},
+	})
+}
+
+func (s *S) TestBrokerPlansServiceNotFound(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{})
+	defer ts.Close()
+	cli.serviceID = "unknown"
+	_, err := cli.Plans("")
+	c.Assert(err, check.Equals, ErrBrokerServiceNotFound)
+}
+
+func (s *S) TestBrokerCreate(c *check.C) {
+	b := &fakeBroker{}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big", TeamOwner: "myteam"}
+	err := cli.Create(&instance, "me@tsuru.io", "")
+	c.Assert(err, check.IsNil)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].method, check.Equals, "PUT")
+	c.Assert(reqs[0].path, check.Equals, "/v2/service_instances/"+brokerInstanceID(&instance))
+	c.Assert(reqs[0].query, check.Equals, "accepts_incomplete=true")
+	c.Assert(reqs[0].body["service_id"], check.Equals, "svc-1")
+	c.Assert(reqs[0].body["plan_id"], check.Equals, "plan-big")
+	c.Assert(reqs[0].body["organization_guid"], check.Equals, "myteam")
+}
+
+func (s *S) TestBrokerCreateTracing(c *check.C) {
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewWriterExporter(&buf))
+	defer tracing.SetExporter(nil)
+	b := &fakeBroker{}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	span := tracing.StartSpan("POST /services/instances", tracing.SpanContext{})
+	defer tracing.BindRequest("request-1", span)()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big", TeamOwner: "myteam"}
+	err := cli.Create(&instance, "me@tsuru.io", "request-1")
+	c.Assert(err, check.IsNil)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	received := tracing.Extract(reqs[0].header)
+	c.Assert(received.TraceID, check.Equals, span.Context().TraceID)
+	c.Assert(received.SpanID, check.Not(check.Equals), span.Context().SpanID)
+}
+
+func (s *S) TestBrokerCreatePlanMandatory(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{})
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", TeamOwner: "myteam"}
+	err := cli.Create(&instance, "me@tsuru.io", "")
+	c.Assert(err, check.Equals, ErrBrokerPlanMandatory)
+}
+
+func (s *S) TestBrokerCreateAlreadyExists(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{status: http.StatusConflict, response: "{}"})
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Create(&instance, "me@tsuru.io", "")
+	c.Assert(err, check.Equals, ErrInstanceAlreadyExistsInAPI)
+}
+
+func (s *S) TestBrokerCreateAsync(c *check.C) {
+	b := &fakeBroker{status: http.StatusAccepted, response: `{"operation": "op-1"}`}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Create(&instance, "me@tsuru.io", "")
+	c.Assert(err, check.Equals, ErrInstancePending)
+	c.Assert(b.nonCatalogRequests(), check.HasLen, 1)
+}
+
+func (s *S) TestBrokerUpdate(c *check.C) {
+	b := &fakeBroker{status: http.StatusOK, response: "{}"}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big", Parameters: map[string]string{"size": "10"}}
+	err := cli.Update(&instance, "small", "")
+	c.Assert(err, check.IsNil)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].method, check.Equals, "PATCH")
+	c.Assert(reqs[0].path, check.Equals, "/v2/service_instances/"+brokerInstanceID(&instance))
+	c.Assert(reqs[0].body, check.DeepEquals, map[string]interface{}{
+		"service_id": "svc-1",
+		"plan_id":    "plan-big",
+		"parameters": map[string]interface{}{"size": "10"},
+		"previous_values": map[string]interface{}{
+			"service_id": "svc-1",
+			"plan_id":    "plan-small",
+		},
+	})
+}
+
+func (s *S) TestBrokerUpdateAsync(c *check.C) {
+	defer func(d time.Duration) { BrokerPollInterval = d }(BrokerPollInterval)
+	BrokerPollInterval = time.Millisecond
+	b := &fakeBroker{
+		status:        http.StatusAccepted,
+		response:      `{"operation": "op-2"}`,
+		lastOperation: []string{"in progress", "succeeded"},
+	}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big"}
+	err := cli.Update(&instance, "small", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.nonCatalogRequests(), check.HasLen, 3)
+}
+
+func (s *S) TestBrokerUpdateRejected(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{status: http.StatusUnprocessableEntity, response: `{"error": "PlanChangeNotSupported", "description": "cannot downgrade"}`})
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small"}
+	err := cli.Update(&instance, "big", "")
+	c.Assert(err, check.ErrorMatches, "Failed to update the instance db: broker returned status 422: cannot downgrade")
+}
+
+func (s *S) TestBrokerDestroy(c *check.C) {
+	b := &fakeBroker{status: http.StatusOK, response: "{}"}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Destroy(&instance, "")
+	c.Assert(err, check.IsNil)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].method, check.Equals, "DELETE")
+	c.Assert(reqs[0].query, check.Equals, "accepts_incomplete=true&plan_id=plan-small&service_id=svc-1")
+}
+
+func (s *S) TestBrokerDestroyAsyncGone(c *check.C) {
+	defer func(d time.Duration) { BrokerPollInterval = d }(BrokerPollInterval)
+	BrokerPollInterval = time.Millisecond
+	b := &fakeBroker{status: http.StatusAccepted, response: "{}", lastOperation: []string{"in progress"}}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Destroy(&instance, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.nonCatalogRequests(), check.HasLen, 3)
+}
+
+func (s *S) TestBrokerDestroyAsyncFailed(c *check.C) {
+	defer func(d time.Duration) { BrokerPollInterval = d }(BrokerPollInterval)
+	BrokerPollInterval = time.Millisecond
+	b := &fakeBroker{
+		status:        http.StatusAccepted,
+		response:      `{"operation": "op-1"}`,
+		lastOperation: []string{"in progress", "failed"},
+	}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Destroy(&instance, "")
+	c.Assert(err, check.ErrorMatches, `broker operation on instance "db" failed: op failed`)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 3)
+	c.Assert(reqs[1].query, check.Equals, "operation=op-1&plan_id=plan-small&service_id=svc-1")
+}
+
+func (s *S) TestBrokerDestroyNotFound(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{status: http.StatusGone, response: "{}"})
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	err := cli.Destroy(&instance, "")
+	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
+}
+
+func (s *S) TestBrokerBindApp(c *check.C) {
+	b := &fakeBroker{response: `{"credentials": {"uri": "mysql://db", "port": 3306, "ssl-mode": "on"}}`}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "my-sql", PlanName: "small", TeamOwner: "myteam"}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	envs, err := cli.BindApp(&instance, a, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]string{
+		"MY_SQL_URI":      "mysql://db",
+		"MY_SQL_PORT":     "3306",
+		"MY_SQL_SSL_MODE": "on",
+	})
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].method, check.Equals, "PUT")
+	c.Assert(reqs[0].path, check.Equals, "/v2/service_instances/"+brokerInstanceID(&instance)+"/service_bindings/"+brokerBindingID(&instance, "myapp"))
+	c.Assert(reqs[0].body["bind_resource"], check.DeepEquals, map[string]interface{}{"app_guid": "myapp"})
+}
+
+func (s *S) TestBrokerBindAppTracing(c *check.C) {
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewWriterExporter(&buf))
+	defer tracing.SetExporter(nil)
+	b := &fakeBroker{response: `{"credentials": {}}`}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	span := tracing.StartSpan("PUT /services/{service}/instances/{instance}/{app}", tracing.SpanContext{})
+	defer tracing.BindRequest("request-1", span)()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small", TeamOwner: "myteam"}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	_, err := cli.BindApp(&instance, a, "request-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.requests, check.HasLen, 2)
+	for _, req := range b.requests {
+		c.Assert(tracing.Extract(req.header).TraceID, check.Equals, span.Context().TraceID)
+	}
+}
+
+func (s *S) TestBrokerBindUnitIsNoop(c *check.C) {
+	b := &fakeBroker{}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small"}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	units, err := a.GetUnits()
+	c.Assert(err, check.IsNil)
+	err = cli.BindUnit(&instance, a, units[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(b.requests, check.HasLen, 0)
+}
+
+func (s *S) TestBrokerUnbindApp(c *check.C) {
+	b := &fakeBroker{status: http.StatusOK, response: "{}"}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small"}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	err := cli.UnbindApp(&instance, a, "")
+	c.Assert(err, check.IsNil)
+	reqs := b.nonCatalogRequests()
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(reqs[0].method, check.Equals, "DELETE")
+	c.Assert(reqs[0].query, check.Equals, "plan_id=plan-small&service_id=svc-1")
+}
+
+func (s *S) TestBrokerUnbindAppNotFound(c *check.C) {
+	ts, cli := newTestBroker(&fakeBroker{status: http.StatusGone, response: "{}"})
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small"}
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	err := cli.UnbindApp(&instance, a, "")
+	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
+}
+
+func (s *S) TestBrokerStatus(c *check.C) {
+	b := &fakeBroker{lastOperation: []string{"in progress", "succeeded", "failed"}}
+	ts, cli := newTestBroker(b)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "small"}
+	for _, expected := range []string{"pending", "up", "down", "not implemented for this service"} {
+		status, err := cli.Status(&instance, "")
+		c.Assert(err, check.IsNil)
+		c.Assert(status, check.Equals, expected)
+	}
+}
+
+func (s *S) TestImportBrokerCatalog(c *check.C) {
+	ts := httptest.NewServer(&fakeBroker{})
+	defer ts.Close()
+	services, err := ImportBrokerCatalog(ts.URL, "user", "secret", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(services, check.DeepEquals, []Service{{
+		Name:            "mysql",
+		Username:        "user",
+		Password:        "secret",
+		Endpoint:        map[string]string{"production": ts.URL},
+		Doc:             "MySQL databases",
+		Protocol:        ProtocolOSB,
+		BrokerServiceID: "svc-1",
+		Tags:            []string{"sql", "database"},
+	}})
+}
+
+func (s *S) TestImportBrokerCatalogUnauthorized(c *check.C) {
+	ts := httptest.NewServer(&fakeBroker{})
+	defer ts.Close()
+	_, err := ImportBrokerCatalog(ts.URL, "user", "wrong", "")
+	c.Assert(err, check.ErrorMatches, "Failed to get broker catalog: broker returned status 401.*")
+}
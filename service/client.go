@@ -0,0 +1,69 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+
+	"github.com/tsuru/tsuru/app/bind"
+)
+
+const (
+	// ProtocolTsuru is the protocol of services implementing the tsuru
+	// service API. It's used when the service protocol is empty.
+	ProtocolTsuru = "tsuru"
+	// ProtocolOSB is the protocol of services implementing the Open Service
+	// Broker API.
+	ProtocolOSB = "osb"
+)
+
+// ServiceClient is the interface implemented by clients of the APIs used to
+// manage service instances.
+type ServiceClient interface {
+	Create(instance *ServiceInstance, user, requestID string) error
+	Update(instance *ServiceInstance, previousPlan, requestID string) error
+	Destroy(instance *ServiceInstance, requestID string) error
+	BindApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error)
+	BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	UnbindApp(instance *ServiceInstance, app bind.App, requestID string) error
+	RotateApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error)
+	RevokeApp(instance *ServiceInstance, app bind.App, requestID string) error
+	DiscardAppRotation(instance *ServiceInstance, app bind.App, requestID string) error
+	UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error
+	Status(instance *ServiceInstance, requestID string) (string, error)
+	Info(instance *ServiceInstance, requestID string) ([]map[string]string, error)
+	CreateBackup(instance *ServiceInstance, requestID string) (*Backup, error)
+	Backups(instance *ServiceInstance, requestID string) ([]Backup, error)
+	Backup(instance *ServiceInstance, backupID, requestID string) (*Backup, error)
+	CancelBackup(instance *ServiceInstance, backupID, requestID string) error
+	RestoreBackup(instance *ServiceInstance, backupID, requestID string) (*Backup, error)
+	CancelRestore(instance *ServiceInstance, backupID, requestID string) error
+	Plans(requestID string) ([]Plan, error)
+	HealthCheck() error
+	Proxy(path string, w http.ResponseWriter, r *http.Request) error
+}
+
+var (
+	_ ServiceClient = &Client{}
+	_ ServiceClient = &brokerClient{}
+)
+
+// endpointClient returns the client for the given endpoint according to the
+// service protocol.
+func (s *Service) endpointClient(endpoint string) (ServiceClient, error) {
+	cli, err := s.getClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.Protocol == ProtocolOSB {
+		return &brokerClient{
+			endpoint:  cli.endpoint,
+			username:  cli.username,
+			password:  cli.password,
+			serviceID: s.BrokerServiceID,
+		}, nil
+	}
+	return cli, nil
+}
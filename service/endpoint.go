@@ -20,12 +20,17 @@ import (
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 var (
 	ErrInstanceAlreadyExistsInAPI = errors.New("instance already exists in the service API")
 	ErrInstanceNotFoundInAPI      = errors.New("instance does not exist in the service API")
 	ErrInstanceNotReady           = errors.New("instance is not ready yet")
+	ErrInstancePending            = errors.New("instance is being provisioned by the service API")
+	ErrRotationNotSupported       = errors.New("the service API does not support rotating credentials")
+	ErrBackupNotSupported         = errors.New("the service API does not support backups")
+	ErrBackupNotFound             = errors.New("backup not found in the service API")
 )
 
 type Client struct {
@@ -78,7 +83,11 @@ func (c *Client) issueRequest(path, method string, params map[string][]string) (
 	}
 	req.SetBasicAuth(c.username, c.password)
 	req.Close = true
-	return net.Dial5Full300ClientNoKeepAlive.Do(req)
+	span := tracing.StartClientSpan(req, tracing.RequestSpan(requestID))
+	span.SetTag("component", "service")
+	resp, err := net.Dial5Full300ClientNoKeepAlive.Do(req)
+	tracing.FinishClientSpan(span, resp, err)
+	return resp, err
 }
 
 func (c *Client) jsonFromResponse(resp *http.Response, v interface{}) error {
@@ -110,6 +119,9 @@ func (c *Client) Create(instance *ServiceInstance, user, requestID string) error
 	resp, err = c.issueRequest("/resources", "POST", params)
 	if err == nil {
 		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusAccepted {
+			return ErrInstancePending
+		}
 		if resp.StatusCode < 300 {
 			return nil
 		}
@@ -122,6 +134,33 @@ func (c *Client) Create(instance *ServiceInstance, user, requestID string) error
 	return errors.New(msg)
 }
 
+// Update changes the plan and the parameters of the instance in the service
+// API. Parameters are sent as parameters.<name> fields.
+func (c *Client) Update(instance *ServiceInstance, previousPlan, requestID string) error {
+	log.Debugf("Attempting to call update of service instance %q at %q api", instance.Name, instance.ServiceName)
+	params := map[string][]string{
+		"plan":      {instance.PlanName},
+		"team":      {instance.TeamOwner},
+		"requestID": {requestID},
+	}
+	for k, v := range instance.Parameters {
+		params["parameters."+k] = []string{v}
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier(), "PUT", params)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrInstanceNotFoundInAPI
+		}
+	}
+	msg := "Failed to update the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
+	log.Error(msg)
+	return errors.New(msg)
+}
+
 func (c *Client) Destroy(instance *ServiceInstance, requestID string) error {
 	log.Debugf("Attempting to call destroy of service instance %q at %q api", instance.Name, instance.ServiceName)
 	params := map[string][]string{
@@ -142,12 +181,13 @@ func (c *Client) Destroy(instance *ServiceInstance, requestID string) error {
 	return err
 }
 
-func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
+func (c *Client) BindApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
 	log.Debugf("Calling bind of instance %q and %q app at %q API",
 		instance.Name, app.GetName(), instance.ServiceName)
 	var resp *http.Response
 	params := map[string][]string{
-		"app-host": {app.GetIp()},
+		"app-host":  {app.GetIp()},
+		"requestID": {requestID},
 	}
 	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind-app", "POST", params)
 	if err != nil {
@@ -156,6 +196,7 @@ func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]st
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
+		params["requestID"] = []string{requestID}
 		resp, err = c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind", "POST", params)
 	}
 	if err != nil {
@@ -212,12 +253,13 @@ func (c *Client) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Uni
 	return nil
 }
 
-func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App) error {
+func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App, requestID string) error {
 	log.Debugf("Calling unbind of service instance %q and app %q at %q", instance.Name, app.GetName(), instance.ServiceName)
 	var resp *http.Response
 	url := "/resources/" + instance.GetIdentifier() + "/bind-app"
 	params := map[string][]string{
-		"app-host": {app.GetIp()},
+		"app-host":  {app.GetIp()},
+		"requestID": {requestID},
 	}
 	resp, err := c.issueRequest(url, "DELETE", params)
 	if err == nil {
@@ -234,6 +276,87 @@ func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App) error {
 	return err
 }
 
+// RotateApp asks the service API to issue new credentials for the app bound
+// to the instance, returning the environment variables holding them. The
+// previous credentials must remain valid until RevokeApp is called. The api
+// should be prepared to receive the request, like below:
+// POST /resources/<name>/bind-app/credentials
+func (c *Client) RotateApp(instance *ServiceInstance, app bind.App, requestID string) (map[string]string, error) {
+	log.Debugf("Calling credentials rotation of instance %q and %q app at %q API",
+		instance.Name, app.GetName(), instance.ServiceName)
+	params := map[string][]string{
+		"app-host":  {app.GetIp()},
+		"app-name":  {app.GetName()},
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/bind-app/credentials", "POST", params)
+	if err != nil {
+		log.Errorf(`Failed to rotate credentials of app %q in service instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, err)
+		return nil, fmt.Errorf("%s api is down.", instance.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		var result map[string]string
+		err = c.jsonFromResponse(resp, &result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusPreconditionFailed:
+		return nil, ErrInstanceNotReady
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, ErrRotationNotSupported
+	}
+	msg := fmt.Sprintf(`Failed to rotate credentials of the app %q in the instance "%s/%s": %s`, app.GetName(), instance.ServiceName, instance.Name, c.buildErrorMessage(err, resp))
+	log.Error(msg)
+	return nil, errors.New(msg)
+}
+
+// RevokeApp asks the service API to revoke the credentials replaced by the
+// last call to RotateApp. The api should be prepared to receive the request,
+// like below:
+// DELETE /resources/<name>/bind-app/credentials
+func (c *Client) RevokeApp(instance *ServiceInstance, app bind.App, requestID string) error {
+	log.Debugf("Calling revocation of old credentials of instance %q and %q app at %q API",
+		instance.Name, app.GetName(), instance.ServiceName)
+	return c.revokeCredentials("/resources/"+instance.GetIdentifier()+"/bind-app/credentials", app, requestID)
+}
+
+// DiscardAppRotation asks the service API to revoke the new credentials issued
+// by the last call to RotateApp, keeping the previous ones, when the app could
+// not start using them. The api should be prepared to receive the request,
+// like below:
+// DELETE /resources/<name>/bind-app/credentials/new
+func (c *Client) DiscardAppRotation(instance *ServiceInstance, app bind.App, requestID string) error {
+	log.Debugf("Calling revocation of new credentials of instance %q and %q app at %q API",
+		instance.Name, app.GetName(), instance.ServiceName)
+	return c.revokeCredentials("/resources/"+instance.GetIdentifier()+"/bind-app/credentials/new", app, requestID)
+}
+
+func (c *Client) revokeCredentials(url string, app bind.App, requestID string) error {
+	params := map[string][]string{
+		"app-host":  {app.GetIp()},
+		"app-name":  {app.GetName()},
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest(url, "DELETE", params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrRotationNotSupported
+		}
+		msg := fmt.Sprintf("Failed to revoke credentials (%q): %s", url, c.buildErrorMessage(err, resp))
+		log.Error(msg)
+		return errors.New(msg)
+	}
+	return nil
+}
+
 func (c *Client) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
 	log.Debugf("Calling unbind of service instance %q and unit %q at %q", instance.Name, unit.GetIp(), instance.ServiceName)
 	var resp *http.Response
@@ -289,6 +412,110 @@ func (c *Client) Status(instance *ServiceInstance, requestID string) (string, er
 	return "", errors.New(msg)
 }
 
+// CreateBackup asks the service API to back up the instance. The returned
+// backup is pending if the service is still creating it. The api should be
+// prepared to receive the request, like below:
+// POST /resources/<name>/backups
+func (c *Client) CreateBackup(instance *ServiceInstance, requestID string) (*Backup, error) {
+	log.Debugf("Attempting to call backup creation of service instance %q at %q api", instance.Name, instance.ServiceName)
+	var backup Backup
+	err := c.backupRequest(instance, "POST", "", requestID, "create a backup of", &backup)
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// Backups returns the backups of the instance. The api should be prepared to
+// receive the request, like below:
+// GET /resources/<name>/backups
+func (c *Client) Backups(instance *ServiceInstance, requestID string) ([]Backup, error) {
+	log.Debugf("Attempting to call backup list of service instance %q at %q api", instance.Name, instance.ServiceName)
+	var backups []Backup
+	err := c.backupRequest(instance, "GET", "", requestID, "list the backups of", &backups)
+	if err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+// Backup returns a backup of the instance, it's used to track the status of
+// backups and restores. The api should be prepared to receive the request,
+// like below:
+// GET /resources/<name>/backups/<backup-id>
+func (c *Client) Backup(instance *ServiceInstance, backupID, requestID string) (*Backup, error) {
+	var backup Backup
+	err := c.backupRequest(instance, "GET", "/"+url.QueryEscape(backupID), requestID, "get a backup of", &backup)
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// CancelBackup asks the service API to cancel a pending backup. The api
+// should be prepared to receive the request, like below:
+// DELETE /resources/<name>/backups/<backup-id>
+func (c *Client) CancelBackup(instance *ServiceInstance, backupID, requestID string) error {
+	return c.backupRequest(instance, "DELETE", "/"+url.QueryEscape(backupID), requestID, "cancel a backup of", nil)
+}
+
+// RestoreBackup asks the service API to restore the instance from a backup.
+// The returned backup has a pending restore status if the service is still
+// restoring it. The api should be prepared to receive the request, like
+// below:
+// POST /resources/<name>/backups/<backup-id>/restore
+func (c *Client) RestoreBackup(instance *ServiceInstance, backupID, requestID string) (*Backup, error) {
+	log.Debugf("Attempting to call restore of service instance %q at %q api", instance.Name, instance.ServiceName)
+	var backup Backup
+	err := c.backupRequest(instance, "POST", "/"+url.QueryEscape(backupID)+"/restore", requestID, "restore a backup of", &backup)
+	if err != nil {
+		return nil, err
+	}
+	if backup.ID == "" {
+		backup.ID = backupID
+	}
+	return &backup, nil
+}
+
+// CancelRestore asks the service API to cancel a pending restore. The api
+// should be prepared to receive the request, like below:
+// DELETE /resources/<name>/backups/<backup-id>/restore
+func (c *Client) CancelRestore(instance *ServiceInstance, backupID, requestID string) error {
+	return c.backupRequest(instance, "DELETE", "/"+url.QueryEscape(backupID)+"/restore", requestID, "cancel the restore of", nil)
+}
+
+func (c *Client) backupRequest(instance *ServiceInstance, method, path, requestID, action string, result interface{}) error {
+	params := map[string][]string{
+		"requestID": {requestID},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.GetIdentifier()+"/backups"+path, method, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+		if result == nil {
+			return nil
+		}
+		return c.jsonFromResponse(resp, result)
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		if path == "" {
+			return ErrBackupNotSupported
+		}
+		return ErrBackupNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrBackupNotSupported
+	case http.StatusPreconditionFailed:
+		return ErrInstanceNotReady
+	}
+	msg := fmt.Sprintf(`Failed to %s the instance "%s/%s": %s`, action, instance.ServiceName, instance.Name, c.buildErrorMessage(err, resp))
+	log.Error(msg)
+	return errors.New(msg)
+}
+
 // Info returns the additional info about a service instance.
 // The api should be prepared to receive the request,
 // like below:
@@ -315,6 +542,21 @@ func (c *Client) Info(instance *ServiceInstance, requestID string) ([]map[string
 	return result, nil
 }
 
+// HealthCheck checks whether the service API is responding, calling the
+// plans endpoint. Any response other than a server error means the API is
+// up, services are not required to implement the plans endpoint.
+func (c *Client) HealthCheck() error {
+	resp, err := c.issueRequest("/resources/plans", "GET", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("service API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 // Plans returns the service plans.
 // The api should be prepared to receive the request,
 // like below:
@@ -343,7 +585,14 @@ func (c *Client) Plans(requestID string) ([]Plan, error) {
 // Proxy is a proxy between tsuru and the service.
 // This method allow customized service methods.
 func (c *Client) Proxy(path string, w http.ResponseWriter, r *http.Request) error {
-	rawurl := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(path, "/")
+	target, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	rawurl := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(target.EscapedPath(), "/")
+	if target.RawQuery != "" {
+		rawurl += "?" + target.RawQuery
+	}
 	url, err := url.Parse(rawurl)
 	if err != nil {
 		log.Errorf("Got error while creating service proxy url %s: %s", rawurl, err)
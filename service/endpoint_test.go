@@ -17,6 +17,7 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 )
 
@@ -104,6 +105,27 @@ func (s *S) TestEndpointCreateEndpointDown(c *check.C) {
 	c.Assert(err, check.ErrorMatches, `Failed to create the instance my-redis: Post http://127.0.0.1:19999/resources: dial tcp 127.0.0.1:19999: getsockopt: connection refused`)
 }
 
+func (s *S) TestEndpointCreateTracing(c *check.C) {
+	var buf bytes.Buffer
+	tracing.SetExporter(tracing.NewWriterExporter(&buf))
+	defer tracing.SetExporter(nil)
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	span := tracing.StartSpan("POST /services/instances", tracing.SpanContext{})
+	defer tracing.BindRequest("request-1", span)()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis", TeamOwner: "theteam"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Create(&instance, "my@user", "request-1")
+	c.Assert(err, check.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	received := tracing.Extract(h.request.Header)
+	c.Assert(received.TraceID, check.Equals, span.Context().TraceID)
+	c.Assert(received.SpanID, check.Not(check.Equals), span.Context().SpanID)
+	c.Assert(buf.String(), check.Matches, `.*"operation":"POST 127.0.0.1:\d+".*"component":"service".*\n`)
+}
+
 func (s *S) TestEndpointCreatePlans(c *check.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
@@ -173,6 +195,53 @@ func (s *S) TestCreateDuplicate(c *check.C) {
 	c.Assert(err, check.Equals, ErrInstanceAlreadyExistsInAPI)
 }
 
+func (s *S) TestCreatePending(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Create(&instance, "my@user", "")
+	c.Assert(err, check.Equals, ErrInstancePending)
+}
+
+func (s *S) TestEndpointUpdate(c *check.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{
+		Name:        "my-redis",
+		ServiceName: "redis",
+		TeamOwner:   "theteam",
+		PlanName:    "big",
+		Parameters:  map[string]string{"maxmemory": "1gb"},
+	}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Update(&instance, "small", "")
+	c.Assert(err, check.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.url, check.Equals, "/resources/my-redis")
+	c.Assert(h.method, check.Equals, "PUT")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	c.Assert(map[string][]string(v), check.DeepEquals, map[string][]string{
+		"plan":                 {"big"},
+		"team":                 {"theteam"},
+		"parameters.maxmemory": {"1gb"},
+	})
+}
+
+func (s *S) TestEndpointUpdateFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis", PlanName: "big"}
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.Update(&instance, "small", "")
+	c.Assert(err, check.ErrorMatches, "^Failed to update the instance my-redis: Server failed to do its job.$")
+}
+
 func (s *S) TestCreateShouldReturnErrorIfTheRequestFail(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
@@ -222,7 +291,7 @@ func (s *S) TestBindAppEndpointDown(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: "http://localhost:1234", username: "user", password: "abcde"}
-	_, err := client.BindApp(&instance, a)
+	_, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.ErrorMatches, ".* api is down.")
 }
@@ -234,7 +303,7 @@ func (s *S) TestBindAppShouldSendAPOSTToTheResourceURL(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	_, err := client.BindApp(&instance, a)
+	_, err := client.BindApp(&instance, a, "")
 	h.Lock()
 	defer h.Unlock()
 	c.Assert(err, check.IsNil)
@@ -267,7 +336,7 @@ func (s *S) TestBindAppBackwardCompatible(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	env, err := client.BindApp(&instance, a)
+	env, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(env, check.DeepEquals, expected)
 	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(2))
@@ -285,7 +354,7 @@ func (s *S) TestBindAppShouldReturnMapWithTheEnvironmentVariable(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	env, err := client.BindApp(&instance, a)
+	env, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(env, check.DeepEquals, expected)
 }
@@ -296,7 +365,7 @@ func (s *S) TestBindAppShouldReturnErrorIfTheRequestFail(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	_, err := client.BindApp(&instance, a)
+	_, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.NotNil)
 	c.Assert(err, check.ErrorMatches, `^Failed to bind the instance "redis/her-redis" to the app "her-app": Server failed to do its job.$`)
 }
@@ -310,7 +379,7 @@ func (s *S) TestBindAppInstanceNotReady(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	_, err := client.BindApp(&instance, a)
+	_, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.Equals, ErrInstanceNotReady)
 }
 
@@ -323,7 +392,7 @@ func (s *S) TestBindAppInstanceNotFound(c *check.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := provisiontest.NewFakeApp("her-app", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	_, err := client.BindApp(&instance, a)
+	_, err := client.BindApp(&instance, a, "")
 	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
 }
 
@@ -402,7 +471,7 @@ func (s *S) TestUnbindApp(c *check.C) {
 	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
 	a := provisiontest.NewFakeApp("arch-enemy", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	err := client.UnbindApp(&instance, a)
+	err := client.UnbindApp(&instance, a, "")
 	h.Lock()
 	defer h.Unlock()
 	c.Assert(err, check.IsNil)
@@ -421,7 +490,7 @@ func (s *S) TestUnbindAppRequestFailure(c *check.C) {
 	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
 	a := provisiontest.NewFakeApp("arch-enemy", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	err := client.UnbindApp(&instance, a)
+	err := client.UnbindApp(&instance, a, "")
 	c.Assert(err, check.NotNil)
 	expected := `Failed to unbind ("/resources/heaven-can-wait/bind-app"): Server failed to do its job.`
 	c.Assert(err.Error(), check.Equals, expected)
@@ -435,10 +504,108 @@ func (s *S) TestUnbindAppInstanceNotFound(c *check.C) {
 	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
 	a := provisiontest.NewFakeApp("arch-enemy", "python", 1)
 	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
-	err := client.UnbindApp(&instance, a)
+	err := client.UnbindApp(&instance, a, "")
 	c.Assert(err, check.Equals, ErrInstanceNotFoundInAPI)
 }
 
+func (s *S) TestRotateApp(c *check.C) {
+	var h TestHandler
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	envs, err := client.RotateApp(&instance, a, "")
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, map[string]string{
+		"MYSQL_DATABASE_NAME": "CHICO",
+		"MYSQL_HOST":          "localhost",
+		"MYSQL_PORT":          "3306",
+	})
+	c.Assert(h.url, check.Equals, "/resources/her-redis/bind-app/credentials")
+	c.Assert(h.method, check.Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	expected := map[string][]string{"app-host": {a.GetIp()}, "app-name": {"her-app"}}
+	c.Assert(map[string][]string(v), check.DeepEquals, expected)
+}
+
+func (s *S) TestRotateAppNotSupported(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	_, err := client.RotateApp(&instance, a, "")
+	c.Assert(err, check.Equals, ErrRotationNotSupported)
+}
+
+func (s *S) TestRotateAppRequestFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	_, err := client.RotateApp(&instance, a, "")
+	c.Assert(err, check.NotNil)
+	expected := `Failed to rotate credentials of the app "her-app" in the instance "redis/her-redis": Server failed to do its job.`
+	c.Assert(err.Error(), check.Equals, expected)
+}
+
+func (s *S) TestRevokeApp(c *check.C) {
+	var h TestHandler
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.RevokeApp(&instance, a, "")
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(h.url, check.Equals, "/resources/her-redis/bind-app/credentials")
+	c.Assert(h.method, check.Equals, "DELETE")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	expected := map[string][]string{"app-host": {a.GetIp()}, "app-name": {"her-app"}}
+	c.Assert(map[string][]string(v), check.DeepEquals, expected)
+}
+
+func (s *S) TestRevokeAppRequestFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.RevokeApp(&instance, a, "")
+	c.Assert(err, check.NotNil)
+	expected := `Failed to revoke credentials ("/resources/her-redis/bind-app/credentials"): Server failed to do its job.`
+	c.Assert(err.Error(), check.Equals, expected)
+}
+
+func (s *S) TestDiscardAppRotation(c *check.C) {
+	var h TestHandler
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := provisiontest.NewFakeApp("her-app", "python", 1)
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	err := client.DiscardAppRotation(&instance, a, "")
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(h.url, check.Equals, "/resources/her-redis/bind-app/credentials/new")
+	c.Assert(h.method, check.Equals, "DELETE")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, check.IsNil)
+	expected := map[string][]string{"app-host": {a.GetIp()}, "app-name": {"her-app"}}
+	c.Assert(map[string][]string(v), check.DeepEquals, expected)
+}
+
 func (s *S) TestUnbindUnit(c *check.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
@@ -603,6 +770,24 @@ func (s *S) TestEndpointProxy(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
 }
 
+func (s *S) TestEndpointProxyWithQueryString(c *check.C) {
+	var proxiedURL string
+	handlerTest := func(w http.ResponseWriter, r *http.Request) {
+		proxiedURL = r.URL.RequestURI()
+		w.WriteHeader(http.StatusNoContent)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handlerTest))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	request, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = client.Proxy("/backup/my%20db?full=true", recorder, request)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	c.Assert(proxiedURL, check.Equals, "/backup/my%20db?full=true")
+}
+
 func (s *S) TestProxyWithBodyAndHeaders(c *check.C) {
 	var proxiedRequest *http.Request
 	var readBodyStr []byte
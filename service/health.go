@@ -0,0 +1,391 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// HealthStatusUp is the health status of services and instances working
+	// as expected.
+	HealthStatusUp = "up"
+	// HealthStatusDown is the health status of services not responding and
+	// of instances reported as down by the service.
+	HealthStatusDown = "down"
+	// HealthStatusPending is the health status of instances the service is
+	// still working on.
+	HealthStatusPending = "pending"
+
+	serviceDownKind         = "service-down"
+	serviceUpKind           = "service-up"
+	serviceInstanceDownKind = "service-instance-down"
+	serviceInstanceUpKind   = "service-instance-up"
+
+	defaultHealthCheckInterval = time.Minute
+	defaultHealthHistoryLimit  = 100
+)
+
+var healthMonitorEnabled bool
+
+func init() {
+	hc.AddChecker("Services", healthCheck)
+}
+
+// HealthEntry is an entry in the status history of a service, or of one of
+// its instances. Entries are only recorded when the status changes.
+type HealthEntry struct {
+	ServiceName  string    `bson:"service_name" json:"service"`
+	InstanceName string    `bson:"instance_name,omitempty" json:"instance,omitempty"`
+	Status       string    `json:"status"`
+	Error        string    `bson:",omitempty" json:"error,omitempty"`
+	Date         time.Time `json:"date"`
+}
+
+func healthHistoryCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.Collection("service_status_history")
+	coll.EnsureIndex(mgo.Index{Key: []string{"service_name", "instance_name", "-date"}})
+	return coll, nil
+}
+
+func addHealthEntry(entry HealthEntry) error {
+	coll, err := healthHistoryCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Insert(entry)
+}
+
+// HealthHistory returns the most recent status changes of a service, or of
+// one of its instances when instanceName is not empty.
+func HealthHistory(serviceName, instanceName string, limit int) ([]HealthEntry, error) {
+	if limit <= 0 {
+		limit = defaultHealthHistoryLimit
+	}
+	coll, err := healthHistoryCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	query := bson.M{"service_name": serviceName}
+	if instanceName == "" {
+		query["instance_name"] = bson.M{"$exists": false}
+	} else {
+		query["instance_name"] = instanceName
+	}
+	var entries []HealthEntry
+	err = coll.Find(query).Sort("-date").Limit(limit).All(&entries)
+	return entries, err
+}
+
+// instanceHealthStatus translates the result of the status call to a service
+// API into a health status. An empty status means the service does not
+// report the status of its instances.
+func instanceHealthStatus(status string, err error) string {
+	if err != nil {
+		return HealthStatusDown
+	}
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case HealthStatusDown:
+		return HealthStatusDown
+	case HealthStatusPending:
+		return HealthStatusPending
+	case "not implemented for this service":
+		return ""
+	}
+	return HealthStatusUp
+}
+
+// checkServicesHealth checks the health of every service, and of its
+// instances, not checked in the last interval. Each service is claimed
+// before being checked, so multiple API instances don't check the same
+// service twice.
+func checkServicesHealth(now time.Time, interval time.Duration) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var services []Service
+	err = conn.Services().Find(bson.M{"$or": []bson.M{
+		{"health_checked_at": bson.M{"$exists": false}},
+		{"health_checked_at": bson.M{"$lte": now.Add(-interval * 9 / 10)}},
+	}}).All(&services)
+	if err != nil {
+		return err
+	}
+	for i := range services {
+		s := &services[i]
+		query := bson.M{"_id": s.Name, "health_checked_at": s.HealthCheckedAt}
+		if s.HealthCheckedAt.IsZero() {
+			query["health_checked_at"] = bson.M{"$exists": false}
+		}
+		err = conn.Services().Update(query, bson.M{"$set": bson.M{"health_checked_at": now}})
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Errorf("[service health] unable to claim service %s: %s", s.Name, err)
+			continue
+		}
+		err = checkServiceHealth(s, now)
+		if err != nil {
+			log.Errorf("[service health] unable to check service %s: %s", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkServiceHealth(s *Service, now time.Time) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	endpoint, err := s.endpointClient("production")
+	if err == nil {
+		err = endpoint.HealthCheck()
+	}
+	status := HealthStatusUp
+	var reason string
+	if err != nil {
+		status = HealthStatusDown
+		reason = err.Error()
+	}
+	update := bson.M{"$set": bson.M{"health_status": status}}
+	if reason == "" {
+		update["$unset"] = bson.M{"health_error": ""}
+	} else {
+		update["$set"].(bson.M)["health_error"] = reason
+	}
+	err = conn.Services().Update(bson.M{"_id": s.Name}, update)
+	if err != nil {
+		return err
+	}
+	if status != s.HealthStatus {
+		err = addHealthEntry(HealthEntry{ServiceName: s.Name, Status: status, Error: reason, Date: now})
+		if err != nil {
+			log.Errorf("[service health] unable to store status of service %s: %s", s.Name, err)
+		}
+		contexts := append(permission.Contexts(permission.CtxTeam, s.OwnerTeams),
+			permission.Context(permission.CtxService, s.Name),
+		)
+		notifyHealthChange(
+			event.Target{Type: event.TargetTypeService, Value: s.Name},
+			event.Allowed(permission.PermServiceReadEvents, contexts...),
+			serviceUpKind, serviceDownKind, s.HealthStatus, status, reason,
+		)
+	}
+	if status == HealthStatusDown {
+		// The status of the instances can't be known while the service API
+		// is down, they keep their last known status.
+		return nil
+	}
+	var instances []ServiceInstance
+	err = conn.ServiceInstances().Find(bson.M{"service_name": s.Name}).All(&instances)
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		si := &instances[i]
+		if !si.IsReady() {
+			continue
+		}
+		result, err := endpoint.Status(si, "")
+		instanceStatus := instanceHealthStatus(result, err)
+		if instanceStatus == "" {
+			continue
+		}
+		var instanceReason string
+		if err != nil {
+			instanceReason = err.Error()
+		}
+		err = si.update(bson.M{"$set": bson.M{"health_status": instanceStatus, "health_checked_at": now}})
+		if err != nil {
+			log.Errorf("[service health] unable to store status of %s/%s: %s", si.ServiceName, si.Name, err)
+			continue
+		}
+		if instanceStatus == si.HealthStatus {
+			continue
+		}
+		err = addHealthEntry(HealthEntry{
+			ServiceName:  si.ServiceName,
+			InstanceName: si.Name,
+			Status:       instanceStatus,
+			Error:        instanceReason,
+			Date:         now,
+		})
+		if err != nil {
+			log.Errorf("[service health] unable to store status of %s/%s: %s", si.ServiceName, si.Name, err)
+		}
+		contexts := append(permission.Contexts(permission.CtxTeam, si.Teams),
+			permission.Context(permission.CtxServiceInstance, si.ServiceName+"/"+si.Name),
+		)
+		notifyHealthChange(
+			event.Target{Type: event.TargetTypeServiceInstance, Value: si.ServiceName + "/" + si.Name},
+			event.Allowed(permission.PermServiceInstanceReadEvents, contexts...),
+			serviceInstanceUpKind, serviceInstanceDownKind, si.HealthStatus, instanceStatus, instanceReason,
+		)
+	}
+	return nil
+}
+
+// notifyHealthChange records an event when the status changes from up to down,
+// or back from down to up. Events for services going down finish with an
+// error, allowing webhooks to filter them.
+func notifyHealthChange(target event.Target, allowed event.AllowedPermission, upKind, downKind, previous, current, reason string) {
+	var kind string
+	var evtErr error
+	switch {
+	case previous == HealthStatusUp && current == HealthStatusDown:
+		kind = downKind
+		evtErr = errors.New("status changed from up to down")
+		if reason != "" {
+			evtErr = fmt.Errorf("%s: %s", evtErr, reason)
+		}
+	case previous == HealthStatusDown && current == HealthStatusUp:
+		kind = upKind
+	default:
+		return
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: kind,
+		Allowed:      allowed,
+		CustomData:   map[string]string{"previous": previous, "current": current},
+	})
+	if err != nil {
+		log.Errorf("[service health] unable to create event for %s %s: %s", target.Type, target.Value, err)
+		return
+	}
+	err = evt.Done(evtErr)
+	if err != nil {
+		log.Errorf("[service health] unable to finish event for %s %s: %s", target.Type, target.Value, err)
+	}
+}
+
+// healthCheck reports the services whose API, or any of its instances, were
+// found down by the health monitor. Degraded services are reported as a
+// warning, so third party services being down don't make the healthcheck of
+// tsuru fail.
+func healthCheck() error {
+	if !healthMonitorEnabled {
+		return hc.ErrDisabledComponent
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var services []Service
+	err = conn.Services().Find(bson.M{"health_status": HealthStatusDown}).Select(bson.M{"_id": 1}).All(&services)
+	if err != nil {
+		return err
+	}
+	degraded := map[string]string{}
+	for _, s := range services {
+		degraded[s.Name] = "API down"
+	}
+	pipe := conn.ServiceInstances().Pipe([]bson.M{
+		{"$match": bson.M{"health_status": HealthStatusDown}},
+		{"$group": bson.M{"_id": "$service_name", "count": bson.M{"$sum": 1}}},
+	})
+	var counts []struct {
+		Service string `bson:"_id"`
+		Count   int
+	}
+	err = pipe.All(&counts)
+	if err != nil {
+		return err
+	}
+	for _, c := range counts {
+		if _, ok := degraded[c.Service]; !ok {
+			degraded[c.Service] = fmt.Sprintf("%d instance(s) down", c.Count)
+		}
+	}
+	if len(degraded) == 0 {
+		return nil
+	}
+	var msgs []string
+	for name, reason := range degraded {
+		msgs = append(msgs, fmt.Sprintf("%s (%s)", name, reason))
+	}
+	sort.Strings(msgs)
+	return &hc.Warning{Message: "degraded services: " + strings.Join(msgs, ", ")}
+}
+
+type healthMonitor struct {
+	interval time.Duration
+	doneCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func (m *healthMonitor) start() {
+	m.doneCh = make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			err := checkServicesHealth(time.Now().UTC(), m.interval)
+			if err != nil {
+				log.Errorf("[service health] %s", err)
+			}
+			select {
+			case <-m.doneCh:
+				return
+			case <-time.After(m.interval):
+			}
+		}
+	}()
+}
+
+func (m *healthMonitor) Shutdown() {
+	close(m.doneCh)
+	m.wg.Wait()
+}
+
+func (m *healthMonitor) String() string {
+	return "service health monitor"
+}
+
+// InitializeHealthMonitor starts polling the health of service APIs and the
+// status of their instances. The config entry services:health:interval sets
+// the interval, in seconds, between checks, and services:health:disabled
+// disables the monitor.
+func InitializeHealthMonitor() error {
+	if disabled, _ := config.GetBool("services:health:disabled"); disabled {
+		return nil
+	}
+	interval := defaultHealthCheckInterval
+	if seconds, err := config.GetInt("services:health:interval"); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	m := &healthMonitor{interval: interval}
+	m.start()
+	shutdown.Register(m)
+	healthMonitorEnabled = true
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/hc"
+	"gopkg.in/check.v1"
+)
+
+type fakeHealthAPI struct {
+	sync.Mutex
+	apiCode    int
+	statusCode int
+}
+
+func (f *fakeHealthAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if strings.HasSuffix(r.URL.Path, "/status") {
+		w.WriteHeader(f.statusCode)
+		return
+	}
+	w.WriteHeader(f.apiCode)
+}
+
+func (f *fakeHealthAPI) set(apiCode, statusCode int) {
+	f.Lock()
+	defer f.Unlock()
+	f.apiCode = apiCode
+	f.statusCode = statusCode
+}
+
+func (s *S) TestInstanceHealthStatus(c *check.C) {
+	c.Assert(instanceHealthStatus("up", nil), check.Equals, HealthStatusUp)
+	c.Assert(instanceHealthStatus("everything is fine", nil), check.Equals, HealthStatusUp)
+	c.Assert(instanceHealthStatus("down", nil), check.Equals, HealthStatusDown)
+	c.Assert(instanceHealthStatus("pending", nil), check.Equals, HealthStatusPending)
+	c.Assert(instanceHealthStatus("not implemented for this service", nil), check.Equals, "")
+	c.Assert(instanceHealthStatus("", errors.New("connection refused")), check.Equals, HealthStatusDown)
+}
+
+func (s *S) TestClientHealthCheck(c *check.C) {
+	api := fakeHealthAPI{apiCode: http.StatusNotFound}
+	ts := httptest.NewServer(&api)
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "user", password: "abcde"}
+	c.Assert(client.HealthCheck(), check.IsNil)
+	api.set(http.StatusServiceUnavailable, 0)
+	c.Assert(client.HealthCheck(), check.ErrorMatches, "service API returned status 503")
+}
+
+func (s *InstanceSuite) TestCheckServicesHealth(c *check.C) {
+	api := fakeHealthAPI{apiCode: http.StatusOK, statusCode: http.StatusNoContent}
+	ts := httptest.NewServer(&api)
+	defer ts.Close()
+	srv := Service{Name: "db", Endpoint: map[string]string{"production": ts.URL}, OwnerTeams: []string{s.team.Name}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "my-db", ServiceName: "db", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = checkServicesHealth(now, time.Minute)
+	c.Assert(err, check.IsNil)
+	err = srv.Get()
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.HealthStatus, check.Equals, HealthStatusUp)
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.HealthStatus, check.Equals, HealthStatusUp)
+	api.set(http.StatusOK, http.StatusInternalServerError)
+	err = checkServicesHealth(now.Add(30*time.Second), time.Minute)
+	c.Assert(err, check.IsNil)
+	dbInstance, err = GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.HealthStatus, check.Equals, HealthStatusUp)
+	now = now.Add(time.Minute)
+	err = checkServicesHealth(now, time.Minute)
+	c.Assert(err, check.IsNil)
+	dbInstance, err = GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.HealthStatus, check.Equals, HealthStatusDown)
+	history, err := HealthHistory("db", "my-db", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 2)
+	c.Assert(history[0].Status, check.Equals, HealthStatusDown)
+	c.Assert(history[1].Status, check.Equals, HealthStatusUp)
+	evts, err := event.List(&event.Filter{KindName: serviceInstanceDownKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target.Value, check.Equals, "db/my-db")
+	c.Assert(evts[0].Error, check.Equals, "status changed from up to down")
+	healthMonitorEnabled = true
+	defer func() { healthMonitorEnabled = false }()
+	c.Assert(healthCheck(), check.DeepEquals, &hc.Warning{Message: "degraded services: db (1 instance(s) down)"})
+}
+
+func (s *InstanceSuite) TestCheckServicesHealthServiceDown(c *check.C) {
+	api := fakeHealthAPI{apiCode: http.StatusOK, statusCode: http.StatusNoContent}
+	ts := httptest.NewServer(&api)
+	defer ts.Close()
+	srv := Service{Name: "db", Endpoint: map[string]string{"production": ts.URL}, OwnerTeams: []string{s.team.Name}}
+	err := srv.Create()
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "my-db", ServiceName: "db", Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = checkServicesHealth(now, time.Minute)
+	c.Assert(err, check.IsNil)
+	api.set(http.StatusInternalServerError, http.StatusInternalServerError)
+	now = now.Add(time.Minute)
+	err = checkServicesHealth(now, time.Minute)
+	c.Assert(err, check.IsNil)
+	err = srv.Get()
+	c.Assert(err, check.IsNil)
+	c.Assert(srv.HealthStatus, check.Equals, HealthStatusDown)
+	c.Assert(srv.HealthError, check.Equals, "service API returned status 500")
+	dbInstance, err := GetServiceInstance("db", "my-db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.HealthStatus, check.Equals, HealthStatusUp)
+	evts, err := event.List(&event.Filter{KindName: serviceDownKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target.Value, check.Equals, "db")
+	api.set(http.StatusOK, http.StatusNoContent)
+	err = checkServicesHealth(now.Add(time.Minute), time.Minute)
+	c.Assert(err, check.IsNil)
+	evts, err = event.List(&event.Filter{KindName: serviceUpKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	history, err := HealthHistory("db", "", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(history, check.HasLen, 3)
+}
+
+func (s *InstanceSuite) TestHealthCheckDisabled(c *check.C) {
+	c.Assert(healthCheck(), check.Equals, hc.ErrDisabledComponent)
+}
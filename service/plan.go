@@ -4,26 +4,178 @@
 
 package service
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultPlansCacheTTL = 5 * time.Minute
+
 // Plan represents a service plan
 type Plan struct {
 	Name        string
 	Description string
+	Schema      *ParametersSchema `json:",omitempty"`
+	Price       *PlanPrice        `json:",omitempty"`
+	// Limits describes the resources available to instances of the plan,
+	// e.g. {"storage": "10GB", "connections": "100"}.
+	Limits map[string]string `json:",omitempty"`
+}
+
+// PlanPrice is the cost of a plan, in the given currency, for each unit of
+// usage, e.g. 10 USD per month.
+type PlanPrice struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+}
+
+// Matches reports whether the search term is part of the name, the
+// description or the limits of the plan, ignoring case.
+func (p *Plan) Matches(search string) bool {
+	search = strings.ToLower(search)
+	fields := []string{p.Name, p.Description}
+	for name, value := range p.Limits {
+		fields = append(fields, name, value)
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParametersSchema describes the provisioning parameters accepted by a plan.
+// It's a subset of JSON Schema, supporting only flat objects.
+type ParametersSchema struct {
+	Properties           map[string]ParameterSchema `json:"properties,omitempty"`
+	Required             []string                   `json:"required,omitempty"`
+	AdditionalProperties *bool                      `json:"additionalProperties,omitempty"`
+}
+
+type ParameterSchema struct {
+	Type        string        `json:"type,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// Validate checks the parameters against the schema, returning a
+// *errors.ValidationError describing the first invalid parameter.
+func (s *ParametersSchema) Validate(params map[string]string) error {
+	if s == nil {
+		return nil
+	}
+	for _, name := range s.Required {
+		if _, ok := params[name]; !ok {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("parameter %q is required", name)}
+		}
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				return &tsuruErrors.ValidationError{Message: fmt.Sprintf("parameter %q is not supported by the plan", name)}
+			}
+			continue
+		}
+		err := prop.validate(params[name])
+		if err != nil {
+			return &tsuruErrors.ValidationError{Message: fmt.Sprintf("invalid value for parameter %q: %s", name, err)}
+		}
+	}
+	return nil
 }
 
+func (p *ParameterSchema) validate(value string) error {
+	var err error
+	switch p.Type {
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("must be of type %s", p.Type)
+	}
+	if len(p.Enum) == 0 {
+		return nil
+	}
+	options := make([]string, len(p.Enum))
+	for i, opt := range p.Enum {
+		options[i] = fmt.Sprint(opt)
+		if options[i] == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+}
+
+func plansCacheTTL() time.Duration {
+	if seconds, err := config.GetInt("services:plans:cache-ttl"); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultPlansCacheTTL
+}
+
+// GetPlansByServiceName returns the plans of the service, from the cache when
+// it's still fresh.
 func GetPlansByServiceName(serviceName, requestID string) ([]Plan, error) {
 	s := Service{Name: serviceName}
 	err := s.Get()
 	if err != nil {
 		return nil, err
 	}
-	endpoint, err := s.getClient("production")
+	if !s.PlansUpdatedAt.IsZero() && time.Since(s.PlansUpdatedAt) < plansCacheTTL() {
+		return s.Plans, nil
+	}
+	return s.RefreshPlans(requestID)
+}
+
+// RefreshPlans fetches the plans from the service API and stores them in the
+// cache. The cached plans are returned when the service API fails.
+func (s *Service) RefreshPlans(requestID string) ([]Plan, error) {
+	endpoint, err := s.endpointClient("production")
 	if err != nil {
 		return []Plan{}, nil
 	}
 	plans, err := endpoint.Plans(requestID)
+	if err != nil {
+		if s.PlansUpdatedAt.IsZero() {
+			return nil, err
+		}
+		log.Errorf("[service plans] unable to refresh plans of %s, using cached plans: %s", s.Name, err)
+		return s.Plans, nil
+	}
+	now := time.Now().UTC()
+	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
+	err = conn.Services().Update(bson.M{"_id": s.Name}, bson.M{"$set": bson.M{"plans": plans, "plans_updated_at": now}})
+	if err != nil {
+		log.Errorf("[service plans] unable to cache plans of %s: %s", s.Name, err)
+	} else {
+		s.Plans = plans
+		s.PlansUpdatedAt = now
+	}
 	return plans, nil
 }
 
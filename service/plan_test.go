@@ -5,10 +5,15 @@
 package service
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
+	"time"
 
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func (s *S) TestPlan(c *check.C) {
@@ -39,6 +44,66 @@ func (s *S) TestGetPlansByServiceName(c *check.C) {
 	c.Assert(plans, check.DeepEquals, expected)
 }
 
+func (s *S) TestGetPlansByServiceNameCached(c *check.C) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		content := `[{"name": "ignite", "description": "some value", "price": {"amount": 10, "currency": "USD", "unit": "month"}, "limits": {"storage": "10GB"}}]`
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srvc)
+	c.Assert(err, check.IsNil)
+	defer s.conn.Services().RemoveId(srvc.Name)
+	expected := []Plan{{
+		Name:        "ignite",
+		Description: "some value",
+		Price:       &PlanPrice{Amount: 10, Currency: "USD", Unit: "month"},
+		Limits:      map[string]string{"storage": "10GB"},
+	}}
+	plans, err := GetPlansByServiceName("mysql", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, expected)
+	plans, err = GetPlansByServiceName("mysql", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, expected)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(1))
+	err = s.conn.Services().UpdateId(srvc.Name, bson.M{"$set": bson.M{"plans_updated_at": time.Now().Add(-time.Hour)}})
+	c.Assert(err, check.IsNil)
+	plans, err = GetPlansByServiceName("mysql", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, expected)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(2))
+}
+
+func (s *S) TestRefreshPlansUsesCacheOnFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer ts.Close()
+	srvc := Service{
+		Name:           "mysql",
+		Endpoint:       map[string]string{"production": ts.URL},
+		Plans:          []Plan{{Name: "cached"}},
+		PlansUpdatedAt: time.Now().Add(-time.Hour),
+	}
+	plans, err := srvc.RefreshPlans("")
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []Plan{{Name: "cached"}})
+	srvc.PlansUpdatedAt = time.Time{}
+	_, err = srvc.RefreshPlans("")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestPlanMatches(c *check.C) {
+	plan := Plan{Name: "small", Description: "Small database", Limits: map[string]string{"storage": "10GB"}}
+	c.Assert(plan.Matches("SMALL"), check.Equals, true)
+	c.Assert(plan.Matches("database"), check.Equals, true)
+	c.Assert(plan.Matches("10gb"), check.Equals, true)
+	c.Assert(plan.Matches("big"), check.Equals, false)
+}
+
 func (s *S) TestGetPlanByServiceNameAndPlanName(c *check.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		content := `[{"name": "ignite", "description": "some value"}, {"name": "small", "description": "not space left for you"}]`
@@ -68,3 +133,46 @@ func (s *S) TestGetPlansByServiceNameWithoutEndpoint(c *check.C) {
 	expected := []Plan{}
 	c.Assert(plans, check.DeepEquals, expected)
 }
+
+func (s *S) TestParametersSchemaValidate(c *check.C) {
+	var schema ParametersSchema
+	err := json.Unmarshal([]byte(`{
+		"properties": {
+			"size": {"type": "integer"},
+			"ratio": {"type": "number"},
+			"ssl": {"type": "boolean"},
+			"engine": {"type": "string", "enum": ["innodb", "myisam"]}
+		},
+		"required": ["size"],
+		"additionalProperties": false
+	}`), &schema)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		params map[string]string
+		err    string
+	}{
+		{map[string]string{"size": "10", "ratio": "0.5", "ssl": "true", "engine": "innodb"}, ""},
+		{map[string]string{"engine": "innodb"}, `parameter "size" is required`},
+		{map[string]string{"size": "ten"}, `invalid value for parameter "size": must be of type integer`},
+		{map[string]string{"size": "1", "ratio": "half"}, `invalid value for parameter "ratio": must be of type number`},
+		{map[string]string{"size": "1", "ssl": "maybe"}, `invalid value for parameter "ssl": must be of type boolean`},
+		{map[string]string{"size": "1", "engine": "csv"}, `invalid value for parameter "engine": must be one of innodb, myisam`},
+		{map[string]string{"size": "1", "other": "x"}, `parameter "other" is not supported by the plan`},
+	}
+	for i, tt := range tests {
+		err = schema.Validate(tt.params)
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+			continue
+		}
+		c.Check(err, check.FitsTypeOf, &tsuruErrors.ValidationError{}, check.Commentf("test %d", i))
+		c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestParametersSchemaValidateNil(c *check.C) {
+	var schema *ParametersSchema
+	c.Assert(schema.Validate(map[string]string{"any": "value"}), check.IsNil)
+	schema = &ParametersSchema{}
+	c.Assert(schema.Validate(map[string]string{"any": "value"}), check.IsNil)
+}
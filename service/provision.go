@@ -0,0 +1,151 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const provisionTaskName = "service-instance-provision"
+
+var (
+	// ProvisionPollInterval is the interval between calls to the status of
+	// instances being provisioned.
+	ProvisionPollInterval = 10 * time.Second
+	// ProvisionTimeout is the maximum time waiting for an instance to be
+	// provisioned, after it the instance is marked as failed.
+	ProvisionTimeout = time.Hour
+)
+
+// RegisterTasks registers the queue tasks used by the service package.
+func RegisterTasks() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	return q.RegisterTask(&provisionTask{})
+}
+
+// WatchProvisioning enqueues a task polling the status of an instance still
+// being provisioned by the service. The task finishes the event with the
+// given id, which must have been detached, once the instance is ready or the
+// provisioning fails.
+func WatchProvisioning(si *ServiceInstance, eventID bson.ObjectId, requestID string) error {
+	return queue.EnqueueAfter(provisionTaskName, monsterqueue.JobParams{
+		"service":   si.ServiceName,
+		"instance":  si.Name,
+		"eventID":   eventID.Hex(),
+		"requestID": requestID,
+		"deadline":  time.Now().Add(ProvisionTimeout).Unix(),
+	}, ProvisionPollInterval)
+}
+
+type provisionTask struct{}
+
+func (t *provisionTask) Name() string {
+	return provisionTaskName
+}
+
+func (t *provisionTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	serviceName, _ := params["service"].(string)
+	instanceName, _ := params["instance"].(string)
+	rawEventID, _ := params["eventID"].(string)
+	requestID, _ := params["requestID"].(string)
+	if serviceName == "" || instanceName == "" || !bson.IsObjectIdHex(rawEventID) {
+		job.Error(errors.New("invalid parameters, expected service, instance and eventID"))
+		return
+	}
+	var deadline time.Time
+	switch v := params["deadline"].(type) {
+	case int:
+		deadline = time.Unix(int64(v), 0)
+	case int64:
+		deadline = time.Unix(v, 0)
+	case float64:
+		deadline = time.Unix(int64(v), 0)
+	default:
+		job.Error(errors.New("invalid parameters, expected deadline"))
+		return
+	}
+	eventID := bson.ObjectIdHex(rawEventID)
+	// Each job checks the instance once, the next check is enqueued as a new
+	// delayed job so pollings don't hold a queue worker and survive restarts.
+	done, err := checkProvisioning(serviceName, instanceName, eventID, requestID, deadline)
+	if done {
+		if err != nil {
+			job.Error(err)
+			return
+		}
+		job.Success(nil)
+		return
+	}
+	err = queue.EnqueueAfter(provisionTaskName, params, ProvisionPollInterval)
+	if err != nil {
+		log.Errorf("[service provision] unable to enqueue next check of instance %s/%s: %s", serviceName, instanceName, err)
+		job.Error(err)
+		return
+	}
+	job.Success(nil)
+}
+
+// checkProvisioning checks the status of a pending instance, updating its
+// state and finishing the event once the service is done provisioning it.
+func checkProvisioning(serviceName, instanceName string, eventID bson.ObjectId, requestID string, deadline time.Time) (bool, error) {
+	evt, err := event.GetByID(eventID)
+	if err != nil {
+		log.Errorf("[service provision] unable to find event for instance %s/%s: %s", serviceName, instanceName, err)
+	}
+	si, err := GetServiceInstance(serviceName, instanceName)
+	if err != nil {
+		if evt != nil && evt.Running {
+			evt.Done(err)
+		}
+		return true, err
+	}
+	if si.State != InstanceStatePending {
+		if evt != nil && evt.Running {
+			evt.Done(si.checkReady())
+		}
+		return true, nil
+	}
+	status, err := si.Status(requestID)
+	if err != nil {
+		log.Errorf("[service provision] unable to get status of instance %s/%s: %s", serviceName, instanceName, err)
+	}
+	var provisionErr error
+	switch {
+	case err != nil || status == "pending":
+		if time.Now().Before(deadline) {
+			if evt != nil {
+				evt.KeepAlive()
+			}
+			return false, nil
+		}
+		provisionErr = fmt.Errorf("timeout after %v waiting for the service to provision the instance", ProvisionTimeout)
+	case status == "down":
+		provisionErr = errors.New("the service reported the instance as down")
+	}
+	update := bson.M{"state": InstanceStateReady}
+	if provisionErr != nil {
+		update = bson.M{"state": InstanceStateFailed, "state_error": provisionErr.Error()}
+	}
+	err = si.update(bson.M{"$set": update})
+	if err != nil {
+		return false, err
+	}
+	if evt != nil && evt.Running {
+		evt.Done(provisionErr)
+	}
+	return true, provisionErr
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *InstanceSuite) newPendingInstance(c *check.C, statusCode int) (*ServiceInstance, *event.Event, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+	}))
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "db", ServiceName: "mysql", State: InstanceStatePending}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, check.IsNil)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeServiceInstance, Value: "mysql/db"},
+		InternalKind: "service-instance-provision-test",
+		Allowed:      event.Allowed(permission.PermServiceInstanceReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Detach()
+	c.Assert(err, check.IsNil)
+	return &si, evt, ts.Close
+}
+
+func (s *InstanceSuite) TestCheckProvisioningReady(c *check.C) {
+	_, evt, cleanup := s.newPendingInstance(c, http.StatusNoContent)
+	defer cleanup()
+	done, err := checkProvisioning("mysql", "db", evt.UniqueID, "", time.Now().Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(done, check.Equals, true)
+	si, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStateReady)
+	c.Assert(si.IsReady(), check.Equals, true)
+	dbEvt, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, false)
+	c.Assert(dbEvt.Error, check.Equals, "")
+}
+
+func (s *InstanceSuite) TestCheckProvisioningPending(c *check.C) {
+	_, evt, cleanup := s.newPendingInstance(c, http.StatusAccepted)
+	defer cleanup()
+	done, err := checkProvisioning("mysql", "db", evt.UniqueID, "", time.Now().Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(done, check.Equals, false)
+	si, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStatePending)
+	dbEvt, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, true)
+}
+
+func (s *InstanceSuite) TestCheckProvisioningTimeout(c *check.C) {
+	_, evt, cleanup := s.newPendingInstance(c, http.StatusAccepted)
+	defer cleanup()
+	done, err := checkProvisioning("mysql", "db", evt.UniqueID, "", time.Now().Add(-time.Second))
+	c.Assert(err, check.ErrorMatches, "timeout after .* waiting for the service to provision the instance")
+	c.Assert(done, check.Equals, true)
+	si, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStateFailed)
+	c.Assert(si.StateError, check.Matches, "timeout after .*")
+	dbEvt, err := event.GetByID(evt.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbEvt.Running, check.Equals, false)
+	c.Assert(dbEvt.Error, check.Matches, "timeout after .*")
+}
+
+func (s *InstanceSuite) TestCheckProvisioningDown(c *check.C) {
+	_, evt, cleanup := s.newPendingInstance(c, http.StatusInternalServerError)
+	defer cleanup()
+	done, err := checkProvisioning("mysql", "db", evt.UniqueID, "", time.Now().Add(time.Minute))
+	c.Assert(err, check.ErrorMatches, "the service reported the instance as down")
+	c.Assert(done, check.Equals, true)
+	si, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.State, check.Equals, InstanceStateFailed)
+	c.Assert(si.StateError, check.Equals, "the service reported the instance as down")
+}
+
+func (s *InstanceSuite) TestWatchProvisioningPollsInSeparateJobs(c *check.C) {
+	config.Set("queue:mongo-database", "tsuru_service_provision_queue_test")
+	config.Set("queue:mongo-polling-interval", 0.1)
+	defer config.Unset("queue:mongo-polling-interval")
+	queue.ResetQueue()
+	defer queue.ResetQueue()
+	defer func(interval time.Duration) { ProvisionPollInterval = interval }(ProvisionPollInterval)
+	ProvisionPollInterval = 0
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	si, evt, cleanup := s.newPendingInstance(c, http.StatusAccepted)
+	defer cleanup()
+	err := s.conn.Services().UpdateId("mysql", bson.M{"$set": bson.M{"endpoint.production": ts.URL}})
+	c.Assert(err, check.IsNil)
+	err = RegisterTasks()
+	c.Assert(err, check.IsNil)
+	err = WatchProvisioning(si, evt.UniqueID, "")
+	c.Assert(err, check.IsNil)
+	timeout := time.After(10 * time.Second)
+	for {
+		si, err = GetServiceInstance("mysql", "db")
+		c.Assert(err, check.IsNil)
+		if si.State != InstanceStatePending {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for instance to be provisioned")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	c.Assert(si.State, check.Equals, InstanceStateReady)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(3))
+}
+
+func (s *InstanceSuite) TestBindAppPendingInstance(c *check.C) {
+	si, evt, cleanup := s.newPendingInstance(c, http.StatusAccepted)
+	defer cleanup()
+	defer evt.Done(nil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	err := si.BindApp(a, false, nil, "")
+	c.Assert(err, check.Equals, ErrInstanceNotReady)
+	si.State = InstanceStateFailed
+	err = si.BindApp(a, false, nil, "")
+	c.Assert(err, check.Equals, ErrInstanceProvisionFailed)
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const proxyRuleAdmin = "admin"
+
+var (
+	ErrProxyPathNotAllowed  = errors.New("the path is not exposed by the service")
+	ErrInvalidProxyCallback = errors.New("invalid proxy callback, it must be a path without encoded slashes or dots")
+)
+
+// ProxyRule exposes paths of the service API through the service instance
+// proxy. Path is a pattern as accepted by path.Match, where {instance} is
+// replaced by the name of the instance being proxied. Rules with Admin set
+// are only available to the administrators of the service.
+type ProxyRule struct {
+	Methods []string `bson:",omitempty"`
+	Path    string
+	Admin   bool `bson:",omitempty"`
+}
+
+// ParseProxyRule parses a rule in the format "<methods> <path> [admin]",
+// where methods is a comma separated list of HTTP methods, or * for any
+// method, e.g. "GET,POST /resources/{instance}/stats".
+func ParseProxyRule(value string) (ProxyRule, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && fields[2] != proxyRuleAdmin) {
+		return ProxyRule{}, fmt.Errorf("invalid proxy rule %q, expected \"<methods> <path> [admin]\"", value)
+	}
+	rule := ProxyRule{Path: CleanProxyPath(fields[1]), Admin: len(fields) == 3}
+	if _, err := path.Match(rule.Path, ""); err != nil {
+		return ProxyRule{}, fmt.Errorf("invalid proxy rule %q: %s", value, err)
+	}
+	if fields[0] != "*" {
+		for _, m := range strings.Split(fields[0], ",") {
+			if m != "" {
+				rule.Methods = append(rule.Methods, strings.ToUpper(m))
+			}
+		}
+	}
+	return rule, nil
+}
+
+func (r ProxyRule) String() string {
+	methods := "*"
+	if len(r.Methods) > 0 {
+		methods = strings.Join(r.Methods, ",")
+	}
+	value := methods + " " + r.Path
+	if r.Admin {
+		value += " " + proxyRuleAdmin
+	}
+	return value
+}
+
+func (r *ProxyRule) matches(method, proxyPath, instanceName string) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, method) {
+		return false
+	}
+	pattern := strings.Replace(r.Path, "{instance}", instanceName, -1)
+	matched, _ := path.Match(pattern, proxyPath)
+	return matched
+}
+
+// CleanProxyPath returns the canonical form of a path sent to the service API
+// through the proxy, so rules can't be bypassed with dot segments.
+func CleanProxyPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// ParseProxyCallback parses the URL proxied to an instance, returning it with
+// the canonical path that must be matched against the proxy rules and
+// forwarded to the service API. Encoded slashes and dots are rejected, as the
+// service API could decode them into a path other than the one checked.
+func ParseProxyCallback(callback string) (*url.URL, error) {
+	u, err := url.Parse(callback)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return nil, ErrInvalidProxyCallback
+	}
+	escapedPath := strings.ToLower(u.EscapedPath())
+	if strings.Contains(escapedPath, "%2f") || strings.Contains(escapedPath, "%2e") {
+		return nil, ErrInvalidProxyCallback
+	}
+	return &url.URL{Path: CleanProxyPath(u.Path), RawQuery: u.RawQuery}, nil
+}
+
+// ProxyRuleFor returns the first rule matching the method and the path
+// proxied to the instance. A nil rule with no error means the service
+// declares no rules, exposing every path to the instance owners.
+func (s *Service) ProxyRuleFor(si *ServiceInstance, method, proxyPath string) (*ProxyRule, error) {
+	if len(s.ProxyRules) == 0 {
+		return nil, nil
+	}
+	for i := range s.ProxyRules {
+		if s.ProxyRules[i].matches(method, proxyPath, si.GetIdentifier()) {
+			return &s.ProxyRules[i], nil
+		}
+	}
+	return nil, ErrProxyPathNotAllowed
+}
+
+// SetProxyRules replaces the proxy rules of the service, an empty list
+// exposes every path to the instance owners.
+func (s *Service) SetProxyRules(rules []ProxyRule) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"proxy_rules": rules}}
+	if len(rules) == 0 {
+		update = bson.M{"$unset": bson.M{"proxy_rules": ""}}
+	}
+	err = conn.Services().UpdateId(s.Name, update)
+	if err != nil {
+		return err
+	}
+	s.ProxyRules = rules
+	return nil
+}
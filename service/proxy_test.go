@@ -0,0 +1,84 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import "gopkg.in/check.v1"
+
+func (s *S) TestParseProxyRule(c *check.C) {
+	tests := []struct {
+		value    string
+		expected ProxyRule
+	}{
+		{"GET /resources/{instance}/stats", ProxyRule{Methods: []string{"GET"}, Path: "/resources/{instance}/stats"}},
+		{"get,post resources/*/cache/ admin", ProxyRule{Methods: []string{"GET", "POST"}, Path: "/resources/*/cache", Admin: true}},
+		{"* /status", ProxyRule{Path: "/status"}},
+	}
+	for _, tt := range tests {
+		rule, err := ParseProxyRule(tt.value)
+		c.Assert(err, check.IsNil)
+		c.Assert(rule, check.DeepEquals, tt.expected)
+	}
+	for _, value := range []string{"/status", "GET /status root", "GET /status admin extra", "GET /[status"} {
+		_, err := ParseProxyRule(value)
+		c.Assert(err, check.NotNil, check.Commentf("rule %q", value))
+	}
+}
+
+func (s *S) TestProxyRuleString(c *check.C) {
+	rule := ProxyRule{Methods: []string{"GET", "POST"}, Path: "/resources/{instance}", Admin: true}
+	c.Assert(rule.String(), check.Equals, "GET,POST /resources/{instance} admin")
+	rule = ProxyRule{Path: "/status"}
+	c.Assert(rule.String(), check.Equals, "* /status")
+}
+
+func (s *S) TestProxyRuleFor(c *check.C) {
+	si := &ServiceInstance{Name: "my-db", ServiceName: "db"}
+	srv := Service{Name: "db"}
+	rule, err := srv.ProxyRuleFor(si, "DELETE", "/anything")
+	c.Assert(err, check.IsNil)
+	c.Assert(rule, check.IsNil)
+	srv.ProxyRules = []ProxyRule{
+		{Methods: []string{"GET"}, Path: "/resources/{instance}/stats"},
+		{Path: "/resources/{instance}/*", Admin: true},
+	}
+	rule, err = srv.ProxyRuleFor(si, "GET", "/resources/my-db/stats")
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.Admin, check.Equals, false)
+	rule, err = srv.ProxyRuleFor(si, "POST", "/resources/my-db/stats")
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.Admin, check.Equals, true)
+	_, err = srv.ProxyRuleFor(si, "GET", "/resources/other-db/stats")
+	c.Assert(err, check.Equals, ErrProxyPathNotAllowed)
+	_, err = srv.ProxyRuleFor(si, "GET", CleanProxyPath("/resources/my-db/../other-db/stats"))
+	c.Assert(err, check.Equals, ErrProxyPathNotAllowed)
+}
+
+func (s *S) TestParseProxyCallback(c *check.C) {
+	tests := []struct {
+		callback string
+		expected string
+	}{
+		{"/resources/my-db/stats", "/resources/my-db/stats"},
+		{"resources/my-db/stats/?verbose=1", "/resources/my-db/stats?verbose=1"},
+		{"/resources/my-db/../other-db/stats", "/resources/other-db/stats"},
+		{"/resources/my%20db/stats", "/resources/my%20db/stats"},
+		{"", "/"},
+	}
+	for _, tt := range tests {
+		u, err := ParseProxyCallback(tt.callback)
+		c.Assert(err, check.IsNil)
+		c.Assert(u.RequestURI(), check.Equals, tt.expected)
+	}
+	for _, callback := range []string{
+		"/resources/my-db%2F..%2Fother-db/stats",
+		"/resources/my-db/%2e%2e/other-db/stats",
+		"http://other.com/resources/my-db",
+		"//other.com/resources/my-db",
+		"/resources/%zz",
+	} {
+		_, err := ParseProxyCallback(callback)
+		c.Assert(err, check.Equals, ErrInvalidProxyCallback, check.Commentf("callback %q", callback))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
@@ -23,12 +25,85 @@ type Service struct {
 	Teams        []string
 	Doc          string
 	IsRestricted bool `bson:"is_restricted"`
+	// Protocol is the API implemented by the service endpoint, either
+	// ProtocolTsuru (the default) or ProtocolOSB.
+	Protocol string
+	// BrokerServiceID is the id of the service in the broker catalog, only
+	// used by services with the ProtocolOSB protocol.
+	BrokerServiceID string `bson:"broker_service_id"`
+	// Pools restricts the pools of the apps allowed to bind instances of the
+	// service, an empty list allows apps from any pool.
+	Pools []string `bson:",omitempty"`
+	// ProxyRules restricts the paths and methods available through the
+	// service instance proxy, an empty list exposes every path.
+	ProxyRules []ProxyRule `bson:"proxy_rules,omitempty"`
+	// Tags and Categories classify the service in the catalog, allowing
+	// users to search and filter services.
+	Tags       []string `bson:",omitempty"`
+	Categories []string `bson:",omitempty"`
+	// Plans is the cache of the plans returned by the service API, refreshed
+	// after PlansUpdatedAt is older than the plans cache TTL.
+	Plans          []Plan    `bson:",omitempty"`
+	PlansUpdatedAt time.Time `bson:"plans_updated_at,omitempty"`
+	// HealthStatus is the status of the service API in its last check by the
+	// health monitor, HealthError explains why it's down.
+	HealthStatus    string    `bson:"health_status,omitempty"`
+	HealthError     string    `bson:"health_error,omitempty"`
+	HealthCheckedAt time.Time `bson:"health_checked_at,omitempty"`
 }
 
 var (
 	ErrServiceAlreadyExists = errors.New("Service already exists.")
 )
 
+// AllowsPool reports whether apps in the given pool can bind instances of
+// the service.
+func (s *Service) AllowsPool(pool string) bool {
+	if len(s.Pools) == 0 {
+		return true
+	}
+	for _, p := range s.Pools {
+		if p == pool {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether the service has the given tag, ignoring case.
+func (s *Service) HasTag(tag string) bool {
+	return containsFold(s.Tags, tag)
+}
+
+// HasCategory reports whether the service is in the given category, ignoring
+// case.
+func (s *Service) HasCategory(category string) bool {
+	return containsFold(s.Categories, category)
+}
+
+// Matches reports whether the search term is part of the name, the
+// documentation, a tag or a category of the service, ignoring case.
+func (s *Service) Matches(search string) bool {
+	search = strings.ToLower(search)
+	fields := append([]string{s.Name, s.Doc}, s.Tags...)
+	fields = append(fields, s.Categories...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), search) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Service) Get() error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -171,15 +246,18 @@ func GetServicesByOwnerTeamsAndServices(teams []string, services []string) ([]Se
 }
 
 type ServiceModel struct {
-	Service   string   `json:"service"`
-	Instances []string `json:"instances"`
-	Plans     []string `json:"plans"`
+	Service    string   `json:"service"`
+	Instances  []string `json:"instances"`
+	Plans      []string `json:"plans"`
+	Health     string   `json:"health,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Categories []string `json:"categories,omitempty"`
 }
 
 // Proxy is a proxy between tsuru and the service.
 // This method allow customized service methods.
 func Proxy(service *Service, path string, w http.ResponseWriter, r *http.Request) error {
-	endpoint, err := service.getClient("production")
+	endpoint, err := service.endpointClient("production")
 	if err != nil {
 		return err
 	}
@@ -7,15 +7,18 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/tsuru/tsuru/action"
 	"github.com/tsuru/tsuru/app/bind"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -31,9 +34,23 @@ var (
 	ErrUnitAlreadyBound          = errors.New("unit is already bound to this service instance")
 	ErrUnitNotBound              = errors.New("unit is not bound to this service instance")
 	ErrServiceInstanceBound      = errors.New("This service instance is bound to at least one app. Unbind them before removing it")
+	ErrInvalidPlan               = errors.New("plan not found for this service")
+	ErrInstanceProvisionFailed   = errors.New("the service failed to provision this instance, remove it and try again")
 	instanceNameRegexp           = regexp.MustCompile(`^[A-Za-z][-a-zA-Z0-9_]+$`)
 )
 
+const (
+	// InstanceStateReady is the state of instances ready to be bound. Instances
+	// with an empty state are also ready.
+	InstanceStateReady = "ready"
+	// InstanceStatePending is the state of instances still being provisioned
+	// by the service.
+	InstanceStatePending = "pending"
+	// InstanceStateFailed is the state of instances the service failed to
+	// provision.
+	InstanceStateFailed = "failed"
+)
+
 type ServiceInstance struct {
 	Name        string
 	Id          int
@@ -44,6 +61,20 @@ type ServiceInstance struct {
 	Teams       []string
 	TeamOwner   string
 	Description string
+	Parameters  map[string]string `bson:",omitempty"`
+	State       string            `bson:",omitempty"`
+	StateError  string            `bson:"state_error,omitempty"`
+	// BackupInterval is the interval between scheduled backups of the
+	// instance, zero means backups are not scheduled.
+	BackupInterval time.Duration `bson:"backup_interval,omitempty"`
+	NextBackup     time.Time     `bson:"next_backup,omitempty"`
+	// PendingBackup is the id of a scheduled backup tsuru stopped waiting
+	// for, it's resumed in the next check instead of starting a new one.
+	PendingBackup string `bson:"pending_backup,omitempty"`
+	// HealthStatus is the status of the instance reported by the service in
+	// the last check of the health monitor.
+	HealthStatus    string    `bson:"health_status,omitempty"`
+	HealthCheckedAt time.Time `bson:"health_checked_at,omitempty"`
 }
 
 // DeleteInstance deletes the service instance from the database.
@@ -51,7 +82,7 @@ func DeleteInstance(si *ServiceInstance, requestID string) error {
 	if len(si.Apps) > 0 {
 		return ErrServiceInstanceBound
 	}
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.Service().endpointClient("production")
 	if err == nil {
 		endpoint.Destroy(si, requestID)
 	}
@@ -85,12 +116,42 @@ func (si *ServiceInstance) MarshalJSON() ([]byte, error) {
 		"ServiceName": si.ServiceName,
 		"Info":        info,
 		"TeamOwner":   si.TeamOwner,
+		"State":       si.state(),
+		"StateError":  si.StateError,
+	}
+	if si.HealthStatus != "" {
+		data["HealthStatus"] = si.HealthStatus
+		data["HealthCheckedAt"] = si.HealthCheckedAt
 	}
 	return json.Marshal(&data)
 }
 
+func (si *ServiceInstance) state() string {
+	if si.State == "" {
+		return InstanceStateReady
+	}
+	return si.State
+}
+
+// IsReady returns whether the instance was provisioned by the service and may
+// be bound to apps.
+func (si *ServiceInstance) IsReady() bool {
+	return si.state() == InstanceStateReady
+}
+
+// checkReady returns an error describing why the instance is not ready.
+func (si *ServiceInstance) checkReady() error {
+	switch si.state() {
+	case InstanceStatePending:
+		return ErrInstanceNotReady
+	case InstanceStateFailed:
+		return ErrInstanceProvisionFailed
+	}
+	return nil
+}
+
 func (si *ServiceInstance) Info(requestID string) (map[string]string, error) {
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.Service().endpointClient("production")
 	if err != nil {
 		return nil, errors.New("endpoint does not exists")
 	}
@@ -147,12 +208,17 @@ func (si *ServiceInstance) update(update bson.M) error {
 }
 
 // BindApp makes the bind between the service instance and an app.
-func (si *ServiceInstance) BindApp(app bind.App, shouldRestart bool, writer io.Writer) error {
+func (si *ServiceInstance) BindApp(app bind.App, shouldRestart bool, writer io.Writer, requestID string) error {
+	err := si.checkReady()
+	if err != nil {
+		return err
+	}
 	args := bindPipelineArgs{
 		serviceInstance: si,
 		app:             app,
 		writer:          writer,
 		shouldRestart:   shouldRestart,
+		requestID:       requestID,
 	}
 	actions := []*action.Action{
 		bindAppDBAction,
@@ -161,12 +227,79 @@ func (si *ServiceInstance) BindApp(app bind.App, shouldRestart bool, writer io.W
 		bindUnitsAction,
 	}
 	pipeline := action.NewPipeline(actions...)
-	return pipeline.Execute(&args)
+	return pipeline.ExecuteWithSpan(tracing.RequestSpan(requestID), &args)
+}
+
+// Update moves the instance to another plan and changes its parameters, an
+// empty plan keeps the current plan. Parameters are merged into the current
+// ones, parameters with empty values are removed. The changes are validated
+// against the plan schema, if the service publishes one, and are only stored
+// after being accepted by the service.
+func (si *ServiceInstance) Update(planName string, params map[string]string, requestID string) error {
+	err := si.checkReady()
+	if err != nil {
+		return err
+	}
+	updated := *si
+	if planName != "" {
+		updated.PlanName = planName
+	}
+	updated.Parameters = map[string]string{}
+	for k, v := range si.Parameters {
+		updated.Parameters[k] = v
+	}
+	for k, v := range params {
+		if v == "" {
+			delete(updated.Parameters, k)
+			continue
+		}
+		updated.Parameters[k] = v
+	}
+	plans, err := GetPlansByServiceName(si.ServiceName, requestID)
+	if err != nil {
+		return err
+	}
+	var plan *Plan
+	for i := range plans {
+		if plans[i].Name == updated.PlanName {
+			plan = &plans[i]
+			break
+		}
+	}
+	if plan == nil && planName != "" && len(plans) > 0 {
+		return ErrInvalidPlan
+	}
+	if plan != nil {
+		err = plan.Schema.Validate(updated.Parameters)
+		if err != nil {
+			return err
+		}
+	}
+	if len(updated.Parameters) == 0 {
+		updated.Parameters = nil
+	}
+	args := updatePipelineArgs{
+		serviceInstance: si,
+		updated:         &updated,
+		requestID:       requestID,
+	}
+	pipeline := action.NewPipeline(updateServiceInstanceEndpoint, updateServiceInstanceDB)
+	err = pipeline.ExecuteWithSpan(tracing.RequestSpan(requestID), &args)
+	if err != nil {
+		return err
+	}
+	si.PlanName = updated.PlanName
+	si.Parameters = updated.Parameters
+	return nil
 }
 
 // BindUnit makes the bind between the binder and an unit.
 func (si *ServiceInstance) BindUnit(app bind.App, unit bind.Unit) error {
-	endpoint, err := si.Service().getClient("production")
+	err := si.checkReady()
+	if err != nil {
+		return err
+	}
+	endpoint, err := si.Service().endpointClient("production")
 	if err != nil {
 		return err
 	}
@@ -195,7 +328,7 @@ func (si *ServiceInstance) BindUnit(app bind.App, unit bind.Unit) error {
 }
 
 // UnbindApp makes the unbind between the service instance and an app.
-func (si *ServiceInstance) UnbindApp(app bind.App, shouldRestart bool, writer io.Writer) error {
+func (si *ServiceInstance) UnbindApp(app bind.App, shouldRestart bool, writer io.Writer, requestID string) error {
 	if si.FindApp(app.GetName()) == -1 {
 		return ErrAppNotBound
 	}
@@ -204,6 +337,7 @@ func (si *ServiceInstance) UnbindApp(app bind.App, shouldRestart bool, writer io
 		app:             app,
 		writer:          writer,
 		shouldRestart:   shouldRestart,
+		requestID:       requestID,
 	}
 	actions := []*action.Action{
 		&unbindUnits,
@@ -212,12 +346,51 @@ func (si *ServiceInstance) UnbindApp(app bind.App, shouldRestart bool, writer io
 		&removeBoundEnvs,
 	}
 	pipeline := action.NewPipeline(actions...)
-	return pipeline.Execute(&args)
+	return pipeline.ExecuteWithSpan(tracing.RequestSpan(requestID), &args)
+}
+
+// RotateAppCredentials replaces the credentials used by the app bound to the
+// instance. New credentials are issued by the service and set in the app with
+// a single restart, the previous credentials are revoked once the app is
+// running with the new ones.
+func (si *ServiceInstance) RotateAppCredentials(app bind.App, shouldRestart bool, writer io.Writer, requestID string) error {
+	if si.FindApp(app.GetName()) == -1 {
+		return ErrAppNotBound
+	}
+	err := si.checkReady()
+	if err != nil {
+		return err
+	}
+	args := bindPipelineArgs{
+		serviceInstance: si,
+		app:             app,
+		writer:          writer,
+		shouldRestart:   shouldRestart,
+		requestID:       requestID,
+	}
+	actions := []*action.Action{
+		rotateAppEndpointAction,
+		setRotatedEnvsAction,
+	}
+	pipeline := action.NewPipeline(actions...)
+	err = pipeline.ExecuteWithSpan(tracing.RequestSpan(requestID), &args)
+	if err != nil {
+		return err
+	}
+	endpoint, err := si.Service().endpointClient("production")
+	if err != nil {
+		return err
+	}
+	err = endpoint.RevokeApp(si, app, requestID)
+	if err != nil {
+		return fmt.Errorf("the app is using the new credentials, but revoking the previous ones failed: %s", err)
+	}
+	return nil
 }
 
 // UnbindUnit makes the unbind between the service instance and an unit.
 func (si *ServiceInstance) UnbindUnit(app bind.App, unit bind.Unit) error {
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.Service().endpointClient("production")
 	if err != nil {
 		return err
 	}
@@ -247,7 +420,7 @@ func (si *ServiceInstance) UnbindUnit(app bind.App, unit bind.Unit) error {
 
 // Status returns the service instance status.
 func (si *ServiceInstance) Status(requestID string) (string, error) {
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.Service().endpointClient("production")
 	if err != nil {
 		return "", err
 	}
@@ -317,7 +490,7 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 	instance.Teams = []string{instance.TeamOwner}
 	actions := []*action.Action{&createServiceInstance, &insertServiceInstance}
 	pipeline := action.NewPipeline(actions...)
-	return pipeline.Execute(*service, instance, user.Email, requestID)
+	return pipeline.ExecuteWithSpan(tracing.RequestSpan(requestID), *service, instance, user.Email, requestID)
 }
 
 func UpdateService(si *ServiceInstance) error {
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"runtime"
 	"sort"
 	"strconv"
@@ -129,7 +130,7 @@ func (s *InstanceSuite) TestBindApp(c *check.C) {
 	var si ServiceInstance
 	a := provisiontest.NewFakeApp("myapp", "python", 1)
 	var buf bytes.Buffer
-	err := si.BindApp(a, true, &buf)
+	err := si.BindApp(a, true, &buf, "")
 	c.Assert(err, check.IsNil)
 	expectedCalls := []string{
 		"bindAppDBAction", "bindAppEndpointAction",
@@ -265,6 +266,8 @@ func (s *InstanceSuite) TestMarshalJSON(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        map[string]interface{}{"key": "value"},
 		"TeamOwner":   "",
+		"State":       "ready",
+		"StateError":  "",
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
@@ -289,6 +292,8 @@ func (s *InstanceSuite) TestMarshalJSONWithoutInfo(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        nil,
 		"TeamOwner":   "",
+		"State":       "ready",
+		"StateError":  "",
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
@@ -313,6 +318,8 @@ func (s *InstanceSuite) TestMarshalJSONWithoutEndpoint(c *check.C) {
 		"ServiceName": "mysql",
 		"Info":        nil,
 		"TeamOwner":   "",
+		"State":       "ready",
+		"StateError":  "",
 	}
 	c.Assert(result, check.DeepEquals, expected)
 }
@@ -676,7 +683,7 @@ func (s *InstanceSuite) TestUnbindApp(c *check.C) {
 		c.Assert(err, check.IsNil)
 	}
 	var buf bytes.Buffer
-	err = si.UnbindApp(a, false, &buf)
+	err = si.UnbindApp(a, false, &buf, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Matches, "remove instance")
 	c.Assert(reqs, check.HasLen, 5)
@@ -696,6 +703,95 @@ func (s *InstanceSuite) TestUnbindApp(c *check.C) {
 	c.Assert(a.GetInstances("mysql"), check.DeepEquals, []bind.ServiceInstance{})
 }
 
+func (s *InstanceSuite) TestRotateAppCredentials(c *check.C) {
+	var reqs []*http.Request
+	var mut sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		reqs = append(reqs, r)
+		if r.Method == "POST" {
+			w.Write([]byte(`{"ENV1":"NEWVAL1"}`))
+		}
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	si := ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		Apps:        []string{a.GetName()},
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = si.RotateAppCredentials(a, true, &buf, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "add instance")
+	c.Assert(reqs, check.HasLen, 2)
+	c.Assert(reqs[0].Method, check.Equals, "POST")
+	c.Assert(reqs[0].URL.Path, check.Equals, "/resources/my-mysql/bind-app/credentials")
+	c.Assert(reqs[1].Method, check.Equals, "DELETE")
+	c.Assert(reqs[1].URL.Path, check.Equals, "/resources/my-mysql/bind-app/credentials")
+	c.Assert(a.GetInstances("mysql"), check.DeepEquals, []bind.ServiceInstance{
+		{Name: "my-mysql", Envs: map[string]string{"ENV1": "NEWVAL1"}},
+	})
+}
+
+func (s *InstanceSuite) TestRotateAppCredentialsNotSupported(c *check.C) {
+	var reqs []*http.Request
+	var mut sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		reqs = append(reqs, r)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Apps: []string{a.GetName()}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.RotateAppCredentials(a, true, nil, "")
+	c.Assert(err, check.Equals, ErrRotationNotSupported)
+	c.Assert(reqs, check.HasLen, 1)
+	c.Assert(a.GetInstances("mysql"), check.HasLen, 0)
+}
+
+func (s *InstanceSuite) TestRotateAppCredentialsRevokeFailure(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Write([]byte(`{"ENV1":"NEWVAL1"}`))
+			return
+		}
+		http.Error(w, "revoke failed", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	serv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := serv.Create()
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Apps: []string{a.GetName()}}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.RotateAppCredentials(a, true, nil, "")
+	c.Assert(err, check.ErrorMatches, `the app is using the new credentials, but revoking the previous ones failed: .*revoke failed\n`)
+	c.Assert(a.GetInstances("mysql"), check.HasLen, 1)
+}
+
+func (s *InstanceSuite) TestRotateAppCredentialsAppNotBound(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "static", 1)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	err := si.RotateAppCredentials(a, true, nil, "")
+	c.Assert(err, check.Equals, ErrAppNotBound)
+}
+
 func (s *InstanceSuite) TestUnbindAppFailureInUnbindAppCall(c *check.C) {
 	var reqs []*http.Request
 	var mut sync.Mutex
@@ -740,7 +836,7 @@ func (s *InstanceSuite) TestUnbindAppFailureInUnbindAppCall(c *check.C) {
 		c.Assert(err, check.IsNil)
 	}
 	var buf bytes.Buffer
-	err = si.UnbindApp(a, true, &buf)
+	err = si.UnbindApp(a, true, &buf, "")
 	c.Assert(err, check.ErrorMatches, `Failed to unbind \("/resources/my-mysql/bind-app"\): my unbind app err`)
 	c.Assert(buf.String(), check.Matches, "")
 	c.Assert(si.Apps, check.DeepEquals, []string{"myapp"})
@@ -796,7 +892,7 @@ func (s *InstanceSuite) TestUnbindAppFailureInAppEnvSet(c *check.C) {
 		c.Assert(err, check.IsNil)
 	}
 	var buf bytes.Buffer
-	err = si.UnbindApp(a, true, &buf)
+	err = si.UnbindApp(a, true, &buf, "")
 	c.Assert(err, check.ErrorMatches, `instance not found`)
 	c.Assert(buf.String(), check.Matches, "")
 	c.Assert(si.Apps, check.DeepEquals, []string{"myapp"})
@@ -847,7 +943,7 @@ func (s *InstanceSuite) TestBindAppFullPipeline(c *check.C) {
 	c.Assert(err, check.IsNil)
 	a := provisiontest.NewFakeApp("myapp", "static", 2)
 	var buf bytes.Buffer
-	err = si.BindApp(a, true, &buf)
+	err = si.BindApp(a, true, &buf, "")
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Matches, "add instance")
 	c.Assert(reqs, check.HasLen, 3)
@@ -903,7 +999,7 @@ func (s *InstanceSuite) TestBindAppMultipleApps(c *check.C) {
 		go func(app bind.App) {
 			defer wg.Done()
 			var buf bytes.Buffer
-			bindErr := si.BindApp(app, true, &buf)
+			bindErr := si.BindApp(app, true, &buf, "")
 			c.Assert(bindErr, check.IsNil)
 		}(app)
 	}
@@ -945,7 +1041,7 @@ func (s *InstanceSuite) TestUnbindAppMultipleApps(c *check.C) {
 		app := provisiontest.NewFakeApp(name, "static", 2)
 		apps = append(apps, app)
 		var buf bytes.Buffer
-		err = si.BindApp(app, true, &buf)
+		err = si.BindApp(app, true, &buf, "")
 		c.Assert(err, check.IsNil)
 	}
 	siDB, err := GetServiceInstance(si.ServiceName, si.Name)
@@ -956,7 +1052,7 @@ func (s *InstanceSuite) TestUnbindAppMultipleApps(c *check.C) {
 		go func(app bind.App) {
 			defer wg.Done()
 			var buf bytes.Buffer
-			unbindErr := siDB.UnbindApp(app, false, &buf)
+			unbindErr := siDB.UnbindApp(app, false, &buf, "")
 			c.Assert(unbindErr, check.IsNil)
 		}(app)
 	}
@@ -967,3 +1063,86 @@ func (s *InstanceSuite) TestUnbindAppMultipleApps(c *check.C) {
 	sort.Strings(siDB.Apps)
 	c.Assert(siDB.Apps, check.DeepEquals, []string{})
 }
+
+func (s *InstanceSuite) TestServiceInstanceUpdate(c *check.C) {
+	var updates []url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "small"}, {"name": "big", "schema": {"properties": {"size": {"type": "integer"}}}}]`))
+			return
+		}
+		r.ParseForm()
+		updates = append(updates, r.Form)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{
+		Name:        "db",
+		ServiceName: "mysql",
+		PlanName:    "small",
+		Parameters:  map[string]string{"engine": "innodb", "ssl": "true"},
+	}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.Update("big", map[string]string{"size": "10", "ssl": ""}, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(si.PlanName, check.Equals, "big")
+	c.Assert(si.Parameters, check.DeepEquals, map[string]string{"engine": "innodb", "size": "10"})
+	c.Assert(updates, check.HasLen, 1)
+	c.Assert(updates[0].Get("plan"), check.Equals, "big")
+	c.Assert(updates[0].Get("parameters.size"), check.Equals, "10")
+	c.Assert(updates[0].Get("parameters.engine"), check.Equals, "innodb")
+	dbInstance, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.PlanName, check.Equals, "big")
+	c.Assert(dbInstance.Parameters, check.DeepEquals, map[string]string{"engine": "innodb", "size": "10"})
+}
+
+func (s *InstanceSuite) TestServiceInstanceUpdateInvalidParameters(c *check.C) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "big", "schema": {"properties": {"size": {"type": "integer"}}}}]`))
+			return
+		}
+		requests++
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big"}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.Update("", map[string]string{"size": "huge"}, "")
+	c.Assert(err, check.ErrorMatches, `invalid value for parameter "size": must be of type integer`)
+	err = si.Update("unknown", nil, "")
+	c.Assert(err, check.Equals, ErrInvalidPlan)
+	c.Assert(requests, check.Equals, 0)
+}
+
+func (s *InstanceSuite) TestServiceInstanceUpdateRejectedByService(c *check.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/plans" {
+			w.Write([]byte(`[{"name": "small"}, {"name": "big"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("cannot downgrade"))
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, check.IsNil)
+	si := ServiceInstance{Name: "db", ServiceName: "mysql", PlanName: "big"}
+	err = si.Create()
+	c.Assert(err, check.IsNil)
+	err = si.Update("small", nil, "")
+	c.Assert(err, check.ErrorMatches, "Failed to update the instance db: cannot downgrade")
+	c.Assert(si.PlanName, check.Equals, "big")
+	dbInstance, err := GetServiceInstance("mysql", "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbInstance.PlanName, check.Equals, "big")
+}
@@ -148,6 +148,32 @@ func (s *S) TestGrantAccessShouldReturnErrorIfTheTeamAlreadyHasAcessToTheService
 	c.Assert(err, check.ErrorMatches, "^This team already has access to this service$")
 }
 
+func (s *S) TestAllowsPool(c *check.C) {
+	srv := Service{Name: "mysql"}
+	c.Assert(srv.AllowsPool("pool1"), check.Equals, true)
+	srv.Pools = []string{"pool1", "pool2"}
+	c.Assert(srv.AllowsPool("pool1"), check.Equals, true)
+	c.Assert(srv.AllowsPool("pool2"), check.Equals, true)
+	c.Assert(srv.AllowsPool("pool3"), check.Equals, false)
+}
+
+func (s *S) TestServiceTagsAndCategories(c *check.C) {
+	srv := Service{Name: "mysql", Tags: []string{"SQL", "database"}, Categories: []string{"Databases"}}
+	c.Assert(srv.HasTag("sql"), check.Equals, true)
+	c.Assert(srv.HasTag("nosql"), check.Equals, false)
+	c.Assert(srv.HasCategory("databases"), check.Equals, true)
+	c.Assert(srv.HasCategory("queues"), check.Equals, false)
+}
+
+func (s *S) TestServiceMatches(c *check.C) {
+	srv := Service{Name: "mysql", Doc: "Relational databases", Tags: []string{"sql"}, Categories: []string{"storage"}}
+	c.Assert(srv.Matches("MYSQL"), check.Equals, true)
+	c.Assert(srv.Matches("relational"), check.Equals, true)
+	c.Assert(srv.Matches("sq"), check.Equals, true)
+	c.Assert(srv.Matches("stor"), check.Equals, true)
+	c.Assert(srv.Matches("queue"), check.Equals, false)
+}
+
 func (s *S) TestRevokeAccessShouldRemoveTeamFromService(c *check.C) {
 	s.createService()
 	err := s.service.GrantAccess(s.team)
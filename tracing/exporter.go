@@ -0,0 +1,83 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterExporter("stdout", func() (Exporter, error) {
+		return NewWriterExporter(os.Stdout), nil
+	})
+}
+
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter writing each span as a line of JSON
+// to w. It's registered as the "stdout" exporter, writing to the standard
+// output, and is mostly useful for debugging and tests.
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+type jsonSpan struct {
+	TraceID   string                 `json:"traceId"`
+	SpanID    string                 `json:"spanId"`
+	ParentID  string                 `json:"parentId,omitempty"`
+	Operation string                 `json:"operation"`
+	Start     time.Time              `json:"start"`
+	Duration  float64                `json:"duration"`
+	Tags      map[string]interface{} `json:"tags,omitempty"`
+}
+
+func (e *writerExporter) ExportSpan(s *SpanData) {
+	span := jsonSpan{
+		TraceID:   strconv.FormatUint(s.Context.TraceID, 16),
+		SpanID:    strconv.FormatUint(s.Context.SpanID, 16),
+		Operation: s.Operation,
+		Start:     s.Start.UTC(),
+		Duration:  s.Duration.Seconds(),
+		Tags:      s.Tags,
+	}
+	if s.ParentID != 0 {
+		span.ParentID = strconv.FormatUint(s.ParentID, 16)
+	}
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(data, '\n'))
+}
+
+// RecordingExporter keeps finished spans in memory. It's mostly useful in
+// tests checking the spans recorded by instrumented code.
+type RecordingExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (e *RecordingExporter) ExportSpan(s *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the spans exported so far, in the order they were finished.
+func (e *RecordingExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
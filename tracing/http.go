@@ -0,0 +1,69 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// The headers used to propagate span contexts, the same used by the
+// OpenTracing basic tracer, so tsuru takes part in traces started by other
+// OpenTracing instrumented services and vice versa.
+const (
+	TraceIDHeader = "Ot-Tracer-Traceid"
+	SpanIDHeader  = "Ot-Tracer-Spanid"
+	SampledHeader = "Ot-Tracer-Sampled"
+)
+
+// Inject adds the span context to the headers of an outgoing request.
+func Inject(ctx SpanContext, h http.Header) {
+	if !ctx.IsValid() {
+		return
+	}
+	h.Set(TraceIDHeader, strconv.FormatUint(ctx.TraceID, 16))
+	h.Set(SpanIDHeader, strconv.FormatUint(ctx.SpanID, 16))
+	h.Set(SampledHeader, "true")
+}
+
+// Extract returns the span context propagated in the headers of an incoming
+// request, or an invalid context when there's none.
+func Extract(h http.Header) SpanContext {
+	traceID, err := strconv.ParseUint(h.Get(TraceIDHeader), 16, 64)
+	if err != nil {
+		return SpanContext{}
+	}
+	spanID, err := strconv.ParseUint(h.Get(SpanIDHeader), 16, 64)
+	if err != nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: traceID, SpanID: spanID}
+}
+
+// StartClientSpan starts a span covering an outgoing request, child of
+// parent, and propagates its context in the request headers.
+func StartClientSpan(req *http.Request, parent SpanContext) *Span {
+	span := StartSpan(req.Method+" "+req.URL.Host, parent)
+	if span == nil {
+		return nil
+	}
+	span.SetTag("span.kind", "client")
+	span.SetTag("http.method", req.Method)
+	span.SetTag("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	Inject(span.Context(), req.Header)
+	return span
+}
+
+// FinishClientSpan finishes a span started by StartClientSpan with the
+// result of the request.
+func FinishClientSpan(span *Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetTag("http.status_code", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetTag("error", true)
+		}
+	}
+	span.FinishWithError(err)
+}
@@ -0,0 +1,278 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tracing records spans describing the operations done by tsuru,
+// following the OpenTracing data model, and sends the finished spans to an
+// exporter.
+//
+// tsuru doesn't pass a context through its calls, so spans are linked
+// explicitly: a span is started as a child of another one, and the span of
+// an API request may be looked up by the request ID. When no exporter is
+// configured, StartSpan returns a nil *Span, which is safe to use, so
+// instrumented code doesn't need to check whether tracing is enabled:
+//
+//	span := parent.StartChild("router AddRoutes")
+//	err := r.AddRoutes(name, routes)
+//	span.FinishWithError(err)
+package tracing
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+)
+
+// SpanContext identifies a span and the trace it belongs to. It's the part
+// of a span propagated to other processes.
+type SpanContext struct {
+	TraceID uint64
+	SpanID  uint64
+}
+
+// IsValid reports whether the context identifies a span.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != 0 && c.SpanID != 0
+}
+
+// SpanData is a finished span, as received by exporters.
+type SpanData struct {
+	Context   SpanContext
+	ParentID  uint64
+	Operation string
+	Start     time.Time
+	Duration  time.Duration
+	Tags      map[string]interface{}
+}
+
+// Exporter sends finished spans to a tracing backend. ExportSpan is called
+// when spans are finished, so it must not block.
+type Exporter interface {
+	ExportSpan(*SpanData)
+}
+
+type exporterFactory func() (Exporter, error)
+
+var (
+	exporters  = map[string]exporterFactory{}
+	exporterMu sync.RWMutex
+	current    Exporter
+
+	idMu     sync.Mutex
+	idSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// RegisterExporter registers an exporter, which may be selected in the
+// tracing:exporter config entry.
+func RegisterExporter(name string, factory func() (Exporter, error)) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporters[name] = factory
+}
+
+// SetExporter sets the exporter receiving finished spans. A nil exporter
+// disables tracing.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	current = e
+}
+
+func getExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return current
+}
+
+// Initialize sets the exporter named in the tracing:exporter config entry.
+// Tracing stays disabled when the entry is not set.
+func Initialize() error {
+	name, _ := config.GetString("tracing:exporter")
+	if name == "" {
+		return nil
+	}
+	exporterMu.RLock()
+	factory, ok := exporters[name]
+	exporterMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown tracing exporter: %q", name)
+	}
+	e, err := factory()
+	if err != nil {
+		return err
+	}
+	SetExporter(e)
+	return nil
+}
+
+func newID() uint64 {
+	idMu.Lock()
+	defer idMu.Unlock()
+	for {
+		if id := uint64(idSource.Int63()); id != 0 {
+			return id
+		}
+	}
+}
+
+// Span is an operation being traced. All methods are safe to call on a nil
+// span, which is returned when tracing is disabled.
+type Span struct {
+	mu        sync.Mutex
+	exporter  Exporter
+	context   SpanContext
+	parentID  uint64
+	operation string
+	start     time.Time
+	tags      map[string]interface{}
+	finished  bool
+}
+
+// StartSpan starts a span, child of parent when it's valid, or the first
+// span of a new trace otherwise. It returns nil when tracing is disabled.
+func StartSpan(operation string, parent SpanContext) *Span {
+	e := getExporter()
+	if e == nil {
+		return nil
+	}
+	s := &Span{
+		exporter:  e,
+		operation: operation,
+		start:     time.Now(),
+		context:   SpanContext{SpanID: newID()},
+	}
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.parentID = parent.SpanID
+	} else {
+		s.context.TraceID = newID()
+	}
+	return s
+}
+
+// StartChild starts a span, child of s. When s is nil, the span starts a new
+// trace.
+func (s *Span) StartChild(operation string) *Span {
+	return StartSpan(operation, s.Context())
+}
+
+// Context returns the context of the span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetOperationName changes the name of the operation traced by the span.
+func (s *Span) SetOperationName(operation string) *Span {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operation = operation
+	return s
+}
+
+// SetTag sets a tag in the span, like "http.status_code".
+func (s *Span) SetTag(key string, value interface{}) *Span {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tags == nil {
+		s.tags = map[string]interface{}{}
+	}
+	s.tags[key] = value
+	return s
+}
+
+// SetError marks the span as failed with err, if err is not nil.
+func (s *Span) SetError(err error) *Span {
+	if s == nil || err == nil {
+		return s
+	}
+	s.SetTag("error", true)
+	return s.SetTag("error.message", err.Error())
+}
+
+// Finish finishes the span, sending it to the exporter. Calls after the
+// first one are ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	data := &SpanData{
+		Context:   s.context,
+		ParentID:  s.parentID,
+		Operation: s.operation,
+		Start:     s.start,
+		Duration:  time.Since(s.start),
+		Tags:      s.tags,
+	}
+	s.mu.Unlock()
+	s.exporter.ExportSpan(data)
+}
+
+// FinishWithError marks the span as failed with err, if err is not nil, and
+// finishes it.
+func (s *Span) FinishWithError(err error) {
+	s.SetError(err)
+	s.Finish()
+}
+
+// Traced is implemented by values carrying the span of the operation they
+// take part in, like apps handled by an API request.
+type Traced interface {
+	TraceSpan() *Span
+}
+
+// SpanOf returns the span carried by v, or nil when v doesn't implement
+// Traced.
+func SpanOf(v interface{}) *Span {
+	if t, ok := v.(Traced); ok {
+		return t.TraceSpan()
+	}
+	return nil
+}
+
+var requests = struct {
+	sync.RWMutex
+	spans map[string]SpanContext
+}{spans: map[string]SpanContext{}}
+
+// BindRequest associates the span of an API request with the request ID, so
+// code receiving only the request ID, like service clients, may start
+// children of it. The returned function removes the association.
+func BindRequest(requestID string, s *Span) func() {
+	if s == nil || requestID == "" {
+		return func() {}
+	}
+	requests.Lock()
+	requests.spans[requestID] = s.Context()
+	requests.Unlock()
+	return func() {
+		requests.Lock()
+		delete(requests.spans, requestID)
+		requests.Unlock()
+	}
+}
+
+// RequestSpan returns the context of the span bound to the request ID, or an
+// invalid context when there's none.
+func RequestSpan(requestID string) SpanContext {
+	requests.RLock()
+	defer requests.RUnlock()
+	return requests.spans[requestID]
+}
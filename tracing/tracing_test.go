@@ -0,0 +1,189 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	buf bytes.Buffer
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.buf.Reset()
+	SetExporter(NewWriterExporter(&s.buf))
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	SetExporter(nil)
+}
+
+func (s *S) exported(c *check.C) []jsonSpan {
+	var spans []jsonSpan
+	for _, line := range strings.Split(strings.TrimSpace(s.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var span jsonSpan
+		err := json.Unmarshal([]byte(line), &span)
+		c.Assert(err, check.IsNil)
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+func (s *S) TestStartSpanDisabled(c *check.C) {
+	SetExporter(nil)
+	span := StartSpan("op", SpanContext{})
+	c.Assert(span, check.IsNil)
+	child := span.StartChild("child").SetTag("key", "value").SetError(errors.New("fail"))
+	c.Assert(child, check.IsNil)
+	child.Finish()
+	span.FinishWithError(errors.New("fail"))
+	c.Assert(span.Context().IsValid(), check.Equals, false)
+	c.Assert(s.buf.String(), check.Equals, "")
+}
+
+func (s *S) TestStartChild(c *check.C) {
+	parent := StartSpan("parent", SpanContext{})
+	c.Assert(parent.Context().IsValid(), check.Equals, true)
+	child := parent.StartChild("child")
+	c.Assert(child.Context().TraceID, check.Equals, parent.Context().TraceID)
+	c.Assert(child.Context().SpanID, check.Not(check.Equals), parent.Context().SpanID)
+	child.SetTag("app", "myapp")
+	child.Finish()
+	parent.Finish()
+	spans := s.exported(c)
+	c.Assert(spans, check.HasLen, 2)
+	c.Assert(spans[0].Operation, check.Equals, "child")
+	c.Assert(spans[0].TraceID, check.Equals, strconv.FormatUint(parent.Context().TraceID, 16))
+	c.Assert(spans[0].ParentID, check.Equals, strconv.FormatUint(parent.Context().SpanID, 16))
+	c.Assert(spans[0].Tags, check.DeepEquals, map[string]interface{}{"app": "myapp"})
+	c.Assert(spans[1].Operation, check.Equals, "parent")
+	c.Assert(spans[1].ParentID, check.Equals, "")
+}
+
+func (s *S) TestFinishWithError(c *check.C) {
+	span := StartSpan("op", SpanContext{})
+	span.SetOperationName("renamed")
+	span.FinishWithError(errors.New("something failed"))
+	span.Finish()
+	spans := s.exported(c)
+	c.Assert(spans, check.HasLen, 1)
+	c.Assert(spans[0].Operation, check.Equals, "renamed")
+	c.Assert(spans[0].Tags, check.DeepEquals, map[string]interface{}{
+		"error":         true,
+		"error.message": "something failed",
+	})
+}
+
+func (s *S) TestInitialize(c *check.C) {
+	SetExporter(nil)
+	err := Initialize()
+	c.Assert(err, check.IsNil)
+	c.Assert(getExporter(), check.IsNil)
+	config.Set("tracing:exporter", "unknown")
+	defer config.Unset("tracing")
+	err = Initialize()
+	c.Assert(err, check.ErrorMatches, `unknown tracing exporter: "unknown"`)
+	config.Set("tracing:exporter", "stdout")
+	err = Initialize()
+	c.Assert(err, check.IsNil)
+	c.Assert(getExporter(), check.FitsTypeOf, &writerExporter{})
+}
+
+func (s *S) TestInjectExtract(c *check.C) {
+	h := http.Header{}
+	Inject(SpanContext{}, h)
+	c.Assert(h, check.HasLen, 0)
+	c.Assert(Extract(h).IsValid(), check.Equals, false)
+	ctx := SpanContext{TraceID: 0xabc, SpanID: 0x123}
+	Inject(ctx, h)
+	c.Assert(h.Get(TraceIDHeader), check.Equals, "abc")
+	c.Assert(h.Get(SpanIDHeader), check.Equals, "123")
+	c.Assert(Extract(h), check.Equals, ctx)
+}
+
+func (s *S) TestClientSpan(c *check.C) {
+	var received SpanContext
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = Extract(r.Header)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	parent := StartSpan("parent", SpanContext{})
+	req, err := http.NewRequest("POST", server.URL+"/resources?x=1", nil)
+	c.Assert(err, check.IsNil)
+	span := StartClientSpan(req, parent.Context())
+	resp, err := http.DefaultClient.Do(req)
+	FinishClientSpan(span, resp, err)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.Equals, span.Context())
+	c.Assert(received.TraceID, check.Equals, parent.Context().TraceID)
+	spans := s.exported(c)
+	c.Assert(spans, check.HasLen, 1)
+	c.Assert(spans[0].Operation, check.Equals, "POST "+req.URL.Host)
+	c.Assert(spans[0].Tags, check.DeepEquals, map[string]interface{}{
+		"span.kind":        "client",
+		"http.method":      "POST",
+		"http.url":         server.URL + "/resources",
+		"http.status_code": float64(http.StatusBadGateway),
+		"error":            true,
+	})
+}
+
+func (s *S) TestBindRequest(c *check.C) {
+	span := StartSpan("request", SpanContext{})
+	unbind := BindRequest("req-1", span)
+	c.Assert(RequestSpan("req-1"), check.Equals, span.Context())
+	c.Assert(RequestSpan("req-2").IsValid(), check.Equals, false)
+	unbind()
+	c.Assert(RequestSpan("req-1").IsValid(), check.Equals, false)
+	BindRequest("req-1", nil)()
+	BindRequest("", span)()
+}
+
+func (s *S) TestRecordingExporter(c *check.C) {
+	exporter := &RecordingExporter{}
+	SetExporter(exporter)
+	parent := StartSpan("parent", SpanContext{})
+	parent.StartChild("child").Finish()
+	parent.Finish()
+	spans := exporter.Spans()
+	c.Assert(spans, check.HasLen, 2)
+	c.Assert(spans[0].Operation, check.Equals, "child")
+	c.Assert(spans[0].ParentID, check.Equals, parent.Context().SpanID)
+	c.Assert(spans[1].Operation, check.Equals, "parent")
+}
+
+type tracedValue struct {
+	span *Span
+}
+
+func (v *tracedValue) TraceSpan() *Span {
+	return v.span
+}
+
+func (s *S) TestSpanOf(c *check.C) {
+	span := StartSpan("op", SpanContext{})
+	c.Assert(SpanOf(&tracedValue{span: span}), check.Equals, span)
+	c.Assert(SpanOf("not traced"), check.IsNil)
+	c.Assert(SpanOf(nil), check.IsNil)
+}